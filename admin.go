@@ -0,0 +1,228 @@
+package log4go
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// AdminHandler returns an http.Handler for controlling the logger while the
+// program runs, to be mounted on a debug mux:
+//
+//	mux.Handle("/debug/log4go/", http.StripPrefix("/debug/log4go", log.Global.AdminHandler()))
+//
+// It serves, relative to where it is mounted:
+//
+//	GET  /levels            the level of every category, as a JSON object
+//	PUT  /levels/{category} set the level of category to the request body,
+//	                        e.g. "DEBUG", or to the level query parameter
+//	POST /rotate            rotate the files of every category
+//	POST /rotate/{category} rotate the file of category
+//	GET  /stats             per category writer type, queue and statistics
+//
+// It has no access control of its own, so it should only be reachable by
+// operators.
+func (log Logger) AdminHandler() http.Handler {
+	return adminHandler{log}
+}
+
+type adminHandler struct {
+	log Logger
+}
+
+// AdminWriterStats is an entry of the /stats response of AdminHandler.
+type AdminWriterStats struct {
+	Level     string       `json:"level"`
+	MaxLevel  string       `json:"max_level,omitempty"` // Set with MaxLevel
+	Writer    string       `json:"writer"`              // The writer type, e.g. "*log4go.FileLogWriter"
+	Filename  string       `json:"filename,omitempty"`  // The file written, for file writers
+	Queued    int          `json:"queued"`              // Records waiting for the writer goroutine
+	Capacity  int          `json:"capacity"`            // Records that can be queued before logging blocks
+	HighWater int          `json:"high_water"`          // The most records queued at once so far
+	Dropped   uint64       `json:"dropped"`             // Records dropped by the overflow policy
+	Limited   uint64       `json:"rate_limited"`        // Messages dropped by the rate limit of the category
+	Shadow    *ShadowStats `json:"shadow,omitempty"`    // Counters of a ShadowLogWriter
+	Socket    *SocketStats `json:"socket,omitempty"`    // Connection state and counters of a SocketLogWriter
+
+	// The writers of a category fanning out to several, see AddWriter
+	Writers []AdminWriterStats `json:"writers,omitempty"`
+}
+
+func (h adminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(r.URL.Path, "/")
+	name, category := path, ""
+	if i := strings.IndexByte(path, '/'); i >= 0 {
+		name, category = path[:i], path[i+1:]
+	}
+
+	switch {
+	case name == "levels" && len(category) == 0 && r.Method == "GET":
+		levels := map[string]string{}
+		names, filters := h.log.snapshot()
+		for i, filt := range filters {
+			levels[names[i]] = configLevelName(filt.level())
+		}
+		writeAdminJSON(w, levels)
+	case name == "levels" && len(category) > 0 && (r.Method == "PUT" || r.Method == "POST"):
+		value := r.URL.Query().Get("level")
+		if len(value) == 0 {
+			body, _ := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, 64))
+			value = strings.Trim(string(body), " \r\n\"")
+		}
+		lvl, err := ParseLevel(value)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := h.log.SetLevel(category, lvl); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		writeAdminJSON(w, map[string]string{category: configLevelName(lvl)})
+	case name == "rotate" && r.Method == "POST":
+		rotated := []string{}
+		names, filters := h.log.snapshot()
+		for i, filt := range filters {
+			if len(category) > 0 && names[i] != category {
+				continue
+			}
+			found, err := rotateFilter(filt)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if found {
+				rotated = append(rotated, names[i])
+			}
+		}
+		if len(category) > 0 && len(rotated) == 0 {
+			http.Error(w, fmt.Sprintf("no file to rotate for category %q", category), http.StatusNotFound)
+			return
+		}
+		writeAdminJSON(w, map[string][]string{"rotated": rotated})
+	case name == "stats" && len(category) == 0 && r.Method == "GET":
+		stats := map[string]AdminWriterStats{}
+		names, filters := h.log.snapshot()
+		for i, filt := range filters {
+			stats[names[i]] = writerStats(filt)
+		}
+		writeAdminJSON(w, stats)
+	case name == "levels" || name == "rotate" || name == "stats":
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// rotateFilter rotates the files that filt writes to, unless it is retired,
+// and reports whether there were any.
+func rotateFilter(filt *Filter) (bool, error) {
+	if !filt.acquire() {
+		return false, nil
+	}
+	defer filt.release()
+	found := false
+	for _, lw := range fannedOut(filt.LogWriter) {
+		rw, ok := baseWriter(lw).(interface{ RotateNow() error })
+		if !ok {
+			continue
+		}
+		if err := rw.RotateNow(); err != nil {
+			return found, err
+		}
+		found = true
+	}
+	return found, nil
+}
+
+// baseWriter returns the writer that w writes through, for writers wrapped
+// by the configuration.
+func baseWriter(w LogWriter) LogWriter {
+	for {
+		inner, ok := unwrapWriter(w)
+		if !ok {
+			return w
+		}
+		w = inner
+	}
+}
+
+// unwrapWriter returns the writer that the configuration wrapper w writes
+// to.
+func unwrapWriter(w LogWriter) (LogWriter, bool) {
+	switch w := w.(type) {
+	case sharedWriter:
+		return w.LogWriter, true
+	case *maxLevelWriter:
+		return w.LogWriter, true
+	case *recordFilter:
+		return w.LogWriter, true
+	case clonedWriter:
+		return w.LogWriter, true
+	}
+	return nil, false
+}
+
+// fannedOut returns the writers that w writes to, see AddWriter.
+func fannedOut(w LogWriter) []LogWriter {
+	fw, ok := w.(*fanoutWriter)
+	if !ok {
+		return []LogWriter{w}
+	}
+	writers := make([]LogWriter, len(fw.filters))
+	for i, filt := range fw.filters {
+		writers[i] = filt.LogWriter
+	}
+	return writers
+}
+
+func writerStats(filt *Filter) AdminWriterStats {
+	w := baseWriter(filt.LogWriter)
+	stats := AdminWriterStats{
+		Level:   configLevelName(filt.level()),
+		Writer:  fmt.Sprintf("%T", w),
+		Limited: filt.rateLimited(),
+	}
+	for lw, ok := filt.LogWriter, true; ok; lw, ok = unwrapWriter(lw) {
+		if mw, isMax := lw.(*maxLevelWriter); isMax {
+			stats.MaxLevel = configLevelName(mw.max)
+		}
+	}
+	if fw, ok := w.(*fanoutWriter); ok {
+		for _, f := range fw.filters {
+			stats.Writers = append(stats.Writers, writerStats(f))
+		}
+		return stats
+	}
+	if sw, ok := w.(*ShadowLogWriter); ok {
+		shadow := sw.Stats()
+		stats.Shadow = &shadow
+		w = sw.Primary()
+	}
+	if dw, ok := w.(interface{ Dropped() uint64 }); ok {
+		stats.Dropped = dw.Dropped()
+	}
+	if qw, ok := w.(interface{ QueueStats() QueueStats }); ok {
+		queue := qw.QueueStats()
+		stats.Queued, stats.Capacity, stats.HighWater = queue.Depth, queue.Capacity, queue.HighWater
+	}
+	switch w := w.(type) {
+	case *FileLogWriter:
+		stats.Filename = w.filename
+	case *SplitFileLogWriter:
+		stats.Filename = w.filename
+	case *SocketLogWriter:
+		socket := w.Stats()
+		stats.Socket = &socket
+	}
+	return stats
+}
+
+func writeAdminJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
@@ -0,0 +1,145 @@
+package log4go
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// batchCompressors make the functions compressing the batches of a
+// SocketLogWriter, appending src compressed to dst, for SetCompression and
+// the "compression" config field of sockets.
+var batchCompressors = map[string]func() (func(dst, src []byte) []byte, error){
+	"gzip": func() (func(dst, src []byte) []byte, error) {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		return func(dst, src []byte) []byte {
+			buf.Reset()
+			zw.Reset(&buf)
+			zw.Write(src)
+			zw.Close()
+			return append(dst, buf.Bytes()...)
+		}, nil
+	},
+	"zstd": func() (func(dst, src []byte) []byte, error) {
+		enc, err := zstd.NewWriter(nil)
+		if err != nil {
+			return nil, err
+		}
+		return func(dst, src []byte) []byte {
+			return enc.EncodeAll(src, dst)
+		}, nil
+	},
+}
+
+// SetBatch sends the records in batches of up to n records, or of the
+// records logged within interval, whichever comes first (chainable).  Each
+// batch is sent in one write, or one udp datagram, holding the records with
+// their framing one after the other, compressed as a whole with
+// SetCompression.  Batches are also sent when they reach
+// DefaultFlushBufferSize bytes, and on Flush.  n of 0 or 1 and zero interval
+// send each record on its own.  Must be called before the first log message
+// is written.
+func (w *SocketLogWriter) SetBatch(n int, interval time.Duration) *SocketLogWriter {
+	w.batchRecords, w.batchInterval = n, interval
+	return w
+}
+
+// SetCompression compresses what is sent, each batch of SetBatch or else
+// each record, with "gzip" or "zstd" (chainable); "none" or "" turns
+// compression off.  Over tcp, each compressed batch is preceded by its
+// length as 4 bytes in big-endian order.  Must be called before the first
+// log message is written.
+func (w *SocketLogWriter) SetCompression(method string) *SocketLogWriter {
+	if method == "" || method == "none" {
+		w.compression = ""
+		return w
+	}
+	if _, ok := batchCompressors[method]; !ok {
+		fmt.Fprintf(os.Stderr, "SocketLogWriter: unknown compression %q, records will not be compressed\n", method)
+		w.compression = ""
+		return w
+	}
+	w.compression = method
+	return w
+}
+
+// startBatches sets c up for the batching and compression of c.w, when the
+// first record is sent over proto.  It returns the interval at which the
+// batch must be sent, zero if none.
+func (c *socketConn) startBatches(proto string) time.Duration {
+	w := c.w
+	if len(w.compression) > 0 {
+		compress, err := batchCompressors[w.compression]()
+		if err != nil {
+			reportError(fmt.Errorf("SocketLogWriter(%q): %s, records will not be compressed", c.hostport, err))
+		} else {
+			c.compress = compress
+			c.prefix = proto == "tcp"
+		}
+	}
+	if proto == "udp" {
+		c.maxBatch = w.datagramSize()
+	}
+	c.batchRecords = w.batchRecords
+	if c.batchRecords <= 0 && w.batchInterval <= 0 {
+		c.batchRecords = 1
+	}
+	if c.batching = c.batchRecords != 1 || c.compress != nil; !c.batching {
+		return 0
+	}
+	return w.batchInterval
+}
+
+// addBatch adds js, the encoding of rec, to the batch, and seals it when it
+// is full.
+func (c *socketConn) addBatch(rec *LogRecord, js []byte) {
+	if c.maxBatch > 0 && len(c.batch)+len(js) > c.maxBatch {
+		// Keep udp batches within a datagram
+		c.seal()
+	}
+	c.batch = append(c.batch, js...)
+	c.batched = append(c.batched, rec)
+	if (c.batchRecords > 0 && len(c.batched) >= c.batchRecords) || len(c.batch) >= DefaultFlushBufferSize {
+		c.seal()
+	}
+}
+
+// seal moves the batch, compressed if need be, to the pending records.
+func (c *socketConn) seal() {
+	if len(c.batched) == 0 {
+		return
+	}
+	b := c.batch
+	if c.compress != nil {
+		c.compressed = c.compress(c.compressed[:0], c.batch)
+		b = c.compressed
+		if c.prefix {
+			c.pending = appendBigEndian32(c.pending, uint32(len(b)))
+		}
+	}
+	c.pending = append(c.pending, b...)
+	c.records += len(c.batched)
+	if c.spooling {
+		c.inflight = append(c.inflight, c.batched...)
+	}
+	c.batch, c.batched = c.batch[:0], c.batched[:0]
+}
+
+// parseBatchInterval returns the duration of a batch_interval property, or
+// zero if none.
+func parseBatchInterval(filename, value string) time.Duration {
+	if len(value) == 0 {
+		return 0
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "LoadConfiguration: Warning: Invalid batch_interval %q in %s, records will not be batched by time\n", value, filename)
+		return 0
+	}
+	return d
+}
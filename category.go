@@ -2,20 +2,186 @@ package log4go
 
 import (
 	"fmt"
-	"runtime"
+	"path"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
-// LOGGER get the log Filter by category
+// LOGGER get the log Filter by category.  The filter returned is a handle,
+// which finds the filter of its category each time the filters change, so
+// that one kept in a package variable can be used from any goroutine while
+// filters are added or the configuration is reloaded.  Categories are
+// hierarchical: one without a filter of its own, e.g. "api.db.query", logs
+// with the level and writer of "api.db", or else of "api", keeping its own
+// name in the records.  When there is no such filter, the handle writes the
+// records, with the category, to the "stdout" filter only, at its level.
 func LOGGER(category string) *Filter {
-	f, ok := Global[category]
-	if !ok {
-		f = &Filter{CRITICAL, NewConsoleLogWriter(), "DEFAULT"}  
+	return Global.newHandle(category, nil)
+}
+
+// LOGGER returns a handle for category in the logger, as the LOGGER function
+// does in Global.  The handle writes to the "stdout" filter of the logger,
+// not of Global, so that a library can log through a Logger of its own (see
+// Clone) whose categories do not collide with those of the program.
+func (log Logger) LOGGER(category string) *Filter {
+	return log.newHandle(category, log)
+}
+
+// newHandle returns the handle of LOGGER for category, finding its filter in
+// owner, or in Global at the time of logging if owner is nil.
+func (log Logger) newHandle(category string, owner Logger) *Filter {
+	gen := atomic.LoadUint64(&loggerGen)
+	v := log.handle(category, owner)
+	h := &Filter{Level: v.Level, LogWriter: v.LogWriter, Category: category, logger: owner, byName: true}
+	h.view.Store(&handleView{gen: gen, filt: v})
+	return h
+}
+
+// handle returns a handle for category, writing to the "stdout" filter of
+// owner, or of Global at the time of logging if owner is nil.
+func (log Logger) handle(category string, owner Logger) *Filter {
+	var h *Filter
+	if f, ok := log.lookup(category); ok {
+		h = f.handle(category)
+	} else if stdout, ok := log.get("stdout"); ok {
+		h = &Filter{Level: stdout.level(), LogWriter: stdoutOnly{}, Category: category, base: stdout}
 	} else {
-		f.Category = category
+		h = &Filter{Level: CRITICAL, LogWriter: stdoutOnly{}, Category: category}
+	}
+	h.logger = owner
+	return h
+}
+
+// stdout returns the "stdout" filter that f also writes to, or nil.
+func (f *Filter) stdout() *Filter {
+	log := f.logger
+	if log == nil {
+		log = Global
+	}
+	stdout, _ := log.get("stdout")
+	return stdout
+}
+
+// lookup returns the filter of category or, for a category without one, of
+// its closest ancestor: "api.db.query" falls back to "api.db" and then "api".
+// Failing those, the filter whose name is the longest wildcard pattern (see
+// path.Match) matching category is used, e.g. "api.*" or "worker-??".
+func (log Logger) lookup(category string) (*Filter, bool) {
+	loggerMu.RLock()
+	defer loggerMu.RUnlock()
+	for c := category; ; {
+		if f, ok := log[c]; ok {
+			return f, true
+		}
+		i := strings.LastIndexByte(c, '.')
+		if i < 0 {
+			break
+		}
+		c = c[:i]
+	}
+
+	var match string
+	for name := range log {
+		if !isCategoryPattern(name) || len(name) < len(match) || (len(name) == len(match) && name > match) {
+			continue
+		}
+		if ok, _ := path.Match(name, category); ok {
+			match = name
+		}
+	}
+	if len(match) == 0 {
+		return nil, false
+	}
+	return log[match], true
+}
+
+// isCategoryPattern reports whether a filter name is a wildcard pattern.
+func isCategoryPattern(name string) bool {
+	return strings.ContainsAny(name, "*?[")
+}
+
+// stdoutOnly is the writer of LOGGER handles for categories without a
+// filter, which are only written to the "stdout" filter.
+type stdoutOnly struct{}
+
+func (stdoutOnly) LogWrite(rec *LogRecord) {}
+
+func (stdoutOnly) Close() {}
+
+// WithFields returns a copy of the filter that attaches fields, merged with
+// any it already attaches, to every record it logs:
+//
+//	log.LOGGER("api").WithFields(log.Fields{"user": id, "req": reqID}).Info("login ok")
+func (f *Filter) WithFields(fields Fields) *Filter {
+	merged := make(Fields, len(f.fields)+len(fields))
+	for k, v := range f.fields {
+		merged[k] = v
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+	return f.derive(f.Category, merged)
+}
+
+// derive returns a filter for category with fields, logging like f: through
+// the filter f was derived from, or as a handle if f is one.
+func (f *Filter) derive(category string, fields Fields) *Filter {
+	d := &Filter{Level: f.level(), LogWriter: f.LogWriter, Category: category, fields: fields, logger: f.logger, byName: f.byName}
+	if !f.byName {
+		d.base = f.registered()
+	} else if v := f.view.Load(); v != nil && category == f.Category {
+		d.view.Store(v)
+	}
+	return d
+}
+
+// Child returns a logger for a part of the module f logs for.  It writes to
+// the same writer at the same minimum level, inherits the fields of f merged
+// with the given ones, and its category is "parent.name":
+//
+//	db := log.LOGGER("api").Child("db", log.Fields{"pool": "main"})
+//	db.Warn("slow query") // category "api.db"
+func (f *Filter) Child(name string, fields ...Fields) *Filter {
+	merged := make(Fields, len(f.fields))
+	for k, v := range f.fields {
+		merged[k] = v
+	}
+	for _, fs := range fields {
+		for k, v := range fs {
+			merged[k] = v
+		}
+	}
+	if len(f.Category) > 0 {
+		name = f.Category + "." + name
+	}
+	return f.derive(name, merged)
+}
+
+// dispatch sends rec to the stdout filter and to f, as the logging methods do.
+func (f *Filter) dispatch(rec *LogRecord) {
+	if !f.allow() {
+		return
+	}
+	if rec = runHooks(rec); rec == nil {
+		return
+	}
+	f.write(rec)
+}
+
+// write sends rec to the "stdout" filter, if it is above its level, and to
+// the writer of f, skipping the filters retired meanwhile.
+func (f *Filter) write(rec *LogRecord) {
+	cur := f.current()
+	if stdout := cur.stdout(); stdout != nil && rec.Level.above(stdout.level()) {
+		stdout.send(rec)
+	}
+	if f.Category != "DEFAULT" && f.Category != "stdout" {
+		if reg := cur.registered(); reg.acquire() {
+			cur.LogWrite(rec)
+			reg.release()
+		}
 	}
-	return f
 }
 
 // Send a formatted log message internally
@@ -23,19 +189,18 @@ func (f *Filter) intLogf(lvl Level, format string, args ...interface{}) {
 	skip := true
 
 	// Determine if any logging will be done
-	if lvl >= f.Level {
+	if lvl.atLeast(f.level()) {
 		skip = false
 	}
 	if skip {
 		return
 	}
+	if !f.allow() {
+		return
+	}
 
 	// Determine caller func
-	pc, _, lineno, ok := runtime.Caller(2)
-	src := ""
-	if ok {
-		src = fmt.Sprintf("%s:%d", runtime.FuncForPC(pc).Name(), lineno)
-	}
+	src, file, lineno := caller(2, f.captureSource())
 
 	msg := format
 	if len(args) > 0 {
@@ -44,31 +209,24 @@ func (f *Filter) intLogf(lvl Level, format string, args ...interface{}) {
 
 	// Make the log record
 	rec := &LogRecord{
-		Level:    lvl,
-		Created:  time.Now(),
-		Source:   src,
-		Message:  msg,
-		Category: f.Category,
+		Level:     lvl,
+		Created:   time.Now(),
+		Source:    src,
+		File:      file,
+		Line:      lineno,
+		Message:   msg,
+		Category:  f.Category,
+		Fields:    withMDC(f.fields),
+		Goroutine: currentGoroutine(),
+		Seq:       nextSeq(),
 	}
-
-	// Dispatch the logs
-	/*for _, filt := range log {
-		if lvl < filt.Level {
-			continue
-		}
-		filt.LogWrite(rec)
-	}
-	*/
-	default_filter := Global["stdout"]
-
-	if default_filter != nil && lvl > default_filter.Level {
-		default_filter.LogWrite(rec)
-	}
-
-	if f.Category != "DEFAULT" && f.Category != "stdout" {
-		f.LogWrite(rec)
+	rec.Stack = errorStack(lvl, rec.Fields, 2)
+	if rec = runHooks(rec); rec == nil {
+		return
 	}
 
+	// Dispatch the logs
+	f.write(rec)
 }
 
 // Send a closure log message internally
@@ -76,70 +234,89 @@ func (f *Filter) intLogc(lvl Level, closure func() string) {
 	skip := true
 
 	// Determine if any logging will be done
-	if lvl >= f.Level {
+	if lvl.atLeast(f.level()) {
 		skip = false
 	}
 	if skip {
 		return
 	}
+	if !f.allow() {
+		return
+	}
 
 	// Determine caller func
-	pc, _, lineno, ok := runtime.Caller(2)
-	src := ""
-	if ok {
-		src = fmt.Sprintf("%s:%d", runtime.FuncForPC(pc).Name(), lineno)
-	}
+	src, file, lineno := caller(2, f.captureSource())
 
 	// Make the log record
 	rec := &LogRecord{
-		Level:    lvl,
-		Created:  time.Now(),
-		Source:   src,
-		Message:  closure(),
-		Category: f.Category,
+		Level:     lvl,
+		Created:   time.Now(),
+		Source:    src,
+		File:      file,
+		Line:      lineno,
+		Message:   closure(),
+		Category:  f.Category,
+		Fields:    withMDC(f.fields),
+		Goroutine: currentGoroutine(),
+		Seq:       nextSeq(),
 	}
-
-	default_filter := Global["stdout"]
-
-	if default_filter != nil &&  lvl > default_filter.Level {
-		default_filter.LogWrite(rec)
+	rec.Stack = errorStack(lvl, rec.Fields, 2)
+	if rec = runHooks(rec); rec == nil {
+		return
 	}
 
-	if f.Category != "DEFAULT" && f.Category != "stdout" {
-		f.LogWrite(rec)
-	}
+	f.write(rec)
 }
 
 // Send a log message with manual level, source, and message.
 func (f *Filter) Log(lvl Level, source, message string) {
+	f.log(lvl, source, message, "")
+}
+
+// LogStack logs message at the given log level with manual source, as Log
+// does, with stack as its stack trace, e.g. the trace of a recovered panic
+// from runtime/debug.Stack.  The trace is written by %K and included as
+// "stack" in JSON output, whether or not SetErrorStacks is enabled.
+func (f *Filter) LogStack(lvl Level, source, message, stack string) {
+	f.log(lvl, source, message, stack)
+}
+
+// log logs a message for Log and LogStack, capturing the stack of the call
+// as errorStack does if stack is empty.
+func (f *Filter) log(lvl Level, source, message, stack string) {
 	skip := true
 
 	// Determine if any logging will be done
-	if lvl >= f.Level {
+	if lvl.atLeast(f.level()) {
 		skip = false
 	}
 	if skip {
 		return
 	}
+	if !f.allow() {
+		return
+	}
 
 	// Make the log record
 	rec := &LogRecord{
-		Level:    lvl,
-		Created:  time.Now(),
-		Source:   source,
-		Message:  message,
-		Category: f.Category,
+		Level:     lvl,
+		Created:   time.Now(),
+		Source:    source,
+		Message:   message,
+		Category:  f.Category,
+		Fields:    withMDC(f.fields),
+		Goroutine: currentGoroutine(),
+		Seq:       nextSeq(),
 	}
-
-	default_filter := Global["stdout"]
-
-	if default_filter != nil && lvl > default_filter.Level {
-		default_filter.LogWrite(rec)
+	rec.Stack = stack
+	if len(stack) == 0 {
+		rec.Stack = errorStack(lvl, rec.Fields, 2)
 	}
-
-	if f.Category != "DEFAULT" && f.Category != "stdout" {
-		f.LogWrite(rec)
+	if rec = runHooks(rec); rec == nil {
+		return
 	}
+
+	f.write(rec)
 }
 
 // Logf logs a formatted log message at the given log level, using the caller as
@@ -271,14 +448,20 @@ func (f *Filter) Warn(arg0 interface{}, args ...interface{}) {
 	var msg string
 	switch first := arg0.(type) {
 	case string:
-		// Use the string as a format string
-		msg = fmt.Sprintf(first, args...)
+		// Use the string as a format string, unless there is nothing to format
+		msg = first
+		if len(args) > 0 {
+			msg = fmt.Sprintf(first, args...)
+		}
 	case func() string:
 		// f the closure (no other arguments used)
 		msg = first()
 	default:
 		// Build a format string so that it will be similar to Sprint
-		msg = fmt.Sprintf(fmt.Sprint(first)+strings.Repeat(" %v", len(args)), args...)
+		msg = fmt.Sprint(first)
+		if len(args) > 0 {
+			msg = fmt.Sprintf(msg+strings.Repeat(" %v", len(args)), args...)
+		}
 	}
 	f.intLogf(lvl, msg)
 }
@@ -293,14 +476,20 @@ func (f *Filter) Error(arg0 interface{}, args ...interface{}) {
 	var msg string
 	switch first := arg0.(type) {
 	case string:
-		// Use the string as a format string
-		msg = fmt.Sprintf(first, args...)
+		// Use the string as a format string, unless there is nothing to format
+		msg = first
+		if len(args) > 0 {
+			msg = fmt.Sprintf(first, args...)
+		}
 	case func() string:
 		// f the closure (no other arguments used)
 		msg = first()
 	default:
 		// Build a format string so that it will be similar to Sprint
-		msg = fmt.Sprintf(fmt.Sprint(first)+strings.Repeat(" %v", len(args)), args...)
+		msg = fmt.Sprint(first)
+		if len(args) > 0 {
+			msg = fmt.Sprintf(msg+strings.Repeat(" %v", len(args)), args...)
+		}
 	}
 	f.intLogf(lvl, msg)
 }
@@ -315,14 +504,20 @@ func (f *Filter) Critical(arg0 interface{}, args ...interface{}) {
 	var msg string
 	switch first := arg0.(type) {
 	case string:
-		// Use the string as a format string
-		msg = fmt.Sprintf(first, args...)
+		// Use the string as a format string, unless there is nothing to format
+		msg = first
+		if len(args) > 0 {
+			msg = fmt.Sprintf(first, args...)
+		}
 	case func() string:
 		// f the closure (no other arguments used)
 		msg = first()
 	default:
 		// Build a format string so that it will be similar to Sprint
-		msg = fmt.Sprintf(fmt.Sprint(first)+strings.Repeat(" %v", len(args)), args...)
+		msg = fmt.Sprint(first)
+		if len(args) > 0 {
+			msg = fmt.Sprintf(msg+strings.Repeat(" %v", len(args)), args...)
+		}
 	}
 	f.intLogf(lvl, msg)
 }
@@ -0,0 +1,54 @@
+package log4go
+
+import "sync/atomic"
+
+// Clone returns a new Logger with the filters of log, writing to the same
+// writers, so that a library can start from the configuration of the program
+// and change it without affecting the program:
+//
+//	lib := log.Global.Clone()
+//	lib.AddFilter("mylib", log.DEBUG, libWriter, "mylib")
+//	lib.SetLevel("stdout", log.WARNING)
+//	lib.LOGGER("mylib").Info("only in the library's logger")
+//
+// Levels, capture of the source and rate limits are copied and then set
+// independently.  Closing the clone closes the writers added to it, not the
+// ones it shares with log.  Use make(Logger) for a logger sharing nothing.
+func (log Logger) Clone() Logger {
+	names, filters := log.snapshot()
+	clone := make(Logger, len(names))
+	for i, f := range filters {
+		c := &Filter{
+			Level:     f.level(),
+			LogWriter: clonedWriter{f.LogWriter, f},
+			Category:  f.Category,
+			fields:    f.fields,
+			nosource:  atomic.LoadUint32(&f.nosource),
+		}
+		c.limiter.Store(f.rateLimiter())
+		clone[names[i]] = c
+	}
+	return clone
+}
+
+// clonedWriter is the writer of the filters of a clone, which leaves closing
+// the writer to the Logger that was cloned, and stops writing once that
+// Logger retires the filter it was cloned from.
+type clonedWriter struct {
+	LogWriter
+	filt *Filter // The filter of the Logger that was cloned
+}
+
+func (w clonedWriter) LogWrite(rec *LogRecord) {
+	if w.filt.acquire() {
+		w.LogWriter.LogWrite(rec)
+		w.filt.release()
+	}
+}
+
+func (w clonedWriter) Close() {}
+
+// Flush flushes the writer if it is a Flusher.
+func (w clonedWriter) Flush() {
+	flushFilter(w.filt, w.LogWriter)
+}
@@ -0,0 +1,45 @@
+package log4go
+
+import (
+	"os/exec"
+	"path/filepath"
+)
+
+// maxCapturedLine is the length from which a line of a child process is
+// logged even though it is not complete, so that a process writing no
+// newlines cannot make the LineWriter buffer its whole output.
+const maxCapturedLine = 64 << 10
+
+// CaptureOutput sets the Stdout and Stderr of cmd, which must not be started
+// yet, to LineWriters logging each line the child process writes, to
+// category at outLvl and errLvl respectively, so that the output of
+// migrations, encoders and the like goes through the usual writers, with
+// their timestamps and rotation.  The records have the fields "cmd", the base
+// name of cmd.Path, and "stream", "stdout" or "stderr".
+//
+// Unlike the LineWriters of Writer, these also end a line at a lone '\r', as
+// progress meters write, and log lines of 64K and more in parts.  The
+// returned function logs the last lines if the process did not end them; call
+// it once cmd.Wait, or Run, has returned:
+//
+//	cmd := exec.Command("ffmpeg", "-i", in, out)
+//	flush := log.Global.CaptureOutput(cmd, "ffmpeg", log.INFO, log.WARNING)
+//	err := cmd.Run()
+//	flush()
+func (log Logger) CaptureOutput(cmd *exec.Cmd, category string, outLvl, errLvl Level) (flush func()) {
+	name := filepath.Base(cmd.Path)
+	stdout, stderr := log.captureWriter(category, outLvl, name, "stdout"), log.captureWriter(category, errLvl, name, "stderr")
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	return func() {
+		stdout.Flush()
+		stderr.Flush()
+	}
+}
+
+func (log Logger) captureWriter(category string, lvl Level, name, stream string) *LineWriter {
+	w := log.Writer(lvl, category)
+	w.fields = Fields{"cmd": name, "stream": stream}
+	w.splitCR = true
+	w.maxLine = maxCapturedLine
+	return w
+}
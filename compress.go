@@ -0,0 +1,103 @@
+package log4go
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// A backupCompressor compresses rotated log files.
+type backupCompressor struct {
+	ext       string
+	newWriter func(io.Writer) (io.WriteCloser, error)
+}
+
+// Supported values for FileLogWriter.SetCompression and the "compression"
+// config field ("none" or empty disables compression).
+var backupCompressors = map[string]backupCompressor{
+	"gzip": {".gz", func(w io.Writer) (io.WriteCloser, error) {
+		return gzip.NewWriter(w), nil
+	}},
+	"zstd": {".zst", func(w io.Writer) (io.WriteCloser, error) {
+		return zstd.NewWriter(w)
+	}},
+}
+
+// SetCompression sets the compression applied to rotated backups (chainable):
+// "gzip", "zstd" or "none".  Compressed backups get a .gz or .zst extension.
+// Must be called before the first log message is written.
+func (w *FileLogWriter) SetCompression(method string) *FileLogWriter {
+	if method == "" || method == "none" {
+		w.compress = nil
+		return w
+	}
+	c, ok := backupCompressors[method]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "FileLogWriter(%q): unknown compression %q, backups will not be compressed\n", w.filename, method)
+		w.compress = nil
+		return w
+	}
+	w.compress = &c
+	return w
+}
+
+// backupExt returns the extension added to backups by the compression setting.
+func (w *FileLogWriter) backupExt() string {
+	if w.compress == nil {
+		return ""
+	}
+	return w.compress.ext
+}
+
+// compressBackup compresses fname into fname+ext in the background, removes
+// fname and then calls done.  Without compression done is called right away.
+// The writer goroutine, the only one calling it, waits for the compression
+// to finish before the next rotation and before it exits (which Close waits
+// for), so backups are never shifted while they are still being written.
+func (w *FileLogWriter) compressBackup(fname string, done func()) {
+	if w.compress == nil {
+		done()
+		return
+	}
+	c := w.compress
+	w.compressing.Add(1)
+	go func() {
+		defer w.compressing.Done()
+		if err := compressFile(fname, fname+c.ext, c); err != nil {
+			fmt.Fprintf(os.Stderr, "FileLogWriter(%q): compress %s: %s\n", w.filename, fname, err)
+		}
+		done()
+	}()
+}
+
+func compressFile(src, dst string, c *backupCompressor) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0660)
+	if err != nil {
+		return err
+	}
+	cw, err := c.newWriter(out)
+	if err == nil {
+		_, err = io.Copy(cw, in)
+		if cerr := cw.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(dst)
+		return err
+	}
+	in.Close()
+	return os.Remove(src)
+}
@@ -0,0 +1,105 @@
+package log4go
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// A "defaults" block in a JSON or YAML configuration holds keys that every
+// entry of the "files" and "sockets" lists inherits unless it sets them
+// itself, so the pattern and rotation settings are written once:
+//
+//	"defaults": {"level": "INFO", "pattern": "[%D %T] [%C] [%L] %M", "rotate": true, "maxsize": "100M"},
+//	"files": [
+//		{"enable": true, "category": "api", "filename": "logs/api.log"},
+//		{"enable": true, "category": "db", "filename": "logs/db.log", "level": "DEBUG", "rotate": false}
+//	]
+//
+// Keys that do not apply to an entry, such as "rotate" for a socket, are
+// ignored like any unknown key.
+var defaultsLists = []string{"files", "sockets"}
+
+// decodeJSONConfig parses a JSON configuration into lc, with the given
+// profile merged over it and its defaults applied.
+func decodeJSONConfig(content []byte, profile string, lc *LogConfig) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(content, &raw); err != nil {
+		return err
+	}
+
+	_, rewrite := raw["profiles"]
+	if err := mergeJSONProfile(raw, configProfile(profile)); err != nil {
+		return err
+	}
+	if defaults, ok := raw["defaults"]; ok {
+		rewrite = true
+		var keys map[string]json.RawMessage
+		if err := json.Unmarshal(defaults, &keys); err != nil {
+			return fmt.Errorf("defaults: %s", err)
+		}
+		for _, list := range defaultsLists {
+			if _, ok := raw[list]; !ok {
+				continue
+			}
+			var entries []map[string]json.RawMessage
+			if err := json.Unmarshal(raw[list], &entries); err != nil {
+				return fmt.Errorf("%s: %s", list, err)
+			}
+			for _, entry := range entries {
+				if entry == nil {
+					continue
+				}
+				for k, v := range keys {
+					if _, ok := entry[k]; !ok {
+						entry[k] = v
+					}
+				}
+			}
+			raw[list], _ = json.Marshal(entries)
+		}
+	}
+	if rewrite {
+		content, _ = json.Marshal(raw)
+	}
+	return json.Unmarshal(content, lc)
+}
+
+// decodeYAMLConfig parses a YAML configuration into lc, with the given
+// profile merged over it and its defaults applied.
+func decodeYAMLConfig(content, profile string, lc *LogConfig) error {
+	root, err := parseYAML(content)
+	if err != nil || root == nil {
+		return err
+	}
+	if !root.isMap() {
+		return fmt.Errorf("expected a mapping")
+	}
+	if err := mergeYAMLProfile(root, configProfile(profile)); err != nil {
+		return err
+	}
+
+	if defaults := root.values["defaults"]; defaults != nil && !defaults.isNull() {
+		if !defaults.isMap() {
+			return fmt.Errorf("defaults: expected a mapping")
+		}
+		for _, list := range defaultsLists {
+			entries := root.values[list]
+			if entries == nil {
+				continue
+			}
+			for _, entry := range entries.items {
+				if !entry.isMap() {
+					continue
+				}
+				for _, k := range defaults.keys {
+					if _, ok := entry.values[k]; !ok {
+						entry.keys = append(entry.keys, k)
+						entry.values[k] = defaults.values[k]
+					}
+				}
+			}
+		}
+	}
+	return decodeYAML(root, reflect.ValueOf(lc).Elem())
+}
@@ -0,0 +1,58 @@
+package log4go
+
+import (
+	"os"
+	"strings"
+)
+
+// expandConfigEnv replaces ${VAR} in a configuration with the value of the
+// environment variable VAR, and ${VAR:-default} with default when VAR is
+// unset or empty, so that one file serves every environment:
+//
+//	"filename": "${LOG_DIR:-/var/log/app}/api.log",
+//	"level": "${LOG_LEVEL:-INFO}"
+//
+// The text is substituted before parsing, so values must not contain
+// characters the format has to escape.  $${ is a literal ${, and a lone $ is
+// left alone.
+func expandConfigEnv(content string) string {
+	if !strings.Contains(content, "${") {
+		return content
+	}
+
+	var sb strings.Builder
+	for {
+		i := strings.Index(content, "${")
+		if i < 0 {
+			break
+		}
+		if i > 0 && content[i-1] == '$' {
+			sb.WriteString(content[:i-1])
+			sb.WriteString("${")
+			content = content[i+2:]
+			continue
+		}
+		end := strings.IndexByte(content[i:], '}')
+		if end < 0 {
+			break
+		}
+		sb.WriteString(content[:i])
+		sb.WriteString(lookupConfigEnv(content[i+2 : i+end]))
+		content = content[i+end+1:]
+	}
+	sb.WriteString(content)
+	return sb.String()
+}
+
+// lookupConfigEnv returns the value of "VAR" or "VAR:-default".
+func lookupConfigEnv(expr string) string {
+	name, def, hasDefault := expr, "", false
+	if i := strings.Index(expr, ":-"); i >= 0 {
+		name, def, hasDefault = expr[:i], expr[i+2:], true
+	}
+	value := os.Getenv(name)
+	if len(value) == 0 && hasDefault {
+		return def
+	}
+	return value
+}
@@ -0,0 +1,210 @@
+package log4go
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// ProfileEnv is the environment variable selecting the profile of a JSON or
+// YAML configuration, unless one is given to LoadConfiguration.
+const ProfileEnv = "LOG4GO_PROFILE"
+
+// A "profiles" object in a JSON or YAML configuration holds overlays, one
+// per environment, of which the selected one is merged over the rest of the
+// configuration before it is used:
+//
+//	"console": {"enable": true, "level": "DEBUG"},
+//	"files": [{"enable": true, "category": "api", "filename": "api.log", "level": "DEBUG"}],
+//	"profiles": {
+//		"prod": {
+//			"console": {"enable": false},
+//			"files": [{"category": "api", "level": "WARNING"}]
+//		}
+//	}
+//
+// Objects are merged key by key.  The entries of "files" and "sockets" are
+// merged with the base entry of the same category, or appended if there is
+// none; other values replace the base ones.  Without a profile, or with one
+// the configuration does not define, only the base is used.
+
+// configProfile returns profile, or the one selected by ProfileEnv.
+func configProfile(profile string) string {
+	if len(profile) == 0 {
+		return os.Getenv(ProfileEnv)
+	}
+	return profile
+}
+
+// mergeJSONProfile merges the selected profile of raw over it and removes
+// the profiles.
+func mergeJSONProfile(raw map[string]json.RawMessage, profile string) error {
+	profiles, ok := raw["profiles"]
+	if !ok {
+		return nil
+	}
+	delete(raw, "profiles")
+
+	var overlays map[string]json.RawMessage
+	if err := json.Unmarshal(profiles, &overlays); err != nil {
+		return fmt.Errorf("profiles: %s", err)
+	}
+	overlay, ok := overlays[profile]
+	if !ok || len(profile) == 0 {
+		return nil
+	}
+	var keys map[string]json.RawMessage
+	if err := json.Unmarshal(overlay, &keys); err != nil {
+		return fmt.Errorf("profile %s: %s", profile, err)
+	}
+
+	for k, v := range keys {
+		base, ok := raw[k]
+		switch {
+		case !ok:
+			raw[k] = v
+		case k == "files" || k == "sockets":
+			merged, err := mergeJSONEntries(base, v)
+			if err != nil {
+				return fmt.Errorf("profile %s: %s: %s", profile, k, err)
+			}
+			raw[k] = merged
+		default:
+			raw[k] = mergeJSON(base, v)
+		}
+	}
+	return nil
+}
+
+// mergeJSON merges overlay over base if both are objects, and otherwise
+// returns overlay.
+func mergeJSON(base, overlay json.RawMessage) json.RawMessage {
+	var bm, om map[string]json.RawMessage
+	if json.Unmarshal(base, &bm) != nil || json.Unmarshal(overlay, &om) != nil || bm == nil || om == nil {
+		return overlay
+	}
+	for k, v := range om {
+		if b, ok := bm[k]; ok {
+			v = mergeJSON(b, v)
+		}
+		bm[k] = v
+	}
+	merged, _ := json.Marshal(bm)
+	return merged
+}
+
+// mergeJSONEntries merges the overlay entries over the base entries of the
+// same category.
+func mergeJSONEntries(base, overlay json.RawMessage) (json.RawMessage, error) {
+	var bs, ovs []json.RawMessage
+	if err := json.Unmarshal(base, &bs); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(overlay, &ovs); err != nil {
+		return nil, err
+	}
+
+	category := func(entry json.RawMessage) string {
+		var e struct {
+			Category string `json:"category"`
+		}
+		json.Unmarshal(entry, &e)
+		return e.Category
+	}
+next:
+	for _, o := range ovs {
+		if c := category(o); len(c) > 0 {
+			for i, b := range bs {
+				if category(b) == c {
+					bs[i] = mergeJSON(b, o)
+					continue next
+				}
+			}
+		}
+		bs = append(bs, o)
+	}
+	return json.Marshal(bs)
+}
+
+// mergeYAMLProfile is mergeJSONProfile for a parsed YAML configuration.
+func mergeYAMLProfile(root *yamlNode, profile string) error {
+	profiles, ok := root.values["profiles"]
+	if !ok {
+		return nil
+	}
+	delete(root.values, "profiles")
+	for i, k := range root.keys {
+		if k == "profiles" {
+			root.keys = append(root.keys[:i:i], root.keys[i+1:]...)
+			break
+		}
+	}
+
+	if !profiles.isMap() && !profiles.isNull() {
+		return fmt.Errorf("profiles: expected a mapping")
+	}
+	overlay := profiles.values[profile]
+	if overlay == nil || len(profile) == 0 || overlay.isNull() {
+		return nil
+	}
+	if !overlay.isMap() {
+		return fmt.Errorf("profile %s: expected a mapping", profile)
+	}
+
+	for _, k := range overlay.keys {
+		v := overlay.values[k]
+		base, ok := root.values[k]
+		switch {
+		case !ok:
+			root.keys = append(root.keys, k)
+		case (k == "files" || k == "sockets") && base.isSeq && v.isSeq:
+			v = mergeYAMLEntries(base, v)
+		default:
+			v = mergeYAML(base, v)
+		}
+		root.values[k] = v
+	}
+	return nil
+}
+
+// mergeYAML merges overlay over base if both are mappings, and otherwise
+// returns overlay.
+func mergeYAML(base, overlay *yamlNode) *yamlNode {
+	if !base.isMap() || !overlay.isMap() {
+		return overlay
+	}
+	for _, k := range overlay.keys {
+		v := overlay.values[k]
+		if b, ok := base.values[k]; ok {
+			v = mergeYAML(b, v)
+		} else {
+			base.keys = append(base.keys, k)
+		}
+		base.values[k] = v
+	}
+	return base
+}
+
+// mergeYAMLEntries merges the overlay entries over the base entries of the
+// same category.
+func mergeYAMLEntries(base, overlay *yamlNode) *yamlNode {
+	category := func(entry *yamlNode) string {
+		if c := entry.values["category"]; c != nil && !c.isMap() && !c.isSeq {
+			return c.scalar
+		}
+		return ""
+	}
+next:
+	for _, o := range overlay.items {
+		if c := category(o); len(c) > 0 {
+			for i, b := range base.items {
+				if category(b) == c {
+					base.items[i] = mergeYAML(b, o)
+					continue next
+				}
+			}
+		}
+		base.items = append(base.items, o)
+	}
+	return base
+}
@@ -0,0 +1,58 @@
+package log4go
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// LoadConfigurationFromReader loads a configuration read from r, for configs
+// that do not live in a file of their own (embed.FS, a Kubernetes ConfigMap,
+// a secrets manager, ...).  format is "json", "yaml" or "xml"; see
+// LoadConfigurationFromBytes.
+func (log Logger) LoadConfigurationFromReader(r io.Reader, format string) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return log.LoadConfigurationFromBytes(data, format)
+}
+
+// LoadConfigurationFromBytes loads a configuration in format "json", "yaml"
+// or "xml".  Unlike the file loaders it returns an error instead of exiting
+// when the configuration cannot be parsed, and the logger is left untouched
+// then.  Once parsed, the configuration is applied as by the file loaders,
+// environment variables and the profile selected by ProfileEnv included.
+func (log Logger) LoadConfigurationFromBytes(data []byte, format string) error {
+	content := []byte(expandConfigEnv(string(data)))
+	name := "<" + format + " configuration>"
+
+	switch strings.ToLower(format) {
+	case "json":
+		var lc LogConfig
+		if err := decodeJSONConfig(content, "", &lc); err != nil {
+			return fmt.Errorf("could not parse json configuration: %s", err)
+		}
+		log.Close()
+		log.applyConfig(name, &lc)
+	case "yaml", "yml":
+		var lc LogConfig
+		if err := decodeYAMLConfig(string(content), "", &lc); err != nil {
+			return fmt.Errorf("could not parse yaml configuration: %s", err)
+		}
+		log.Close()
+		log.applyConfig(name, &lc)
+	case "xml":
+		xc := new(xmlLoggerConfig)
+		if err := xml.Unmarshal(content, xc); err != nil {
+			return fmt.Errorf("could not parse XML configuration: %s", err)
+		}
+		log.Close()
+		log.applyXMLConfig(name, xc)
+	default:
+		return fmt.Errorf("unknown configuration format %q", format)
+	}
+	return nil
+}
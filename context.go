@@ -0,0 +1,28 @@
+package log4go
+
+import "context"
+
+// filterKey is the context key under which NewContext stores a *Filter.
+type filterKey struct{}
+
+// NewContext returns a copy of ctx carrying f, so that request scoped loggers
+// (see WithFields) can be handed down a chain of handlers:
+//
+//	ctx = log.NewContext(ctx, log.LOGGER("api").WithFields(log.Fields{"req": reqID}))
+//	...
+//	if l, ok := log.FromContext(ctx); ok {
+//		l.Info("handled")
+//	}
+func NewContext(ctx context.Context, f *Filter) context.Context {
+	return context.WithValue(ctx, filterKey{}, f)
+}
+
+// FromContext returns the *Filter stored in ctx by NewContext, if any, with
+// the ids of the span active in ctx attached (see WithContext).
+func FromContext(ctx context.Context) (*Filter, bool) {
+	f, ok := ctx.Value(filterKey{}).(*Filter)
+	if !ok || f == nil {
+		return nil, false
+	}
+	return f.WithContext(ctx), true
+}
@@ -0,0 +1,180 @@
+package log4go
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Levels are ordered by rank, on a scale where the built-in levels rank ten
+// apart: FINEST 0, FINE 10, DEBUG 20, TRACE 30, INFO 40, WARNING 50, ERROR 60,
+// CRITICAL 70, PANIC 80 and FATAL 90.  Custom levels (see RegisterLevel) are
+// the Level values from customLevelBase up, customLevelBase+rank, so that
+// the built-in levels keep their values.
+const customLevelBase Level = 1000
+
+// customLevel is the registration of a custom level.
+type customLevel struct {
+	name  string // Used in configuration files
+	short string // Shown by %L and the formatters
+}
+
+// customLevels holds the map[Level]customLevel of the registered levels.  It
+// is replaced, never modified, so that writer goroutines can read it without
+// locking.
+var (
+	customLevels     atomic.Value
+	customLevelsLock sync.Mutex
+)
+
+// RegisterLevel adds a level called name, e.g. "AUDIT" or "NOTICE", that can
+// be used in configuration files and is shown as short, or name if it is not
+// given, by %L and the formatters.  Its place among the other levels is
+// given by rank (see above); a NOTICE level between INFO and WARNING could
+// rank 45:
+//
+//	NOTICE, _ := log.RegisterLevel("NOTICE", 45, "NOTE")
+//	log.LOGGER("api").Logf(NOTICE, "configuration reloaded")
+//
+// Registering a name again with the same rank returns the same level, with
+// the new short name if one is given.  The rank of a built-in level, or a
+// name already in use, is an error.
+func RegisterLevel(name string, rank int, short ...string) (Level, error) {
+	if len(name) == 0 {
+		return 0, fmt.Errorf("RegisterLevel: empty name")
+	}
+	if rank < 0 {
+		return 0, fmt.Errorf("RegisterLevel: negative rank %d", rank)
+	}
+	if rank%10 == 0 && rank <= FATAL.rank() {
+		return 0, fmt.Errorf("RegisterLevel: rank %d is that of %s", rank, configLevelName(Level(rank/10)))
+	}
+	for _, builtin := range levelConfigNames {
+		if builtin == name {
+			return 0, fmt.Errorf("RegisterLevel: %s is a built-in level", name)
+		}
+	}
+
+	lvl := customLevelBase + Level(rank)
+	cl := customLevel{name: name, short: firstString(short)}
+	if len(cl.short) == 0 {
+		cl.short = name
+	}
+
+	customLevelsLock.Lock()
+	defer customLevelsLock.Unlock()
+	current, _ := customLevels.Load().(map[Level]customLevel)
+	for l, c := range current {
+		if c.name == name && l != lvl {
+			return 0, fmt.Errorf("RegisterLevel: %s is registered with rank %d", name, l.rank())
+		}
+		if l == lvl && c.name != name {
+			return 0, fmt.Errorf("RegisterLevel: rank %d is that of %s", rank, c.name)
+		}
+		if l == lvl && len(short) == 0 {
+			return lvl, nil
+		}
+	}
+	levels := make(map[Level]customLevel, len(current)+1)
+	for l, c := range current {
+		levels[l] = c
+	}
+	levels[lvl] = cl
+	customLevels.Store(levels)
+	return lvl, nil
+}
+
+// custom returns the registration of the custom level l.
+func (l Level) custom() (customLevel, bool) {
+	levels, _ := customLevels.Load().(map[Level]customLevel)
+	cl, ok := levels[l]
+	return cl, ok
+}
+
+// setCustomName changes the name shown for the custom level l, see
+// SetLevelName.
+func setCustomName(l Level, short string) {
+	customLevelsLock.Lock()
+	defer customLevelsLock.Unlock()
+	current, _ := customLevels.Load().(map[Level]customLevel)
+	cl, ok := current[l]
+	if !ok {
+		return
+	}
+	cl.short = short
+	if len(short) == 0 {
+		cl.short = cl.name
+	}
+	levels := make(map[Level]customLevel, len(current))
+	for l, c := range current {
+		levels[l] = c
+	}
+	levels[l] = cl
+	customLevels.Store(levels)
+}
+
+// rank returns the position of l among the levels, see above.
+func (l Level) rank() int {
+	if l >= customLevelBase {
+		return int(l - customLevelBase)
+	}
+	return int(l) * 10
+}
+
+// atLeast reports whether l is min or a more severe level, i.e. whether a
+// filter at min lets records at l through.
+func (l Level) atLeast(min Level) bool {
+	return l.rank() >= min.rank()
+}
+
+// above reports whether l is more severe than min.
+func (l Level) above(min Level) bool {
+	return l.rank() > min.rank()
+}
+
+// builtin returns the most severe built-in level that l is at least, for the
+// tables of per-level settings, e.g. colors.
+func (l Level) builtin() Level {
+	if l < customLevelBase {
+		return l
+	}
+	b := Level(l.rank() / 10)
+	if b > FATAL {
+		b = FATAL
+	}
+	return b
+}
+
+// configLevelName returns the name of lvl in configuration files.
+func configLevelName(lvl Level) string {
+	if lvl >= FINEST && lvl <= FATAL {
+		return levelConfigNames[lvl]
+	}
+	if cl, ok := lvl.custom(); ok {
+		return cl.name
+	}
+	return lvl.String()
+}
+
+// customConfigLevel returns the custom level called name.
+func customConfigLevel(name string) (Level, bool) {
+	levels, _ := customLevels.Load().(map[Level]customLevel)
+	for l, cl := range levels {
+		if cl.name == name {
+			return l, true
+		}
+	}
+	return 0, false
+}
+
+// splitLevelName returns the name of lvl in SplitFileLogWriter file names.
+func splitLevelName(lvl Level) string {
+	if lvl >= FINEST && lvl <= FATAL {
+		return splitLevelNames[lvl]
+	}
+	if cl, ok := lvl.custom(); ok {
+		return strings.ToLower(cl.name)
+	}
+	return "unknown"
+}
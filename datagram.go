@@ -0,0 +1,126 @@
+package log4go
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"unicode/utf8"
+)
+
+// DefaultMaxDatagramSize is the largest udp datagram a SocketLogWriter sends
+// unless SetMaxDatagramSize says otherwise: the largest udp payload over
+// IPv4.  Datagrams this large are fragmented, and often lost, on most
+// networks; 1400 or less fits the usual MTUs.
+var DefaultMaxDatagramSize = 65507
+
+// DatagramPolicy is what a SocketLogWriter does with the records too large
+// for a udp datagram, see SetMaxDatagramSize.
+type DatagramPolicy int
+
+const (
+	// DatagramTruncate shortens the message, ending it with a
+	// "…(truncated N bytes)" marker.
+	DatagramTruncate DatagramPolicy = iota
+
+	// DatagramSplit sends the message in several records, one per
+	// datagram, each ending with a "…(part i/n)" marker.
+	DatagramSplit
+)
+
+// SetMaxDatagramSize sets the largest udp datagram sent, e.g. 1400 to avoid
+// fragmentation (chainable), and what is done with the records that do not
+// fit: their message is truncated or split over several records.  A record
+// that does not fit even with a short message, e.g. because of its fields,
+// is dropped, reported and counted by Dropped.  Zero keeps
+// DefaultMaxDatagramSize.  tcp sockets ignore it.  Must be called before the
+// first log message is written.
+func (w *SocketLogWriter) SetMaxDatagramSize(max int, policy DatagramPolicy) *SocketLogWriter {
+	w.maxDatagram, w.datagramPolicy = max, policy
+	return w
+}
+
+// datagramSize returns the largest datagram w sends.
+func (w *SocketLogWriter) datagramSize() int {
+	if w.maxDatagram > 0 {
+		return w.maxDatagram
+	}
+	return DefaultMaxDatagramSize
+}
+
+// fitDatagrams returns the encodings of the records to send for rec, encoded
+// as js, in datagrams of at most max bytes.  It returns none if rec cannot
+// fit.
+func (w *SocketLogWriter) fitDatagrams(rec *LogRecord, js []byte, max int, hostport string) (recs []*LogRecord, encs [][]byte) {
+	if len(js) <= max {
+		return []*LogRecord{rec}, [][]byte{js}
+	}
+	overhead := len(js) - len(rec.Message)
+
+	if w.datagramPolicy == DatagramSplit {
+		// Leave room for the marker, and some escaping
+		for size := max - overhead - 32; size > 0; size -= size/4 + 1 {
+			recs, encs = w.splitRecord(rec, size, max, hostport)
+			if recs != nil {
+				return recs, encs
+			}
+		}
+	} else {
+		for keep := len(rec.Message) - (len(js) - max) - 32; keep > 0; keep -= keep/4 + 1 {
+			sent, enc, err := w.encode(truncateRecord(rec, keep), hostport)
+			if err != nil || enc == nil {
+				return nil, nil
+			}
+			if len(enc) <= max {
+				return []*LogRecord{sent}, [][]byte{enc}
+			}
+		}
+	}
+
+	w.overflow.drop(1)
+	reportError(fmt.Errorf("SocketLogWriter(%q): record of %d bytes does not fit a datagram of %d bytes, dropped", hostport, len(js), max))
+	return nil, nil
+}
+
+// splitRecord returns rec with its message split in parts of size bytes, and
+// their encodings, or nil if one of them is larger than max bytes.
+func (w *SocketLogWriter) splitRecord(rec *LogRecord, size, max int, hostport string) (recs []*LogRecord, encs [][]byte) {
+	var parts []string
+	for msg := rec.Message; len(msg) > 0; {
+		cut := size
+		if cut >= len(msg) {
+			cut = len(msg)
+		} else {
+			for cut > 0 && !utf8.RuneStart(msg[cut]) {
+				cut--
+			}
+			if cut == 0 {
+				return nil, nil
+			}
+		}
+		parts, msg = append(parts, msg[:cut]), msg[cut:]
+	}
+
+	for i, part := range parts {
+		r := *rec
+		r.Message = part + "…(part " + strconv.Itoa(i+1) + "/" + strconv.Itoa(len(parts)) + ")"
+		sent, enc, err := w.encode(&r, hostport)
+		if err != nil || enc == nil || len(enc) > max {
+			return nil, nil
+		}
+		recs, encs = append(recs, sent), append(encs, enc)
+	}
+	return recs, encs
+}
+
+// parseDatagramPolicy returns the policy named by a datagram_policy
+// property, "truncate" or "split".
+func parseDatagramPolicy(filename, name string) DatagramPolicy {
+	switch name {
+	case "", "truncate":
+	case "split":
+		return DatagramSplit
+	default:
+		fmt.Fprintf(os.Stderr, "LoadConfiguration: Warning: Unknown datagram_policy %q in %s, records will be truncated\n", name, filename)
+	}
+	return DatagramTruncate
+}
@@ -0,0 +1,16 @@
+// Package echolog provides Echo middleware logging requests and recovering
+// from panics through log4go, as package httplog does for net/http:
+//
+//	e := echo.New()
+//	e.Use(echolog.Logger("access"), echolog.Recover("panic"))
+//
+// The records are logged with httplog's Logger, with an explicit source, so
+// that they do not depend on the depth of the middleware chain, and to the
+// writers of the categories, whose overflow policies (see
+// log4go.OverflowPolicy) decide whether a slow writer blocks the requests.
+//
+// The Echo code is only built with the log4go_echo tag, so that programs not
+// using it do not build Echo.  The go.mod of log4go requires the version of
+// github.com/labstack/echo/v4 it is tested with; programs using it build with
+// -tags log4go_echo.
+package echolog
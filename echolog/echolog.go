@@ -0,0 +1,76 @@
+//go:build log4go_echo
+
+package echolog
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/jeanphorn/log4go"
+	"github.com/jeanphorn/log4go/httplog"
+	"github.com/labstack/echo/v4"
+)
+
+// Logger returns a middleware logging the requests to category of
+// log4go.Global, in the Combined format of httplog.
+func Logger(category string) echo.MiddlewareFunc {
+	return LoggerWith(httplog.New(log4go.LOGGER(category)))
+}
+
+// LoggerWith returns a middleware logging the requests with l, see
+// httplog.Logger.  As Echo's own logger does, it has the errors returned by
+// the handlers written by the HTTPErrorHandler of Echo, for their status to
+// be logged.
+func LoggerWith(l *httplog.Logger) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			if err := next(c); err != nil {
+				c.Error(err)
+			}
+			res := c.Response()
+			l.LogRequest(c.Request(), res.Status, res.Size, start)
+			return nil
+		}
+	}
+}
+
+// Recover returns a middleware recovering from the panics of the handlers
+// after it and logging them to category of log4go.Global, see RecoverWith.
+func Recover(category string) echo.MiddlewareFunc {
+	return RecoverWith(httplog.New(log4go.LOGGER(category)))
+}
+
+// RecoverWith returns a middleware recovering from the panics of the
+// handlers after it and logging them with l, at CRITICAL with their stack
+// trace, as httplog.Logger.Recover does.  The panic is then handled as an
+// error by the HTTPErrorHandler of Echo, a 500 by default, if the response
+// had not started; otherwise the response is aborted.  Use it after Logger
+// for the 500s to be logged by Logger.
+func RecoverWith(l *httplog.Logger) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			defer func() {
+				e := recover()
+				if e == nil {
+					return
+				}
+				if e == http.ErrAbortHandler {
+					panic(e)
+				}
+				l.LogPanic(c.Request(), e, debug.Stack())
+				if c.Response().Committed {
+					panic(http.ErrAbortHandler)
+				}
+				err, ok := e.(error)
+				if !ok {
+					err = fmt.Errorf("%v", e)
+				}
+				c.Error(err)
+			}()
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+//go:build log4go_echo
+
+package echolog
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jeanphorn/log4go"
+	"github.com/jeanphorn/log4go/httplog"
+	"github.com/labstack/echo/v4"
+)
+
+type recordingLogWriter struct {
+	records []*log4go.LogRecord
+}
+
+func (w *recordingLogWriter) LogWrite(rec *log4go.LogRecord) {
+	w.records = append(w.records, rec)
+}
+
+func (w *recordingLogWriter) Close() {}
+
+func TestMiddleware(t *testing.T) {
+	w := &recordingLogWriter{}
+	log := make(log4go.Logger)
+	log.AddFilter("http", log4go.DEBUG, w, "http")
+	l := httplog.New(log.LOGGER("http")).SetFormat(httplog.Structured)
+
+	e := echo.New()
+	e.Use(LoggerWith(l), RecoverWith(l))
+	e.GET("/users/:id", func(c echo.Context) error {
+		return c.String(http.StatusOK, "user "+c.Param("id"))
+	})
+	e.GET("/missing", func(c echo.Context) error {
+		return echo.NewHTTPError(http.StatusNotFound, "no such page")
+	})
+	e.GET("/panic", func(c echo.Context) error {
+		panic("boom")
+	})
+
+	for _, path := range []string{"/users/42", "/missing", "/panic"} {
+		e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	if len(w.records) != 4 {
+		t.Fatalf("got %d records, want 4", len(w.records))
+	}
+	if rec := w.records[0]; rec.Message != "GET /users/42 200" || rec.Fields["bytes"] != int64(len("user 42")) {
+		t.Errorf("got %q with %v", rec.Message, rec.Fields)
+	}
+	if rec := w.records[1]; rec.Message != "GET /missing 404" || rec.Level != log4go.WARNING {
+		t.Errorf("got %q at %v", rec.Message, rec.Level)
+	}
+	if rec := w.records[2]; rec.Level != log4go.CRITICAL || rec.Message != "panic serving GET /panic: boom" || !strings.Contains(rec.Stack, "echolog.TestMiddleware") {
+		t.Errorf("got %q at %v", rec.Message, rec.Level)
+	}
+	if rec := w.records[3]; rec.Message != "GET /panic 500" || rec.Level != log4go.ERROR {
+		t.Errorf("got %q at %v", rec.Message, rec.Level)
+	}
+}
@@ -0,0 +1,184 @@
+package log4go
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// Encrypted log files are a sequence of chunks, one per write.  Each chunk is
+// a 4-byte big-endian length followed by that many bytes of AES-GCM nonce and
+// sealed data.
+
+// maxEncryptedChunk bounds the chunk length accepted by the decrypter so that
+// a corrupted length prefix can't trigger a huge allocation.
+const maxEncryptedChunk = 64 << 20
+
+// A KeySource returns the AES key (16, 24 or 32 bytes) used to encrypt or
+// decrypt log files.
+type KeySource func() ([]byte, error)
+
+// EnvKeySource reads a hex encoded key from the environment variable name.
+func EnvKeySource(name string) KeySource {
+	return func() ([]byte, error) {
+		val := os.Getenv(name)
+		if len(val) == 0 {
+			return nil, fmt.Errorf("encryption key variable %s is empty", name)
+		}
+		return parseKey([]byte(val))
+	}
+}
+
+// FileKeySource reads the key from path.  The file may contain either the raw
+// key bytes or the key in hex.
+func FileKeySource(path string) KeySource {
+	return func() ([]byte, error) {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read encryption key %s fail %s", path, err)
+		}
+		return parseKey(data)
+	}
+}
+
+// parseKey accepts a hex encoded key, or else the raw key bytes.  Hex is
+// tried first, since a 32 character hex key is also 32 bytes long.
+func parseKey(data []byte) ([]byte, error) {
+	key, err := hex.DecodeString(string(bytes.TrimSpace(data)))
+	if err != nil {
+		switch len(data) {
+		case 16, 24, 32:
+			return data, nil
+		}
+		return nil, fmt.Errorf("encryption key is neither raw nor hex: %s", err)
+	}
+	switch len(key) {
+	case 16, 24, 32:
+		return key, nil
+	}
+	return nil, fmt.Errorf("encryption key must be 16, 24 or 32 bytes, got %d", len(key))
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealChunk encrypts p into a length-prefixed chunk.
+func sealChunk(aead cipher.AEAD, p []byte) ([]byte, error) {
+	size := aead.NonceSize() + len(p) + aead.Overhead()
+	chunk := make([]byte, 4+aead.NonceSize(), 4+size)
+	binary.BigEndian.PutUint32(chunk, uint32(size))
+	if _, err := io.ReadFull(rand.Reader, chunk[4:]); err != nil {
+		return nil, err
+	}
+	return aead.Seal(chunk, chunk[4:], p, nil), nil
+}
+
+// DecryptLogFile reads an encrypted log from r and writes the plain text log
+// to w.
+func DecryptLogFile(r io.Reader, w io.Writer, key []byte) error {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return err
+	}
+	return decryptChunks(r, w, aead)
+}
+
+func decryptChunks(r io.Reader, w io.Writer, aead cipher.AEAD) error {
+	var prefix [4]byte
+	for {
+		if _, err := io.ReadFull(r, prefix[:]); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return fmt.Errorf("DecryptLogFile: truncated chunk length: %s", err)
+		}
+		size := binary.BigEndian.Uint32(prefix[:])
+		if size < uint32(aead.NonceSize()+aead.Overhead()) || size > maxEncryptedChunk {
+			return fmt.Errorf("DecryptLogFile: invalid chunk length %d", size)
+		}
+		chunk := make([]byte, size)
+		if _, err := io.ReadFull(r, chunk); err != nil {
+			return fmt.Errorf("DecryptLogFile: truncated chunk: %s", err)
+		}
+		plain, err := aead.Open(nil, chunk[:aead.NonceSize()], chunk[aead.NonceSize():], nil)
+		if err != nil {
+			return errors.New("DecryptLogFile: chunk authentication failed")
+		}
+		if _, err := w.Write(plain); err != nil {
+			return err
+		}
+	}
+}
+
+// SetEncryptionKey enables AES-GCM encryption of everything subsequently
+// written to the log file.  It must be called before the first log message
+// is written and before SetHeadFoot.  Unlike the other Set* methods it is not
+// chainable, since silently falling back to plain text on a bad key is not
+// acceptable.
+//
+// The file was already opened by NewFileLogWriter.  If it holds anything but
+// data encrypted with the same key, e.g. the plain text log of an earlier
+// run, appending would make it undecryptable: with rotation enabled the file
+// is rotated away first, otherwise an error is returned.
+func (w *FileLogWriter) SetEncryptionKey(key []byte) error {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return fmt.Errorf("FileLogWriter(%q): %s", w.filename, err)
+	}
+	if err := w.flush(); err != nil {
+		return fmt.Errorf("FileLogWriter(%q): %s", w.filename, err)
+	}
+	if w.file == nil || encryptedWith(w.filename, aead) {
+		w.aead = aead
+		return nil
+	}
+	if !w.keepsBackups() {
+		return fmt.Errorf("FileLogWriter(%q): refusing to append encrypted data to a file that is not encrypted with this key", w.filename)
+	}
+
+	// Leave the old file as it is, without a trailer, and start a new one
+	w.closeFile()
+	w.file = nil
+	w.aead = aead
+	if err := w.intRotate(); err != nil {
+		return fmt.Errorf("FileLogWriter(%q): %s", w.filename, err)
+	}
+	return nil
+}
+
+// encryptedWith reports whether fname is empty or holds only data encrypted
+// with aead.
+func encryptedWith(fname string, aead cipher.AEAD) bool {
+	fd, err := os.Open(fname)
+	if err != nil {
+		return false
+	}
+	defer fd.Close()
+	if fi, err := fd.Stat(); err != nil || fi.Size() == 0 {
+		return err == nil
+	}
+	return decryptChunks(bufio.NewReader(fd), ioutil.Discard, aead) == nil
+}
+
+// SetEncryptionKeySource is like SetEncryptionKey but fetches the key from src.
+func (w *FileLogWriter) SetEncryptionKeySource(src KeySource) error {
+	key, err := src()
+	if err != nil {
+		return fmt.Errorf("FileLogWriter(%q): %s", w.filename, err)
+	}
+	return w.SetEncryptionKey(key)
+}
@@ -0,0 +1,77 @@
+package log4go
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// LevelEnv is the environment variable overriding the level of every
+// category, e.g. LOG4GO_LEVEL=DEBUG.  The level of one category is
+// overridden by LevelEnv + "_" + the category in upper case with other
+// characters than letters and digits replaced by "_", e.g.
+// LOG4GO_LEVEL_API_DB=DEBUG for "api.db", which takes precedence.  They let
+// support engineers turn on DEBUG for a container through its deployment
+// environment, without changing the configuration files.
+//
+// The overrides apply to the default Global logger, to the categories of a
+// configuration once it is loaded, and to the filters added by AddFilter.
+// Writers added with AddWriter, or by repeating a category in a
+// configuration, keep their own levels, except those that were at the level
+// of the category, which follow the override.
+var LevelEnv = "LOG4GO_LEVEL"
+
+// envLevelName returns the environment variable overriding the level of
+// category.
+func envLevelName(category string) string {
+	name := []byte(strings.ToUpper(category))
+	for i, c := range name {
+		if (c < 'A' || c > 'Z') && (c < '0' || c > '9') {
+			name[i] = '_'
+		}
+	}
+	return LevelEnv + "_" + string(name)
+}
+
+// envLevel returns the level that the environment sets for category.
+func envLevel(category string) (Level, bool) {
+	for _, name := range []string{envLevelName(category), LevelEnv} {
+		value, ok := os.LookupEnv(name)
+		if !ok || len(value) == 0 {
+			continue
+		}
+		lvl, err := ParseLevel(value)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "log4go: Warning: %s in %s, ignored\n", err, name)
+			continue
+		}
+		return lvl, true
+	}
+	return 0, false
+}
+
+// applyEnvLevels overrides the levels of the filters of the logger with
+// those set in the environment.
+func (log Logger) applyEnvLevels() {
+	names, filters := log.snapshot()
+	for i, filt := range filters {
+		filt.applyEnvLevel(names[i])
+	}
+}
+
+// applyEnvLevel overrides the level of f, registered as name, with the one
+// set in the environment.
+func (f *Filter) applyEnvLevel(name string) {
+	lvl, ok := envLevel(name)
+	if !ok {
+		return
+	}
+	if fw, ok := f.LogWriter.(*fanoutWriter); ok {
+		for _, inner := range fw.filters {
+			if inner.level() == f.level() {
+				inner.setLevel(lvl)
+			}
+		}
+	}
+	f.setLevel(lvl)
+}
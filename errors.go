@@ -0,0 +1,83 @@
+package log4go
+
+import (
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// ErrorKey is the field under which WithError attaches an error.
+const ErrorKey = "error"
+
+// errorStacks is non-zero when records carrying an error at ERROR or above
+// capture the stack of the logging call.
+var errorStacks int32
+
+// SetErrorStacks enables or disables capturing the stack trace of the logging
+// call for records at ERROR and above that carry an error (see WithError).
+// The trace is written by %K and included as "stack" in JSON output.
+func SetErrorStacks(enable bool) {
+	var v int32
+	if enable {
+		v = 1
+	}
+	atomic.StoreInt32(&errorStacks, v)
+}
+
+// WithError returns a copy of the filter that attaches err, as the field
+// ErrorKey, to every record it logs.
+func (f *Filter) WithError(err error) *Filter {
+	return f.WithFields(Fields{ErrorKey: err})
+}
+
+// Errorw logs a message at the error level with err attached, see WithError
+// and Error.
+func (f *Filter) Errorw(err error, arg0 interface{}, args ...interface{}) {
+	f.WithError(err).intLogf(ERROR, formatArgs(arg0, args...))
+}
+
+// formatArgs builds the message of the Filter logging methods from their
+// arguments.
+func formatArgs(arg0 interface{}, args ...interface{}) string {
+	switch first := arg0.(type) {
+	case string:
+		// Use the string as a format string
+		return fmt.Sprintf(first, args...)
+	case func() string:
+		// Call the closure (no other arguments used)
+		return first()
+	}
+	// Build a format string so that it will be similar to Sprint
+	return fmt.Sprintf(fmt.Sprint(arg0)+strings.Repeat(" %v", len(args)), args...)
+}
+
+// errorStack returns the stack trace starting skip frames above its caller,
+// as in runtime.Caller, if lvl and fields call for one.
+func errorStack(lvl Level, fields Fields, skip int) string {
+	if !lvl.atLeast(ERROR) || atomic.LoadInt32(&errorStacks) == 0 {
+		return ""
+	}
+	if _, ok := fields[ErrorKey].(error); !ok {
+		return ""
+	}
+
+	pcs := make([]uintptr, 32)
+	pcs = pcs[:runtime.Callers(skip+2, pcs)]
+	frames := runtime.CallersFrames(pcs)
+	var out strings.Builder
+	for {
+		frame, more := frames.Next()
+		out.WriteString(frame.Function)
+		out.WriteString("\n\t")
+		out.WriteString(frame.File)
+		out.WriteByte(':')
+		out.WriteString(strconv.Itoa(frame.Line))
+		out.WriteByte('\n')
+		if !more {
+			break
+		}
+	}
+	return out.String()
+}
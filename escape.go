@@ -0,0 +1,113 @@
+package log4go
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// An EscapeMode decides how messages are escaped before they are formatted,
+// e.g. to stop user input from forging extra log lines.
+type EscapeMode int
+
+const (
+	EscapeNone    EscapeMode = iota // Messages are written as they are
+	EscapeNewline                   // Newlines are written as \n (SetSanitize)
+	EscapeControl                   // All control characters are escaped
+	EscapeQuote                     // Messages are written as Go quoted strings
+)
+
+var escapeModeNames = [...]string{"none", "newline", "control", "quote"}
+
+func (m EscapeMode) String() string {
+	if m < 0 || int(m) >= len(escapeModeNames) {
+		return "unknown"
+	}
+	return escapeModeNames[m]
+}
+
+// ParseEscapeMode returns the EscapeMode called name ("none", "newline",
+// "control" or "quote").
+func ParseEscapeMode(name string) (EscapeMode, error) {
+	for i, n := range escapeModeNames {
+		if n == name {
+			return EscapeMode(i), nil
+		}
+	}
+	return EscapeNone, fmt.Errorf("unknown escape mode %q", name)
+}
+
+// Escape returns msg escaped according to m.
+func (m EscapeMode) Escape(msg string) string {
+	switch m {
+	case EscapeNewline:
+		return strings.Replace(msg, "\n", "\\n", -1)
+	case EscapeControl:
+		return escapeControl(msg)
+	case EscapeQuote:
+		return strconv.Quote(msg)
+	}
+	return msg
+}
+
+// escapeControl replaces control characters in msg with Go escapes, leaving
+// everything else, quotes and backslashes included, alone.
+func escapeControl(msg string) string {
+	clean := true
+	for _, r := range msg {
+		if unicode.IsControl(r) {
+			clean = false
+			break
+		}
+	}
+	if clean {
+		return msg
+	}
+
+	var out strings.Builder
+	out.Grow(len(msg) + 8)
+	for _, r := range msg {
+		switch {
+		case r == '\n':
+			out.WriteString(`\n`)
+		case r == '\r':
+			out.WriteString(`\r`)
+		case r == '\t':
+			out.WriteString(`\t`)
+		case r < utf8.RuneSelf && unicode.IsControl(r):
+			fmt.Fprintf(&out, `\x%02x`, r)
+		case unicode.IsControl(r):
+			fmt.Fprintf(&out, `\u%04x`, r)
+		default:
+			out.WriteRune(r)
+		}
+	}
+	return out.String()
+}
+
+// escapeRecord returns rec with its message escaped, copying it if needed so
+// that records shared with other writers are left alone.
+func escapeRecord(rec *LogRecord, m EscapeMode) *LogRecord {
+	if m == EscapeNone {
+		return rec
+	}
+	escaped := *rec
+	escaped.Message = m.Escape(rec.Message)
+	return &escaped
+}
+
+// parseEscape parses the "escape" config value.  An empty value means fallback.
+func parseEscape(loader, filename, value string, fallback EscapeMode) EscapeMode {
+	if len(value) == 0 {
+		return fallback
+	}
+	m, err := ParseEscapeMode(value)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: Warning: %s in %s, using %q\n", loader, err, filename, fallback)
+		return fallback
+	}
+	return m
+}
@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"time"
 )
 
 import l4g "log4go"
@@ -43,10 +42,8 @@ func main() {
 		log.Info(message)
 	}
 
-	//HACK. The system will lose the last few log messages due to a sync error. In this
-	//example program, there are only a  few messages, so it loses everything (at least
-	//on my system. This sleep preserves those messages.
-	time.Sleep(2 * time.Second)
+	// Wait for the messages to be written
+	log.Flush()
 
 	// Close the log
 	log.Close()
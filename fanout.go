@@ -0,0 +1,82 @@
+package log4go
+
+import "sync/atomic"
+
+// AddWriter adds writer to the writers of category, with lvl as its own
+// minimum level, so that a category can fan out to several writers, e.g.
+// everything to a file at DEBUG and only ERROR and above to an alerting
+// sink:
+//
+//	log.AddFilter("api", log.DEBUG, fileWriter, "api")
+//	log.AddWriter("api", log.ERROR, alertWriter)
+//
+// Without a filter for category, it is the same as AddFilter(category, lvl,
+// writer, category).  SetLevel(category) then sets the minimum level of the
+// category as a whole, which each writer raises with its own.  Handles
+// returned by LOGGER before the call write to the new writer too.  Returns
+// the logger for chaining.
+func (log Logger) AddWriter(category string, lvl Level, writer LogWriter) Logger {
+	log.add(category, &Filter{Level: lvl, LogWriter: writer, Category: category})
+	return log
+}
+
+// add registers filt as the filter called name or, if there is one already,
+// adds the writer of filt to it.
+func (log Logger) add(name string, filt *Filter) {
+	loggerMu.Lock()
+	defer loggerMu.Unlock()
+	if old, ok := log[name]; ok {
+		filt = old.fanout(filt)
+	}
+	log[name] = filt
+	atomic.AddUint64(&loggerGen, 1)
+}
+
+// fanout returns a filter writing to the writers of f and of g, at their own
+// levels.  f is left unchanged, for handles using it.
+func (f *Filter) fanout(g *Filter) *Filter {
+	var filters []*Filter
+	if fw, ok := f.LogWriter.(*fanoutWriter); ok {
+		filters = append(filters, fw.filters...)
+	} else {
+		filters = append(filters, &Filter{Level: f.level(), LogWriter: f.LogWriter, Category: f.Category})
+	}
+	filters = append(filters, g)
+
+	lvl := g.level()
+	if f.level().rank() < lvl.rank() {
+		lvl = f.level()
+	}
+	merged := &Filter{Level: lvl, LogWriter: &fanoutWriter{filters}, Category: f.Category, fields: f.fields, nosource: atomic.LoadUint32(&f.nosource)}
+	merged.limiter.Store(f.rateLimiter())
+	return merged
+}
+
+// fanoutWriter writes the records of a category to several writers, each
+// behind the level of its filter.
+type fanoutWriter struct {
+	filters []*Filter
+}
+
+func (w *fanoutWriter) LogWrite(rec *LogRecord) {
+	for _, filt := range w.filters {
+		if rec.Level.atLeast(filt.level()) {
+			filt.LogWrite(rec)
+		}
+	}
+}
+
+func (w *fanoutWriter) Close() {
+	for _, filt := range w.filters {
+		filt.Close()
+	}
+}
+
+// Flush flushes every writer that is a Flusher.
+func (w *fanoutWriter) Flush() {
+	for _, filt := range w.filters {
+		if f, ok := filt.LogWriter.(Flusher); ok {
+			f.Flush()
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package log4go
+
+import (
+	"fmt"
+	"os"
+)
+
+// exit ends the program after Fatal, replaced by tests.
+var exit = os.Exit
+
+// Fatal logs its arguments, formatted as by fmt.Sprint, at the FATAL level,
+// waits for the writers to write everything queued, and then exits the
+// program with status 1, like Fatal of the standard log package.
+func (f *Filter) Fatal(args ...interface{}) {
+	f.intLogf(FATAL, "%s", fmt.Sprint(args...))
+	f.flush()
+	exit(1)
+}
+
+// Fatalf is Fatal with a format string.
+func (f *Filter) Fatalf(format string, args ...interface{}) {
+	f.intLogf(FATAL, format, args...)
+	f.flush()
+	exit(1)
+}
+
+// Panic logs its arguments, formatted as by fmt.Sprint, at the PANIC level,
+// waits for the writers to write everything queued, and then panics with
+// the message, like Panic of the standard log package.
+func (f *Filter) Panic(args ...interface{}) {
+	msg := fmt.Sprint(args...)
+	f.intLogf(PANIC, "%s", msg)
+	f.flush()
+	panic(msg)
+}
+
+// Panicf is Panic with a format string.
+func (f *Filter) Panicf(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	f.intLogf(PANIC, "%s", msg)
+	f.flush()
+	panic(msg)
+}
+
+// flush waits for the writer of f and the "stdout" filter it also writes to.
+func (f *Filter) flush() {
+	cur := f.current()
+	flushFilter(cur.registered(), cur.LogWriter)
+	if stdout := cur.stdout(); stdout != nil {
+		flushFilter(stdout, stdout.LogWriter)
+	}
+}
+
+// flushFilter flushes w, the writer of the filter filt of a Logger, unless
+// filt is retired.
+func flushFilter(filt *Filter, w LogWriter) {
+	if !filt.acquire() {
+		return
+	}
+	if fl, ok := w.(Flusher); ok {
+		fl.Flush()
+	}
+	filt.release()
+}
+
+// Fatal logs its arguments, formatted as by fmt.Sprint, at the FATAL level,
+// flushes the logger, and then exits the program with status 1.
+func (log Logger) Fatal(args ...interface{}) {
+	log.intLogf(FATAL, "%s", fmt.Sprint(args...))
+	log.Flush()
+	exit(1)
+}
+
+// Fatalf is Fatal with a format string.
+func (log Logger) Fatalf(format string, args ...interface{}) {
+	log.intLogf(FATAL, format, args...)
+	log.Flush()
+	exit(1)
+}
+
+// Panic logs its arguments, formatted as by fmt.Sprint, at the PANIC level,
+// flushes the logger, and then panics with the message.
+func (log Logger) Panic(args ...interface{}) {
+	msg := fmt.Sprint(args...)
+	log.intLogf(PANIC, "%s", msg)
+	log.Flush()
+	panic(msg)
+}
+
+// Panicf is Panic with a format string.
+func (log Logger) Panicf(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	log.intLogf(PANIC, "%s", msg)
+	log.Flush()
+	panic(msg)
+}
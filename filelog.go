@@ -3,16 +3,24 @@
 package log4go
 
 import (
+	"bufio"
+	"crypto/cipher"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
 	"time"
 	"strings"
+	"sync"
 )
 
 // This log writer sends output to a file
 type FileLogWriter struct {
-	rec chan *LogRecord
-	rot chan bool
+	rec  chan *LogRecord
+	rot  chan chan error
+	done chan struct{} // closed when the writer goroutine has finished
 
 	// The opened file
 	filename string
@@ -21,6 +29,12 @@ type FileLogWriter struct {
 	// The logging format
 	format string
 
+	// The time codes of the last second formatted, for the writer goroutine
+	timeCache *formatCacheType
+
+	// Formats records instead of format when set (e.g. JSON)
+	formatter Formatter
+
 	// File header/trailer
 	header, trailer string
 
@@ -33,25 +47,84 @@ type FileLogWriter struct {
 	maxsize_cursize int
 
 	// Rotate daily
-	daily          bool
-	daily_opendate int
+	daily bool
+
+	// When the current file was opened
+	opened time.Time
+
+	// Decides when to rotate and how backups are named
+	policy RotationPolicy
 
 	// Keep old logfiles (.001, .002, etc)
 	rotate    bool
 	maxbackup int
 
-	// Sanitize newlines to prevent log injection
-	sanitize	bool
+	// Name backups by rotation time (.20240615-130501.123) instead
+	timestamp bool
+
+	// Escape messages, e.g. newlines to prevent log injection
+	escape EscapeMode
+
+	// Truncate longer messages (0 if unlimited)
+	maxMessage int
+
+	// Write records without the trailing newline
+	raw bool
+
+	// Format times in UTC instead of local time
+	utc bool
+
+	// Encrypt everything written to the file (nil if disabled)
+	aead cipher.AEAD
+
+	// Hash chain records for tamper evidence (nil if disabled)
+	audit *auditor
+
+	// Buffer writes and flush them at least this often (0 if unbuffered)
+	flushInterval time.Duration
+	buf           *bufio.Writer
+
+	// Compress rotated backups (nil if disabled)
+	compress    *backupCompressor
+	compressing sync.WaitGroup
+
+	// What LogWrite does when rec is full
+	overflow overflow
+
+	// The queues records are formatted from in parallel (nil for rec alone),
+	// see SetShards
+	shards *shardedQueue
 }
 
-// This is the FileLogWriter's output method
+// This is the FileLogWriter's output method.  When the queue is full, it
+// blocks or drops a record according to the overflow policy.
 func (w *FileLogWriter) LogWrite(rec *LogRecord) {
-	w.rec <- rec
+	if w.shards != nil {
+		w.shards.send(rec, &w.overflow)
+		return
+	}
+	w.overflow.send(w.rec, rec)
 }
 
+// Flush blocks until the records queued before the call are written to the
+// file, including any held in the SetFlushInterval buffer.
+func (w *FileLogWriter) Flush() {
+	if w.shards != nil {
+		w.shards.flush(w.done)
+		return
+	}
+	flushQueue(w.rec, w.done)
+}
+
+// Close writes the trailer, closes the file and waits for it and any backup
+// still being compressed to be finished.
 func (w *FileLogWriter) Close() {
-	close(w.rec)
-	w.file.Sync()
+	if w.shards != nil {
+		w.shards.close()
+	} else {
+		close(w.rec)
+	}
+	<-w.done
 }
 
 // NewFileLogWriter creates a new LogWriter which writes to the given file and
@@ -66,65 +139,100 @@ func (w *FileLogWriter) Close() {
 func NewFileLogWriter(fname string, rotate bool, daily bool) *FileLogWriter {
 	w := &FileLogWriter{
 		rec:       make(chan *LogRecord, LogBufferLength),
-		rot:       make(chan bool),
+		rot:       make(chan chan error),
+		done:      make(chan struct{}),
 		filename:  fname,
 		format:    "[%D %T] [%L] (%S) %M",
 		daily:     daily,
 		rotate:    rotate,
 		maxbackup: 999,
-		sanitize:  false, // set to false so as not to break compatibility
+		escape:    EscapeNone, // set to none so as not to break compatibility
 	}
+	w.policy = stdRotation{w}
 	// open the file for the first time
 	if err := w.intRotate(); err != nil {
 		fmt.Fprintf(os.Stderr, "FileLogWriter(%q): %s\n", w.filename, err)
 		return nil
 	}
 
+	queue := w.rec // the goroutine's copy, see SetBufferLength
 	go func() {
-		defer recoverPanic()
+		var (
+			flush  flushTicker
+			shards *shardedQueue
+		)
+		defer close(w.done)
+		defer recoverWriter("FileLogWriter", w.filename)
 		defer func() {
+			flush.stop()
 			if w.file != nil {
-				fmt.Fprint(w.file, FormatLogRecord(w.trailer, &LogRecord{Created: time.Now()}))
-				w.file.Close()
+				w.write(FormatLogRecord(w.trailer, w.markerRecord()))
+				w.writeCheckpoint()
+				w.flush()
+				w.file.Sync()
+				w.closeFile()
 			}
+			// Only this goroutine starts compressions, so none can be added now
+			w.compressing.Wait()
 		}()
 
 		for {
 			select {
-			case <-w.rot:
-				if err := w.intRotate(); err != nil {
+			case <-flush.C():
+				if err := w.flush(); err != nil {
 					fmt.Fprintf(os.Stderr, "FileLogWriter(%q): %s\n", w.filename, err)
-					return
 				}
-			case rec, ok := <-w.rec:
+			case done := <-w.rot:
+				// A failed rotation keeps writing to the current file, so
+				// that it can be retried
+				err := w.intRotate()
+				if done != nil {
+					done <- err
+				}
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "FileLogWriter(%q): %s\n", w.filename, err)
+				}
+			case rec, ok := <-queue:
 				if !ok {
 					return
 				}
-				now := time.Now()
-				if (w.maxlines > 0 && w.maxlines_curlines >= w.maxlines) ||
-					(w.maxsize > 0 && w.maxsize_cursize >= w.maxsize) ||
-					(w.daily && now.Day() != w.daily_opendate) {
-					if err := w.intRotate(); err != nil {
+				if rec == nil {
+					// SetBufferLength replaced the channel
+					queue = w.rec
+					continue
+				}
+				if rec == shardsSet {
+					// The records come from the shards from now on
+					shards, queue = w.shards, nil
+					continue
+				}
+				if rec.flushed != nil {
+					// Flush: the records queued before rec are written
+					if err := w.flush(); err != nil {
 						fmt.Fprintf(os.Stderr, "FileLogWriter(%q): %s\n", w.filename, err)
-						return
 					}
+					close(rec.flushed)
+					continue
 				}
-
-				// Sanitize newlines
-				if w.sanitize {
-					rec.Message = strings.Replace(rec.Message, "\n", "\\n", -1)
-				}
-
-				// Perform the write
-				n, err := fmt.Fprint(w.file, FormatLogRecord(w.format, rec))
-				if err != nil {
-					fmt.Fprintf(os.Stderr, "FileLogWriter(%q): %s\n", w.filename, err)
+				flush.start(w.flushInterval)
+				w.writeRecord(rec)
+			case r, ok := <-shards.outC():
+				if !ok {
+					// Closed, and the records before are written
 					return
 				}
-
-				// Update the counts
-				w.maxlines_curlines++
-				w.maxsize_cursize += n
+				shards.received()
+				if r.rec.flushed != nil {
+					if err := w.flush(); err != nil {
+						fmt.Fprintf(os.Stderr, "FileLogWriter(%q): %s\n", w.filename, err)
+					}
+					close(r.rec.flushed)
+					continue
+				}
+				flush.start(w.flushInterval)
+				if r.ok {
+					w.writeShardRecord(r)
+				}
 			}
 		}
 	}()
@@ -132,64 +240,149 @@ func NewFileLogWriter(fname string, rotate bool, daily bool) *FileLogWriter {
 	return w
 }
 
+// writeRecord writes rec to the file, rotating it first if needed.  A panic,
+// e.g. in the formatter or the rotation policy, drops rec, see
+// recoverWriter.
+func (w *FileLogWriter) writeRecord(rec *LogRecord) {
+	defer recoverWriter("FileLogWriter", w.filename)
+	w.writeFormatted(rec, w.formatRecord(rec, &w.timeCache))
+}
+
+// writeFormatted writes s, rec as formatted, to the file, rotating it first if
+// needed.
+func (w *FileLogWriter) writeFormatted(rec *LogRecord, s string) {
+	if w.file == nil || w.policy.ShouldRotate(rec, w.stats()) {
+		if err := w.intRotate(); err != nil {
+			fmt.Fprintf(os.Stderr, "FileLogWriter(%q): %s\n", w.filename, err)
+			countWriteError()
+		}
+	}
+	if w.file == nil {
+		// The file could not be reopened, drop the record
+		return
+	}
+
+	// Perform the write
+	n, err := w.write(s)
+	countBytesWritten(uint64(n))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "FileLogWriter(%q): %s\n", w.filename, err)
+		countWriteError()
+		return
+	}
+
+	// Update the counts
+	w.maxlines_curlines++
+	w.maxsize_cursize += n
+	written(w, rec)
+}
+
+// write sends s to the open file, chaining it in audit mode, and returns the
+// number of bytes written to disk.
+func (w *FileLogWriter) write(s string) (int, error) {
+	if w.audit != nil && len(s) > 0 {
+		s = w.audit.chain(s)
+	}
+	return w.writeRaw(s)
+}
+
+// writeRaw sends s to the open file, encrypting it first if encryption is
+// enabled, and returns the number of bytes written to disk.
+func (w *FileLogWriter) writeRaw(s string) (int, error) {
+	if w.flushInterval > 0 && w.buf == nil {
+		w.buf = bufio.NewWriterSize(w.file, DefaultFlushBufferSize)
+	}
+	if w.aead == nil {
+		if w.buf != nil {
+			return w.buf.WriteString(s)
+		}
+		return w.file.WriteString(s)
+	}
+	if len(s) == 0 {
+		return 0, nil
+	}
+	chunk, err := sealChunk(w.aead, []byte(s))
+	if err != nil {
+		return 0, err
+	}
+	if w.buf != nil {
+		return w.buf.Write(chunk)
+	}
+	return w.file.Write(chunk)
+}
+
+// flush writes out any buffered data.
+func (w *FileLogWriter) flush() error {
+	if w.buf == nil {
+		return nil
+	}
+	return w.buf.Flush()
+}
+
+// closeFile flushes and closes the open file.
+func (w *FileLogWriter) closeFile() {
+	if err := w.flush(); err != nil {
+		fmt.Fprintf(os.Stderr, "FileLogWriter(%q): %s\n", w.filename, err)
+	}
+	w.buf = nil
+	w.file.Close()
+}
+
 // Request that the logs rotate
 func (w *FileLogWriter) Rotate() {
-	w.rot <- true
+	select {
+	case w.rot <- nil:
+	case <-w.done:
+	}
+}
+
+// RotateNow rotates the logs and waits for the rotation to complete, returning
+// any error it produced.  Records queued before the call may be written either
+// before or after the rotation.  After a failed rotation the writer keeps
+// appending to the current file, and RotateNow may be called again.
+func (w *FileLogWriter) RotateNow() error {
+	done := make(chan error, 1)
+	select {
+	case w.rot <- done:
+	case <-w.done:
+		return fmt.Errorf("FileLogWriter(%q): closed", w.filename)
+	}
+	return <-done
 }
 
 // If this is called in a threaded context, it MUST be synchronized
 func (w *FileLogWriter) intRotate() error {
 	// Close any log file that may be open
-	if w.file != nil {
-		fmt.Fprint(w.file, FormatLogRecord(w.trailer, &LogRecord{Created: time.Now()}))
-		w.file.Close()
-	}
-	// If we are keeping log files, move it to the next available number
-	if w.rotate {
-		info, err := os.Stat(w.filename)
-		// _, err = os.Lstat(w.filename)
-
-		if err == nil { // file exists
-			// Find the next available number
-			modifiedtime := info.ModTime()
-			w.daily_opendate = modifiedtime.Day()
-			num := 1
-			fname := ""
-			if w.daily && time.Now().Day() != w.daily_opendate {
-				modifieddate := modifiedtime.Format("2006-01-02")
-				// for ; err == nil && num <= w.maxbackup; num++ {
-				// 	fname = w.filename + fmt.Sprintf(".%s.%03d", yesterday, num)
-				// 	_, err = os.Lstat(fname)
-				// }
-				// if err == nil {
-				// 	return fmt.Errorf("Rotate: Cannot find free log number to rename %s\n", w.filename)
-				// }
-				fname = w.filename + fmt.Sprintf(".%s", modifieddate)
-				w.file.Close()
+	rotating := w.file != nil
+	if rotating {
+		w.write(FormatLogRecord(w.trailer, w.markerRecord()))
+		w.writeCheckpoint()
+		w.closeFile()
+		w.file = nil
+	}
+	// Backups being compressed must be finished before they are shifted
+	w.compressing.Wait()
+
+	// If we are keeping log files, move it to the name the policy chooses.  If
+	// that fails the file is reopened and appended to.
+	var rotateErr error
+	if w.keepsBackups() {
+		if _, err := os.Stat(w.filename); err == nil { // file exists
+			if fname := w.policy.NextName(w.filename); fname != "" {
 				// Rename the file to its newfound home
-				err = os.Rename(w.filename, fname)
-				if err != nil {
-					return fmt.Errorf("Rotate: %s\n", err)
-				}
-			} else if !w.daily {
-				num = w.maxbackup - 1
-				for ; num >= 1; num-- {
-					fname = w.filename + fmt.Sprintf(".%d", num)
-					nfname := w.filename + fmt.Sprintf(".%d", num+1)
-					_, err = os.Lstat(fname)
-					if err == nil {
-						os.Rename(fname, nfname)
+				if err := os.Rename(w.filename, fname); err != nil {
+					rotateErr = fmt.Errorf("Rotate: %s", err)
+				} else {
+					// Prune once the new backup is compressed, so that a
+					// backup and its half-written compressed copy never
+					// count as two, nor is one deleted under the compressor
+					prune := func() {}
+					if _, ok := w.policy.(stdRotation); ok && w.timestamp {
+						prune = w.pruneTimestampBackups
 					}
-				}
-				w.file.Close()
-				// Rename the file to its newfound home
-				err = os.Rename(w.filename, fname)
-				// return error if the last file checked still existed
-				if err != nil {
-					return fmt.Errorf("Rotate: %s\n", err)
+					w.compressBackup(fname, prune)
 				}
 			}
-
 		}
 	}
 
@@ -199,24 +392,101 @@ func (w *FileLogWriter) intRotate() error {
 		return err
 	}
 	w.file = fd
+	if w.audit != nil {
+		w.audit.reset()
+	}
 
-	now := time.Now()
-	fmt.Fprint(w.file, FormatLogRecord(w.header, &LogRecord{Created: now}))
+	w.write(FormatLogRecord(w.header, w.markerRecord()))
 
-	// Set the daily open date to the current date
-	w.daily_opendate = now.Day()
+	// Remember when the file was opened for daily rotation
+	w.opened = time.Now()
 
 	// initialize rotation values
 	w.maxlines_curlines = 0
 	w.maxsize_cursize = 0
 
-	return nil
+	if rotating {
+		countRotation()
+	}
+	return rotateErr
+}
+
+// stats reports the current file's counters to the rotation policy.
+func (w *FileLogWriter) stats() RotationStats {
+	return RotationStats{
+		Filename: w.filename,
+		Lines:    w.maxlines_curlines,
+		Size:     w.maxsize_cursize,
+		Opened:   w.opened,
+	}
+}
+
+// markerRecord returns the record the header and trailer are formatted with.
+func (w *FileLogWriter) markerRecord() *LogRecord {
+	now := time.Now()
+	if w.utc {
+		now = now.UTC()
+	}
+	return &LogRecord{Created: now}
+}
+
+// formatRecord renders rec with the formatter if one is set, otherwise with
+// the pattern format, keeping the time codes in cache.
+func (w *FileLogWriter) formatRecord(rec *LogRecord, cache **formatCacheType) string {
+	if w.utc {
+		rec = utcRecord(rec)
+	}
+	rec = escapeRecord(truncateRecord(rec, w.maxMessage), w.escape)
+	var s string
+	if w.formatter != nil {
+		s = string(w.formatter.Format(rec))
+	} else if len(w.format) > 0 {
+		buf := formatBuffers.Get().(*[]byte)
+		b := appendFormat((*buf)[:0], w.format, rec, cache)
+		s = string(b)
+		putFormatBuffer(buf, b)
+	}
+	if w.raw {
+		s = strings.TrimSuffix(s, "\n")
+	}
+	return s
 }
 
 // Set the logging format (chainable).  Must be called before the first log
 // message is written.
 func (w *FileLogWriter) SetFormat(format string) *FileLogWriter {
 	w.format = format
+	cachedPattern(format) // compile now, so %g has goroutines from the start
+	return w
+}
+
+// SetFormatter sets a custom Formatter used instead of the pattern format
+// (chainable).  A nil Formatter restores the pattern format.  Must be called
+// before the first log message is written.
+func (w *FileLogWriter) SetFormatter(f Formatter) *FileLogWriter {
+	w.formatter = f
+	return w
+}
+
+// SetLogfmt switches between logfmt output (see LogfmtFormatter) and the
+// pattern format (chainable).  Must be called before the first log message is
+// written.
+func (w *FileLogWriter) SetLogfmt(enable bool) *FileLogWriter {
+	w.formatter = nil
+	if enable {
+		w.formatter = NewLogfmtFormatter()
+	}
+	return w
+}
+
+// SetJSON switches between JSON output (one object per line, see
+// JSONFormatter) and the pattern format (chainable).  Must be called before
+// the first log message is written.
+func (w *FileLogWriter) SetJSON(enable bool) *FileLogWriter {
+	w.formatter = nil
+	if enable {
+		w.formatter = NewJSONFormatter()
+	}
 	return w
 }
 
@@ -226,7 +496,7 @@ func (w *FileLogWriter) SetFormat(format string) *FileLogWriter {
 func (w *FileLogWriter) SetHeadFoot(head, foot string) *FileLogWriter {
 	w.header, w.trailer = head, foot
 	if w.maxlines_curlines == 0 {
-		fmt.Fprint(w.file, FormatLogRecord(w.header, &LogRecord{Created: time.Now()}))
+		w.write(FormatLogRecord(w.header, w.markerRecord()))
 	}
 	return w
 }
@@ -262,6 +532,56 @@ func (w *FileLogWriter) SetRotateMaxBackup(maxbackup int) *FileLogWriter {
 	return w
 }
 
+// SetFlushInterval buffers writes to the file and flushes them at least every
+// interval, bounding how stale the file can be for tailing tools (chainable).
+// Zero, the default, writes every record straight to the file.  Must be
+// called before the first log message is written.
+func (w *FileLogWriter) SetFlushInterval(interval time.Duration) *FileLogWriter {
+	w.flushInterval = interval
+	return w
+}
+
+// SetBufferLength sets how many records can be queued for the file before
+// LogWrite blocks (chainable), LogBufferLength by default.  Must be called
+// before the first log message is written.
+func (w *FileLogWriter) SetBufferLength(n int) *FileLogWriter {
+	setQueueLength(&w.rec, n)
+	return w
+}
+
+// SetOverflowPolicy sets what LogWrite does when the queue is full
+// (chainable): block, the default, or drop the new or the oldest record.
+// Must be called before the first log message is written.
+func (w *FileLogWriter) SetOverflowPolicy(p OverflowPolicy) *FileLogWriter {
+	w.overflow.policy = p
+	return w
+}
+
+// Dropped returns the number of records dropped by the overflow policy.
+func (w *FileLogWriter) Dropped() uint64 {
+	return w.overflow.count()
+}
+
+// QueueStats returns the depth, capacity and high-water mark of the queue, or
+// of the shards together, see SetShards.
+func (w *FileLogWriter) QueueStats() QueueStats {
+	stats := w.overflow.stats(w.rec)
+	if w.shards != nil {
+		stats.Depth = w.shards.queued()
+		stats.Capacity = len(w.shards.in) * cap(w.shards.in[0])
+	}
+	return stats
+}
+
+// SetRotateTimestamp names backups after the time of rotation, e.g.
+// app.log.20240615-130501.123, instead of numbering them (chainable).  Names
+// never collide, and maxbackup only limits how many backups are kept: the
+// oldest are deleted.  Must be called before the first log message is written.
+func (w *FileLogWriter) SetRotateTimestamp(timestamp bool) *FileLogWriter {
+	w.timestamp = timestamp
+	return w
+}
+
 // SetRotate changes whether or not the old logs are kept. (chainable) Must be
 // called before the first log message is written.  If rotate is false, the
 // files are overwritten; otherwise, they are rotated to another file before the
@@ -272,12 +592,47 @@ func (w *FileLogWriter) SetRotate(rotate bool) *FileLogWriter {
 	return w
 }
 
+// SetUTC switches between formatting times in UTC and in local time
+// (chainable).  Daily rotation still follows the local day.  Must be called
+// before the first log message is written.
+func (w *FileLogWriter) SetUTC(utc bool) *FileLogWriter {
+	w.utc = utc
+	return w
+}
+
 // SetSanitize changes whether or not the sanitization of newline characters takes
 // place. This is to prevent log injection, although at some point the sanitization
 // of other non-printable characters might be valueable just to prevent binary
 // data from mucking up the logs.
 func (w *FileLogWriter) SetSanitize(sanitize bool) *FileLogWriter {
-	w.sanitize = sanitize
+	w.escape = EscapeNone
+	if sanitize {
+		w.escape = EscapeNewline
+	}
+	return w
+}
+
+// SetRaw writes each formatted record exactly as the format or formatter
+// produced it, without the trailing newline (chainable).  Must be called
+// before the first log message is written.
+func (w *FileLogWriter) SetRaw(raw bool) *FileLogWriter {
+	w.raw = raw
+	return w
+}
+
+// SetMaxMessageLength truncates messages longer than max bytes, marking them
+// with a "…(truncated N bytes)" suffix (chainable).  Zero, the default, keeps
+// messages whole.  Must be called before the first log message is written.
+func (w *FileLogWriter) SetMaxMessageLength(max int) *FileLogWriter {
+	w.maxMessage = max
+	return w
+}
+
+// SetEscape sets how messages are escaped (chainable), extending SetSanitize
+// to all control characters or Go quoting.  Must be called before the first
+// log message is written.
+func (w *FileLogWriter) SetEscape(mode EscapeMode) *FileLogWriter {
+	w.escape = mode
 	return w
 }
 
@@ -291,3 +646,66 @@ func NewXMLLogWriter(fname string, rotate bool, daily bool) *FileLogWriter {
 		<message>%M</message>
 	</record>`).SetHeadFoot("<log created=\"%D %T\">", "</log>")
 }
+
+// uniqueFilename returns fname if neither fname nor fname+ext exists,
+// otherwise the first fname.N (N = 1, 2, ...) that is free in the same sense.
+func uniqueFilename(fname, ext string) string {
+	free := func(name string) bool {
+		if _, err := os.Lstat(name); err == nil {
+			return false
+		}
+		if _, err := os.Lstat(name + ext); ext != "" && err == nil {
+			return false
+		}
+		return true
+	}
+	if free(fname) {
+		return fname
+	}
+	for num := 1; ; num++ {
+		nfname := fmt.Sprintf("%s.%d", fname, num)
+		if free(nfname) {
+			return nfname
+		}
+	}
+}
+
+// Layout of the timestamp appended to backups by SetRotateTimestamp
+const backupTimestampLayout = "20060102-150405.000"
+
+// pruneTimestampBackups removes the oldest timestamped backups so that at most
+// maxbackup remain.
+func (w *FileLogWriter) pruneTimestampBackups() {
+	if w.maxbackup <= 0 {
+		return
+	}
+	dir, base := filepath.Split(w.filename)
+	if dir == "" {
+		dir = "."
+	}
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	pattern := regexp.MustCompile(`^(` + regexp.QuoteMeta(base) + `\.\d{8}-\d{6}\.\d{3}(\.\d+)?)(\.gz|\.zst)?$`)
+	// A backup left both plain and compressed (e.g. by an interrupted
+	// compression) is one backup
+	files := make(map[string][]string)
+	var backups []string
+	for _, entry := range entries {
+		if m := pattern.FindStringSubmatch(entry.Name()); m != nil {
+			if _, ok := files[m[1]]; !ok {
+				backups = append(backups, m[1])
+			}
+			files[m[1]] = append(files[m[1]], entry.Name())
+		}
+	}
+	// Lexical order is chronological for this layout
+	sort.Strings(backups)
+	for len(backups) > w.maxbackup {
+		for _, name := range files[backups[0]] {
+			os.Remove(filepath.Join(dir, name))
+		}
+		backups = backups[1:]
+	}
+}
@@ -0,0 +1,131 @@
+package log4go
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// fileOptions are the settings shared by a FileLogWriter and every per-level
+// file of a SplitFileLogWriter.  Configuration files fill them in once and
+// newFileWriter applies them to whichever writer the filter asks for.
+type fileOptions struct {
+	format        string
+	formatter     Formatter
+	maxlines      int
+	maxsize       int
+	maxbackup     int
+	escape        EscapeMode
+	maxMessage    int
+	raw           bool
+	compression   string
+	timestamp     bool
+	flushInterval time.Duration
+	utc           bool
+	keySource     KeySource
+	bufferLength  int // LogBufferLength if zero
+	overflow      OverflowPolicy
+	shards        int // A single queue if 1 or less
+}
+
+// defaultFileOptions returns the settings of a new FileLogWriter.
+func defaultFileOptions() fileOptions {
+	return fileOptions{
+		format:    "[%D %T] [%L] (%S) %M",
+		maxbackup: 999,
+	}
+}
+
+// apply configures w with the options.  Encryption is enabled first so that
+// nothing reaches the file in plain text; if it fails, w must not be used.
+func (o *fileOptions) apply(w *FileLogWriter) error {
+	if o.keySource != nil {
+		if err := w.SetEncryptionKeySource(o.keySource); err != nil {
+			return err
+		}
+	}
+	w.SetFormat(o.format)
+	w.SetFormatter(o.formatter)
+	w.SetRotateLines(o.maxlines)
+	w.SetRotateSize(o.maxsize)
+	w.SetRotateMaxBackup(o.maxbackup)
+	w.SetEscape(o.escape)
+	w.SetMaxMessageLength(o.maxMessage)
+	w.SetRaw(o.raw)
+	w.SetCompression(o.compression)
+	w.SetRotateTimestamp(o.timestamp)
+	w.SetFlushInterval(o.flushInterval)
+	w.SetUTC(o.utc)
+	if o.bufferLength > 0 {
+		w.SetBufferLength(o.bufferLength)
+	}
+	w.SetOverflowPolicy(o.overflow)
+	w.SetShards(o.shards)
+	return nil
+}
+
+// newFileWriter creates the writer of a file filter: a SplitFileLogWriter
+// if split is set, otherwise a FileLogWriter, configured with opts.  The
+// placeholders in fname are expanded first, see expandFilename.
+func newFileWriter(fname string, rotate, daily, split bool, opts *fileOptions) (LogWriter, error) {
+	fname = expandFilename(fname)
+	if split {
+		slw := NewSplitFileLogWriter(fname, rotate, daily)
+		slw.opts = *opts
+		slw.SetFormat(opts.format)
+		if opts.keySource != nil {
+			// Check the key now rather than when a level is first written
+			if err := slw.SetEncryptionKeySource(opts.keySource); err != nil {
+				return nil, err
+			}
+		}
+		return slw, nil
+	}
+
+	flw := NewFileLogWriter(fname, rotate, daily)
+	if flw == nil {
+		return nil, fmt.Errorf("could not open %s", fname)
+	}
+	if err := opts.apply(flw); err != nil {
+		flw.Close()
+		return nil, err
+	}
+	return flw, nil
+}
+
+// expandFilename replaces the placeholders of a configured file name, so that
+// several instances on one host write to files of their own:
+//
+//	{hostname}  the host name
+//	{pid}       the process id
+//	{date}      the date the writer was created, e.g. 2024-06-15
+//
+// as in "logs/api-{hostname}-{pid}.log".  Other text in braces is kept.
+func expandFilename(fname string) string {
+	if !strings.Contains(fname, "{") {
+		return fname
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "localhost"
+	}
+	return strings.NewReplacer(
+		"{hostname}", hostname,
+		"{pid}", strconv.Itoa(os.Getpid()),
+		"{date}", time.Now().Format("2006-01-02"),
+	).Replace(fname)
+}
+
+// fileKeySource returns the KeySource of the encrypt_key_env or
+// encrypt_key_file setting, or nil if neither is set.
+func fileKeySource(keyEnv, keyFile string) KeySource {
+	switch {
+	case len(keyEnv) > 0:
+		return EnvKeySource(keyEnv)
+	case len(keyFile) > 0:
+		return FileKeySource(keyFile)
+	}
+	return nil
+}
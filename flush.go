@@ -0,0 +1,89 @@
+package log4go
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// DefaultFlushBufferSize is the size of the write buffer used by writers with
+// a flush interval.
+var DefaultFlushBufferSize = 64 * 1024
+
+// flushTicker is the ticker shared by the buffered writers.  Its channel is
+// nil, and so never fires in a select, until it is started with a positive
+// interval.
+type flushTicker struct {
+	ticker *time.Ticker
+}
+
+// start begins ticking every interval unless it is already running or the
+// interval is not positive.
+func (t *flushTicker) start(interval time.Duration) {
+	if t.ticker != nil || interval <= 0 {
+		return
+	}
+	t.ticker = time.NewTicker(interval)
+}
+
+// C returns the channel to select on.
+func (t *flushTicker) C() <-chan time.Time {
+	if t.ticker == nil {
+		return nil
+	}
+	return t.ticker.C
+}
+
+func (t *flushTicker) stop() {
+	if t.ticker != nil {
+		t.ticker.Stop()
+		t.ticker = nil
+	}
+}
+
+// parseFlushInterval parses the "flush_interval" config value, e.g. "500ms"
+// or "2s".  An empty value disables buffering.
+func parseFlushInterval(filename, value string) time.Duration {
+	if len(value) == 0 {
+		return 0
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "LoadConfiguration: Warning: Invalid flush_interval %q in %s, writes will not be buffered\n", value, filename)
+		return 0
+	}
+	return d
+}
+
+// A Flusher is a LogWriter that can wait until the records queued for it have
+// been written.  All of the writers of this package are Flushers.
+type Flusher interface {
+	Flush()
+}
+
+// Flush blocks until every record logged before the call has been written by
+// the writers of the logger, so that a program can exit without losing the
+// last messages, or hand the log files on, without closing the logger.
+// Writers that are not Flushers are skipped.
+func (log Logger) Flush() {
+	_, filters := log.snapshot()
+	for _, filt := range filters {
+		flushFilter(filt, filt.LogWriter)
+	}
+}
+
+// flushQueue sends a flush marker through queue to a writer goroutine and
+// waits for the goroutine to reach it, having written the records queued
+// before it, or to finish (done is closed).
+func flushQueue(queue chan *LogRecord, done chan struct{}) {
+	marker := &LogRecord{flushed: make(chan struct{})}
+	select {
+	case queue <- marker:
+	case <-done:
+		return
+	}
+	select {
+	case <-marker.flushed:
+	case <-done:
+	}
+}
@@ -0,0 +1,16 @@
+// Package ginlog provides Gin middleware logging requests and recovering
+// from panics through log4go, as package httplog does for net/http:
+//
+//	r := gin.New()
+//	r.Use(ginlog.Logger("access"), ginlog.Recovery("panic"))
+//
+// The records are logged with httplog's Logger, with an explicit source, so
+// that they do not depend on the depth of the middleware chain, and to the
+// writers of the categories, whose overflow policies (see
+// log4go.OverflowPolicy) decide whether a slow writer blocks the requests.
+//
+// The Gin code is only built with the log4go_gin tag, so that programs not
+// using it do not build Gin.  The go.mod of log4go requires the version of
+// github.com/gin-gonic/gin it is tested with; programs using it build with
+// -tags log4go_gin.
+package ginlog
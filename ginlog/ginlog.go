@@ -0,0 +1,64 @@
+//go:build log4go_gin
+
+package ginlog
+
+import (
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jeanphorn/log4go"
+	"github.com/jeanphorn/log4go/httplog"
+)
+
+// Logger returns a middleware logging the requests to category of
+// log4go.Global, in the Combined format of httplog.
+func Logger(category string) gin.HandlerFunc {
+	return LoggerWith(httplog.New(log4go.LOGGER(category)))
+}
+
+// LoggerWith returns a middleware logging the requests with l, see
+// httplog.Logger.
+func LoggerWith(l *httplog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		size := c.Writer.Size()
+		if size < 0 {
+			size = 0
+		}
+		l.LogRequest(c.Request, c.Writer.Status(), int64(size), start)
+	}
+}
+
+// Recovery returns a middleware recovering from the panics of the handlers
+// after it and logging them to category of log4go.Global, see RecoveryWith.
+func Recovery(category string) gin.HandlerFunc {
+	return RecoveryWith(httplog.New(log4go.LOGGER(category)))
+}
+
+// RecoveryWith returns a middleware recovering from the panics of the
+// handlers after it and logging them with l, at CRITICAL with their stack
+// trace, as httplog.Logger.Recover does.  The client gets a 500 if the
+// response had not started; otherwise the response is aborted.  Use it
+// after Logger for the 500s to be logged by Logger.
+func RecoveryWith(l *httplog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			e := recover()
+			if e == nil {
+				return
+			}
+			if e == http.ErrAbortHandler {
+				panic(e)
+			}
+			l.LogPanic(c.Request, e, debug.Stack())
+			if c.Writer.Written() {
+				panic(http.ErrAbortHandler)
+			}
+			c.AbortWithStatus(http.StatusInternalServerError)
+		}()
+		c.Next()
+	}
+}
@@ -0,0 +1,62 @@
+//go:build log4go_gin
+
+package ginlog
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jeanphorn/log4go"
+	"github.com/jeanphorn/log4go/httplog"
+)
+
+type recordingLogWriter struct {
+	records []*log4go.LogRecord
+}
+
+func (w *recordingLogWriter) LogWrite(rec *log4go.LogRecord) {
+	w.records = append(w.records, rec)
+}
+
+func (w *recordingLogWriter) Close() {}
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	w := &recordingLogWriter{}
+	log := make(log4go.Logger)
+	log.AddFilter("http", log4go.DEBUG, w, "http")
+	l := httplog.New(log.LOGGER("http")).SetFormat(httplog.Structured)
+
+	r := gin.New()
+	r.Use(LoggerWith(l), RecoveryWith(l))
+	r.GET("/users/:id", func(c *gin.Context) {
+		c.String(http.StatusOK, "user %s", c.Param("id"))
+	})
+	r.GET("/panic", func(c *gin.Context) {
+		panic("boom")
+	})
+
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, httptest.NewRequest("GET", "/users/42", nil))
+	resp = httptest.NewRecorder()
+	r.ServeHTTP(resp, httptest.NewRequest("GET", "/panic", nil))
+	if resp.Code != http.StatusInternalServerError {
+		t.Errorf("panic: got status %d", resp.Code)
+	}
+
+	if len(w.records) != 3 {
+		t.Fatalf("got %d records, want 3", len(w.records))
+	}
+	if rec := w.records[0]; rec.Message != "GET /users/42 200" || rec.Fields["bytes"] != int64(len("user 42")) {
+		t.Errorf("got %q with %v", rec.Message, rec.Fields)
+	}
+	if rec := w.records[1]; rec.Level != log4go.CRITICAL || rec.Message != "panic serving GET /panic: boom" || !strings.Contains(rec.Stack, "ginlog.TestMiddleware") {
+		t.Errorf("got %q at %v", rec.Message, rec.Level)
+	}
+	if rec := w.records[2]; rec.Message != "GET /panic 500" || rec.Level != log4go.ERROR {
+		t.Errorf("got %q at %v", rec.Message, rec.Level)
+	}
+}
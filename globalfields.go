@@ -0,0 +1,54 @@
+package log4go
+
+import "sync/atomic"
+
+// globalFields holds the Fields set by SetGlobalFields.  It is replaced, never
+// modified, so that loggers can read it without locking.
+var globalFields atomic.Value
+
+// SetGlobalFields sets fields attached to every record, e.g. the application
+// name, version, host and environment, so they need not be repeated in every
+// pattern:
+//
+//	log.SetGlobalFields(map[string]interface{}{"app": "billing", "env": "prod"})
+//
+// MDC values and fields given to WithFields take precedence over global fields
+// of the same key.  The map is copied; nil removes the global fields.
+func SetGlobalFields(fields map[string]interface{}) {
+	copied := make(Fields, len(fields))
+	for k, v := range fields {
+		copied[k] = v
+	}
+	globalFields.Store(copied)
+}
+
+// GlobalFields returns a copy of the fields set by SetGlobalFields.
+func GlobalFields() Fields {
+	global, _ := globalFields.Load().(Fields)
+	copied := make(Fields, len(global))
+	for k, v := range global {
+		copied[k] = v
+	}
+	return copied
+}
+
+// contextFields returns the global fields merged with the calling goroutine's
+// context, or nil.  The result must not be modified.
+func contextFields() Fields {
+	global, _ := globalFields.Load().(Fields)
+	ctx := mdcFields()
+	if len(global) == 0 {
+		return ctx
+	}
+	if len(ctx) == 0 {
+		return global
+	}
+	merged := make(Fields, len(global)+len(ctx))
+	for k, v := range global {
+		merged[k] = v
+	}
+	for k, v := range ctx {
+		merged[k] = v
+	}
+	return merged
+}
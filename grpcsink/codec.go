@@ -0,0 +1,244 @@
+// Package grpcsink ships log4go records to a collector over gRPC, a typed
+// alternative to the raw socket of log4go.SocketLogWriter: Writer streams
+// records to a LogSink server, and Register serves the LogSink service, see
+// log4go.proto.
+//
+// The gRPC code is only built with the log4go_grpc tag, so that programs not
+// using it do not build gRPC.  The go.mod of log4go requires the version of
+// google.golang.org/grpc it is tested with; programs using it build with
+// -tags log4go_grpc.
+package grpcsink
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jeanphorn/log4go"
+)
+
+// Ack is the reply of the LogSink server when a stream ends.
+type Ack struct {
+	Received uint64 // Records received on the stream
+}
+
+// Codec is the gRPC codec of the LogSink messages, *log4go.LogRecord and
+// *Ack, in the protobuf wire format of log4go.proto.  It stands in for the
+// code protoc would generate.
+type Codec struct{}
+
+// Name is the content subtype of the messages, "proto", so that LogSink
+// servers and clients generated from log4go.proto understand them.
+func (Codec) Name() string {
+	return "proto"
+}
+
+// Marshal encodes v, a *log4go.LogRecord or an *Ack.
+func (Codec) Marshal(v interface{}) ([]byte, error) {
+	switch m := v.(type) {
+	case *log4go.LogRecord:
+		return appendRecord(nil, m), nil
+	case *Ack:
+		var b []byte
+		if m.Received != 0 {
+			b = appendVarint(appendTag(b, 1, wireVarint), m.Received)
+		}
+		return b, nil
+	}
+	return nil, fmt.Errorf("grpcsink: cannot marshal %T", v)
+}
+
+// Unmarshal decodes data into v, a *log4go.LogRecord or an *Ack.
+func (Codec) Unmarshal(data []byte, v interface{}) error {
+	switch m := v.(type) {
+	case *log4go.LogRecord:
+		return unmarshalRecord(data, m)
+	case *Ack:
+		*m = Ack{}
+		return eachField(data, func(num int, x uint64, _ []byte) error {
+			if num == 1 {
+				m.Received = x
+			}
+			return nil
+		})
+	}
+	return fmt.Errorf("grpcsink: cannot unmarshal into %T", v)
+}
+
+// The protobuf wire types used by log4go.proto
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+func appendVarint(b []byte, x uint64) []byte {
+	for x >= 0x80 {
+		b = append(b, byte(x)|0x80)
+		x >>= 7
+	}
+	return append(b, byte(x))
+}
+
+func appendTag(b []byte, num, wire int) []byte {
+	return appendVarint(b, uint64(num)<<3|uint64(wire))
+}
+
+// appendString appends field num, omitted when empty as in proto3.
+func appendString(b []byte, num int, s string) []byte {
+	if len(s) == 0 {
+		return b
+	}
+	b = appendVarint(appendTag(b, num, wireBytes), uint64(len(s)))
+	return append(b, s...)
+}
+
+// appendInt appends field num, omitted when zero as in proto3.  Negative
+// values take ten bytes, as protobuf encodes int32 and int64.
+func appendInt(b []byte, num int, x int64) []byte {
+	if x == 0 {
+		return b
+	}
+	return appendVarint(appendTag(b, num, wireVarint), uint64(x))
+}
+
+// appendRecord appends rec as a LogRecord message.
+func appendRecord(b []byte, rec *log4go.LogRecord) []byte {
+	b = appendInt(b, 1, int64(rec.Level))
+	if !rec.Created.IsZero() {
+		b = appendInt(b, 2, rec.Created.UnixNano())
+	}
+	b = appendString(b, 3, rec.Source)
+	b = appendString(b, 4, rec.Message)
+	b = appendString(b, 5, rec.Category)
+	for k, v := range rec.Fields {
+		var entry []byte
+		entry = appendString(entry, 1, k)
+		entry = appendString(entry, 2, fmt.Sprint(v))
+		b = appendVarint(appendTag(b, 6, wireBytes), uint64(len(entry)))
+		b = append(b, entry...)
+	}
+	b = appendString(b, 7, rec.Stack)
+	if rec.Seq != 0 {
+		b = appendVarint(appendTag(b, 8, wireVarint), rec.Seq)
+	}
+	b = appendString(b, 9, rec.File)
+	b = appendInt(b, 10, int64(rec.Line))
+	return b
+}
+
+// unmarshalRecord decodes a LogRecord message into rec.  Field values are
+// decoded as strings.
+func unmarshalRecord(data []byte, rec *log4go.LogRecord) error {
+	*rec = log4go.LogRecord{}
+	return eachField(data, func(num int, x uint64, v []byte) error {
+		switch num {
+		case 1:
+			rec.Level = log4go.Level(int32(x))
+		case 2:
+			rec.Created = time.Unix(0, int64(x))
+		case 3:
+			rec.Source = string(v)
+		case 4:
+			rec.Message = string(v)
+		case 5:
+			rec.Category = string(v)
+		case 6:
+			var key, value string
+			err := eachField(v, func(num int, _ uint64, v []byte) error {
+				switch num {
+				case 1:
+					key = string(v)
+				case 2:
+					value = string(v)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			if rec.Fields == nil {
+				rec.Fields = log4go.Fields{}
+			}
+			rec.Fields[key] = value
+		case 7:
+			rec.Stack = string(v)
+		case 8:
+			rec.Seq = x
+		case 9:
+			rec.File = string(v)
+		case 10:
+			rec.Line = int(int32(x))
+		}
+		return nil
+	})
+}
+
+var errTruncated = errors.New("grpcsink: truncated message")
+
+// eachField calls f with the number and the value of each field of the
+// message in data: x for varints, v for length-delimited fields.  Fixed-size
+// fields, which log4go.proto does not use, are skipped.
+func eachField(data []byte, f func(num int, x uint64, v []byte) error) error {
+	for len(data) > 0 {
+		tag, n := consumeVarint(data)
+		if n == 0 {
+			return errTruncated
+		}
+		data = data[n:]
+		num, wire := int(tag>>3), int(tag&7)
+		if num <= 0 || num >= 1<<29 {
+			return fmt.Errorf("grpcsink: invalid field number %d", num)
+		}
+
+		var x uint64
+		var v []byte
+		switch wire {
+		case wireVarint:
+			if x, n = consumeVarint(data); n == 0 {
+				return errTruncated
+			}
+		case wireFixed64:
+			if n = 8; len(data) < n {
+				return errTruncated
+			}
+		case wireBytes:
+			var size uint64
+			if size, n = consumeVarint(data); n == 0 || size > uint64(len(data)-n) {
+				return errTruncated
+			}
+			v = data[n : n+int(size)]
+			n += int(size)
+		case wireFixed32:
+			if n = 4; len(data) < n {
+				return errTruncated
+			}
+		default:
+			return fmt.Errorf("grpcsink: unsupported wire type %d", wire)
+		}
+		data = data[n:]
+
+		if wire == wireFixed64 || wire == wireFixed32 {
+			continue
+		}
+		if err := f(num, x, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// consumeVarint returns the varint at the start of b and its length, or a
+// length of zero if it is invalid.
+func consumeVarint(b []byte) (x uint64, n int) {
+	for shift := uint(0); n < len(b) && shift < 64; shift += 7 {
+		c := b[n]
+		n++
+		x |= uint64(c&0x7f) << shift
+		if c < 0x80 {
+			return x, n
+		}
+	}
+	return 0, 0
+}
@@ -0,0 +1,68 @@
+package grpcsink
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jeanphorn/log4go"
+)
+
+func TestCodecRecord(t *testing.T) {
+	rec := &log4go.LogRecord{
+		Level:    log4go.ERROR,
+		Created:  time.Unix(1234567890, 123456789),
+		Source:   "main.main:15",
+		Message:  "disk full",
+		Category: "api",
+		Fields:   log4go.Fields{"user": "ann", "tries": 3, "err": errors.New("ENOSPC")},
+		Stack:    "goroutine 1 [running]:",
+		Seq:      42,
+		File:     "main.go",
+		Line:     15,
+	}
+	data, err := Codec{}.Marshal(rec)
+	if err != nil {
+		t.Fatalf("Marshal: %s", err)
+	}
+	got := &log4go.LogRecord{}
+	if err := (Codec{}).Unmarshal(data, got); err != nil {
+		t.Fatalf("Unmarshal: %s", err)
+	}
+	want := *rec
+	want.Fields = log4go.Fields{"user": "ann", "tries": "3", "err": "ENOSPC"}
+	if !got.Created.Equal(want.Created) {
+		t.Errorf("Created = %s, want %s", got.Created, want.Created)
+	}
+	got.Created = want.Created
+	if !reflect.DeepEqual(*got, want) {
+		t.Errorf("Unmarshal = %+v\nwant %+v", *got, want)
+	}
+
+	// Fields unknown to this version are skipped, truncated messages fail
+	data = append(data, 0x58, 0x01, 0x61, 0x01, 0, 0, 0, 0, 0, 0, 0)
+	if err := (Codec{}).Unmarshal(data, got); err != nil || got.Message != "disk full" {
+		t.Errorf("Unmarshal with unknown fields = %+v, %v", got, err)
+	}
+	if err := (Codec{}).Unmarshal(data[:len(data)-1], got); err == nil {
+		t.Error("Unmarshal of a truncated message succeeded")
+	}
+}
+
+func TestCodecAck(t *testing.T) {
+	data, err := Codec{}.Marshal(&Ack{Received: 300})
+	if err != nil {
+		t.Fatalf("Marshal: %s", err)
+	}
+	if want := []byte{0x08, 0xac, 0x02}; !reflect.DeepEqual(data, want) {
+		t.Errorf("Marshal = % x, want % x", data, want)
+	}
+	ack := &Ack{}
+	if err := (Codec{}).Unmarshal(data, ack); err != nil || ack.Received != 300 {
+		t.Errorf("Unmarshal = %+v, %v", ack, err)
+	}
+	if _, err := (Codec{}).Marshal("text"); err == nil {
+		t.Error("Marshal of a string succeeded")
+	}
+}
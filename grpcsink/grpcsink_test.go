@@ -0,0 +1,52 @@
+//go:build log4go_grpc
+
+package grpcsink
+
+import (
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/jeanphorn/log4go"
+	"google.golang.org/grpc"
+)
+
+func TestWriterServer(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("listen: %s", err)
+	}
+	var (
+		mu  sync.Mutex
+		got []*log4go.LogRecord
+	)
+	s := grpc.NewServer(ServerOption())
+	Register(s, func(rec *log4go.LogRecord) {
+		mu.Lock()
+		got = append(got, rec)
+		mu.Unlock()
+	})
+	go s.Serve(ln)
+	defer s.Stop()
+
+	cc, err := grpc.Dial(ln.Addr().String(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatalf("Dial: %s", err)
+	}
+	defer cc.Close()
+
+	w := NewWriter(cc)
+	w.LogWrite(&log4go.LogRecord{Level: log4go.INFO, Category: "api", Message: "first", Fields: log4go.Fields{"user": "ann"}})
+	w.LogWrite(&log4go.LogRecord{Level: log4go.ERROR, Category: "api", Message: "second"})
+	w.Close()
+
+	// The server has handled the records when it acknowledges the stream
+	mu.Lock()
+	defer mu.Unlock()
+	if len(got) != 2 || got[0].Message != "first" || got[0].Fields["user"] != "ann" || got[1].Level != log4go.ERROR {
+		t.Fatalf("Server got %+v", got)
+	}
+	if w.Sent() != 2 || w.Dropped() != 0 {
+		t.Errorf("Sent %d, dropped %d", w.Sent(), w.Dropped())
+	}
+}
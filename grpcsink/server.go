@@ -0,0 +1,100 @@
+//go:build log4go_grpc
+
+package grpcsink
+
+import (
+	"io"
+
+	"github.com/jeanphorn/log4go"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+)
+
+// The LogSink service of log4go.proto, as protoc would describe it
+const logSinkStreamMethod = "/log4go.LogSink/Stream"
+
+var logSinkStream = grpc.StreamDesc{
+	StreamName:    "Stream",
+	ClientStreams: true,
+}
+
+// Handler handles the records received by a LogSink server.  It is called
+// from the goroutines of the streams, concurrently.
+type Handler func(rec *log4go.LogRecord)
+
+// LoggerHandler returns a Handler passing the records received to log, as
+// log.Ingest does, e.g. to write the records of all the services to the
+// files of the collector's configuration.
+func LoggerHandler(log log4go.Logger) Handler {
+	return func(rec *log4go.LogRecord) {
+		log.Ingest([]*log4go.LogRecord{rec})
+	}
+}
+
+// ServerOption returns the option a server serving LogSink must be created
+// with, for it to decode the records.  The messages of its other services
+// are left to the codec registered for "proto", as usual.
+func ServerOption() grpc.ServerOption {
+	return grpc.ForceServerCodec(serverCodec{})
+}
+
+// serverCodec is Codec, falling back to the registered "proto" codec for the
+// messages of other services.
+type serverCodec struct {
+	Codec
+}
+
+func (c serverCodec) Marshal(v interface{}) ([]byte, error) {
+	switch v.(type) {
+	case *log4go.LogRecord, *Ack:
+		return c.Codec.Marshal(v)
+	}
+	return encoding.GetCodec("proto").Marshal(v)
+}
+
+func (c serverCodec) Unmarshal(data []byte, v interface{}) error {
+	switch v.(type) {
+	case *log4go.LogRecord, *Ack:
+		return c.Codec.Unmarshal(data, v)
+	}
+	return encoding.GetCodec("proto").Unmarshal(data, v)
+}
+
+// Register registers on s, created with ServerOption, the LogSink service,
+// passing each record received to h.  A minimal collector is:
+//
+//	s := grpc.NewServer(grpcsink.ServerOption(), grpc.Creds(creds))
+//	grpcsink.Register(s, grpcsink.LoggerHandler(log.Global))
+//	s.Serve(listener)
+func Register(s *grpc.Server, h Handler) {
+	s.RegisterService(&grpc.ServiceDesc{
+		ServiceName: "log4go.LogSink",
+		HandlerType: (*interface{})(nil),
+		Streams: []grpc.StreamDesc{{
+			StreamName:    "Stream",
+			ClientStreams: true,
+			Handler: func(_ interface{}, stream grpc.ServerStream) error {
+				return serveStream(stream, h)
+			},
+		}},
+		Metadata: "log4go.proto",
+	}, nil)
+}
+
+// serveStream passes the records received on stream to h, and acknowledges
+// them when the client ends it.
+func serveStream(stream grpc.ServerStream, h Handler) error {
+	ack := &Ack{}
+	for {
+		rec := &log4go.LogRecord{}
+		err := stream.RecvMsg(rec)
+		if err == io.EOF {
+			return stream.SendMsg(ack)
+		}
+		if err != nil {
+			return err
+		}
+		ack.Received++
+		h(rec)
+	}
+}
@@ -0,0 +1,177 @@
+//go:build log4go_grpc
+
+package grpcsink
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+
+	"github.com/jeanphorn/log4go"
+	"google.golang.org/grpc"
+)
+
+// Writer is a log4go.LogWriter streaming records to a LogSink server.  Like
+// the writers of log4go, it queues the records, and a goroutine sends them,
+// here on a client stream.  When the stream fails, the goroutine opens
+// another, waiting log4go.DefaultReconnectDelay, then twice as long after
+// each failed attempt up to log4go.DefaultMaxReconnectDelay, and sends the
+// record again.  The records sent on the failed stream that the server had
+// not received yet are lost: a client stream is only acknowledged at its end.
+type Writer struct {
+	cc      grpc.ClientConnInterface
+	target  string
+	queue   chan item
+	done    chan struct{} // closed when the writer goroutine has finished
+	closing chan struct{} // closed by Close, to stop reopening the stream
+
+	sent, dropped uint64
+}
+
+// item is a record, or the marker of a Flush
+type item struct {
+	rec     *log4go.LogRecord
+	flushed chan struct{}
+}
+
+// NewWriter returns a writer streaming records over cc, e.g. a
+// *grpc.ClientConn, whose dial options set the transport credentials.  cc
+// is left open by Close.
+func NewWriter(cc grpc.ClientConnInterface) *Writer {
+	w := &Writer{
+		cc:      cc,
+		queue:   make(chan item, log4go.LogBufferLength),
+		done:    make(chan struct{}),
+		closing: make(chan struct{}),
+	}
+	if conn, ok := cc.(*grpc.ClientConn); ok {
+		w.target = conn.Target()
+	}
+	go w.run()
+	return w
+}
+
+// This is the Writer's output method.  It blocks while the queue is full.
+func (w *Writer) LogWrite(rec *log4go.LogRecord) {
+	w.queue <- item{rec: rec}
+}
+
+// Flush blocks until the records queued before the call are sent on the
+// stream, or dropped.
+func (w *Writer) Flush() {
+	flushed := make(chan struct{})
+	select {
+	case w.queue <- item{flushed: flushed}:
+	case <-w.done:
+		return
+	}
+	select {
+	case <-flushed:
+	case <-w.done:
+	}
+}
+
+// Close sends the queued records, ends the stream and waits for the server
+// to acknowledge it.  The records still queued while the stream cannot be
+// opened are dropped.
+func (w *Writer) Close() {
+	close(w.closing)
+	close(w.queue)
+	<-w.done
+}
+
+// Sent returns the number of records sent on the streams.
+func (w *Writer) Sent() uint64 {
+	return atomic.LoadUint64(&w.sent)
+}
+
+// Dropped returns the number of records dropped because no stream could be
+// opened before the writer was closed.
+func (w *Writer) Dropped() uint64 {
+	return atomic.LoadUint64(&w.dropped)
+}
+
+func (w *Writer) run() {
+	defer close(w.done)
+
+	var (
+		stream grpc.ClientStream
+		delay  time.Duration
+		gaveUp bool // Closed while the stream could not be opened
+	)
+	defer func() {
+		if stream == nil {
+			return
+		}
+		ack := &Ack{}
+		if err := stream.CloseSend(); err != nil {
+			w.report(err, "records may be lost")
+		} else if err := stream.RecvMsg(ack); err != nil {
+			w.report(err, "records may be lost")
+		}
+	}()
+
+	for it := range w.queue {
+		if it.flushed != nil {
+			close(it.flushed)
+			continue
+		}
+		for {
+			if stream == nil {
+				if gaveUp {
+					atomic.AddUint64(&w.dropped, 1)
+					break
+				}
+				if stream = w.open(&delay); stream == nil {
+					gaveUp = true
+					log4go.ReportError(fmt.Errorf("grpcsink.Writer(%q): closed while the stream could not be opened, records dropped", w.target))
+					continue
+				}
+			}
+			err := stream.SendMsg(it.rec)
+			if err == nil {
+				atomic.AddUint64(&w.sent, 1)
+				break
+			}
+			if err == io.EOF {
+				// The stream was aborted, the reason is its status
+				err = stream.RecvMsg(&Ack{})
+			}
+			w.report(err, "reopening the stream")
+			stream = nil
+		}
+	}
+}
+
+// open opens a stream, waiting longer after each failed attempt, until it
+// succeeds or the writer is closed, when it returns nil.
+func (w *Writer) open(delay *time.Duration) grpc.ClientStream {
+	for {
+		stream, err := w.cc.NewStream(context.Background(), &logSinkStream, logSinkStreamMethod, grpc.ForceCodec(Codec{}))
+		if err == nil {
+			*delay = 0
+			return stream
+		}
+		w.report(err, "retrying")
+
+		if *delay < log4go.DefaultReconnectDelay {
+			*delay = log4go.DefaultReconnectDelay
+		}
+		timer := time.NewTimer(*delay)
+		select {
+		case <-timer.C:
+		case <-w.closing:
+			timer.Stop()
+			return nil
+		}
+		if *delay *= 2; *delay > log4go.DefaultMaxReconnectDelay {
+			*delay = log4go.DefaultMaxReconnectDelay
+		}
+	}
+}
+
+func (w *Writer) report(err error, action string) {
+	log4go.ReportError(fmt.Errorf("grpcsink.Writer(%q): %s, %s", w.target, err, action))
+}
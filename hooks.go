@@ -0,0 +1,111 @@
+package log4go
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// preHooks and postHooks hold the []*preHook and []*postHook registered with
+// RegisterHook and RegisterPostWriteHook.  They are replaced, never modified,
+// so that loggers and writer goroutines can read them without locking.
+var (
+	preHooks, postHooks atomic.Value
+	hooksLock           sync.Mutex
+)
+
+type preHook struct{ fn func(*LogRecord) *LogRecord }
+
+type postHook struct{ fn func(LogWriter, *LogRecord) }
+
+// RegisterHook adds hook, called with every record logged before it is sent
+// to the writers, e.g. to enrich or redact it:
+//
+//	remove := log.RegisterHook(func(rec *log.LogRecord) *log.LogRecord {
+//		rec.Message = strings.Replace(rec.Message, password, "***", -1)
+//		return rec
+//	})
+//
+// hook returns the record to write, rec itself or another one, or nil to
+// drop it; the hooks run in the order they were registered, each with the
+// record returned by the one before.  Hooks are called from the logging
+// goroutines, so they must be safe for concurrent use.  The returned
+// function removes the hook.
+func RegisterHook(hook func(*LogRecord) *LogRecord) (remove func()) {
+	h := &preHook{hook}
+	addHook(&preHooks, h)
+	return func() { removeHook(&preHooks, h) }
+}
+
+// RegisterPostWriteHook adds hook, called by the writers with every record
+// once they have written it successfully, e.g. to count records per writer
+// for metrics.  It is called from the writer goroutines, and should return
+// quickly as the writer waits for it.  The console, file and socket writers
+// call it; the record must not be modified.  The returned function removes
+// the hook.
+func RegisterPostWriteHook(hook func(w LogWriter, rec *LogRecord)) (remove func()) {
+	h := &postHook{hook}
+	addHook(&postHooks, h)
+	return func() { removeHook(&postHooks, h) }
+}
+
+func addHook(hooks *atomic.Value, h interface{}) {
+	hooksLock.Lock()
+	defer hooksLock.Unlock()
+	switch h := h.(type) {
+	case *preHook:
+		current, _ := hooks.Load().([]*preHook)
+		hooks.Store(append(current[:len(current):len(current)], h))
+	case *postHook:
+		current, _ := hooks.Load().([]*postHook)
+		hooks.Store(append(current[:len(current):len(current)], h))
+	}
+}
+
+func removeHook(hooks *atomic.Value, h interface{}) {
+	hooksLock.Lock()
+	defer hooksLock.Unlock()
+	switch h := h.(type) {
+	case *preHook:
+		current, _ := hooks.Load().([]*preHook)
+		var kept []*preHook
+		for _, c := range current {
+			if c != h {
+				kept = append(kept, c)
+			}
+		}
+		hooks.Store(kept)
+	case *postHook:
+		current, _ := hooks.Load().([]*postHook)
+		var kept []*postHook
+		for _, c := range current {
+			if c != h {
+				kept = append(kept, c)
+			}
+		}
+		hooks.Store(kept)
+	}
+}
+
+// runHooks passes rec through the hooks registered with RegisterHook and the
+// redactors, and returns the record to write, or nil.
+func runHooks(rec *LogRecord) *LogRecord {
+	hooks, _ := preHooks.Load().([]*preHook)
+	for _, h := range hooks {
+		if rec = h.fn(rec); rec == nil {
+			return nil
+		}
+	}
+	if rec = redact(rec); rec != nil {
+		countRecord(rec)
+	}
+	return rec
+}
+
+// written calls the hooks registered with RegisterPostWriteHook for rec,
+// written by w.
+func written(w LogWriter, rec *LogRecord) {
+	hooks, _ := postHooks.Load().([]*postHook)
+	for _, h := range hooks {
+		h.fn(w, rec)
+	}
+}
@@ -0,0 +1,216 @@
+// Package httplog logs the requests served by a net/http server through
+// log4go, as an access log:
+//
+//	http.ListenAndServe(":8080", httplog.Handler("access", mux))
+//
+// Each request is logged once served, to the category's filter, at INFO, or
+// WARNING for 4xx statuses and ERROR for 5xx, either as a line of the Apache
+// combined log format or as a short message with the details as fields.
+// Recover logs the panics of handlers with their stack trace.
+package httplog
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jeanphorn/log4go"
+)
+
+// Format is how the requests are logged.
+type Format int
+
+const (
+	// Combined logs each request as a line of the Apache combined log
+	// format, followed by the latency in microseconds as Apache's %D:
+	//
+	//	127.0.0.1 - alice [10/Oct/2000:13:55:36 -0700] "GET /index.html HTTP/1.1" 200 2326 "http://example.com/" "Mozilla/4.08" 1520
+	//
+	// Writers with the pattern "%M" write the lines log analyzers expect.
+	Combined Format = iota
+
+	// Structured logs each request as "GET /index.html 200", with the
+	// fields method, path, status, bytes, latency (a time.Duration) and
+	// remote, for writers showing fields such as the JSON formatter.
+	Structured
+)
+
+// Logger logs the requests served by the handlers it wraps.
+type Logger struct {
+	filter *log4go.Filter
+	format Format
+}
+
+// New returns a Logger logging the requests to filter, e.g.
+// log4go.LOGGER("access"), in the Combined format.
+func New(filter *log4go.Filter) *Logger {
+	return &Logger{filter: filter}
+}
+
+// SetFormat sets how the requests are logged (chainable).
+func (l *Logger) SetFormat(format Format) *Logger {
+	l.format = format
+	return l
+}
+
+// Handler returns next, logging the requests it serves to category of
+// log4go.Global in the Combined format.
+func Handler(category string, next http.Handler) http.Handler {
+	return New(log4go.LOGGER(category)).Handler(next)
+}
+
+// Handler returns next, logging the requests it serves.  A request whose
+// handler panics is not logged, unless the panic is recovered within next.
+func (l *Logger) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rw := &responseWriter{ResponseWriter: w}
+		next.ServeHTTP(rw, r)
+		l.LogRequest(r, rw.statusCode(), rw.bytes, start)
+	})
+}
+
+// LogRequest logs r, served since start with status and bytes of body, for
+// frameworks with their own middleware.  The ids of the span active in the
+// context of r are attached, see log4go.Filter.WithContext.
+func (l *Logger) LogRequest(r *http.Request, status int, bytes int64, start time.Time) {
+	latency := time.Since(start)
+	lvl := log4go.INFO
+	switch {
+	case status >= 500:
+		lvl = log4go.ERROR
+	case status >= 400:
+		lvl = log4go.WARNING
+	}
+	filter := l.filter.WithContext(r.Context())
+	if l.format == Structured {
+		filter.WithFields(log4go.Fields{
+			"method":  r.Method,
+			"path":    r.URL.Path,
+			"status":  status,
+			"bytes":   bytes,
+			"latency": latency,
+			"remote":  r.RemoteAddr,
+		}).Log(lvl, "httplog", r.Method+" "+r.URL.Path+" "+strconv.Itoa(status))
+		return
+	}
+	filter.Log(lvl, "httplog", string(appendCombined(nil, r, status, bytes, start, latency)))
+}
+
+// appendCombined appends the combined log line of r.
+func appendCombined(b []byte, r *http.Request, status int, bytes int64, start time.Time, latency time.Duration) []byte {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	b = appendField(b, host)
+	b = append(b, " - "...)
+	user := ""
+	if r.URL != nil && r.URL.User != nil {
+		user = r.URL.User.Username()
+	} else if name, _, ok := r.BasicAuth(); ok {
+		user = name
+	}
+	b = appendField(b, user)
+	b = append(b, " ["...)
+	b = start.AppendFormat(b, "02/Jan/2006:15:04:05 -0700")
+	b = append(b, "] "...)
+	b = strconv.AppendQuote(b, r.Method+" "+r.RequestURI+" "+r.Proto)
+	b = append(b, ' ')
+	b = strconv.AppendInt(b, int64(status), 10)
+	b = append(b, ' ')
+	if bytes == 0 {
+		b = append(b, '-')
+	} else {
+		b = strconv.AppendInt(b, bytes, 10)
+	}
+	b = append(b, ' ')
+	b = strconv.AppendQuote(b, r.Referer())
+	b = append(b, ' ')
+	b = strconv.AppendQuote(b, r.UserAgent())
+	b = append(b, ' ')
+	return strconv.AppendInt(b, latency.Microseconds(), 10)
+}
+
+// appendField appends s, or "-" if it is empty, as the combined log format
+// does.
+func appendField(b []byte, s string) []byte {
+	if len(s) == 0 {
+		return append(b, '-')
+	}
+	return append(b, s...)
+}
+
+// responseWriter records the status and the size of the response.  It keeps
+// the optional interfaces of the ResponseWriter of net/http that handlers
+// rely on: flushing, hijacking for websockets and ReadFrom for sendfile.
+type responseWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+// statusCode returns the status of the response, 200 if the handler wrote
+// nothing.
+func (w *responseWriter) statusCode() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+func (w *responseWriter) WriteHeader(code int) {
+	// Informational headers, e.g. 103 Early Hints, precede the status
+	if w.status == 0 && (code >= 200 || code == http.StatusSwitchingProtocols) {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+func (w *responseWriter) ReadFrom(src io.Reader) (int64, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := io.Copy(w.ResponseWriter, src)
+	w.bytes += n
+	return n, err
+}
+
+func (w *responseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		if w.status == 0 {
+			w.status = http.StatusOK
+		}
+		f.Flush()
+	}
+}
+
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("httplog: the ResponseWriter does not support hijacking")
+	}
+	conn, rw, err := h.Hijack()
+	if err == nil && w.status == 0 {
+		w.status = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+// Unwrap returns the wrapped ResponseWriter, for http.ResponseController.
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,217 @@
+package httplog
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jeanphorn/log4go"
+)
+
+type recordingLogWriter struct {
+	mu      sync.Mutex
+	records []*log4go.LogRecord
+}
+
+func (w *recordingLogWriter) LogWrite(rec *log4go.LogRecord) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.records = append(w.records, rec)
+}
+
+func (w *recordingLogWriter) Close() {}
+
+func newTestLogger(format Format) (*Logger, *recordingLogWriter) {
+	w := &recordingLogWriter{}
+	log := make(log4go.Logger)
+	log.AddFilter("access", log4go.DEBUG, w, "access")
+	return New(log.LOGGER("access")).SetFormat(format), w
+}
+
+func TestCombined(t *testing.T) {
+	l, w := newTestLogger(Combined)
+	h := l.Handler(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		io.WriteString(rw, "hello")
+	}))
+	r := httptest.NewRequest("GET", "/index.html?lang=en", nil)
+	r.RemoteAddr = "192.0.2.1:51234"
+	r.SetBasicAuth("alice", "secret")
+	r.Header.Set("Referer", "http://example.com/")
+	r.Header.Set("User-Agent", `Mozilla/4.08 "quoted"`)
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	if len(w.records) != 1 {
+		t.Fatalf("got %d records, want 1", len(w.records))
+	}
+	rec := w.records[0]
+	want := regexp.MustCompile(`^192\.0\.2\.1 - alice \[\d\d/\w{3}/\d{4}:\d\d:\d\d:\d\d [-+]\d{4}\] "GET /index.html\?lang=en HTTP/1.1" 200 5 "http://example.com/" "Mozilla/4.08 \\"quoted\\"" \d+$`)
+	if !want.MatchString(rec.Message) {
+		t.Errorf("got %q", rec.Message)
+	}
+	if rec.Level != log4go.INFO || rec.Category != "access" || rec.Source != "httplog" {
+		t.Errorf("got level %v, category %q and source %q", rec.Level, rec.Category, rec.Source)
+	}
+}
+
+func TestStructured(t *testing.T) {
+	l, w := newTestLogger(Structured)
+	h := l.Handler(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Millisecond)
+		http.Error(rw, "no such user", http.StatusNotFound)
+	}))
+	r := httptest.NewRequest("DELETE", "/users/42", nil)
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	if len(w.records) != 1 {
+		t.Fatalf("got %d records, want 1", len(w.records))
+	}
+	rec := w.records[0]
+	if rec.Message != "DELETE /users/42 404" || rec.Level != log4go.WARNING {
+		t.Errorf("got %q at %v", rec.Message, rec.Level)
+	}
+	f := rec.Fields
+	if f["method"] != "DELETE" || f["path"] != "/users/42" || f["status"] != 404 || f["bytes"] != int64(len("no such user\n")) || f["remote"] != r.RemoteAddr {
+		t.Errorf("got fields %v", f)
+	}
+	if latency, _ := f["latency"].(time.Duration); latency < time.Millisecond {
+		t.Errorf("got latency %v", f["latency"])
+	}
+}
+
+func TestLevels(t *testing.T) {
+	l, w := newTestLogger(Structured)
+	for _, status := range []int{http.StatusNoContent, http.StatusFound, http.StatusBadRequest, http.StatusServiceUnavailable} {
+		status := status
+		l.Handler(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			rw.WriteHeader(status)
+		})).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	}
+	want := []log4go.Level{log4go.INFO, log4go.INFO, log4go.WARNING, log4go.ERROR}
+	if len(w.records) != len(want) {
+		t.Fatalf("got %d records", len(w.records))
+	}
+	for i, rec := range w.records {
+		if rec.Level != want[i] {
+			t.Errorf("%s: got %v, want %v", rec.Message, rec.Level, want[i])
+		}
+	}
+}
+
+func TestResponseWriter(t *testing.T) {
+	l, w := newTestLogger(Structured)
+	s := httptest.NewServer(l.Handler(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/stream":
+			rw.(http.Flusher).Flush()
+			io.WriteString(rw, "data")
+		case "/file":
+			// Served with ReadFrom
+			io.Copy(rw, strings.NewReader("contents"))
+		case "/upgrade":
+			conn, buf, err := rw.(http.Hijacker).Hijack()
+			if err != nil {
+				t.Errorf("Hijack: %s", err)
+				return
+			}
+			buf.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: close\r\n\r\n")
+			buf.Flush()
+			conn.Close()
+		}
+	})))
+	defer s.Close()
+
+	for _, path := range []string{"/stream", "/file", "/upgrade"} {
+		resp, err := http.Get(s.URL + path)
+		if err != nil {
+			t.Fatalf("%s: %s", path, err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+	s.Close()
+
+	// The server does not wait for the handler of a hijacked connection
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for i := 0; i < 100 && len(w.records) < 3; i++ {
+		w.mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		w.mu.Lock()
+	}
+	got := map[string]log4go.Fields{}
+	for _, rec := range w.records {
+		got[rec.Fields["path"].(string)] = rec.Fields
+	}
+	for path, want := range map[string][2]interface{}{
+		"/stream":  {200, int64(4)},
+		"/file":    {200, int64(8)},
+		"/upgrade": {101, int64(0)},
+	} {
+		if f := got[path]; f["status"] != want[0] || f["bytes"] != want[1] {
+			t.Errorf("%s: got fields %v", path, f)
+		}
+	}
+}
+
+func TestRecover(t *testing.T) {
+	l, w := newTestLogger(Structured)
+	h := l.Handler(l.Recover(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/started" {
+			io.WriteString(rw, "partial")
+		}
+		var m map[string]int
+		m["boom"]++
+	})))
+
+	resp := httptest.NewRecorder()
+	h.ServeHTTP(resp, httptest.NewRequest("POST", "/orders", nil))
+	if resp.Code != http.StatusInternalServerError {
+		t.Errorf("got status %d", resp.Code)
+	}
+	if len(w.records) != 2 {
+		t.Fatalf("got %d records, want 2", len(w.records))
+	}
+	rec := w.records[0]
+	if rec.Level != log4go.CRITICAL || !strings.HasPrefix(rec.Message, "panic serving POST /orders: assignment to entry in nil map") {
+		t.Errorf("got %q at %v", rec.Message, rec.Level)
+	}
+	if _, ok := rec.Fields[log4go.ErrorKey].(error); !ok || rec.Fields["method"] != "POST" || rec.Fields["path"] != "/orders" {
+		t.Errorf("got fields %v", rec.Fields)
+	}
+	// The trace goes down to the panic
+	if !strings.Contains(rec.Stack, "httplog.TestRecover.func1") || !strings.Contains(rec.Stack, "panic(") {
+		t.Errorf("got stack %q", rec.Stack)
+	}
+	if access := w.records[1]; access.Message != "POST /orders 500" {
+		t.Errorf("got access log %q", access.Message)
+	}
+
+	// Once the response started, it can only be aborted
+	func() {
+		defer func() {
+			if e := recover(); e != http.ErrAbortHandler {
+				t.Errorf("got panic %v, want http.ErrAbortHandler", e)
+			}
+		}()
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/started", nil))
+	}()
+	if len(w.records) != 3 || w.records[2].Level != log4go.CRITICAL {
+		t.Errorf("got %d records", len(w.records))
+	}
+
+	// Aborting is not an error
+	func() {
+		defer func() { recover() }()
+		l.Recover(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			panic(http.ErrAbortHandler)
+		})).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	}()
+	if len(w.records) != 3 {
+		t.Errorf("ErrAbortHandler: got %d records, want 3", len(w.records))
+	}
+}
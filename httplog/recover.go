@@ -0,0 +1,65 @@
+package httplog
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/jeanphorn/log4go"
+)
+
+// Recover returns next, recovering from the panics of its handlers and
+// logging them to category of log4go.Global, see Logger.Recover.
+func Recover(category string, next http.Handler) http.Handler {
+	return New(log4go.LOGGER(category)).Recover(next)
+}
+
+// Recover returns next, recovering from the panics of its handlers.  A
+// panic is logged at CRITICAL as "panic serving GET /path: value", with the
+// panic value as the field log4go.ErrorKey, the method, path and remote
+// address of the request as fields, and the stack trace of the panic as the
+// record's Stack, written by %K and as "stack" in JSON.  The client gets a
+// 500 Internal Server Error if the response had not started; otherwise the
+// response is aborted with http.ErrAbortHandler, as net/http does, so that
+// the client does not take it for complete.  Panics with
+// http.ErrAbortHandler itself are passed on without being logged.
+//
+// Wrap the Recover handler with Handler for the 500s to be access logged:
+//
+//	http.ListenAndServe(":8080", httplog.Handler("access", httplog.Recover("panic", mux)))
+func (l *Logger) Recover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rw := &responseWriter{ResponseWriter: w}
+		defer func() {
+			e := recover()
+			if e == nil {
+				return
+			}
+			if e == http.ErrAbortHandler {
+				panic(e)
+			}
+			l.LogPanic(r, e, debug.Stack())
+			if rw.status != 0 {
+				panic(http.ErrAbortHandler)
+			}
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}()
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// LogPanic logs the panic e, recovered while serving r, with stack, e.g.
+// from runtime/debug.Stack, as Recover does, for frameworks with their own
+// middleware.
+func (l *Logger) LogPanic(r *http.Request, e interface{}, stack []byte) {
+	err, ok := e.(error)
+	if !ok {
+		err = fmt.Errorf("%v", e)
+	}
+	l.filter.WithContext(r.Context()).WithFields(log4go.Fields{
+		log4go.ErrorKey: err,
+		"method":        r.Method,
+		"path":          r.URL.Path,
+		"remote":        r.RemoteAddr,
+	}).LogStack(log4go.CRITICAL, "httplog", "panic serving "+r.Method+" "+r.URL.Path+": "+err.Error(), string(stack))
+}
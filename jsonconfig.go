@@ -4,24 +4,46 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"net/http"
 	"os"
+	"path/filepath"
 	"strings"
-
-	"github.com/toolkits/file"
+	"time"
 )
 
 type ConsoleConfig struct {
-	Enable  bool   `json:"enable"`
-	Level   string `json:"level"`
-	Pattern string `json:"pattern"`
+	Enable   bool   `json:"enable"`
+	Level    string `json:"level"`
+	MaxLevel string `json:"max_level"` // Drop more severe records, e.g. "INFO" to leave WARNING and above to another writer
+	Pattern  string `json:"pattern"`
+	Format   string `json:"format"` // "json", "logfmt", or "pretty" for local development, otherwise Pattern is used
+	UTC      bool   `json:"utc"`    // Format times in UTC instead of local time
+	Escape   string `json:"escape"` // Escape messages: none, newline, control or quote
+	Raw      bool   `json:"raw"`    // Write records without the trailing newline
+
+	MaxMessageLength string `json:"max_message_length"` // Truncate longer messages, \d+[KMG]? Suffixes are in terms of 2**10
+
+	// Only messages matching one of the Allow regular expressions, if any,
+	// and none of the Deny ones are written
+	Allow []string `json:"allow"`
+	Deny  []string `json:"deny"`
+
+	BufferLength int    `json:"buffer_length"` // Records queued before logging blocks, LogBufferLength if zero
+	Overflow     string `json:"overflow"`      // When the queue is full: "block" (default), "drop" or "drop_oldest"
 }
 
 type FileConfig struct {
 	Enable   bool   `json:"enable"`
-	Category string `json:"category"`
+	Category string `json:"category"` // May be a wildcard pattern, e.g. "api.*" or "worker-??"
 	Level    string `json:"level"`
+	MaxLevel string `json:"max_level"` // Drop more severe records, e.g. "INFO" to leave WARNING and above to another file
 	Filename string `json:"filename"`
 
+	// More categories written to the same file through one writer, e.g.
+	// ["worker", "cron"]; with only these, Category may be left empty
+	Categories []string `json:"categories"`
+
 	// %T - Time (15:04:05 MST)
 	// %t - Time (15:04)
 	// %D - Date (2006/01/02)
@@ -33,22 +55,103 @@ type FileConfig struct {
 	// It ignores unknown format strings (and removes them)
 	// Recommended: "[%D %T] [%C] [%L] (%S) %M"//
 	Pattern string `json:"pattern"`
+	Format  string `json:"format"` // "json" or "logfmt", otherwise Pattern is used
+	UTC     bool   `json:"utc"`    // Format times in UTC instead of local time
 
 	Rotate   bool   `json:"rotate"`
 	Maxsize  string `json:"maxsize"`  // \d+[KMG]? Suffixes are in terms of 2**10
 	Maxlines string `json:"maxlines"` //\d+[KMG]? Suffixes are in terms of thousands
 	Daily    bool   `json:"daily"`    //Automatically rotates by day
 	Sanitize bool   `json:"sanitize"` //Sanitize newlines to prevent log injection
+	Escape   string `json:"escape"`   //Escape messages: none, newline, control or quote (overrides sanitize)
+	Raw      bool   `json:"raw"`      //Write records without the trailing newline
+
+	MaxMessageLength string `json:"max_message_length"` //Truncate longer messages, \d+[KMG]? Suffixes are in terms of 2**10
+
+	// Only messages matching one of the Allow regular expressions, if any,
+	// and none of the Deny ones are written
+	Allow []string `json:"allow"`
+	Deny  []string `json:"deny"`
+
+	// Messages a second, on average, logged for the category, and the bursts
+	// allowed above it (1 if zero); no limit if zero, see SetRateLimit
+	RateLimit float64 `json:"rate_limit"`
+	RateBurst int     `json:"rate_burst"`
+
+	Compression string `json:"compression"` //Compress rotated backups: gzip, zstd or none
+	Maxbackup   int    `json:"maxbackup"`   //Number of backups to keep
+	Timestamp   bool   `json:"timestamp"`   //Name backups by rotation time (app.log.20240615-130501.123)
+
+	FlushInterval string `json:"flush_interval"` //Buffer writes and flush at least this often, e.g. "1s"
+
+	SplitByLevel bool `json:"split_by_level"` //Write each level to its own file (app.error.log, app.info.log, ...)
+
+	EncryptKeyEnv  string `json:"encrypt_key_env"`  //Encrypt the file with the hex AES key in this environment variable
+	EncryptKeyFile string `json:"encrypt_key_file"` //Encrypt the file with the AES key (raw or hex) read from this file
+
+	BufferLength int    `json:"buffer_length"` //Records queued before logging blocks, LogBufferLength if zero
+	Overflow     string `json:"overflow"`      //When the queue is full: "block" (default), "drop" or "drop_oldest"
+	Shards       int    `json:"shards"`        //Queues formatted in parallel for heavy logging, see SetShards
 }
 
 type SocketConfig struct {
 	Enable   bool   `json:"enable"`
-	Category string `json:"category"`
+	Category string `json:"category"` // May be a wildcard pattern, e.g. "api.*" or "worker-??"
 	Level    string `json:"level"`
+	MaxLevel string `json:"max_level"` // Drop more severe records
 	Pattern  string `json:"pattern"`
+	Format   string `json:"format"`  // "json", "logfmt", "msgpack" or "pattern" encoding, the LogRecord as JSON if empty
+	Framing  string `json:"framing"` // "newline" or "length_prefix", see SetFraming
+	UTC      bool   `json:"utc"`     // Send times in UTC instead of local time
+	Raw      bool   `json:"raw"`     // Send records without the trailing newline
+
+	MaxMessageLength string `json:"max_message_length"` // Truncate longer messages, \d+[KMG]? Suffixes are in terms of 2**10
+
+	// Only messages matching one of the Allow regular expressions, if any,
+	// and none of the Deny ones are written
+	Allow []string `json:"allow"`
+	Deny  []string `json:"deny"`
+
+	// Messages a second, on average, logged for the category, and the bursts
+	// allowed above it (1 if zero); no limit if zero, see SetRateLimit
+	RateLimit float64 `json:"rate_limit"`
+	RateBurst int     `json:"rate_burst"`
 
 	Addr     string `json:"addr"`
 	Protocol string `json:"protocol"`
+
+	// Connect over TLS (tcp only), verifying the collector against TLSCA, or
+	// the system roots, and presenting TLSCert and TLSKey for mutual TLS
+	TLS                   bool   `json:"tls"`
+	TLSCert               string `json:"tls_cert"`
+	TLSKey                string `json:"tls_key"`
+	TLSCA                 string `json:"tls_ca"`
+	TLSServerName         string `json:"tls_server_name"`          //Name verified in the collector's certificate, the host of addr if empty
+	TLSInsecureSkipVerify bool   `json:"tls_insecure_skip_verify"` //Do not verify the collector's certificate, for testing only
+
+	FlushInterval string `json:"flush_interval"` //Buffer tcp writes and flush at least this often, e.g. "1s"
+
+	MaxDatagramSize int    `json:"max_datagram_size"` //Largest udp datagram, e.g. 1400, DefaultMaxDatagramSize if zero
+	DatagramPolicy  string `json:"datagram_policy"`   //Larger records: "truncate" (default) or "split" their message
+
+	Expvar string `json:"expvar"` //Publish the writer's Stats as this expvar, see PublishExpvar
+
+	DialTimeout  string `json:"dial_timeout"`  //Give up connecting after this long, DefaultDialTimeout if empty
+	WriteTimeout string `json:"write_timeout"` //Reconnect when a write takes longer, e.g. "10s"; writes may block if empty
+	KeepAlive    string `json:"keepalive"`     //Period of tcp keep-alive probes, e.g. "1m"; "-1s" disables them, 15s if empty
+
+	ReconnectDelay    string `json:"reconnect_delay"`     //Wait before dialing again after the connection drops, doubled after each failure, e.g. "100ms"
+	MaxReconnectDelay string `json:"max_reconnect_delay"` //Longest wait between attempts, e.g. "30s"
+
+	BufferLength int    `json:"buffer_length"` //Records queued before logging blocks, LogBufferLength if zero
+	Overflow     string `json:"overflow"`      //When the queue is full: "block" (default), "drop" or "drop_oldest"
+
+	BatchRecords  int    `json:"batch_records"`  //Send up to this many records together, see SetBatch
+	BatchInterval string `json:"batch_interval"` //Send the records logged within this interval together, e.g. "200ms"
+	Compression   string `json:"compression"`    //Compress what is sent: gzip, zstd or none
+
+	Spool        string `json:"spool"`          //File spooling records when the queue is full, e.g. while the collector is down, see SetSpool
+	SpoolMaxSize string `json:"spool_max_size"` //Drop records spooled beyond this size, \d+[KMG]? Suffixes are in terms of 2**10
 }
 
 // LogConfig presents json log config struct
@@ -56,11 +159,101 @@ type LogConfig struct {
 	Console *ConsoleConfig  `json:"console"`
 	Files   []*FileConfig   `json:"files"`
 	Sockets []*SocketConfig `json:"sockets"`
+
+	// MissingCategory decides what happens to file and socket entries without
+	// a category:
+	//   "error" (or empty) - refuse the configuration
+	//   "default"          - use DefaultCategory
+	//   "filename"         - derive it from the file name ("logs/api.log" -> "api"),
+	//                        falling back to DefaultCategory for sockets
+	MissingCategory string `json:"missing_category"`
+
+	// LevelNames overrides the names displayed for levels, e.g.
+	// {"WARNING": "WARNING"} instead of "WARN"; see SetLevelName
+	LevelNames map[string]string `json:"level_names"`
+
+	// GlobalFields are attached to every record, e.g. {"app": "billing",
+	// "env": "prod"}; see SetGlobalFields
+	GlobalFields map[string]interface{} `json:"global_fields"`
+
+	// Redact lists the redactors applied to every record, e.g.
+	// [{"name": "email"}, {"pattern": "ssn=\\d+", "replacement": "ssn=***"}];
+	// see SetRedactors
+	Redact []RedactConfig `json:"redact"`
+
+	// A "defaults" object holds keys inherited by every file and socket
+	// entry that does not set them, e.g. {"pattern": "...", "rotate": true}.
+	// It is merged into the entries while parsing, so it has no field here.
+}
+
+// DefaultCategory is the implicit category given to config entries without
+// one when MissingCategory is "default" or "filename".
+var DefaultCategory = "app"
+
+// resolveCategory returns the category to use for a config entry, or false if
+// the entry has none and the configuration is strict.
+func (lc *LogConfig) resolveCategory(category, fname string) (string, bool) {
+	if len(category) > 0 {
+		return category, true
+	}
+	switch lc.MissingCategory {
+	case "default":
+		return DefaultCategory, true
+	case "filename":
+		base := filepath.Base(fname)
+		base = strings.TrimSuffix(base, filepath.Ext(base))
+		if len(fname) == 0 || base == "." || len(base) == 0 {
+			return DefaultCategory, true
+		}
+		return base, true
+	}
+	return "", false
+}
+
+// fileCategories returns the categories of a file entry: its category, as
+// resolved by resolveCategory, and those in its categories list.
+func (lc *LogConfig) fileCategories(fc *FileConfig) ([]string, bool) {
+	var categories []string
+	if len(fc.Category) > 0 || len(fc.Categories) == 0 {
+		category, ok := lc.resolveCategory(fc.Category, fc.Filename)
+		if !ok {
+			return nil, false
+		}
+		categories = append(categories, category)
+	}
+	for _, category := range fc.Categories {
+		dup := len(category) == 0
+		for _, c := range categories {
+			dup = dup || c == category
+		}
+		if !dup {
+			categories = append(categories, category)
+		}
+	}
+	return categories, len(categories) > 0
 }
 
+// sharedWriter is the writer of all but the first category of a file entry
+// with several categories.  The file is written and closed through the first
+// category's filter, which also takes the records without a category that a
+// Logger sends to every filter.
+type sharedWriter struct {
+	LogWriter
+}
+
+func (w sharedWriter) LogWrite(rec *LogRecord) {
+	if len(rec.Category) > 0 {
+		w.LogWriter.LogWrite(rec)
+	}
+}
+
+func (w sharedWriter) Close() {}
+
 // LoadJsonConfiguration load log config from json file
 // see examples/example.json for ducumentation
-func (log Logger) LoadJsonConfiguration(filename string) {
+// ${VAR} and ${VAR:-default} in the file are replaced by environment variables
+// profile selects the "profiles" overlay to use, ProfileEnv if not given
+func (log Logger) LoadJsonConfiguration(filename string, profile ...string) {
 	log.Close()
 	dst := new(bytes.Buffer)
 	var (
@@ -79,45 +272,92 @@ func (log Logger) LoadJsonConfiguration(filename string) {
 		content = string(dst.Bytes())
 	}
 
-	err = json.Unmarshal([]byte(content), &lc)
+	err = decodeJSONConfig([]byte(expandConfigEnv(content)), firstString(profile), &lc)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "LoadJsonConfiguration: Error: Could not parse json configuration in %q: %s\n", filename, err)
 		os.Exit(1)
 	}
+	log.applyConfig(filename, &lc)
+}
+
+// applyConfig sets up the filters of a parsed configuration.
+func (log Logger) applyConfig(filename string, lc *LogConfig) {
+	// The environment overrides the configured levels, see LevelEnv
+	defer log.applyEnvLevels()
 
-	if lc.Console.Enable {
+	for level, name := range lc.LevelNames {
+		lvl, ok := configLevel(level)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "LoadJsonConfiguration: Warning: Unknown level \"%s\" in level_names in %s\n", level, filename)
+			continue
+		}
+		SetLevelName(lvl, name)
+	}
+	if lc.GlobalFields != nil {
+		SetGlobalFields(lc.GlobalFields)
+	}
+	if lc.Redact != nil {
+		SetRedactors(configRedactors("LoadJsonConfiguration", filename, lc.Redact)...)
+	}
+
+	if lc.Console != nil && lc.Console.Enable {
 		filt, _ := jsonToConsoleLogWriter(filename, lc.Console)
-		log["stdout"] = &Filter{getLogLevel(lc.Console.Level), filt, "DEFAULT"}
+		log.set("stdout", &Filter{Level: getLogLevel(lc.Console.Level), LogWriter: jsonWrapWriter(filename, filt, lc.Console.MaxLevel, lc.Console.Allow, lc.Console.Deny), Category: "DEFAULT"})
 	}
 
 	for _, fc := range lc.Files {
 		if !fc.Enable {
 			continue
 		}
-		if len(fc.Category) == 0 {
-			fmt.Fprintf(os.Stderr, "LoadJsonConfiguration: file category can not be empty in <%s>: ", filename)
+		categories, ok := lc.fileCategories(fc)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "LoadJsonConfiguration: file category can not be empty in <%s>\n", filename)
 			os.Exit(1)
 		}
 
 		filt, _ := jsonToFileLogWriter(filename, fc)
-		log[fc.Category] = &Filter{getLogLevel(fc.Level), filt, fc.Category}
+		lvl := getLogLevel(fc.Level)
+		for i, category := range categories {
+			w := filt
+			if i > 0 {
+				w = sharedWriter{filt}
+			}
+			log.add(category, &Filter{Level: lvl, LogWriter: jsonWrapWriter(filename, w, fc.MaxLevel, fc.Allow, fc.Deny), Category: category})
+			if fc.RateLimit > 0 {
+				log.SetRateLimit(category, fc.RateLimit, fc.RateBurst)
+			}
+		}
 	}
 
 	for _, sc := range lc.Sockets {
 		if !sc.Enable {
 			continue
 		}
-		if len(sc.Category) == 0 {
-			fmt.Fprintf(os.Stderr, "LoadJsonConfiguration: file category can not be empty in <%s>: ", filename)
+		category, ok := lc.resolveCategory(sc.Category, "")
+		if !ok {
+			fmt.Fprintf(os.Stderr, "LoadJsonConfiguration: socket category can not be empty in <%s>\n", filename)
 			os.Exit(1)
 		}
 
-		filt, _ := jsonToSocketLogWriter(filename, sc)
-		log[sc.Category] = &Filter{getLogLevel(sc.Level), filt, sc.Category}
+		filt, ok := jsonToSocketLogWriter(filename, sc)
+		if !ok {
+			// The socket could not be opened, which was reported already
+			continue
+		}
+		log.add(category, &Filter{Level: getLogLevel(sc.Level), LogWriter: jsonWrapWriter(filename, filt, sc.MaxLevel, sc.Allow, sc.Deny), Category: category})
+		if sc.RateLimit > 0 {
+			log.SetRateLimit(category, sc.RateLimit, sc.RateBurst)
+		}
 	}
 
 }
 
+// jsonWrapWriter wraps the writer of an entry for its max_level, allow and
+// deny values.
+func jsonWrapWriter(filename string, w LogWriter, maxLevel string, allow, deny []string) LogWriter {
+	return withMessageFilter("LoadJsonConfiguration", filename, withMaxLevel(w, maxLevel), allow, deny)
+}
+
 func getLogLevel(l string) Level {
 	var lvl Level
 	switch l {
@@ -137,7 +377,14 @@ func getLogLevel(l string) Level {
 		lvl = ERROR
 	case "CRITICAL":
 		lvl = CRITICAL
+	case "PANIC":
+		lvl = PANIC
+	case "FATAL":
+		lvl = FATAL
 	default:
+		if custom, ok := customConfigLevel(l); ok {
+			return custom
+		}
 		fmt.Fprintf(os.Stderr, "LoadJsonConfiguration: Error: Required level <%s> for filter has unknown value: %s\n", "level", l)
 		os.Exit(1)
 	}
@@ -149,6 +396,7 @@ func jsonToConsoleLogWriter(filename string, cf *ConsoleConfig) (*ConsoleLogWrit
 
 	if len(cf.Pattern) > 0 {
 		format = strings.Trim(cf.Pattern, " \r\n")
+		checkPattern(filename, format)
 	}
 
 	if !cf.Enable {
@@ -157,48 +405,101 @@ func jsonToConsoleLogWriter(filename string, cf *ConsoleConfig) (*ConsoleLogWrit
 
 	clw := NewConsoleLogWriter()
 	clw.SetFormat(format)
+	switch cf.Format {
+	case "json":
+		clw.SetJSON(true)
+	case "logfmt":
+		clw.SetLogfmt(true)
+	case "pretty":
+		clw.SetPretty(true)
+	}
+	clw.SetUTC(cf.UTC)
+	clw.SetEscape(parseEscape("LoadJsonConfiguration", filename, cf.Escape, EscapeNone))
+	clw.SetMaxMessageLength(strToNumSuffix(strings.Trim(cf.MaxMessageLength, " \r\n"), 1024))
+	clw.SetRaw(cf.Raw)
+	if cf.BufferLength > 0 {
+		clw.SetBufferLength(cf.BufferLength)
+	}
+	clw.SetOverflowPolicy(parseOverflow("LoadJsonConfiguration", filename, cf.Overflow))
 
 	return clw, true
 }
 
-func jsonToFileLogWriter(filename string, ff *FileConfig) (*FileLogWriter, bool) {
+func jsonToFileLogWriter(filename string, ff *FileConfig) (LogWriter, bool) {
 	file := "app.log"
-	format := "[%D %T] [%C] [%L] (%S) %M"
-	maxlines := 0
-	maxsize := 0
-	daily := false
-	rotate := false
-	sanitize := false
+	opts := defaultFileOptions()
+	opts.format = "[%D %T] [%C] [%L] (%S) %M"
 
 	if len(ff.Filename) > 0 {
 		file = ff.Filename
 	}
 	if len(ff.Pattern) > 0 {
-		format = strings.Trim(ff.Pattern, " \r\n")
+		opts.format = strings.Trim(ff.Pattern, " \r\n")
+		checkPattern(filename, opts.format)
 	}
 	if len(ff.Maxlines) > 0 {
-		maxlines = strToNumSuffix(strings.Trim(ff.Maxlines, " \r\n"), 1000)
+		opts.maxlines = strToNumSuffix(strings.Trim(ff.Maxlines, " \r\n"), 1000)
 	}
 	if len(ff.Maxsize) > 0 {
-		maxsize = strToNumSuffix(strings.Trim(ff.Maxsize, " \r\n"), 1024)
+		opts.maxsize = strToNumSuffix(strings.Trim(ff.Maxsize, " \r\n"), 1024)
+	}
+	if ff.Maxbackup > 0 {
+		opts.maxbackup = ff.Maxbackup
 	}
-	daily = ff.Daily
-	rotate = ff.Rotate
-	sanitize = ff.Sanitize
+	switch ff.Format {
+	case "json":
+		opts.formatter = NewJSONFormatter()
+	case "logfmt":
+		opts.formatter = NewLogfmtFormatter()
+	}
+	if ff.Sanitize {
+		opts.escape = EscapeNewline
+	}
+	opts.escape = parseEscape("LoadJsonConfiguration", filename, ff.Escape, opts.escape)
+	opts.maxMessage = strToNumSuffix(strings.Trim(ff.MaxMessageLength, " \r\n"), 1024)
+	opts.raw = ff.Raw
+	opts.compression = ff.Compression
+	opts.timestamp = ff.Timestamp
+	opts.utc = ff.UTC
+	opts.flushInterval = parseFlushInterval(filename, ff.FlushInterval)
+	opts.keySource = fileKeySource(ff.EncryptKeyEnv, ff.EncryptKeyFile)
+	opts.bufferLength = ff.BufferLength
+	opts.overflow = parseOverflow("LoadJsonConfiguration", filename, ff.Overflow)
+	opts.shards = ff.Shards
 
 	if !ff.Enable {
 		return nil, true
 	}
 
-	flw := NewFileLogWriter(file, rotate, daily)
-	flw.SetFormat(format)
-	flw.SetRotateLines(maxlines)
-	flw.SetRotateSize(maxsize)
-	flw.SetSanitize(sanitize)
-	return flw, true
+	fw, err := newFileWriter(file, ff.Rotate, ff.Daily, ff.SplitByLevel, &opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "LoadJsonConfiguration: Error: Could not set up file %s in %s: %s\n", file, filename, err)
+		os.Exit(1)
+	}
+	return fw, true
 }
 
-func jsonToSocketLogWriter(filename string, sf *SocketConfig) (SocketLogWriter, bool) {
+// checkPattern warns about pattern mistakes, which otherwise only show up as
+// broken output.
+func checkPattern(filename, pattern string) {
+	if err := ValidatePattern(pattern); err != nil {
+		fmt.Fprintf(os.Stderr, "LoadJsonConfiguration: Warning: %s in %s\n", err, filename)
+	}
+}
+
+// tls returns the TLS settings of sf.
+func (sf *SocketConfig) tls() socketTLS {
+	return socketTLS{
+		enable:     sf.TLS,
+		cert:       sf.TLSCert,
+		key:        sf.TLSKey,
+		ca:         sf.TLSCA,
+		serverName: sf.TLSServerName,
+		insecure:   sf.TLSInsecureSkipVerify,
+	}
+}
+
+func jsonToSocketLogWriter(filename string, sf *SocketConfig) (LogWriter, bool) {
 	endpoint := ""
 	protocol := "tcp"
 
@@ -221,22 +522,93 @@ func jsonToSocketLogWriter(filename string, sf *SocketConfig) (SocketLogWriter,
 		return nil, true
 	}
 
-	return NewSocketLogWriter(protocol, endpoint), true
+	slw, err := sf.tls().dial(socketDialer(filename, sf.DialTimeout, sf.KeepAlive), protocol, endpoint)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "LoadConfiguration: Error: %s for socket %q in %s\n", err, endpoint, filename)
+		return nil, false
+	}
+	if slw == nil {
+		return nil, false
+	}
+	slw.SetJSON(sf.Format == "json")
+	switch sf.Format {
+	case "logfmt":
+		slw.SetLogfmt(true)
+	case "msgpack":
+		slw.SetMsgpack(true)
+	case "pattern":
+		pattern := FORMAT_DEFAULT
+		if len(sf.Pattern) > 0 {
+			pattern = strings.Trim(sf.Pattern, " \r\n")
+			checkPattern(filename, pattern)
+		}
+		slw.SetFormatter(PatternFormatter(pattern))
+	}
+	slw.SetFraming(parseFraming(filename, sf.Framing))
+	slw.SetFlushInterval(parseFlushInterval(filename, sf.FlushInterval))
+	slw.SetWriteTimeout(parseSocketDuration(filename, "write_timeout", sf.WriteTimeout))
+	slw.SetReconnectDelay(parseSocketDuration(filename, "reconnect_delay", sf.ReconnectDelay),
+		parseSocketDuration(filename, "max_reconnect_delay", sf.MaxReconnectDelay))
+	slw.SetUTC(sf.UTC)
+	slw.SetMaxMessageLength(strToNumSuffix(strings.Trim(sf.MaxMessageLength, " \r\n"), 1024))
+	slw.SetRaw(sf.Raw)
+	if sf.BufferLength > 0 {
+		slw.SetBufferLength(sf.BufferLength)
+	}
+	slw.SetOverflowPolicy(parseOverflow("LoadJsonConfiguration", filename, sf.Overflow))
+	slw.SetMaxDatagramSize(sf.MaxDatagramSize, parseDatagramPolicy(filename, sf.DatagramPolicy))
+	slw.SetBatch(sf.BatchRecords, parseBatchInterval(filename, sf.BatchInterval))
+	slw.SetCompression(sf.Compression)
+	if len(sf.Spool) > 0 {
+		slw.SetSpool(expandFilename(sf.Spool), int64(strToNumSuffix(strings.Trim(sf.SpoolMaxSize, " \r\n"), 1024)))
+	}
+	if len(sf.Expvar) > 0 {
+		slw.PublishExpvar(sf.Expvar)
+	}
+	return slw, true
 }
 
+// configFetchTimeout bounds how long ReadFile waits for a remote config.
+var configFetchTimeout = 10 * time.Second
+
+// ReadFile returns the trimmed contents of a configuration source.  path may
+// be a file name, "-" for standard input, or an http:// or https:// URL.
 func ReadFile(path string) (string, error) {
 	if path == "" {
 		return "", fmt.Errorf("[%s] path empty", path)
 	}
 
-	if !file.IsExist(path) {
-		return "", fmt.Errorf("config file %s is nonexistent", path)
+	var (
+		configContent []byte
+		err           error
+	)
+	switch {
+	case path == "-":
+		configContent, err = ioutil.ReadAll(os.Stdin)
+	case strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://"):
+		configContent, err = readURL(path)
+	default:
+		configContent, err = ioutil.ReadFile(path)
+		if os.IsNotExist(err) {
+			return "", fmt.Errorf("config file %s is nonexistent", path)
+		}
 	}
-
-	configContent, err := file.ToTrimString(path)
 	if err != nil {
 		return "", fmt.Errorf("read file %s fail %s", path, err)
 	}
 
-	return configContent, nil
+	return strings.TrimSpace(string(configContent)), nil
+}
+
+func readURL(url string) ([]byte, error) {
+	client := &http.Client{Timeout: configFetchTimeout}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
 }
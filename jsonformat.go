@@ -0,0 +1,65 @@
+package log4go
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// JSONFormatter formats each record as one JSON object per line:
+//
+//	{"timestamp":"2009-02-13T23:31:30.123456789Z","level":"EROR","category":"api","source":"main.main:15","message":"..."}
+//
+// Empty category and source are omitted.  Structured fields are emitted as
+// the "fields" object, the stack trace of error records as "stack" and the
+// sequence number as "seq".
+type JSONFormatter struct {
+	// TimeLayout is the layout of the timestamp field (default time.RFC3339Nano)
+	TimeLayout string
+}
+
+// NewJSONFormatter creates a JSONFormatter with the default settings.
+func NewJSONFormatter() *JSONFormatter {
+	return &JSONFormatter{TimeLayout: time.RFC3339Nano}
+}
+
+type jsonRecord struct {
+	Timestamp string `json:"timestamp"`
+	Level     string `json:"level"`
+	Category  string `json:"category,omitempty"`
+	Source    string `json:"source,omitempty"`
+	Message   string `json:"message"`
+	Fields    Fields `json:"fields,omitempty"`
+	Stack     string `json:"stack,omitempty"`
+	Seq       uint64 `json:"seq,omitempty"`
+}
+
+// Format returns rec as a single line of JSON, including the trailing newline.
+func (f *JSONFormatter) Format(rec *LogRecord) []byte {
+	layout := f.TimeLayout
+	if len(layout) == 0 {
+		layout = time.RFC3339Nano
+	}
+	js, err := json.Marshal(&jsonRecord{
+		Timestamp: rec.Created.Format(layout),
+		Level:     rec.Level.String(),
+		Category:  rec.Category,
+		Source:    rec.Source,
+		Message:   rec.Message,
+		Fields:    rec.Fields,
+		Stack:     rec.Stack,
+		Seq:       rec.Seq,
+	})
+	if err != nil {
+		// A field value could not be encoded, keep the rest of the record
+		js, _ = json.Marshal(&jsonRecord{
+			Timestamp: rec.Created.Format(layout),
+			Level:     rec.Level.String(),
+			Category:  rec.Category,
+			Source:    rec.Source,
+			Message:   rec.Message,
+			Fields:    Fields{"error": err.Error()},
+			Stack:     rec.Stack,
+		})
+	}
+	return append(js, '\n')
+}
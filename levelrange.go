@@ -0,0 +1,41 @@
+package log4go
+
+// MaxLevel returns a writer that writes to writer only the records at max or
+// a less severe level, so that a filter writes a range of levels, e.g.
+// DEBUG..INFO to info.log while WARNING and above go to error.log:
+//
+//	log.AddFilter("info", log.DEBUG, log.MaxLevel(log.INFO, infoWriter))
+//	log.AddFilter("error", log.WARNING, errorWriter)
+//
+// The minimum level stays that of the filter.  In configuration files, it is
+// "max_level" in JSON and YAML and <maxlevel> in XML.
+func MaxLevel(max Level, writer LogWriter) LogWriter {
+	return &maxLevelWriter{writer, max}
+}
+
+type maxLevelWriter struct {
+	LogWriter
+	max Level
+}
+
+func (w *maxLevelWriter) LogWrite(rec *LogRecord) {
+	if rec.Level.above(w.max) {
+		return
+	}
+	w.LogWriter.LogWrite(rec)
+}
+
+// Flush flushes the writer if it is a Flusher.
+func (w *maxLevelWriter) Flush() {
+	if f, ok := w.LogWriter.(Flusher); ok {
+		f.Flush()
+	}
+}
+
+// withMaxLevel wraps w in MaxLevel for the "max_level" config value, if set.
+func withMaxLevel(w LogWriter, max string) LogWriter {
+	if len(max) == 0 {
+		return w
+	}
+	return MaxLevel(getLogLevel(max), w)
+}
@@ -0,0 +1,159 @@
+package log4go
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"unsafe"
+)
+
+// level returns the filter's Level, which SetLevel may change while other
+// goroutines log.
+func (f *Filter) level() Level {
+	if f.byName {
+		return f.current().level()
+	}
+	if f.base != nil {
+		return f.base.level()
+	}
+	p := unsafe.Pointer(&f.Level)
+	if unsafe.Sizeof(f.Level) == 8 {
+		return Level(atomic.LoadInt64((*int64)(p)))
+	}
+	return Level(atomic.LoadInt32((*int32)(p)))
+}
+
+func (f *Filter) setLevel(lvl Level) {
+	p := unsafe.Pointer(&f.Level)
+	if unsafe.Sizeof(f.Level) == 8 {
+		atomic.StoreInt64((*int64)(p), int64(lvl))
+	} else {
+		atomic.StoreInt32((*int32)(p), int32(lvl))
+	}
+}
+
+// SetLevel changes the minimum level of the filter registered for category
+// ("stdout" for the console) while the program runs, e.g. to turn on DEBUG
+// for one category without reloading the configuration.  Logging through
+// LOGGER(category), and the filters derived from it with WithFields, Child
+// or WithContext, see the change at once.
+func (log Logger) SetLevel(category string, lvl Level) error {
+	filt, ok := log.get(category)
+	if !ok {
+		return fmt.Errorf("no filter for category %q", category)
+	}
+	filt.setLevel(lvl)
+	return nil
+}
+
+// GetLevel returns the minimum level of the filter registered for category.
+func (log Logger) GetLevel(category string) (Level, bool) {
+	filt, ok := log.get(category)
+	if !ok {
+		return 0, false
+	}
+	return filt.level(), true
+}
+
+// IsEnabledFor reports whether a message logged through f at lvl would be
+// written, so that arguments that are expensive to build are only built
+// when they are needed:
+//
+//	if api.IsEnabledFor(log.DEBUG) {
+//		api.Debug("request: %s", dump(req))
+//	}
+//
+// Rate limits and writer filters may still drop the message.
+func (f *Filter) IsEnabledFor(lvl Level) bool {
+	return lvl.atLeast(f.level())
+}
+
+// IsEnabledFor reports whether a message logged through the logger at lvl
+// would be written by any of its filters.
+func (log Logger) IsEnabledFor(lvl Level) bool {
+	return len(log.enabled(lvl)) > 0
+}
+
+// ParseLevel returns the level called name, as in configuration files
+// ("DEBUG", "WARNING", or a level added with RegisterLevel) or as displayed
+// by %L ("DEBG", "WARN"), in any case.
+func ParseLevel(name string) (Level, error) {
+	s := strings.TrimSpace(name)
+	if lvl, ok := configLevel(s); ok {
+		return lvl, nil
+	}
+	upper := strings.ToUpper(s)
+	if lvl, ok := configLevel(upper); ok {
+		return lvl, nil
+	}
+	for i, short := range levelStrings {
+		if short == upper {
+			return Level(i), nil
+		}
+	}
+	if len(s) > 0 {
+		for lvl := FINEST; lvl <= FATAL; lvl++ {
+			if strings.EqualFold(lvl.String(), s) {
+				return lvl, nil
+			}
+		}
+		levels, _ := customLevels.Load().(map[Level]customLevel)
+		for lvl, cl := range levels {
+			if strings.EqualFold(cl.name, s) || strings.EqualFold(cl.short, s) {
+				return lvl, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("unknown level %q", name)
+}
+
+// MarshalText encodes l as its name in configuration files, e.g. "WARNING",
+// which ParseLevel and UnmarshalText read back.
+func (l Level) MarshalText() ([]byte, error) {
+	if (l < FINEST || l > FATAL) && l < customLevelBase {
+		return nil, fmt.Errorf("unknown level %d", int(l))
+	}
+	if _, ok := l.custom(); l >= customLevelBase && !ok {
+		return nil, fmt.Errorf("unregistered level %d", int(l))
+	}
+	return []byte(configLevelName(l)), nil
+}
+
+// UnmarshalText sets l to the level named text, see ParseLevel.
+func (l *Level) UnmarshalText(text []byte) error {
+	lvl, err := ParseLevel(string(text))
+	if err != nil {
+		return err
+	}
+	*l = lvl
+	return nil
+}
+
+// MarshalJSON keeps levels numbers in JSON, as in the records sent by
+// SocketLogWriter, rather than the names of MarshalText.
+func (l Level) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Itoa(int(l))), nil
+}
+
+// UnmarshalJSON reads a level number or name.
+func (l *Level) UnmarshalJSON(data []byte) error {
+	if n, err := strconv.Atoi(string(data)); err == nil {
+		*l = Level(n)
+		return nil
+	}
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return fmt.Errorf("invalid level %s", data)
+	}
+	return l.UnmarshalText([]byte(name))
+}
+
+// Set sets l to the level called value, so that *Level is a flag.Value:
+//
+//	lvl := log.INFO
+//	flag.Var(&lvl, "level", "minimum level to log")
+func (l *Level) Set(value string) error {
+	return l.UnmarshalText([]byte(value))
+}
@@ -0,0 +1,100 @@
+package log4go
+
+import (
+	"bytes"
+	"sync"
+	"time"
+)
+
+// LineWriter is an io.Writer that logs every line written to it as a record,
+// for APIs that want an io.Writer (exec.Cmd.Stdout, ...); NewStdLogger makes
+// the *log.Logger that others want.  It is safe for concurrent use.
+type LineWriter struct {
+	log      Logger
+	lvl      Level
+	category string
+	fields   Fields
+	splitCR  bool // A lone '\r' ends a line too, for progress output
+	maxLine  int  // Longer lines are logged in parts; no limit if zero
+
+	mu  sync.Mutex
+	buf []byte
+}
+
+// Writer returns a LineWriter logging each line at lvl.  With a category the
+// records are routed like those of LOGGER(category), otherwise they go to
+// every filter, like Log.
+//
+//	cmd.Stderr = log.Global.Writer(log.WARNING, "worker")
+func (log Logger) Writer(lvl Level, category string) *LineWriter {
+	return &LineWriter{log: log, lvl: lvl, category: category}
+}
+
+// Write logs every complete line in p.  The end of p after the last newline
+// is kept until the rest of its line is written, or Flush is called.
+func (w *LineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf = append(w.buf, p...)
+	for {
+		i := w.lineEnd()
+		if i < 0 {
+			break
+		}
+		w.logLine(w.buf[:i])
+		w.buf = w.buf[i+1:]
+	}
+	if w.maxLine > 0 && len(w.buf) >= w.maxLine {
+		w.logLine(w.buf)
+		w.buf = nil
+	}
+	if len(w.buf) == 0 {
+		w.buf = nil
+	}
+	return len(p), nil
+}
+
+// lineEnd returns the index of the byte ending the first line of the buffer,
+// or -1 if the line is incomplete.
+func (w *LineWriter) lineEnd() int {
+	i := bytes.IndexByte(w.buf, '\n')
+	if !w.splitCR {
+		return i
+	}
+	j := bytes.IndexByte(w.buf, '\r')
+	if j < 0 || (i >= 0 && i < j) {
+		return i
+	}
+	if j+1 == len(w.buf) {
+		// It could be the start of a "\r\n"
+		return -1
+	}
+	if w.buf[j+1] == '\n' {
+		return j + 1
+	}
+	return j
+}
+
+// Flush logs the incomplete last line, if any.
+func (w *LineWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.logLine(w.buf)
+	w.buf = nil
+}
+
+func (w *LineWriter) logLine(line []byte) {
+	line = bytes.TrimSuffix(line, []byte{'\r'})
+	if len(line) == 0 {
+		return
+	}
+	w.log.Ingest([]*LogRecord{{
+		Level:     w.lvl,
+		Created:   time.Now(),
+		Message:   string(line),
+		Category:  w.category,
+		Goroutine: currentGoroutine(),
+		Fields:    withMDC(w.fields),
+	}})
+}
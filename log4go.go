@@ -46,11 +46,14 @@
 package log4go
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
-	"runtime"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -64,7 +67,8 @@ const (
 
 /****** Constants ******/
 
-// These are the integer logging levels used by the logger
+// These are the integer logging levels used by the logger.  More can be added
+// with RegisterLevel.
 type Level int
 
 const (
@@ -76,24 +80,67 @@ const (
 	WARNING
 	ERROR
 	CRITICAL
+	PANIC // Logged by Panic, which then panics
+	FATAL // Logged by Fatal, which then exits the program
 )
 
 // Logging level strings
 var (
-	levelStrings = [...]string{"FNST", "FINE", "DEBG", "TRAC", "INFO", "WARN", "EROR", "CRIT"}
+	levelStrings = [...]string{"FNST", "FINE", "DEBG", "TRAC", "INFO", "WARN", "EROR", "CRIT", "PANC", "FATL"}
+)
+
+// levelNames holds the *[len(levelStrings)]string in use once SetLevelName
+// has been called.  It is replaced, never modified, so that writer goroutines
+// can read it without locking.
+var (
+	levelNames     atomic.Value
+	levelNamesLock sync.Mutex
 )
 
 func (l Level) String() string {
-	if l < 0 || int(l) > len(levelStrings) {
+	if cl, ok := l.custom(); ok {
+		return cl.short
+	}
+	if l < 0 || int(l) >= len(levelStrings) {
 		return "UNKNOWN"
 	}
+	if names, ok := levelNames.Load().(*[len(levelStrings)]string); ok {
+		return names[l]
+	}
 	return levelStrings[int(l)]
 }
 
+// SetLevelName changes the name displayed for lvl by %L and the structured
+// formatters, e.g. "WARNING" instead of "WARN" or a localized name.  An empty
+// name restores the default.
+func SetLevelName(lvl Level, name string) {
+	if lvl >= customLevelBase {
+		setCustomName(lvl, name)
+		return
+	}
+	if lvl < 0 || int(lvl) >= len(levelStrings) {
+		return
+	}
+	levelNamesLock.Lock()
+	defer levelNamesLock.Unlock()
+	names := levelStrings
+	if current, ok := levelNames.Load().(*[len(levelStrings)]string); ok {
+		names = *current
+	}
+	names[lvl] = name
+	if len(name) == 0 {
+		names[lvl] = levelStrings[lvl]
+	}
+	levelNames.Store(&names)
+}
+
 /****** Variables ******/
 var (
 	// LogBufferLength specifies how many log messages a particular log4go
-	// logger can buffer at a time before writing them.
+	// logger can buffer at a time before writing them.  It is read when a
+	// writer is created; SetBufferLength, or "buffer_length" in the config,
+	// sets the length of a single writer, and QueueStats shows how full it
+	// gets.
 	LogBufferLength = 32
 )
 
@@ -106,6 +153,61 @@ type LogRecord struct {
 	Source   string    // The message source
 	Message  string    // The log message
 	Category string    // The log group
+
+	// The id of the logging goroutine, only recorded once a pattern uses %g
+	Goroutine uint64 `json:",omitempty"`
+
+	// The file and line of the logging call, if known
+	File string `json:",omitempty"`
+	Line int    `json:",omitempty"`
+
+	// Structured key-value pairs, see Filter.WithFields
+	Fields Fields `json:",omitempty"`
+
+	// The stack of the logging call, see SetErrorStacks
+	Stack string `json:",omitempty"`
+
+	// The number of the record among those created by the process, starting
+	// at 1, so that receivers can detect lost or reordered records
+	Seq uint64 `json:",omitempty"`
+
+	// Set on the markers queued by Flush, closed by the writer goroutine
+	// when it reaches them
+	flushed chan struct{}
+}
+
+// recordSeq is the sequence number of the last record created.
+var recordSeq uint64
+
+// nextSeq returns the sequence number of a new record.
+func nextSeq() uint64 {
+	return atomic.AddUint64(&recordSeq, 1)
+}
+
+// Fields are structured key-value pairs attached to log records.
+type Fields map[string]interface{}
+
+// MarshalJSON encodes errors among the fields as their messages, which
+// encoding/json would otherwise turn into empty objects.
+func (f Fields) MarshalJSON() ([]byte, error) {
+	m := make(map[string]interface{}, len(f))
+	for k, v := range f {
+		if err, ok := v.(error); ok {
+			v = err.Error()
+		}
+		m[k] = v
+	}
+	return json.Marshal(m)
+}
+
+// keys returns the field names in sorted order, so that output is stable.
+func (f Fields) keys() []string {
+	keys := make([]string, 0, len(f))
+	for k := range f {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
 }
 
 /****** LogWriter ******/
@@ -123,15 +225,45 @@ type LogWriter interface {
 /****** Logger ******/
 
 // A Filter represents the log level below which no log records are written to
-// the associated LogWriter.
+// the associated LogWriter.  Filters are created with AddFilter, or with
+// keyed fields, &Filter{Level: INFO, LogWriter: w, Category: "cat"}, as they
+// have unexported fields.
 type Filter struct {
 	Level Level
 	LogWriter
 	Category string
+
+	// Attached to every record logged through the filter, see WithFields
+	fields Fields
+
+	// The filter of the Logger this one was derived from by LOGGER,
+	// WithFields or Child, whose level it follows
+	base *Filter
+
+	// Non-zero when messages logged through the filter are not given their
+	// source, see SetCaptureSource; accessed atomically
+	nosource uint32
+
+	// The *rateLimiter set by SetRateLimit
+	limiter atomic.Value
+
+	// The Logger whose "stdout" filter a handle also writes to, Global if
+	// nil, see Logger.LOGGER
+	logger Logger
+
+	// Set for the handles of LOGGER, which find the filter of their
+	// category in logger when logging, keeping the *handleView in view
+	byName bool
+	view   atomic.Value
+
+	// The writes in progress to a filter of a Logger, and non-zero once it
+	// is retired; accessed atomically, see acquire
+	users   int32
+	retired uint32
 }
 
 // A Logger represents a collection of Filters through which log messages are
-// written.
+// written.  Its methods may be called from several goroutines.
 type Logger map[string]*Filter
 
 // Create a new logger.
@@ -149,7 +281,7 @@ func NewLogger() Logger {
 func NewConsoleLogger(lvl Level) Logger {
 	os.Stderr.WriteString("warning: use of deprecated NewConsoleLogger\n")
 	return Logger{
-		"stdout": &Filter{lvl, NewConsoleLogWriter(), "DEFAULT"},
+		"stdout": &Filter{Level: lvl, LogWriter: NewConsoleLogWriter(), Category: "DEFAULT"},
 	}
 }
 
@@ -157,25 +289,71 @@ func NewConsoleLogger(lvl Level) Logger {
 // or above lvl to standard output.
 func NewDefaultLogger(lvl Level) Logger {
 	return Logger{
-		"stdout": &Filter{lvl, NewConsoleLogWriter(), "DEFAULT"},
+		"stdout": &Filter{Level: lvl, LogWriter: NewConsoleLogWriter(), Category: "DEFAULT"},
 	}
 }
 
 // Closes all log writers in preparation for exiting the program or a
 // reconfiguration of logging.  Calling this is not really imperative, unless
 // you want to guarantee that all log messages are written.  Close removes
-// all filters (and thus all LogWriters) from the logger.
+// all filters (and thus all LogWriters) from the logger, and returns once
+// the writers of this package have written everything queued for them.
+// Records logged by other goroutines meanwhile are written before the
+// writers are closed, or dropped.
 func (log Logger) Close() {
-	// Close all open loggers
-	for name, filt := range log {
+	// Close all open loggers, once nothing is writing to them
+	filters := log.removeAll()
+	retireAll(filters)
+	for _, filt := range filters {
 		filt.Close()
+	}
+}
+
+// CloseTimeout is Close, giving up waiting for the writers after timeout, e.g.
+// so that a stalled socket cannot hold up the exit of the program.  The
+// writers that did not finish in time keep going in the background, and an
+// error reports how many there were.
+func (log Logger) CloseTimeout(timeout time.Duration) error {
+	filters := log.removeAll()
+	done := make(chan bool, len(filters))
+	go func() {
+		retireAll(filters)
+		for _, filt := range filters {
+			go func(filt *Filter) {
+				filt.Close()
+				done <- true
+			}(filt)
+		}
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for closed := 0; closed < len(filters); closed++ {
+		select {
+		case <-done:
+		case <-timer.C:
+			return fmt.Errorf("log4go: %d of %d writers not closed after %s", len(filters)-closed, len(filters), timeout)
+		}
+	}
+	return nil
+}
+
+// removeAll removes all filters from the logger and returns them.
+func (log Logger) removeAll() []*Filter {
+	loggerMu.Lock()
+	defer loggerMu.Unlock()
+	filters := make([]*Filter, 0, len(log))
+	for name, filt := range log {
+		filters = append(filters, filt)
 		delete(log, name)
 	}
+	atomic.AddUint64(&loggerGen, 1)
+	return filters
 }
 
 // Add a new LogWriter to the Logger which will only log messages at lvl or
-// higher.  This function should not be called from multiple goroutines.
-// Returns the logger for chaining.
+// higher, or at the level set in the environment (see LevelEnv).  Returns the
+// logger for chaining.
 func (log Logger) AddFilter(name string, lvl Level, writer LogWriter, categorys ...string) Logger {
 	var c string
 	if len(categorys) > 0 {
@@ -184,32 +362,23 @@ func (log Logger) AddFilter(name string, lvl Level, writer LogWriter, categorys
 		c = "DEFAULT"
 	}
 
-	log[name] = &Filter{lvl, writer, c}
+	filt := &Filter{Level: lvl, LogWriter: writer, Category: c}
+	filt.applyEnvLevel(name)
+	log.set(name, filt)
 	return log
 }
 
 /******* Logging *******/
 // Send a formatted log message internally
 func (log Logger) intLogf(lvl Level, format string, args ...interface{}) {
-	skip := true
-
 	// Determine if any logging will be done
-	for _, filt := range log {
-		if lvl >= filt.Level {
-			skip = false
-			break
-		}
-	}
-	if skip {
+	filters := log.enabled(lvl)
+	if len(filters) == 0 {
 		return
 	}
 
 	// Determine caller func
-	pc, _, lineno, ok := runtime.Caller(2)
-	src := ""
-	if ok {
-		src = fmt.Sprintf("%s:%d", runtime.FuncForPC(pc).Name(), lineno)
-	}
+	src, file, lineno := caller(2, anyCaptureSource(filters))
 
 	msg := format
 	if len(args) > 0 {
@@ -218,89 +387,116 @@ func (log Logger) intLogf(lvl Level, format string, args ...interface{}) {
 
 	// Make the log record
 	rec := &LogRecord{
-		Level:   lvl,
-		Created: time.Now(),
-		Source:  src,
-		Message: msg,
+		Level:     lvl,
+		Created:   time.Now(),
+		Source:    src,
+		File:      file,
+		Line:      lineno,
+		Message:   msg,
+		Goroutine: currentGoroutine(),
+		Seq:       nextSeq(),
+		Fields:    withMDC(nil),
 	}
 
-	// Dispatch the logs
-	for _, filt := range log {
-		if lvl < filt.Level {
-			continue
-		}
-		filt.LogWrite(rec)
+	if rec = runHooks(rec); rec == nil {
+		return
 	}
+
+	// Dispatch the logs
+	writeTo(filters, rec)
 }
 
 // Send a closure log message internally
 func (log Logger) intLogc(lvl Level, closure func() string) {
-	skip := true
-
 	// Determine if any logging will be done
-	for _, filt := range log {
-		if lvl >= filt.Level {
-			skip = false
-			break
-		}
-	}
-	if skip {
+	filters := log.enabled(lvl)
+	if len(filters) == 0 {
 		return
 	}
 
 	// Determine caller func
-	pc, _, lineno, ok := runtime.Caller(2)
-	src := ""
-	if ok {
-		src = fmt.Sprintf("%s:%d", runtime.FuncForPC(pc).Name(), lineno)
-	}
+	src, file, lineno := caller(2, anyCaptureSource(filters))
 
 	// Make the log record
 	rec := &LogRecord{
-		Level:   lvl,
-		Created: time.Now(),
-		Source:  src,
-		Message: closure(),
+		Level:     lvl,
+		Created:   time.Now(),
+		Source:    src,
+		File:      file,
+		Line:      lineno,
+		Message:   closure(),
+		Goroutine: currentGoroutine(),
+		Seq:       nextSeq(),
+		Fields:    withMDC(nil),
 	}
 
-	// Dispatch the logs
-	for _, filt := range log {
-		if lvl < filt.Level {
-			continue
-		}
-		filt.LogWrite(rec)
+	if rec = runHooks(rec); rec == nil {
+		return
 	}
+
+	// Dispatch the logs
+	writeTo(filters, rec)
 }
 
 // Send a log message with manual level, source, and message.
 func (log Logger) Log(lvl Level, source, message string) {
-	skip := true
-
 	// Determine if any logging will be done
-	for _, filt := range log {
-		if lvl >= filt.Level {
-			skip = false
-			break
-		}
-	}
-	if skip {
+	filters := log.enabled(lvl)
+	if len(filters) == 0 {
 		return
 	}
 
 	// Make the log record
 	rec := &LogRecord{
-		Level:   lvl,
-		Created: time.Now(),
-		Source:  source,
-		Message: message,
+		Level:     lvl,
+		Created:   time.Now(),
+		Source:    source,
+		Message:   message,
+		Goroutine: currentGoroutine(),
+		Seq:       nextSeq(),
+		Fields:    withMDC(nil),
+	}
+
+	if rec = runHooks(rec); rec == nil {
+		return
 	}
 
 	// Dispatch the logs
-	for _, filt := range log {
-		if lvl < filt.Level {
+	writeTo(filters, rec)
+}
+
+// Ingest pushes records built elsewhere (read from files, received from other
+// processes, ...) through the logger.  Records with a Category are routed the
+// same way as messages logged through LOGGER(category); records without one
+// go to every filter, like Log.  Records with a zero Created time are stamped
+// with the current time, those without a Seq are numbered, and nil records
+// are skipped.
+func (log Logger) Ingest(records []*LogRecord) {
+	for _, rec := range records {
+		if rec == nil {
+			continue
+		}
+		if rec.Created.IsZero() {
+			rec.Created = time.Now()
+		}
+		if rec.Seq == 0 {
+			rec.Seq = nextSeq()
+		}
+		if rec = runHooks(rec); rec == nil {
+			continue
+		}
+
+		if len(rec.Category) == 0 {
+			writeTo(log.enabled(rec.Level), rec)
 			continue
 		}
-		filt.LogWrite(rec)
+
+		if default_filter, _ := log.get("stdout"); default_filter != nil && rec.Level.above(default_filter.level()) {
+			default_filter.send(rec)
+		}
+		if filt, ok := log.lookup(rec.Category); ok && rec.Category != "DEFAULT" && rec.Category != "stdout" && rec.Level.atLeast(filt.level()) && filt.allow() {
+			filt.send(rec)
+		}
 	}
 }
 
@@ -433,14 +629,20 @@ func (log Logger) Warn(arg0 interface{}, args ...interface{}) error {
 	var msg string
 	switch first := arg0.(type) {
 	case string:
-		// Use the string as a format string
-		msg = fmt.Sprintf(first, args...)
+		// Use the string as a format string, unless there is nothing to format
+		msg = first
+		if len(args) > 0 {
+			msg = fmt.Sprintf(first, args...)
+		}
 	case func() string:
 		// Log the closure (no other arguments used)
 		msg = first()
 	default:
 		// Build a format string so that it will be similar to Sprint
-		msg = fmt.Sprintf(fmt.Sprint(first)+strings.Repeat(" %v", len(args)), args...)
+		msg = fmt.Sprint(first)
+		if len(args) > 0 {
+			msg = fmt.Sprintf(msg+strings.Repeat(" %v", len(args)), args...)
+		}
 	}
 	log.intLogf(lvl, msg)
 	return errors.New(msg)
@@ -456,14 +658,20 @@ func (log Logger) Error(arg0 interface{}, args ...interface{}) error {
 	var msg string
 	switch first := arg0.(type) {
 	case string:
-		// Use the string as a format string
-		msg = fmt.Sprintf(first, args...)
+		// Use the string as a format string, unless there is nothing to format
+		msg = first
+		if len(args) > 0 {
+			msg = fmt.Sprintf(first, args...)
+		}
 	case func() string:
 		// Log the closure (no other arguments used)
 		msg = first()
 	default:
 		// Build a format string so that it will be similar to Sprint
-		msg = fmt.Sprintf(fmt.Sprint(first)+strings.Repeat(" %v", len(args)), args...)
+		msg = fmt.Sprint(first)
+		if len(args) > 0 {
+			msg = fmt.Sprintf(msg+strings.Repeat(" %v", len(args)), args...)
+		}
 	}
 	log.intLogf(lvl, msg)
 	return errors.New(msg)
@@ -479,14 +687,20 @@ func (log Logger) Critical(arg0 interface{}, args ...interface{}) error {
 	var msg string
 	switch first := arg0.(type) {
 	case string:
-		// Use the string as a format string
-		msg = fmt.Sprintf(first, args...)
+		// Use the string as a format string, unless there is nothing to format
+		msg = first
+		if len(args) > 0 {
+			msg = fmt.Sprintf(first, args...)
+		}
 	case func() string:
 		// Log the closure (no other arguments used)
 		msg = first()
 	default:
 		// Build a format string so that it will be similar to Sprint
-		msg = fmt.Sprintf(fmt.Sprint(first)+strings.Repeat(" %v", len(args)), args...)
+		msg = fmt.Sprint(first)
+		if len(args) > 0 {
+			msg = fmt.Sprintf(msg+strings.Repeat(" %v", len(args)), args...)
+		}
 	}
 	log.intLogf(lvl, msg)
 	return errors.New(msg)
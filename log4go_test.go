@@ -3,15 +3,45 @@
 package log4go
 
 import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/md5"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
 	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"expvar"
+	"flag"
 	"fmt"
 	"io"
 	"io/ioutil"
+	stdlog "log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"os/exec"
+	"path/filepath"
 	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/klauspost/compress/zstd"
 )
 
 const testLogFile = "_logtest.log"
@@ -108,6 +138,410 @@ func TestFormatDttmPatternLogRecord(t *testing.T) {
 	}
 }
 
+func TestCompilePattern(t *testing.T) {
+	rec := newLogRecord(ERROR, "pkg/source", "message")
+	for format, want := range map[string]string{
+		"%L %s %M":                "EROR source message\n",
+		"100%% %Q%M %":            "100message \n",
+		"%D{2006}-%D{01} %D{":     "2009-02 2009/02/13{\n",
+		"[%D %T] [%L] (%S) %M":    "[2009/02/13 23:31:30 UTC] [EROR] (pkg/source) message\n",
+		"%D{15:04:05.000} %C: %M": "23:31:30.123 DEFAULT: message\n",
+		"%o %o{3} %o{9} %o{0}":    "123456 123 123456789 123456{0}\n",
+		"[%-6L|%3L|%8C] %M":       "[EROR  |EROR| DEFAULT] message\n",
+		"%-4o{2}|%5D{06}|%":       "12  |   09|\n",
+	} {
+		if got := string(CompilePattern(format).Format(rec)); got != want {
+			t.Errorf("CompilePattern(%q): got %q, want %q", format, got, want)
+		}
+	}
+}
+
+func TestValidatePattern(t *testing.T) {
+	for format, valid := range map[string]bool{
+		"[%D %T] [%C] [%L] (%S) %M":  true,
+		"%D{2006-01-02} %o{3} %o %M": true,
+		"%Q %M":                      false,
+		"%M %":                       false,
+		"100%% %M":                   false,
+		"%D{2006-01-02 %M":           false,
+		"%o{12} %M":                  false,
+		"%-5L %10C %-8D{15:04} %M":   true,
+		"%-5":                        false,
+	} {
+		if err := ValidatePattern(format); (err == nil) != valid {
+			t.Errorf("ValidatePattern(%q) = %v, want valid=%v", format, err, valid)
+		}
+	}
+}
+
+func TestFileLineVerbs(t *testing.T) {
+	rw := &recordingLogWriter{}
+	l := make(Logger)
+	l.AddFilter("rec", DEBUG, rw)
+	_, _, line, _ := runtime.Caller(0)
+	l.Info("message")
+
+	if len(rw.records) != 1 {
+		t.Fatalf("Expected 1 record, got %d", len(rw.records))
+	}
+	want := fmt.Sprintf("log4go_test.go:%d message\n", line+1)
+	if got := FormatLogRecord("%F:%l %M", rw.records[0]); got != want {
+		t.Errorf("FormatLogRecord: got %q, want %q", got, want)
+	}
+}
+
+func TestEnvVerb(t *testing.T) {
+	os.Setenv("LOG4GO_TEST_REGION", "eu-west-1")
+	defer os.Unsetenv("LOG4GO_TEST_REGION")
+
+	p := CompilePattern("[%E{LOG4GO_TEST_REGION}] [%E{LOG4GO_TEST_UNSET}] %M")
+	os.Setenv("LOG4GO_TEST_REGION", "changed")
+	if got, want := string(p.Format(newLogRecord(INFO, "source", "message"))), "[eu-west-1] [] message\n"; got != want {
+		t.Errorf("Format: got %q, want %q", got, want)
+	}
+	if err := ValidatePattern("%E{REGION %M"); err == nil {
+		t.Errorf("ValidatePattern accepted an unclosed %%E{")
+	}
+}
+
+func TestEscapeMode(t *testing.T) {
+	msg := "a \"b\"\nc\td\x00\u0085"
+	for mode, want := range map[EscapeMode]string{
+		EscapeNone:    msg,
+		EscapeNewline: "a \"b\"\\nc\td\x00\u0085",
+		EscapeControl: `a "b"\nc\td\x00\u0085`,
+		EscapeQuote:   `"a \"b\"\nc\td\x00\u0085"`,
+	} {
+		if got := mode.Escape(msg); got != want {
+			t.Errorf("%s: got %q, want %q", mode, got, want)
+		}
+		if parsed, err := ParseEscapeMode(mode.String()); err != nil || parsed != mode {
+			t.Errorf("ParseEscapeMode(%q) = %v, %v", mode.String(), parsed, err)
+		}
+	}
+
+	w := NewFileLogWriter(testLogFile, false, false).SetFormat("%M").SetEscape(EscapeQuote)
+	if w == nil {
+		t.Fatalf("Invalid return: w should not be nil")
+	}
+	defer os.Remove(testLogFile)
+	rec := newLogRecord(INFO, "source", "line\nforged")
+	w.LogWrite(rec)
+	w.Close()
+	time.Sleep(50 * time.Millisecond)
+	if contents, err := ioutil.ReadFile(testLogFile); err != nil || string(contents) != `"line\nforged"`+"\n" {
+		t.Errorf("Escaped log: got %q (%v)", contents, err)
+	}
+	if rec.Message != "line\nforged" {
+		t.Errorf("Escaping modified the shared record: %q", rec.Message)
+	}
+}
+
+func TestMaxMessageLength(t *testing.T) {
+	for _, test := range []struct {
+		msg  string
+		max  int
+		want string
+	}{
+		{"short", 10, "short"},
+		{"exactly10!", 10, "exactly10!"},
+		{"0123456789abcdef", 10, "0123456789…(truncated 6 bytes)"},
+		{"ab\u00e9\u00e9", 3, "ab…(truncated 4 bytes)"},
+		{"unlimited", 0, "unlimited"},
+	} {
+		if got := truncateMessage(test.msg, test.max); got != test.want {
+			t.Errorf("truncateMessage(%q, %d): got %q, want %q", test.msg, test.max, got, test.want)
+		}
+	}
+
+	w := NewFileLogWriter(testLogFile, false, false).SetFormat("%M").SetMaxMessageLength(4)
+	if w == nil {
+		t.Fatalf("Invalid return: w should not be nil")
+	}
+	defer os.Remove(testLogFile)
+	w.LogWrite(newLogRecord(INFO, "source", "payload"))
+	w.Close()
+	time.Sleep(50 * time.Millisecond)
+	if contents, err := ioutil.ReadFile(testLogFile); err != nil || string(contents) != "payl…(truncated 3 bytes)\n" {
+		t.Errorf("Truncated log: got %q (%v)", contents, err)
+	}
+}
+
+func TestSetLevelName(t *testing.T) {
+	defer SetLevelName(WARNING, "")
+	SetLevelName(WARNING, "WARNING")
+
+	rec := newLogRecord(WARNING, "source", "message")
+	if got, want := FormatLogRecord("[%L] %M", rec), "[WARNING] message\n"; got != want {
+		t.Errorf("FormatLogRecord: got %q, want %q", got, want)
+	}
+	if got := string(NewJSONFormatter().Format(rec)); !strings.Contains(got, `"level":"WARNING"`) {
+		t.Errorf("JSONFormatter: level name not used in %q", got)
+	}
+	if got := ERROR.String(); got != "EROR" {
+		t.Errorf("Other levels changed: %q", got)
+	}
+
+	SetLevelName(WARNING, "")
+	if got := WARNING.String(); got != "WARN" {
+		t.Errorf("Empty name did not restore the default: %q", got)
+	}
+}
+
+func TestRawMode(t *testing.T) {
+	w := NewFileLogWriter(testLogFile, false, false).SetJSON(true).SetRaw(true)
+	if w == nil {
+		t.Fatalf("Invalid return: w should not be nil")
+	}
+	defer os.Remove(testLogFile)
+	w.LogWrite(newLogRecord(INFO, "source", "one"))
+	w.LogWrite(newLogRecord(INFO, "source", "two"))
+	w.Close()
+	time.Sleep(50 * time.Millisecond)
+
+	contents, err := ioutil.ReadFile(testLogFile)
+	if err != nil {
+		t.Fatalf("read(%q): %s", testLogFile, err)
+	}
+	if bytes.Contains(contents, []byte("\n")) || !bytes.Contains(contents, []byte(`"message":"one"}{`)) {
+		t.Errorf("Raw log contains newlines: %q", contents)
+	}
+}
+
+func TestWithFields(t *testing.T) {
+	rw := &recordingLogWriter{}
+	l := make(Logger)
+	l.AddFilter("api", DEBUG, rw, "api")
+
+	base := l["api"].WithFields(Fields{"user": "bob"})
+	base.WithFields(Fields{"req": 42}).Info("login ok")
+	base.Info("plain")
+
+	if len(rw.records) != 2 {
+		t.Fatalf("Expected 2 records, got %d", len(rw.records))
+	}
+	rec := rw.records[0]
+	if got, want := FormatLogRecord("%M [%X{user}] [%X{missing}] %X", rec), "login ok [bob] [] req=42 user=bob\n"; got != want {
+		t.Errorf("FormatLogRecord: got %q, want %q", got, want)
+	}
+	if got := string(NewJSONFormatter().Format(rec)); !strings.Contains(got, `"fields":{"req":42,"user":"bob"}`) {
+		t.Errorf("JSONFormatter: fields missing from %q", got)
+	}
+	if got := string(NewLogfmtFormatter().Format(rec)); !strings.HasSuffix(got, "msg=\"login ok\" req=42 user=bob\n") {
+		t.Errorf("LogfmtFormatter: fields missing from %q", got)
+	}
+	if len(rw.records[1].Fields) != 1 {
+		t.Errorf("WithFields modified its parent: %v", rw.records[1].Fields)
+	}
+	if l["api"].fields != nil {
+		t.Errorf("WithFields modified the original filter")
+	}
+}
+
+func TestWithContextSpan(t *testing.T) {
+	type spanKey struct{}
+	old, _ := spanExtractor.Load().(SpanExtractor)
+	defer SetSpanExtractor(old)
+	SetSpanExtractor(func(ctx context.Context) (string, string) {
+		if span, ok := ctx.Value(spanKey{}).(string); ok {
+			return "trace-1", span
+		}
+		return "", ""
+	})
+
+	rw := &recordingLogWriter{}
+	l := make(Logger)
+	l.AddFilter("api", INFO, rw, "api")
+
+	ctx := NewContext(context.WithValue(context.Background(), spanKey{}, "span-1"), l["api"])
+	if f, ok := FromContext(ctx); ok {
+		f.Info("handled")
+	}
+	l["api"].WithContext(context.Background()).Info("no span")
+
+	if len(rw.records) != 2 {
+		t.Fatalf("Expected 2 records, got %d", len(rw.records))
+	}
+	if got, want := FormatLogRecord("[%I/%i] %M", rw.records[0]), "[trace-1/span-1] handled\n"; got != want {
+		t.Errorf("With span: got %q, want %q", got, want)
+	}
+	if rw.records[1].Fields != nil {
+		t.Errorf("Without span: got fields %v", rw.records[1].Fields)
+	}
+}
+
+func TestChild(t *testing.T) {
+	rw := &recordingLogWriter{}
+	l := make(Logger)
+	l.AddFilter("api", INFO, rw, "api")
+
+	parent := l["api"].WithFields(Fields{"user": "bob"})
+	db := parent.Child("db", Fields{"pool": "main"}).Child("tx", Fields{"user": "eve"})
+	if db.Level != INFO {
+		t.Errorf("Child level: got %v, want %v", db.Level, INFO)
+	}
+	db.Debug("dropped")
+	db.Info("committed")
+
+	if len(rw.records) != 1 {
+		t.Fatalf("Expected 1 record, got %d", len(rw.records))
+	}
+	if got, want := FormatLogRecord("[%C] %M %X", rw.records[0]), "[api.db.tx] committed pool=main user=eve\n"; got != want {
+		t.Errorf("FormatLogRecord: got %q, want %q", got, want)
+	}
+	if parent.Category != "api" || len(parent.fields) != 1 {
+		t.Errorf("Child modified its parent: %+v", parent)
+	}
+}
+
+func TestWithError(t *testing.T) {
+	rw := &recordingLogWriter{}
+	l := make(Logger)
+	l.AddFilter("api", DEBUG, rw, "api")
+	SetErrorStacks(true)
+	defer SetErrorStacks(false)
+
+	err := errors.New("disk full")
+	l["api"].Errorw(err, "save %d", 3)
+	l["api"].WithError(err).Warn("retrying")
+	l["api"].Error("no error attached")
+
+	if len(rw.records) != 3 {
+		t.Fatalf("Expected 3 records, got %d", len(rw.records))
+	}
+	rec := rw.records[0]
+	if got := FormatLogRecord("%M: %X{error}", rec); got != "save 3: disk full\n" {
+		t.Errorf("FormatLogRecord: got %q", got)
+	}
+	if !strings.HasPrefix(rec.Stack, "github.com/jeanphorn/log4go.TestWithError\n") {
+		t.Errorf("Stack does not start at the logging call: %q", rec.Stack)
+	}
+	if got := FormatLogRecord("%M%K", rec); !strings.HasPrefix(got, "save 3\ngithub.com/jeanphorn/log4go.TestWithError\n\t") {
+		t.Errorf("%%K: got %q", got)
+	}
+	if got := string(NewJSONFormatter().Format(rec)); !strings.Contains(got, `"fields":{"error":"disk full"},"stack":"github.com/`) {
+		t.Errorf("JSONFormatter: got %q", got)
+	}
+	for _, rec := range rw.records[1:] {
+		if len(rec.Stack) > 0 {
+			t.Errorf("Unexpected stack for %q", rec.Message)
+		}
+	}
+
+	l["api"].WithError(err).Log(CRITICAL, "source", "manual")
+	if rec := rw.records[3]; !strings.HasPrefix(rec.Stack, "github.com/jeanphorn/log4go.TestWithError\n") {
+		t.Errorf("Log: stack does not start at the logging call: %q", rec.Stack)
+	}
+	SetErrorStacks(false)
+	l["api"].LogStack(CRITICAL, "source", "recovered", "main.handler\n\tmain.go:12\n")
+	if rec := rw.records[4]; rec.Stack != "main.handler\n\tmain.go:12\n" || rec.Source != "source" {
+		t.Errorf("LogStack: got stack %q and source %q", rec.Stack, rec.Source)
+	}
+}
+
+func TestContext(t *testing.T) {
+	if _, ok := FromContext(context.Background()); ok {
+		t.Errorf("FromContext found a filter in an empty context")
+	}
+
+	rw := &recordingLogWriter{}
+	l := make(Logger)
+	l.AddFilter("api", DEBUG, rw, "api")
+
+	ctx := NewContext(context.Background(), l["api"].WithFields(Fields{"req": 7}))
+	f, ok := FromContext(ctx)
+	if !ok {
+		t.Fatalf("FromContext did not find the filter")
+	}
+	f.Info("handled")
+	if len(rw.records) != 1 || rw.records[0].Fields["req"] != 7 {
+		t.Errorf("Record did not carry the context fields: %+v", rw.records)
+	}
+}
+
+func TestMDC(t *testing.T) {
+	rw := &recordingLogWriter{}
+	l := make(Logger)
+	l.AddFilter("api", DEBUG, rw, "api")
+
+	MDCPut("req", "r-1")
+	MDCPut("user", "alice")
+	defer MDCClear()
+	if v, ok := MDCGet("req"); !ok || v != "r-1" {
+		t.Errorf("MDCGet: got %v, %v", v, ok)
+	}
+
+	l.Info("map logger")
+	l["api"].WithFields(Fields{"user": "bob"}).Info("filter")
+	done := make(chan bool)
+	go func() {
+		l.Info("other goroutine")
+		done <- true
+	}()
+	<-done
+	MDCRemove("user")
+	l.Info("removed")
+
+	want := []string{
+		"map logger [r-1] [alice]\n",
+		"filter [r-1] [bob]\n",
+		"other goroutine [] []\n",
+		"removed [r-1] []\n",
+	}
+	if len(rw.records) != len(want) {
+		t.Fatalf("Expected %d records, got %d", len(want), len(rw.records))
+	}
+	for i, rec := range rw.records {
+		if got := FormatLogRecord("%M [%X{req}] [%X{user}]", rec); got != want[i] {
+			t.Errorf("Record %d: got %q, want %q", i, got, want[i])
+		}
+	}
+
+	MDCClear()
+	if _, ok := MDCGet("req"); ok || mdcEntries != 0 {
+		t.Errorf("MDCClear left the context behind")
+	}
+}
+
+func TestProcessVerbs(t *testing.T) {
+	host, _ := os.Hostname()
+	p := CompilePattern("%P %h %g")
+
+	rw := &recordingLogWriter{}
+	l := make(Logger)
+	l.AddFilter("rec", DEBUG, rw)
+	l.Info("message")
+	if len(rw.records) != 1 || rw.records[0].Goroutine == 0 {
+		t.Fatalf("Logged record does not carry the goroutine id: %+v", rw.records)
+	}
+
+	want := fmt.Sprintf("%d %s %d\n", os.Getpid(), host, rw.records[0].Goroutine)
+	if got := string(p.Format(rw.records[0])); got != want {
+		t.Errorf("Format: got %q, want %q", got, want)
+	}
+}
+
+func TestSetFormatRecordsGoroutines(t *testing.T) {
+	atomic.StoreInt32(&recordGoroutines, 0)
+	defer os.Remove(testLogFile)
+
+	// The first record must carry its goroutine, not just the later ones
+	w := NewFileLogWriter(testLogFile, false, false).SetFormat("goroutine %g: %M")
+	l := make(Logger)
+	l.AddFilter("file", DEBUG, w)
+	l.Info("first")
+	l.Close()
+	time.Sleep(50 * time.Millisecond)
+
+	contents, err := ioutil.ReadFile(testLogFile)
+	if err != nil {
+		t.Fatalf("read %s: %s", testLogFile, err)
+	}
+	if want := fmt.Sprintf("goroutine %d: first\n", goroutineID()); string(contents) != want {
+		t.Errorf("Log: got %q, want %q", contents, want)
+	}
+}
+
 var logRecordWriteTests = []struct {
 	Test    string
 	Record  *LogRecord
@@ -126,10 +560,14 @@ var logRecordWriteTests = []struct {
 }
 
 func TestConsoleLogWriter(t *testing.T) {
-	console := new(ConsoleLogWriter)
+	console := &ConsoleLogWriter{
+		format: "[%T %D] [%L] %M",
+		w:      make(chan *LogRecord, LogBufferLength),
+		done:   make(chan struct{}),
+	}
 
 	r, w := io.Pipe()
-	go console.run(w)
+	go console.run(console.w, w)
 	defer console.Close()
 
 	buf := make([]byte, 1024)
@@ -153,7 +591,7 @@ func TestFileLogWriter(t *testing.T) {
 	}(LogBufferLength)
 	LogBufferLength = 0
 
-	w := NewFileLogWriter(testLogFile, false)
+	w := NewFileLogWriter(testLogFile, false, false)
 	if w == nil {
 		t.Fatalf("Invalid return: w should not be nil")
 	}
@@ -176,7 +614,7 @@ func TestXMLLogWriter(t *testing.T) {
 	}(LogBufferLength)
 	LogBufferLength = 0
 
-	w := NewXMLLogWriter(testLogFile, false)
+	w := NewXMLLogWriter(testLogFile, false, false)
 	if w == nil {
 		t.Fatalf("Invalid return: w should not be nil")
 	}
@@ -261,7 +699,7 @@ func TestLogOutput(t *testing.T) {
 	l := make(Logger)
 
 	// Delete and open the output log without a timestamp (for a constant md5sum)
-	l.AddFilter("file", FINEST, NewFileLogWriter(testLogFile, false).SetFormat("[%L] %M"))
+	l.AddFilter("file", FINEST, NewFileLogWriter(testLogFile, false, false).SetFormat("[%L] %M"))
 	defer os.Remove(testLogFile)
 
 	// Send some log messages
@@ -344,6 +782,7 @@ func TestXMLConfig(t *testing.T) {
 	}
 
 	fmt.Fprintln(fd, "<logging>")
+	io.WriteString(fd, "  <!-- <globalfield name=\"app\">example</globalfield> attaches app=example to every record, shown by %X -->\n")
 	fmt.Fprintln(fd, "  <filter enabled=\"true\">")
 	fmt.Fprintln(fd, "    <tag>stdout</tag>")
 	fmt.Fprintln(fd, "    <type>console</type>")
@@ -352,21 +791,22 @@ func TestXMLConfig(t *testing.T) {
 	fmt.Fprintln(fd, "  </filter>")
 	fmt.Fprintln(fd, "  <filter enabled=\"true\">")
 	fmt.Fprintln(fd, "    <tag>file</tag>")
+	fmt.Fprintln(fd, "    <!-- <category>Test</category> would register the filter for LOGGER(\"Test\") instead of its tag -->")
 	fmt.Fprintln(fd, "    <type>file</type>")
 	fmt.Fprintln(fd, "    <level>FINEST</level>")
 	fmt.Fprintln(fd, "    <property name=\"filename\">test.log</property>")
 	fmt.Fprintln(fd, "    <!--")
-	fmt.Fprintln(fd, "       %T - Time (15:04:05 MST)")
-	fmt.Fprintln(fd, "       %t - Time (15:04)")
-	fmt.Fprintln(fd, "       %D - Date (2006/01/02)")
-	fmt.Fprintln(fd, "       %d - Date (01/02/06)")
-	fmt.Fprintln(fd, "       %L - Level (FNST, FINE, DEBG, TRAC, WARN, EROR, CRIT)")
-	fmt.Fprintln(fd, "       %S - Source")
-	fmt.Fprintln(fd, "       %M - Message")
+	io.WriteString(fd, "       %T - Time (15:04:05 MST)\n")
+	io.WriteString(fd, "       %t - Time (15:04)\n")
+	io.WriteString(fd, "       %D - Date (2006/01/02)\n")
+	io.WriteString(fd, "       %d - Date (01/02/06)\n")
+	io.WriteString(fd, "       %L - Level (FNST, FINE, DEBG, TRAC, WARN, EROR, CRIT)\n")
+	io.WriteString(fd, "       %S - Source\n")
+	io.WriteString(fd, "       %M - Message\n")
 	fmt.Fprintln(fd, "       It ignores unknown format strings (and removes them)")
-	fmt.Fprintln(fd, "       Recommended: \"[%D %T] [%L] (%S) %M\"")
+	io.WriteString(fd, "       Recommended: \"[%D %T] [%L] (%S) %M\"\n")
 	fmt.Fprintln(fd, "    -->")
-	fmt.Fprintln(fd, "    <property name=\"format\">[%D %T] [%L] (%S) %M</property>")
+	io.WriteString(fd, "    <property name=\"format\">[%D %T] [%L] (%S) %M</property>\n")
 	fmt.Fprintln(fd, "    <property name=\"rotate\">false</property> <!-- true enables log rotation, otherwise append -->")
 	fmt.Fprintln(fd, "    <property name=\"maxsize\">0M</property> <!-- \\d+[KMG]? Suffixes are in terms of 2**10 -->")
 	fmt.Fprintln(fd, "    <property name=\"maxlines\">0K</property> <!-- \\d+[KMG]? Suffixes are in terms of thousands -->")
@@ -450,117 +890,3581 @@ func TestXMLConfig(t *testing.T) {
 	os.Rename(configfile, "examples/"+configfile) // Keep this so that an example with the documentation is available
 }
 
-func BenchmarkFormatLogRecord(b *testing.B) {
-	const updateEvery = 1
-	rec := &LogRecord{
-		Level:   CRITICAL,
-		Created: now,
-		Source:  "source",
-		Message: "message",
+func TestXMLConfigCategories(t *testing.T) {
+	defer SetGlobalFields(nil)
+	defer os.Remove(testLogFile)
+
+	log := make(Logger)
+	log.LoadConfiguration(`<logging>
+  <globalfield name="app">billing</globalfield>
+  <filter enabled="true">
+    <tag>apifile</tag>
+    <category>api</category>
+    <type>file</type>
+    <level>INFO</level>
+    <property name="filename">` + testLogFile + `</property>
+    <property name="format">[%C] %M %X</property>
+  </filter>
+</logging>`)
+
+	filt, ok := log["api"]
+	if !ok {
+		t.Fatalf("XMLConfig: Expected the filter under its category, got %v", log)
 	}
-	for i := 0; i < b.N; i++ {
-		rec.Created = rec.Created.Add(1 * time.Second / updateEvery)
-		if i%2 == 0 {
-			FormatLogRecord(FORMAT_DEFAULT, rec)
-		} else {
-			FormatLogRecord(FORMAT_SHORT, rec)
-		}
+	if filt.Category != "api" || filt.Level != INFO {
+		t.Errorf("XMLConfig: got category %q and level %v", filt.Category, filt.Level)
+	}
+	filt.Info("hello")
+	log.Close()
+	time.Sleep(50 * time.Millisecond)
+
+	if contents, err := ioutil.ReadFile(testLogFile); err != nil || string(contents) != "[api] hello app=billing\n" {
+		t.Errorf("Log: got %q (%v)", contents, err)
 	}
 }
 
-func BenchmarkConsoleLog(b *testing.B) {
-	/* This doesn't seem to work on OS X
-	sink, err := os.Open(os.DevNull)
-	if err != nil {
-		panic(err)
+func TestYamlConfig(t *testing.T) {
+	defer SetGlobalFields(nil)
+	defer os.Remove(testLogFile)
+
+	log := make(Logger)
+	log.LoadYamlConfiguration(`---
+# comments are ignored
+console:
+  enable: false
+global_fields: {app: billing, shard: 3}
+files:
+  - enable: true
+    category: api
+    level: INFO   # trailing comment
+    filename: "` + testLogFile + `"
+    pattern: '[%C] %M %X'
+`)
+
+	filt, ok := log["api"]
+	if !ok {
+		t.Fatalf("YamlConfig: Expected the filter under its category, got %v", log)
 	}
-	if err := syscall.Dup2(int(sink.Fd()), syscall.Stdout); err != nil {
-		panic(err)
+	if filt.Level != INFO {
+		t.Errorf("YamlConfig: got level %v", filt.Level)
 	}
-	*/
+	if shard := GlobalFields()["shard"]; shard != 3 {
+		t.Errorf("YamlConfig: got global field %#v", shard)
+	}
+	filt.Info("hello")
+	log.Close()
+	time.Sleep(50 * time.Millisecond)
 
-	stdout = ioutil.Discard
-	sl := NewDefaultLogger(INFO)
-	for i := 0; i < b.N; i++ {
-		sl.Log(WARNING, "here", "This is a log message")
+	if contents, err := ioutil.ReadFile(testLogFile); err != nil || string(contents) != "[api] hello app=billing shard=3\n" {
+		t.Errorf("Log: got %q (%v)", contents, err)
 	}
 }
 
-func BenchmarkConsoleNotLogged(b *testing.B) {
-	sl := NewDefaultLogger(INFO)
-	for i := 0; i < b.N; i++ {
-		sl.Log(DEBUG, "here", "This is a log message")
+func TestExpandConfigEnv(t *testing.T) {
+	os.Setenv("LOG4GO_TEST_DIR", "/tmp/logs")
+	os.Setenv("LOG4GO_TEST_EMPTY", "")
+	defer os.Unsetenv("LOG4GO_TEST_DIR")
+	defer os.Unsetenv("LOG4GO_TEST_EMPTY")
+
+	for in, want := range map[string]string{
+		`"${LOG4GO_TEST_DIR}/api.log"`:         `"/tmp/logs/api.log"`,
+		`"${LOG4GO_TEST_DIR:-/var/log}"`:       `"/tmp/logs"`,
+		`"${LOG4GO_TEST_UNSET:-INFO}"`:         `"INFO"`,
+		`"${LOG4GO_TEST_EMPTY:-INFO}"`:         `"INFO"`,
+		`"${LOG4GO_TEST_UNSET}"`:               `""`,
+		`"$${LOG4GO_TEST_DIR} $HOME ${broken"`: `"${LOG4GO_TEST_DIR} $HOME ${broken"`,
+	} {
+		if got := expandConfigEnv(in); got != want {
+			t.Errorf("expandConfigEnv(%s) = %s, want %s", in, got, want)
+		}
 	}
-}
 
-func BenchmarkConsoleUtilLog(b *testing.B) {
-	sl := NewDefaultLogger(INFO)
-	for i := 0; i < b.N; i++ {
-		sl.Info("%s is a log message", "This")
+	os.Setenv("LOG4GO_TEST_LEVEL", "ERROR")
+	defer os.Unsetenv("LOG4GO_TEST_LEVEL")
+	log := make(Logger)
+	log.LoadJsonConfiguration(`{"console": {"enable": false}, "files": [{"enable": true, "category": "api",
+		"level": "${LOG4GO_TEST_LEVEL:-INFO}", "filename": "${LOG4GO_TEST_UNSET:-` + testLogFile + `}"}]}`)
+	defer os.Remove(testLogFile)
+	defer log.Close()
+	if filt, ok := log["api"]; !ok || filt.Level != ERROR {
+		t.Errorf("LoadJsonConfiguration: expected an ERROR filter for api, got %v", log)
 	}
 }
 
-func BenchmarkConsoleUtilNotLog(b *testing.B) {
-	sl := NewDefaultLogger(INFO)
-	for i := 0; i < b.N; i++ {
-		sl.Debug("%s is a log message", "This")
+func TestLoadConfigurationFromBytes(t *testing.T) {
+	defer os.Remove(testLogFile)
+
+	log := make(Logger)
+	err := log.LoadConfigurationFromReader(strings.NewReader(`files:
+  - enable: true
+    category: api
+    level: INFO
+    filename: `+testLogFile+`
+    pattern: "%M"
+`), "yaml")
+	if err != nil {
+		t.Fatalf("LoadConfigurationFromReader: %s", err)
 	}
-}
 
-func BenchmarkFileLog(b *testing.B) {
-	sl := make(Logger)
-	b.StopTimer()
-	sl.AddFilter("file", INFO, NewFileLogWriter("benchlog.log", false))
-	b.StartTimer()
-	for i := 0; i < b.N; i++ {
-		sl.Log(WARNING, "here", "This is a log message")
+	// A bad configuration must leave the logger as it was
+	for format, data := range map[string]string{"json": `{"files": [`, "xml": `<logging>`, "toml": `a = 1`} {
+		if err := log.LoadConfigurationFromBytes([]byte(data), format); err == nil {
+			t.Errorf("LoadConfigurationFromBytes(%s): expected an error", format)
+		}
 	}
-	b.StopTimer()
-	os.Remove("benchlog.log")
-}
+	filt, ok := log["api"]
+	if !ok || filt.Level != INFO {
+		t.Fatalf("LoadConfigurationFromReader: expected an INFO filter for api, got %v", log)
+	}
+	filt.Info("hello")
+	log.Close()
+	time.Sleep(50 * time.Millisecond)
 
-func BenchmarkFileNotLogged(b *testing.B) {
-	sl := make(Logger)
-	b.StopTimer()
-	sl.AddFilter("file", INFO, NewFileLogWriter("benchlog.log", false))
-	b.StartTimer()
-	for i := 0; i < b.N; i++ {
-		sl.Log(DEBUG, "here", "This is a log message")
+	if contents, err := ioutil.ReadFile(testLogFile); err != nil || string(contents) != "hello\n" {
+		t.Errorf("Log: got %q (%v)", contents, err)
 	}
-	b.StopTimer()
-	os.Remove("benchlog.log")
-}
 
-func BenchmarkFileUtilLog(b *testing.B) {
-	sl := make(Logger)
-	b.StopTimer()
-	sl.AddFilter("file", INFO, NewFileLogWriter("benchlog.log", false))
-	b.StartTimer()
-	for i := 0; i < b.N; i++ {
-		sl.Info("%s is a log message", "This")
+	err = log.LoadConfigurationFromBytes([]byte(`<logging><filter enabled="true"><tag>stdout</tag>
+<type>console</type><level>ERROR</level></filter></logging>`), "xml")
+	if err != nil {
+		t.Fatalf("LoadConfigurationFromBytes: %s", err)
+	}
+	defer log.Close()
+	if filt, ok := log["stdout"]; !ok || filt.Level != ERROR {
+		t.Errorf("LoadConfigurationFromBytes: expected an ERROR console filter, got %v", log)
 	}
-	b.StopTimer()
-	os.Remove("benchlog.log")
 }
 
-func BenchmarkFileUtilNotLog(b *testing.B) {
-	sl := make(Logger)
-	b.StopTimer()
-	sl.AddFilter("file", INFO, NewFileLogWriter("benchlog.log", false))
-	b.StartTimer()
-	for i := 0; i < b.N; i++ {
-		sl.Debug("%s is a log message", "This")
+// fakeSource serves configs in turn, then signals done and waits for ctx.
+type fakeSource struct {
+	configs []string
+	done    chan bool
+}
+
+func (s *fakeSource) Fetch(ctx context.Context, version uint64) ([]byte, uint64, error) {
+	if int(version) < len(s.configs) {
+		return []byte(s.configs[version]), version + 1, nil
 	}
-	b.StopTimer()
-	os.Remove("benchlog.log")
+	close(s.done)
+	<-ctx.Done()
+	return nil, 0, ctx.Err()
 }
 
-// Benchmark results (darwin amd64 6g)
-//elog.BenchmarkConsoleLog           100000       22819 ns/op
-//elog.BenchmarkConsoleNotLogged    2000000         879 ns/op
-//elog.BenchmarkConsoleUtilLog        50000       34380 ns/op
-//elog.BenchmarkConsoleUtilNotLog   1000000        1339 ns/op
+func TestWatchRemoteConfiguration(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	log := make(Logger)
+	defer log.Close()
+
+	src := &fakeSource{configs: []string{
+		`{"console": {"enable": true, "level": "ERROR"}}`,
+		`{"console": {"enable": true, "level": "DEBUG"}}`,
+	}, done: make(chan bool)}
+	if err := log.WatchRemoteConfiguration(ctx, src, "json"); err != nil {
+		t.Fatalf("WatchRemoteConfiguration: %s", err)
+	}
+	<-src.done
+	if filt, ok := log["stdout"]; !ok || filt.Level != DEBUG {
+		t.Errorf("WatchRemoteConfiguration: expected the DEBUG console filter, got %v", log)
+	}
+
+	if err := log.WatchRemoteConfiguration(ctx, &fakeSource{configs: []string{`{`}}, "json"); err == nil {
+		t.Errorf("WatchRemoteConfiguration: expected an error for a bad configuration")
+	}
+}
+
+func TestWatchRemoteConfigurationWhileLogging(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	log := make(Logger)
+	defer log.Close()
+
+	fname := filepath.Join(t.TempDir(), "remote.log")
+	src := &fakeSource{done: make(chan bool)}
+	for i := 0; i < 20; i++ {
+		src.configs = append(src.configs, fmt.Sprintf(`{"console": {"enable": false}, "files": [{"enable": true,
+			"category": "api", "level": "%s", "filename": "%s"}]}`, []string{"INFO", "DEBUG"}[i%2], fname))
+	}
+	api := log.LOGGER("api")
+	stop := make(chan bool)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				log.Info("logger")
+				api.Info("handle")
+			}
+		}()
+	}
+	if err := log.WatchRemoteConfiguration(ctx, src, "json"); err != nil {
+		t.Fatalf("WatchRemoteConfiguration: %s", err)
+	}
+	<-src.done
+	close(stop)
+	wg.Wait()
+
+	api.Info("after the changes")
+	log.Flush()
+	contents, err := ioutil.ReadFile(fname)
+	if err != nil {
+		t.Fatalf("read(%q): %s", fname, err)
+	}
+	if !bytes.Contains(contents, []byte("after the changes")) {
+		t.Errorf("WatchRemoteConfiguration: record not written after the changes")
+	}
+}
+
+func TestConsulSource(t *testing.T) {
+	configs := make(chan string, 1)
+	consul := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/kv/config/log4go" || r.Header.Get("X-Consul-Token") != "secret" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.URL.Query().Get("index") == "" {
+			w.Header().Set("X-Consul-Index", "7")
+			fmt.Fprint(w, "config 7")
+			return
+		}
+		select {
+		case config := <-configs:
+			w.Header().Set("X-Consul-Index", "8")
+			fmt.Fprint(w, config)
+		case <-time.After(20 * time.Millisecond):
+			// The blocking query timed out without a change
+			w.Header().Set("X-Consul-Index", r.URL.Query().Get("index"))
+			fmt.Fprint(w, "config 7")
+		}
+	}))
+	defer consul.Close()
+
+	src := &ConsulSource{Addr: consul.URL, Key: "config/log4go", Token: "secret"}
+	data, version, err := src.Fetch(context.Background(), 0)
+	if err != nil || string(data) != "config 7" || version != 7 {
+		t.Fatalf("Fetch: got %q %d (%v)", data, version, err)
+	}
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		configs <- "config 8"
+	}()
+	data, version, err = src.Fetch(context.Background(), version)
+	if err != nil || string(data) != "config 8" || version != 8 {
+		t.Errorf("Fetch: got %q %d (%v)", data, version, err)
+	}
+
+	if _, _, err := (&ConsulSource{Addr: consul.URL, Key: "missing"}).Fetch(context.Background(), 0); err == nil {
+		t.Errorf("Fetch: expected an error for a missing key")
+	}
+}
+
+func TestEtcdSource(t *testing.T) {
+	var rev int32 = 3
+	etcd := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct{ Key []byte }
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || r.URL.Path != "/v3/kv/range" || string(req.Key) != "/config/log4go" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		n := atomic.LoadInt32(&rev)
+		fmt.Fprintf(w, `{"header": {"revision": "%d"}, "kvs": [{"value": %q, "mod_revision": "%d"}]}`,
+			n+10, base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("config %d", n))), n)
+	}))
+	defer etcd.Close()
+
+	src := &EtcdSource{Endpoint: etcd.URL, Key: "/config/log4go", PollInterval: 10 * time.Millisecond}
+	data, version, err := src.Fetch(context.Background(), 0)
+	if err != nil || string(data) != "config 3" || version != 3 {
+		t.Fatalf("Fetch: got %q %d (%v)", data, version, err)
+	}
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		atomic.StoreInt32(&rev, 4)
+	}()
+	data, version, err = src.Fetch(context.Background(), version)
+	if err != nil || string(data) != "config 4" || version != 4 {
+		t.Errorf("Fetch: got %q %d (%v)", data, version, err)
+	}
+}
+
+func TestValidateConfiguration(t *testing.T) {
+	issues, err := ValidateConfiguration(`{
+		"level_names": {"WARN": "W"},
+		"console": {"enable": true, "level": "INFO", "format": "xml"},
+		"files": [
+			{"enable": true, "category": "api", "level": "LOUD", "filename": "` + testLogFile + `", "pattern": "%M %"},
+			{"enable": true, "category": "api", "level": "INFO", "filename": "no/such/dir/api.log", "compression": "lz4"}
+		],
+		"sockets": [{"enable": true, "level": "INFO", "addr": "localhost"}]
+	}`)
+	if err != nil {
+		t.Fatalf("ValidateConfiguration: %s", err)
+	}
+	want := []string{
+		`level_names: unknown level "WARN"`,
+		`console: unknown format "xml"`,
+		`files[0]: unknown level "LOUD"`,
+		`files[0]: pattern "%M %": dangling % at the end`,
+		`files[1]: unknown compression "lz4"`,
+		`files[1]: directory no/such/dir of no/such/dir/api.log does not exist`,
+		`sockets[0]: invalid address "localhost": address localhost: missing port in address`,
+		`sockets[0]: no category`,
+	}
+	var got []string
+	for _, issue := range issues {
+		got = append(got, issue.String())
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("ValidateConfiguration:\ngot  %q\nwant %q", got, want)
+	}
+	if _, err := os.Stat(testLogFile); err == nil {
+		os.Remove(testLogFile)
+		t.Errorf("ValidateConfiguration: created the log file")
+	}
+
+	issues, err = ValidateConfiguration(`<logging>
+  <filter enabled="true"><tag>stdout</tag><type>console</type><level>INFO</level></filter>
+  <filter enabled="true"><tag>net</tag><type>socket</type><level>INFO</level>
+    <property name="endpoint">127.0.0.1:12124</property></filter>
+  <filter enabled="true"><tag>stdout</tag><type>syslog</type></filter>
+</logging>`)
+	if err != nil {
+		t.Fatalf("ValidateConfiguration: %s", err)
+	}
+	if len(issues) != 2 || issues[0].String() != "filter[2] (stdout): missing <level>" ||
+		issues[1].Message != `unknown filter type "syslog"` {
+		t.Errorf("ValidateConfiguration: got %v", issues)
+	}
+
+	if _, err := ValidateConfiguration("no-such-config.json"); err == nil {
+		t.Errorf("ValidateConfiguration: expected an error for a missing file")
+	}
+}
+
+func TestSetBufferLength(t *testing.T) {
+	defer os.Remove(testLogFile)
+
+	w := NewFileLogWriter(testLogFile, false, false).SetFormat("%M").SetBufferLength(100)
+	if cap(w.rec) != 100 {
+		t.Errorf("SetBufferLength: got a buffer of %d", cap(w.rec))
+	}
+	for i := 0; i < 100; i++ {
+		w.LogWrite(newLogRecord(INFO, "source", "message"))
+	}
+	w.Close()
+	if contents, err := ioutil.ReadFile(testLogFile); err != nil || strings.Count(string(contents), "message\n") != 100 {
+		t.Errorf("SetBufferLength: got %d records (%v)", strings.Count(string(contents), "\n"), err)
+	}
+
+	log := make(Logger)
+	log.LoadJsonConfiguration(`{"console": {"enable": true, "level": "INFO", "buffer_length": 7}}`)
+	defer log.Close()
+	if c, ok := log["stdout"].LogWriter.(*ConsoleLogWriter); !ok || cap(c.w) != 7 {
+		t.Errorf("buffer_length: expected a console buffer of 7, got %v", log["stdout"])
+	}
+}
+
+func TestConfigDefaults(t *testing.T) {
+	var lc LogConfig
+	err := decodeJSONConfig([]byte(`{
+		"defaults": {"level": "INFO", "pattern": "%M", "rotate": true, "maxsize": "100M"},
+		"files": [
+			{"enable": true, "category": "api", "filename": "api.log"},
+			{"enable": true, "category": "db", "filename": "db.log", "level": "DEBUG", "rotate": false},
+			null
+		],
+		"sockets": [{"enable": true, "category": "net", "addr": "127.0.0.1:12124"}]
+	}`), "", &lc)
+	if err != nil {
+		t.Fatalf("decodeJSONConfig: %s", err)
+	}
+	if api := lc.Files[0]; api.Level != "INFO" || api.Pattern != "%M" || !api.Rotate || api.Maxsize != "100M" {
+		t.Errorf("defaults: api inherited %+v", api)
+	}
+	if db := lc.Files[1]; db.Level != "DEBUG" || db.Pattern != "%M" || db.Rotate {
+		t.Errorf("defaults: db inherited %+v", db)
+	}
+	if net := lc.Sockets[0]; net.Level != "INFO" || net.Pattern != "%M" {
+		t.Errorf("defaults: net inherited %+v", net)
+	}
+
+	lc = LogConfig{}
+	err = decodeYAMLConfig(`defaults:
+  level: INFO
+  rotate: true
+files:
+  - category: api
+  - category: db
+    rotate: false
+`, "", &lc)
+	if err != nil {
+		t.Fatalf("decodeYAMLConfig: %s", err)
+	}
+	if len(lc.Files) != 2 || lc.Files[0].Level != "INFO" || !lc.Files[0].Rotate || lc.Files[1].Level != "INFO" || lc.Files[1].Rotate {
+		t.Errorf("defaults: got %+v %+v", lc.Files[0], lc.Files[len(lc.Files)-1])
+	}
+
+	if err := decodeJSONConfig([]byte(`{"defaults": "INFO", "files": []}`), "", &LogConfig{}); err == nil {
+		t.Errorf("decodeJSONConfig: expected an error for defaults that are not an object")
+	}
+}
+
+func TestJsonConfigSharedCategories(t *testing.T) {
+	defer os.Remove(testLogFile)
+
+	log := make(Logger)
+	log.LoadJsonConfiguration(`{"files": [{"enable": true, "category": "api", "categories": ["worker", "cron", "api"],
+		"level": "INFO", "filename": "` + testLogFile + `", "pattern": "[%C] %M"}]}`)
+	if len(log) != 3 {
+		t.Fatalf("categories: expected 3 filters, got %v", log)
+	}
+	log["api"].Info("a")
+	log["cron"].Info("c")
+	log["worker"].Child("jobs").Info("j")
+	log.Info("everyone")
+	log.Close()
+
+	want := "[api] a\n[cron] c\n[worker.jobs] j\n[DEFAULT] everyone\n"
+	if contents, err := ioutil.ReadFile(testLogFile); err != nil || string(contents) != want {
+		t.Errorf("Log: got %q (%v), want %q", contents, err, want)
+	}
+}
+
+func TestExpandFilename(t *testing.T) {
+	hostname, _ := os.Hostname()
+	want := fmt.Sprintf("logs/api-%s-%d-%s.{other}.log", hostname, os.Getpid(), time.Now().Format("2006-01-02"))
+	if got := expandFilename("logs/api-{hostname}-{pid}-{date}.{other}.log"); got != want {
+		t.Errorf("expandFilename: got %q, want %q", got, want)
+	}
+
+	defer os.Remove(fmt.Sprintf("_logtest-%d.log", os.Getpid()))
+	log := make(Logger)
+	log.LoadJsonConfiguration(`{"files": [{"enable": true, "category": "api", "level": "INFO", "filename": "_logtest-{pid}.log"}]}`)
+	defer log.Close()
+	if fname := log["api"].LogWriter.(*FileLogWriter).filename; fname != fmt.Sprintf("_logtest-%d.log", os.Getpid()) {
+		t.Errorf("filename: got %q", fname)
+	}
+}
+
+func TestConfigProfiles(t *testing.T) {
+	const config = `{
+		"console": {"enable": true, "level": "DEBUG"},
+		"defaults": {"pattern": "%M"},
+		"files": [{"enable": true, "category": "api", "filename": "api.log", "level": "DEBUG"}],
+		"profiles": {
+			"prod": {
+				"console": {"enable": false},
+				"defaults": {"rotate": true},
+				"files": [{"category": "api", "level": "WARNING"}, {"enable": true, "category": "audit", "level": "INFO"}]
+			}
+		}
+	}`
+
+	var lc LogConfig
+	if err := decodeJSONConfig([]byte(config), "prod", &lc); err != nil {
+		t.Fatalf("decodeJSONConfig: %s", err)
+	}
+	if lc.Console.Enable || lc.Console.Level != "DEBUG" {
+		t.Errorf("prod: got console %+v", lc.Console)
+	}
+	if len(lc.Files) != 2 {
+		t.Fatalf("prod: got %d files", len(lc.Files))
+	}
+	if api := lc.Files[0]; !api.Enable || api.Filename != "api.log" || api.Level != "WARNING" || api.Pattern != "%M" || !api.Rotate {
+		t.Errorf("prod: got api %+v", api)
+	}
+	if audit := lc.Files[1]; audit.Category != "audit" || audit.Level != "INFO" || !audit.Rotate {
+		t.Errorf("prod: got audit %+v", audit)
+	}
+
+	// The profile comes from the environment unless one is given
+	os.Setenv(ProfileEnv, "prod")
+	defer os.Unsetenv(ProfileEnv)
+	lc = LogConfig{}
+	if err := decodeJSONConfig([]byte(config), "", &lc); err != nil || lc.Console.Enable {
+		t.Errorf("%s=prod: got console %+v (%v)", ProfileEnv, lc.Console, err)
+	}
+	lc = LogConfig{}
+	if err := decodeJSONConfig([]byte(config), "dev", &lc); err != nil || !lc.Console.Enable || len(lc.Files) != 1 || lc.Files[0].Rotate {
+		t.Errorf("dev: got %+v %+v (%v)", lc.Console, lc.Files[0], err)
+	}
+
+	lc = LogConfig{}
+	err := decodeYAMLConfig(`console:
+  enable: true
+  level: DEBUG
+files:
+  - category: api
+    level: DEBUG
+profiles:
+  prod:
+    console: {level: ERROR}
+    files:
+      - category: api
+        level: WARNING
+`, "prod", &lc)
+	if err != nil {
+		t.Fatalf("decodeYAMLConfig: %s", err)
+	}
+	if !lc.Console.Enable || lc.Console.Level != "ERROR" || len(lc.Files) != 1 || lc.Files[0].Level != "WARNING" {
+		t.Errorf("yaml prod: got %+v %+v", lc.Console, lc.Files)
+	}
+}
+
+func TestSetLevel(t *testing.T) {
+	w := &recordingLogWriter{}
+	log := Logger{"api": &Filter{Level: INFO, LogWriter: w, Category: "api"}}
+
+	if err := log.SetLevel("db", DEBUG); err == nil {
+		t.Errorf("SetLevel: expected an error for an unknown category")
+	}
+	if lvl, ok := log.GetLevel("api"); !ok || lvl != INFO {
+		t.Errorf("GetLevel: got %v %v", lvl, ok)
+	}
+
+	done := make(chan bool)
+	go func() {
+		for i := 0; i < 100; i++ {
+			log["api"].Debug("racing")
+		}
+		close(done)
+	}()
+	if err := log.SetLevel("api", DEBUG); err != nil {
+		t.Errorf("SetLevel: %s", err)
+	}
+	<-done
+
+	log["api"].Debug("on")
+	if lvl, _ := log.GetLevel("api"); lvl != DEBUG {
+		t.Errorf("GetLevel: got %v after SetLevel", lvl)
+	}
+	if recs := w.records; len(recs) == 0 || recs[len(recs)-1].Message != "on" {
+		t.Errorf("SetLevel: DEBUG record not logged")
+	}
+}
+
+func TestAdminHandler(t *testing.T) {
+	defer os.Remove(testLogFile)
+	fw := NewFileLogWriter(testLogFile, false, false)
+	log := Logger{
+		"api":  &Filter{Level: INFO, LogWriter: &recordingLogWriter{}, Category: "api"},
+		"file": &Filter{Level: DEBUG, LogWriter: fw, Category: "file"},
+	}
+	defer log.Close()
+	srv := httptest.NewServer(http.StripPrefix("/debug/log4go", log.AdminHandler()))
+	defer srv.Close()
+
+	do := func(method, path, body string) (int, string) {
+		req, _ := http.NewRequest(method, srv.URL+"/debug/log4go"+path, strings.NewReader(body))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %s", method, path, err)
+		}
+		defer resp.Body.Close()
+		b, _ := ioutil.ReadAll(resp.Body)
+		return resp.StatusCode, string(b)
+	}
+
+	var levels map[string]string
+	if code, body := do("GET", "/levels", ""); code != 200 || json.Unmarshal([]byte(body), &levels) != nil || levels["api"] != "INFO" {
+		t.Errorf("GET /levels: %d %s", code, body)
+	}
+	if code, body := do("PUT", "/levels/api", "debug"); code != 200 {
+		t.Errorf("PUT /levels/api: %d %s", code, body)
+	}
+	if lvl, _ := log.GetLevel("api"); lvl != DEBUG {
+		t.Errorf("PUT /levels/api: level is %v", lvl)
+	}
+	if code, _ := do("POST", "/levels/api?level=LOUD", ""); code != http.StatusBadRequest {
+		t.Errorf("unknown level: got status %d", code)
+	}
+	if code, _ := do("PUT", "/levels/db", "INFO"); code != http.StatusNotFound {
+		t.Errorf("unknown category: got status %d", code)
+	}
+
+	if code, body := do("POST", "/rotate", ""); code != 200 || !strings.Contains(body, `"file"`) || strings.Contains(body, `"api"`) {
+		t.Errorf("POST /rotate: %d %s", code, body)
+	}
+	if code, _ := do("POST", "/rotate/api", ""); code != http.StatusNotFound {
+		t.Errorf("POST /rotate/api: got status %d", code)
+	}
+
+	var stats map[string]AdminWriterStats
+	if code, body := do("GET", "/stats", ""); code != 200 || json.Unmarshal([]byte(body), &stats) != nil {
+		t.Fatalf("GET /stats: %d %s", code, body)
+	}
+	if s := stats["file"]; s.Writer != "*log4go.FileLogWriter" || s.Filename != testLogFile || s.Capacity != LogBufferLength {
+		t.Errorf("GET /stats: got %+v", s)
+	}
+	if code, _ := do("DELETE", "/stats", ""); code != http.StatusMethodNotAllowed {
+		t.Errorf("DELETE /stats: got status %d", code)
+	}
+}
+
+func TestLoggerConcurrency(t *testing.T) {
+	log := make(Logger)
+	log.AddFilter("api", INFO, &recordingLogWriter{}, "api")
+	defer log.Close()
+
+	done := make(chan bool)
+	go func() {
+		for i := 0; i < 100; i++ {
+			log.AddFilter(fmt.Sprintf("db%d", i), INFO, &recordingLogWriter{}, "db")
+			log.SetLevel("api", Level(i%2)+INFO)
+		}
+		close(done)
+	}()
+	for i := 0; i < 100; i++ {
+		log.Debug("racing")
+		log.GetLevel("api")
+		log.AdminHandler().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/stats", nil))
+	}
+	<-done
+
+	f := log["api"]
+	h := f.handle("api").WithFields(Fields{"k": "v"})
+	log.SetLevel("api", ERROR)
+	if h.level() != ERROR || f.Category != "api" {
+		t.Errorf("handle: got level %v, category %q", h.level(), f.Category)
+	}
+}
+
+func TestReloadWhileLogging(t *testing.T) {
+	defer func(saved Logger) { Global = saved }(Global)
+	Global = make(Logger)
+	fname := filepath.Join(t.TempDir(), "reload.log")
+	config := `{"console": {"enable": false}, "files": [{"enable": true, "category": "api",
+		"categories": ["api", "db"], "level": "INFO", "filename": "` + fname + `"}]}`
+	Global.LoadJsonConfiguration(config)
+	defer Global.Close()
+
+	api, db := LOGGER("api"), LOGGER("db").WithFields(Fields{"k": "v"})
+	stop := make(chan bool)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				Global.Info("global")
+				api.Info("api")
+				db.Warn("db")
+				LOGGER("api").Child("req").Info("child")
+			}
+		}()
+	}
+	for i := 0; i < 20; i++ {
+		Global.LoadJsonConfiguration(config)
+	}
+	close(stop)
+	wg.Wait()
+
+	h := LOGGER("api")
+	Global.LoadJsonConfiguration(config)
+	h.Info("after reload")
+	Global.Flush()
+	contents, err := ioutil.ReadFile(fname)
+	if err != nil {
+		t.Fatalf("read(%q): %s", fname, err)
+	}
+	if !bytes.Contains(contents, []byte("after reload")) {
+		t.Errorf("handle taken before the reload: record not written")
+	}
+}
+
+func TestLOGGERMissingCategory(t *testing.T) {
+	defer func(saved Logger) { Global = saved }(Global)
+	stdout := &recordingLogWriter{}
+	Global = Logger{"stdout": &Filter{Level: INFO, LogWriter: stdout, Category: "DEFAULT"}}
+
+	a, b := LOGGER("A"), LOGGER("B")
+	a.Warn("from a")
+	b.Warn("from b")
+	if got := Global["stdout"].Category; got != "DEFAULT" {
+		t.Errorf("LOGGER changed the stdout filter category to %q", got)
+	}
+	if len(stdout.records) != 2 || stdout.records[0].Category != "A" || stdout.records[1].Category != "B" {
+		t.Fatalf("LOGGER: got %d records on stdout", len(stdout.records))
+	}
+
+	Global.SetLevel("stdout", ERROR)
+	a.Warn("filtered")
+	if len(stdout.records) != 2 {
+		t.Errorf("LOGGER: handle did not follow the stdout level")
+	}
+}
+
+func TestFlush(t *testing.T) {
+	defer os.Remove(testLogFile)
+	var out bytes.Buffer
+	log := make(Logger)
+	log.AddFilter("file", INFO, NewFileLogWriter(testLogFile, false, false).SetFormat("[%L] %M").SetFlushInterval(time.Hour))
+	log.AddFilter("format", INFO, NewFormatLogWriter(&out, "%M"))
+	log.AddFilter("rec", INFO, &recordingLogWriter{})
+	defer log.Close()
+
+	for i := 0; i < 100; i++ {
+		log.Info("line %d", i)
+	}
+	log.Flush()
+
+	contents, err := ioutil.ReadFile(testLogFile)
+	if err != nil {
+		t.Fatalf("read(%q): %s", testLogFile, err)
+	}
+	if n := bytes.Count(contents, []byte("\n")); n != 100 {
+		t.Errorf("Flush: %d lines in the file, want 100", n)
+	}
+	if n := strings.Count(out.String(), "\n"); n != 100 {
+		t.Errorf("Flush: %d lines written by FormatLogWriter, want 100", n)
+	}
+}
+
+type blockingLogWriter chan bool
+
+func (w blockingLogWriter) LogWrite(rec *LogRecord) {}
+func (w blockingLogWriter) Close()                  { <-w }
+
+func TestCloseTimeout(t *testing.T) {
+	var out bytes.Buffer
+	log := make(Logger)
+	log.AddFilter("format", INFO, NewFormatLogWriter(&out, "%M"))
+	log.Info("last words")
+	if err := log.CloseTimeout(time.Second); err != nil {
+		t.Errorf("CloseTimeout: %s", err)
+	}
+	if got := out.String(); got != "last words\n" {
+		t.Errorf("CloseTimeout: returned before %q was written, got %q", "last words", got)
+	}
+
+	stuck := make(blockingLogWriter)
+	defer close(stuck)
+	log.AddFilter("stuck", INFO, stuck)
+	log.AddFilter("rec", INFO, &recordingLogWriter{})
+	if err := log.CloseTimeout(10 * time.Millisecond); err == nil || !strings.Contains(err.Error(), "1 of 2") {
+		t.Errorf("CloseTimeout: got %v for a stuck writer", err)
+	}
+	if len(log) != 0 {
+		t.Errorf("CloseTimeout: %d filters left", len(log))
+	}
+}
+
+func TestOverflowPolicy(t *testing.T) {
+	for _, test := range []struct {
+		policy OverflowPolicy
+		queued []string
+	}{
+		{OverflowDrop, []string{"0", "1"}},
+		{OverflowDropOldest, []string{"3", "4"}},
+	} {
+		// No goroutine reads the queue, as if the writer were stuck
+		console := &ConsoleLogWriter{w: make(chan *LogRecord, 2)}
+		console.SetOverflowPolicy(test.policy)
+		for i := 0; i < 5; i++ {
+			console.LogWrite(newLogRecord(INFO, "source", fmt.Sprint(i)))
+		}
+		if got := console.Dropped(); got != 3 {
+			t.Errorf("%s: Dropped() = %d, want 3", test.policy, got)
+		}
+		for _, want := range test.queued {
+			if got := (<-console.w).Message; got != want {
+				t.Errorf("%s: queued %q, want %q", test.policy, got, want)
+			}
+		}
+	}
+
+	if p, err := ParseOverflowPolicy("drop_oldest"); err != nil || p != OverflowDropOldest {
+		t.Errorf("ParseOverflowPolicy: got %v, %v", p, err)
+	}
+	if _, err := ParseOverflowPolicy("spill"); err == nil {
+		t.Errorf("ParseOverflowPolicy: expected an error")
+	}
+	issues, err := ValidateConfiguration(`{"console": {"enable": true, "level": "INFO", "overflow": "spill"}}`)
+	if err != nil || len(issues) != 1 || !strings.Contains(issues[0].Message, "overflow") {
+		t.Errorf("ValidateConfiguration: got %v, %v", issues, err)
+	}
+}
+
+func TestFatalAndPanic(t *testing.T) {
+	defer func(saved func(int)) { exit = saved }(exit)
+	code := -1
+	exit = func(c int) { code = c }
+
+	rw := &recordingLogWriter{}
+	l := make(Logger)
+	l.AddFilter("rec", CRITICAL, rw)
+	l.Fatalf("disk %s", "full")
+	if code != 1 || len(rw.records) != 1 || rw.records[0].Level != FATAL || rw.records[0].Message != "disk full" {
+		t.Errorf("Fatalf: exit code %d, records %d", code, len(rw.records))
+	}
+
+	func() {
+		defer func() {
+			if r := recover(); r != "bad state 42" {
+				t.Errorf("Panic: recovered %v", r)
+			}
+		}()
+		l.Panic("bad state ", 42)
+	}()
+	if len(rw.records) != 2 || rw.records[1].Level != PANIC || rw.records[1].Level.String() != "PANC" {
+		t.Errorf("Panic: got %d records", len(rw.records))
+	}
+
+	if lvl, ok := configLevel("FATAL"); !ok || lvl != FATAL {
+		t.Errorf("configLevel(FATAL): got %v, %v", lvl, ok)
+	}
+}
+
+func TestRegisterLevel(t *testing.T) {
+	notice, err := RegisterLevel("NOTICE", 45, "NOTE")
+	if err != nil {
+		t.Fatalf("RegisterLevel: %s", err)
+	}
+	if again, err := RegisterLevel("NOTICE", 45); err != nil || again != notice {
+		t.Errorf("RegisterLevel again: got %v, %v", again, err)
+	}
+	for _, bad := range []struct {
+		name string
+		rank int
+	}{{"INFO2", 40}, {"NOTICE", 46}, {"OTHER", 45}, {"WARNING", 55}, {"", 47}} {
+		if _, err := RegisterLevel(bad.name, bad.rank); err == nil {
+			t.Errorf("RegisterLevel(%q, %d): expected an error", bad.name, bad.rank)
+		}
+	}
+
+	if !notice.atLeast(INFO) || notice.atLeast(WARNING) || !WARNING.atLeast(notice) {
+		t.Errorf("NOTICE is not between INFO and WARNING")
+	}
+	if lvl, ok := configLevel("NOTICE"); !ok || lvl != notice {
+		t.Errorf("configLevel(NOTICE): got %v, %v", lvl, ok)
+	}
+	if got := FormatLogRecord("[%L] %M", newLogRecord(notice, "source", "message")); got != "[NOTE] message\n" {
+		t.Errorf("FormatLogRecord: got %q", got)
+	}
+	SetLevelName(notice, "Notice")
+	if got := notice.String(); got != "Notice" {
+		t.Errorf("SetLevelName: got %q", got)
+	}
+	SetLevelName(notice, "")
+	if got := NewSplitFileLogWriter("app.log", false, false).LevelFilename(notice); got != "app.notice.log" {
+		t.Errorf("LevelFilename: got %q", got)
+	}
+
+	info, warning := &recordingLogWriter{}, &recordingLogWriter{}
+	l := make(Logger)
+	l.AddFilter("info", INFO, info)
+	l.AddFilter("warning", WARNING, warning)
+	l.Logf(notice, "config reloaded")
+	if len(info.records) != 1 || len(warning.records) != 0 {
+		t.Errorf("Logf(NOTICE): %d records at INFO, %d at WARNING", len(info.records), len(warning.records))
+	}
+}
+
+func TestHierarchicalCategories(t *testing.T) {
+	defer func(saved Logger) { Global = saved }(Global)
+	api, db := &recordingLogWriter{}, &recordingLogWriter{}
+	Global = Logger{
+		"api":    &Filter{Level: INFO, LogWriter: api, Category: "api"},
+		"api.db": &Filter{Level: DEBUG, LogWriter: db, Category: "api.db"},
+	}
+
+	LOGGER("api.db.query").Debug("select")
+	LOGGER("api.http").Debug("filtered")
+	LOGGER("api.http").Info("get")
+	LOGGER("apiary").Info("no parent")
+	if len(db.records) != 1 || db.records[0].Category != "api.db.query" {
+		t.Errorf("api.db.query: got %d records in api.db", len(db.records))
+	}
+	if len(api.records) != 1 || api.records[0].Category != "api.http" {
+		t.Errorf("api.http: got %d records in api", len(api.records))
+	}
+
+	Global.SetLevel("api.db", WARNING)
+	LOGGER("api.db.query").Info("filtered")
+	if len(db.records) != 1 {
+		t.Errorf("api.db.query: level of api.db not inherited")
+	}
+
+	Global.Ingest([]*LogRecord{{Level: INFO, Category: "api.auth", Message: "ingested"}})
+	if len(api.records) != 2 {
+		t.Errorf("Ingest: api.auth not routed to api")
+	}
+}
+
+func TestWildcardCategories(t *testing.T) {
+	defer func(saved Logger) { Global = saved }(Global)
+	defer os.Remove(testLogFile)
+	Global = make(Logger)
+	Global.LoadJsonConfiguration(`{"files": [
+		{"enable": true, "category": "worker-??", "level": "INFO", "filename": "` + testLogFile + `", "pattern": "%C %M"}
+	]}`)
+	api := &recordingLogWriter{}
+	Global.AddFilter("api.*", INFO, api)
+	Global.AddFilter("api.v2.*", INFO, &recordingLogWriter{})
+
+	LOGGER("worker-01").Info("started")
+	LOGGER("worker-100").Info("not matched")
+	LOGGER("api.users").Info("listed")
+	LOGGER("api.v2.users").Info("longer pattern")
+	Global.Close()
+
+	contents, _ := ioutil.ReadFile(testLogFile)
+	if got := string(contents); got != "worker-01 started\n" {
+		t.Errorf("worker-??: got %q", got)
+	}
+	if len(api.records) != 1 || api.records[0].Category != "api.users" {
+		t.Errorf("api.*: got %d records", len(api.records))
+	}
+
+	issues, err := ValidateConfiguration(`{"files": [{"enable": true, "category": "api.[", "level": "INFO", "filename": "` + testLogFile + `"}]}`)
+	if err != nil || len(issues) != 1 || !strings.Contains(issues[0].Message, "pattern") {
+		t.Errorf("ValidateConfiguration: got %v, %v", issues, err)
+	}
+}
+
+func TestAddWriter(t *testing.T) {
+	defer func(saved Logger) { Global = saved }(Global)
+	Global = make(Logger)
+	all, alerts := &recordingLogWriter{}, &recordingLogWriter{}
+	Global.AddFilter("api", DEBUG, all, "api").AddWriter("api", ERROR, alerts)
+
+	api := LOGGER("api")
+	api.Debug("request")
+	api.Error("failed")
+	if len(all.records) != 2 || len(alerts.records) != 1 || alerts.records[0].Message != "failed" {
+		t.Errorf("AddWriter: got %d and %d records", len(all.records), len(alerts.records))
+	}
+
+	// The category as a whole is raised, each writer keeps its own level
+	Global.SetLevel("api", WARNING)
+	api.Info("dropped")
+	api.Critical("down")
+	if len(all.records) != 3 || len(alerts.records) != 2 {
+		t.Errorf("SetLevel: got %d and %d records", len(all.records), len(alerts.records))
+	}
+	Global.Close()
+
+	defer os.Remove(testLogFile)
+	Global = make(Logger)
+	Global.LoadJsonConfiguration(`{"files": [
+		{"enable": true, "category": "api", "level": "DEBUG", "filename": "` + testLogFile + `", "pattern": "%L %M"},
+		{"enable": true, "category": "api", "level": "ERROR", "filename": "` + testLogFile + `.err", "pattern": "%L %M"}
+	]}`)
+	defer os.Remove(testLogFile + ".err")
+	LOGGER("api").Debug("request")
+	LOGGER("api").Error("failed")
+	Global.Close()
+
+	contents, _ := ioutil.ReadFile(testLogFile)
+	errors, _ := ioutil.ReadFile(testLogFile + ".err")
+	if string(contents) != "DEBG request\nEROR failed\n" || string(errors) != "EROR failed\n" {
+		t.Errorf("config: got %q and %q", contents, errors)
+	}
+}
+
+func TestMaxLevel(t *testing.T) {
+	defer func(saved Logger) { Global = saved }(Global)
+	defer os.Remove(testLogFile)
+	defer os.Remove(testLogFile + ".err")
+	Global = make(Logger)
+	Global.LoadJsonConfiguration(`{"files": [
+		{"enable": true, "category": "app", "level": "DEBUG", "max_level": "INFO", "filename": "` + testLogFile + `", "pattern": "%L %M"},
+		{"enable": true, "category": "app", "level": "WARNING", "filename": "` + testLogFile + `.err", "pattern": "%L %M"}
+	]}`)
+	app := LOGGER("app")
+	app.Debug("request")
+	app.Info("served")
+	app.Warn("slow")
+	app.Error("failed")
+	Global.Close()
+
+	contents, _ := ioutil.ReadFile(testLogFile)
+	errors, _ := ioutil.ReadFile(testLogFile + ".err")
+	if string(contents) != "DEBG request\nINFO served\n" || string(errors) != "WARN slow\nEROR failed\n" {
+		t.Errorf("max_level: got %q and %q", contents, errors)
+	}
+
+	w := &recordingLogWriter{}
+	Global = make(Logger)
+	Global.LoadConfiguration(`<logging><filter enabled="true"><tag>stdout</tag><type>console</type>
+<level>FINEST</level><maxlevel>FINE</maxlevel></filter></logging>`)
+	if filt, ok := Global.get("stdout"); !ok || filt.LogWriter.(*maxLevelWriter).max != FINE {
+		t.Errorf("<maxlevel>: not applied")
+	}
+	Global.Close()
+	Global.AddFilter("trace", FINEST, MaxLevel(TRACE, w))
+	Global.Debug("kept")
+	Global.Info("dropped")
+	if len(w.records) != 1 || w.records[0].Message != "kept" {
+		t.Errorf("MaxLevel: got %d records", len(w.records))
+	}
+
+	issues, err := ValidateConfiguration(`{"console": {"enable": true, "level": "ERROR", "max_level": "INFO"}}`)
+	if err != nil || len(issues) != 1 || issues[0].Message != "max level INFO is below level ERROR, nothing is written" {
+		t.Errorf("ValidateConfiguration: got %v, %v", issues, err)
+	}
+}
+
+func TestMessageFilters(t *testing.T) {
+	defer func(saved Logger) { Global = saved }(Global)
+	defer os.Remove(testLogFile)
+	Global = make(Logger)
+	Global.LoadJsonConfiguration(`{"files": [{"enable": true, "category": "api", "level": "DEBUG",
+		"filename": "` + testLogFile + `", "pattern": "%M", "deny": ["^health check", "ping$"]}]}`)
+	api := LOGGER("api")
+	api.Info("health check ok")
+	api.Info("served /users")
+	api.Debug("ping")
+	Global.Close()
+	if contents, _ := ioutil.ReadFile(testLogFile); string(contents) != "served /users\n" {
+		t.Errorf("deny: got %q", contents)
+	}
+
+	w := &recordingLogWriter{}
+	allowed, err := FilterMessages([]string{"^payment"}, []string{"test"}, w)
+	if err != nil {
+		t.Fatalf("FilterMessages: %s", err)
+	}
+	Global = make(Logger)
+	Global.AddFilter("payments", INFO, allowed)
+	Global.AddFilter("warnings", INFO, FilterRecords(func(rec *LogRecord) bool { return rec.Level == WARNING }, w))
+	Global.Info("payment accepted")
+	Global.Info("payment test")
+	Global.Info("refund accepted")
+	if len(w.records) != 1 || w.records[0].Message != "payment accepted" {
+		t.Errorf("FilterMessages: got %d records", len(w.records))
+	}
+	Global.Warn("refund delayed")
+	if len(w.records) != 2 || w.records[1].Message != "refund delayed" {
+		t.Errorf("FilterRecords: got %d records", len(w.records))
+	}
+
+	if _, err := FilterMessages(nil, []string{"("}, w); err == nil {
+		t.Errorf("FilterMessages: expected an error for an invalid expression")
+	}
+	issues, err := ValidateConfiguration(`<logging><filter enabled="true"><tag>stdout</tag><type>console</type><level>INFO</level>
+<property name="deny">ok</property><property name="deny">[</property></filter></logging>`)
+	if err != nil || len(issues) != 1 || !strings.Contains(issues[0].Message, `invalid message filter "["`) {
+		t.Errorf("ValidateConfiguration: got %v, %v", issues, err)
+	}
+}
+
+func TestHooks(t *testing.T) {
+	defer func(saved Logger) { Global = saved }(Global)
+	defer os.Remove(testLogFile)
+	removeRedact := RegisterHook(func(rec *LogRecord) *LogRecord {
+		rec.Message = strings.Replace(rec.Message, "hunter2", "***", -1)
+		return rec
+	})
+	removeDrop := RegisterHook(func(rec *LogRecord) *LogRecord {
+		if rec.Message == "noise" {
+			return nil
+		}
+		return rec
+	})
+	var wrote int32
+	removeCount := RegisterPostWriteHook(func(w LogWriter, rec *LogRecord) {
+		if _, ok := w.(*FileLogWriter); ok {
+			atomic.AddInt32(&wrote, 1)
+		}
+	})
+
+	Global = make(Logger)
+	Global.AddFilter("file", INFO, NewFileLogWriter(testLogFile, false, false).SetFormat("%M"))
+	Global.Info("password hunter2")
+	Global.Info("noise")
+	LOGGER("file").Info("hunter2 again")
+	Global.Flush()
+	removeRedact()
+	removeDrop()
+	removeCount()
+	Global.Info("hunter2 unhooked")
+	Global.Close()
+
+	contents, _ := ioutil.ReadFile(testLogFile)
+	if want := "password ***\n*** again\nhunter2 unhooked\n"; string(contents) != want {
+		t.Errorf("RegisterHook: got %q, want %q", contents, want)
+	}
+	if n := atomic.LoadInt32(&wrote); n != 2 {
+		t.Errorf("RegisterPostWriteHook: called %d times", n)
+	}
+}
+
+func TestSetCaptureSource(t *testing.T) {
+	defer func(saved Logger) { Global = saved }(Global)
+	w := &recordingLogWriter{}
+	Global = make(Logger)
+	Global.AddFilter("hot", INFO, w, "hot")
+
+	hot := LOGGER("hot")
+	hot.Info("with source")
+	if err := SetCaptureSource("hot", false); err != nil {
+		t.Fatalf("SetCaptureSource: %s", err)
+	}
+	hot.Info("without source")
+	Global.Info("without source either")
+	if len(w.records) != 3 || !strings.Contains(w.records[0].Source, "TestSetCaptureSource") || w.records[0].Line == 0 {
+		t.Fatalf("SetCaptureSource: got %d records, source %q", len(w.records), w.records[0].Source)
+	}
+	for _, rec := range w.records[1:] {
+		if rec.Source != "" || rec.File != "" || rec.Line != 0 {
+			t.Errorf("SetCaptureSource(false): %q has source %q %s:%d", rec.Message, rec.Source, rec.File, rec.Line)
+		}
+	}
+	if err := SetCaptureSource("cold", false); err == nil {
+		t.Errorf("SetCaptureSource: expected an error for a missing category")
+	}
+}
+
+func TestSetRateLimit(t *testing.T) {
+	defer func(saved Logger) { Global = saved }(Global)
+	w := &recordingLogWriter{}
+	Global = make(Logger)
+	Global.AddFilter("chatty", INFO, w, "chatty")
+	if err := SetRateLimit("chatty", 0.001, 3); err != nil {
+		t.Fatalf("SetRateLimit: %s", err)
+	}
+
+	chatty := LOGGER("chatty").WithFields(Fields{"conn": 7})
+	for i := 0; i < 10; i++ {
+		chatty.Info("message %d", i)
+	}
+	if len(w.records) != 3 {
+		t.Errorf("SetRateLimit: got %d records, want the burst of 3", len(w.records))
+	}
+	if stats := writerStats(Global["chatty"]); stats.Limited != 7 {
+		t.Errorf("SetRateLimit: %d messages counted dropped", stats.Limited)
+	}
+
+	l := &rateLimiter{rate: 2, burst: 1, tokens: 0, last: time.Unix(0, 0)}
+	if l.allow(time.Unix(0, 0)) || !l.allow(time.Unix(0, 5e8)) || l.allow(time.Unix(0, 6e8)) {
+		t.Errorf("rateLimiter: tokens not refilled at the rate")
+	}
+
+	SetRateLimit("chatty", 0, 0)
+	chatty.Info("unlimited")
+	if len(w.records) != 4 {
+		t.Errorf("SetRateLimit(0): got %d records", len(w.records))
+	}
+
+	Global = make(Logger)
+	Global.LoadConfiguration(`<logging><filter enabled="true"><tag>net</tag><type>console</type><level>INFO</level>
+<property name="rate_limit">100</property><property name="rate_burst">20</property></filter></logging>`)
+	defer Global.Close()
+	if l := Global["net"].rateLimiter(); l == nil || l.rate != 100 || l.burst != 20 {
+		t.Errorf("rate_limit: got %+v", l)
+	}
+}
+
+func TestRedactors(t *testing.T) {
+	defer func(saved Logger) { Global = saved }(Global)
+	defer SetRedactors()
+	w := &recordingLogWriter{}
+	Global = make(Logger)
+	Global.AddFilter("api", INFO, w, "api")
+	SetRedactors(RedactEmails, RedactCardNumbers, RedactTokens)
+
+	shared := Fields{"user": "ann@example.com", "id": 42}
+	LOGGER("api").WithFields(shared).Info("paid with 4111 1111 1111 1111, Authorization: Bearer abc.def")
+	LOGGER("api").Info("login password=hunter2&next=/")
+	if len(w.records) != 2 {
+		t.Fatalf("redact: got %d records", len(w.records))
+	}
+	if got := w.records[0].Message; got != "paid with [CARD], Authorization: Bearer ***" {
+		t.Errorf("redact: got %q", got)
+	}
+	if got := w.records[0].Fields["user"]; got != "[EMAIL]" || w.records[0].Fields["id"] != 42 || shared["user"] != "ann@example.com" {
+		t.Errorf("redact fields: got %v, shared %v", w.records[0].Fields, shared)
+	}
+	if got := w.records[1].Message; got != "login password=***&next=/" {
+		t.Errorf("redact: got %q", got)
+	}
+
+	Global.LoadJsonConfiguration(`{"redact": [{"name": "email"}, {"pattern": "ssn=\\d+", "replacement": "ssn=?"}]}`)
+	Global.AddFilter("api", INFO, w, "api")
+	LOGGER("api").Info("ssn=123456 bob@example.org 4111111111111111")
+	if got := w.records[2].Message; got != "ssn=? [EMAIL] 4111111111111111" {
+		t.Errorf("redact config: got %q", got)
+	}
+
+	issues, err := ValidateConfiguration(`<logging><redact name="phone"/><redact>(</redact></logging>`)
+	if err != nil || len(issues) != 2 {
+		t.Errorf("ValidateConfiguration: got %v, %v", issues, err)
+	}
+}
+
+func TestIsEnabledFor(t *testing.T) {
+	defer func(saved Logger) { Global = saved }(Global)
+	Global = make(Logger)
+	Global.AddFilter("api", INFO, &recordingLogWriter{}, "api")
+
+	api := LOGGER("api")
+	if api.IsEnabledFor(DEBUG) || !api.IsEnabledFor(INFO) || !api.IsEnabledFor(ERROR) {
+		t.Errorf("Filter.IsEnabledFor: wrong at INFO")
+	}
+	if IsEnabledFor(DEBUG) || !IsEnabledFor(WARNING) {
+		t.Errorf("IsEnabledFor: wrong at INFO")
+	}
+	SetLevel("api", DEBUG)
+	if !api.IsEnabledFor(DEBUG) || !IsEnabledFor(DEBUG) {
+		t.Errorf("IsEnabledFor: SetLevel not seen")
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for name, want := range map[string]Level{"DEBUG": DEBUG, "warning": WARNING, "WARN": WARNING, "eror": ERROR, " fatal ": FATAL} {
+		if lvl, err := ParseLevel(name); err != nil || lvl != want {
+			t.Errorf("ParseLevel(%q): got %v, %v", name, lvl, err)
+		}
+	}
+	if _, err := ParseLevel("LOUD"); err == nil {
+		t.Errorf("ParseLevel: expected an error for an unknown level")
+	}
+
+	notice, err := RegisterLevel("REVIEW", 47, "RVW")
+	if err != nil {
+		t.Fatalf("RegisterLevel: %s", err)
+	}
+	for _, lvl := range []Level{FINEST, INFO, CRITICAL, FATAL, notice} {
+		text, err := lvl.MarshalText()
+		var back Level
+		if err != nil || back.UnmarshalText(text) != nil || back != lvl {
+			t.Errorf("MarshalText(%v): %q, %v, read back as %v", lvl, text, err, back)
+		}
+	}
+	if _, err := Level(42).MarshalText(); err == nil {
+		t.Errorf("MarshalText: expected an error for an unknown level")
+	}
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	lvl := INFO
+	fs.Var(&lvl, "level", "")
+	if err := fs.Parse([]string{"-level", "rvw"}); err != nil || lvl != notice {
+		t.Errorf("flag: got %v, %v", lvl, err)
+	}
+
+	var cfg struct {
+		Min Level
+		Max Level
+	}
+	if err := json.Unmarshal([]byte(`{"Min": "debug", "Max": 6}`), &cfg); err != nil || cfg.Min != DEBUG || cfg.Max != ERROR {
+		t.Errorf("json: got %+v, %v", cfg, err)
+	}
+	if js, _ := json.Marshal(&LogRecord{Level: WARNING}); !strings.Contains(string(js), `"Level":5`) {
+		t.Errorf("json: records changed to %s", js)
+	}
+}
+
+func TestEnvLevels(t *testing.T) {
+	defer func(saved Logger) { Global = saved }(Global)
+	defer os.Unsetenv("LOG4GO_LEVEL")
+	defer os.Unsetenv("LOG4GO_LEVEL_API_DB")
+	os.Setenv("LOG4GO_LEVEL", "warning")
+	os.Setenv("LOG4GO_LEVEL_API_DB", "DEBUG")
+
+	Global = make(Logger)
+	Global.LoadJsonConfiguration(`{"files": [
+		{"enable": true, "category": "api", "level": "INFO", "filename": "` + testLogFile + `"},
+		{"enable": true, "category": "api.db", "level": "ERROR", "filename": "` + testLogFile + `"},
+		{"enable": true, "category": "api.db", "level": "CRITICAL", "filename": "` + testLogFile + `.crit"}
+	]}`)
+	defer os.Remove(testLogFile)
+	defer os.Remove(testLogFile + ".crit")
+	if lvl, _ := GetLevel("api"); lvl != WARNING {
+		t.Errorf("LOG4GO_LEVEL: api at %v", lvl)
+	}
+	if lvl, _ := GetLevel("api.db"); lvl != DEBUG {
+		t.Errorf("LOG4GO_LEVEL_API_DB: api.db at %v", lvl)
+	}
+	fw := Global["api.db"].LogWriter.(*fanoutWriter)
+	if fw.filters[0].level() != DEBUG || fw.filters[1].level() != CRITICAL {
+		t.Errorf("LOG4GO_LEVEL_API_DB: writers at %v and %v", fw.filters[0].level(), fw.filters[1].level())
+	}
+	Global.Close()
+
+	Global.AddFilter("cron", ERROR, &recordingLogWriter{})
+	if lvl, _ := GetLevel("cron"); lvl != WARNING {
+		t.Errorf("AddFilter: cron at %v", lvl)
+	}
+	if envLevelName("worker-1.io") != "LOG4GO_LEVEL_WORKER_1_IO" {
+		t.Errorf("envLevelName: got %s", envLevelName("worker-1.io"))
+	}
+}
+
+func TestClone(t *testing.T) {
+	defer func(saved Logger) { Global = saved }(Global)
+	stdout, api := &recordingLogWriter{}, &recordingLogWriter{}
+	Global = Logger{"stdout": &Filter{Level: INFO, LogWriter: stdout, Category: "DEFAULT"}}
+	Global.AddFilter("api", INFO, api, "api")
+
+	lib := Global.Clone()
+	libWriter := &recordingLogWriter{}
+	lib.AddFilter("api", DEBUG, libWriter, "api")
+	lib.SetLevel("stdout", ERROR)
+
+	LOGGER("api").Debug("program debug")
+	LOGGER("api").Warn("program warning")
+	lib.LOGGER("api").Debug("library debug")
+	lib.LOGGER("api").Warn("library warning")
+	lib.LOGGER("other").Critical("library error")
+	if len(api.records) != 1 || api.records[0].Message != "program warning" {
+		t.Errorf("Clone: program category got %d records", len(api.records))
+	}
+	if len(libWriter.records) != 2 {
+		t.Errorf("Clone: library category got %d records", len(libWriter.records))
+	}
+	// Both loggers share the console writer, each at its own level
+	if len(stdout.records) != 2 || stdout.records[0].Message != "program warning" || stdout.records[1].Message != "library error" {
+		t.Errorf("Clone: stdout got %d records", len(stdout.records))
+	}
+	if lvl, _ := Global.GetLevel("stdout"); lvl != INFO {
+		t.Errorf("Clone: SetLevel on the clone changed the program to %v", lvl)
+	}
+
+	lib.Close()
+	if len(Global) != 2 {
+		t.Errorf("Clone: Close changed the program's logger")
+	}
+	LOGGER("api").Warn("still logging")
+	if len(api.records) != 2 {
+		t.Errorf("Clone: program writer got %d records after closing the clone", len(api.records))
+	}
+}
+
+func TestWriterPanics(t *testing.T) {
+	defer os.Remove(testLogFile)
+	defer SetErrorHandler(nil)
+	var (
+		mu     sync.Mutex
+		panics []*WriterPanic
+	)
+	SetErrorHandler(func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if p, ok := err.(*WriterPanic); ok {
+			panics = append(panics, p)
+		}
+	})
+
+	w := NewFileLogWriter(testLogFile, false, false).SetFormatter(FormatterFunc(func(rec *LogRecord) []byte {
+		if rec.Message == "boom" {
+			panic("bad record")
+		}
+		return []byte(rec.Message + "\n")
+	}))
+	for _, msg := range []string{"before", "boom", "after"} {
+		w.LogWrite(&LogRecord{Level: INFO, Created: now, Message: msg})
+	}
+	w.Close()
+
+	contents, _ := ioutil.ReadFile(testLogFile)
+	if string(contents) != "before\nafter\n" {
+		t.Errorf("FileLogWriter: got %q after a panic", contents)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(panics) != 1 || panics[0].Value != "bad record" || !strings.Contains(panics[0].Writer, testLogFile) || len(panics[0].Stack) == 0 {
+		t.Errorf("SetErrorHandler: got %v", panics)
+	}
+}
+
+// writeTestCert writes a self-signed certificate for 127.0.0.1, usable by
+// both ends of a connection, and its key to dir.
+func writeTestCert(t *testing.T, dir string) (certFile, keyFile string, cert tls.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "log4go test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := ioutil.WriteFile(certFile, certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if cert, err = tls.X509KeyPair(certPEM, keyPEM); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile, cert
+}
+
+func TestTLSSocketLogWriter(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile, cert := writeTestCert(t, dir)
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	})
+	if err != nil {
+		t.Skipf("listen: %s", err)
+	}
+	defer ln.Close()
+	received := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		line, err := bufio.NewReader(conn).ReadString('\n')
+		if err != nil {
+			received <- "error: " + err.Error()
+			return
+		}
+		received <- line
+	}()
+
+	log := make(Logger)
+	log.LoadJsonConfiguration(`{"sockets": [{"enable": true, "category": "s", "level": "INFO", "addr": "` + ln.Addr().String() + `",
+		"format": "logfmt", "tls": true, "tls_cert": "` + certFile + `", "tls_key": "` + keyFile + `", "tls_ca": "` + certFile + `"}]}`)
+	if _, ok := log["s"]; !ok {
+		t.Fatal("No filter for the tls socket")
+	}
+	log.Info("over tls")
+	log.Close()
+
+	select {
+	case line := <-received:
+		if !strings.Contains(line, `msg="over tls"`) {
+			t.Errorf("Collector received %q", line)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Collector received nothing")
+	}
+
+	for _, tc := range []struct{ config, issue string }{
+		{`"protocol": "udp", "tls": true`, "tls requires the tcp protocol"},
+		{`"tls_ca": "` + certFile + `"`, "tls settings without tls enabled"},
+		{`"tls": true, "tls_cert": "` + certFile + `"`, "tls_cert and tls_key must be set together"},
+		{`"tls": true, "tls_ca": "` + keyFile + `"`, "tls_ca: no certificate found"},
+	} {
+		issues, err := ValidateConfiguration(`{"sockets": [{"enable": true, "category": "s", "level": "INFO", "addr": "127.0.0.1:5000", `+tc.config+`}]}`, "json")
+		if err != nil {
+			t.Fatalf("%s: %s", tc.config, err)
+		}
+		if len(issues) != 1 || !strings.Contains(issues[0].Message, tc.issue) {
+			t.Errorf("%s: got issues %v, want %q", tc.config, issues, tc.issue)
+		}
+	}
+}
+
+func TestSocketReconnect(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("listen: %s", err)
+	}
+	defer ln.Close()
+	type line struct {
+		conn int
+		text string
+	}
+	lines := make(chan line, 100)
+	go func() {
+		for n := 0; ; n++ {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(n int, conn net.Conn) {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				for {
+					text, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					lines <- line{n, text}
+					if n == 0 {
+						return // the collector drops the first connection
+					}
+				}
+			}(n, conn)
+		}
+	}()
+
+	var reported atomic.Value
+	SetErrorHandler(func(err error) { reported.Store(err.Error()) })
+	defer SetErrorHandler(nil)
+
+	w := NewSocketLogWriter("tcp", ln.Addr().String())
+	if w == nil {
+		t.Fatal("NewSocketLogWriter failed")
+	}
+	w.SetLogfmt(true).SetReconnectDelay(10*time.Millisecond, 50*time.Millisecond)
+	defer w.Close()
+
+	w.LogWrite(&LogRecord{Level: INFO, Created: now, Message: "first"})
+	if l := <-lines; l.conn != 0 || !strings.Contains(l.text, "msg=first") {
+		t.Fatalf("Got %+v on the first connection", l)
+	}
+
+	// Writes to the dropped connection fail after a while, then the writer
+	// reconnects and sends the rest
+	deadline := time.After(10 * time.Second)
+	for i := 0; ; i++ {
+		w.LogWrite(&LogRecord{Level: INFO, Created: now, Message: fmt.Sprintf("after%d", i)})
+		select {
+		case l := <-lines:
+			if l.conn != 1 {
+				t.Fatalf("Got %+v, want the second connection", l)
+			}
+			if msg, _ := reported.Load().(string); !strings.Contains(msg, "reconnecting") {
+				t.Errorf("Reported %q", msg)
+			}
+			return
+		case <-time.After(20 * time.Millisecond):
+		case <-deadline:
+			t.Fatal("The writer did not reconnect")
+		}
+	}
+}
+
+func TestSocketSpool(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("listen: %s", err)
+	}
+	addr := ln.Addr().String()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		if conn, err := ln.Accept(); err == nil {
+			accepted <- conn
+		}
+	}()
+
+	var reported atomic.Value
+	SetErrorHandler(func(err error) { reported.Store(err.Error()) })
+	defer SetErrorHandler(nil)
+
+	spoolFile := filepath.Join(t.TempDir(), "socket.spool")
+	w := NewSocketLogWriter("tcp", addr)
+	if w == nil {
+		t.Fatal("NewSocketLogWriter failed")
+	}
+	w.SetLogfmt(true).SetReconnectDelay(10*time.Millisecond, 20*time.Millisecond).SetBufferLength(1).SetSpool(spoolFile, 0)
+
+	// The collector goes away; once the writer notices, records pile up in
+	// the queue and then in the spool
+	conn := <-accepted
+	conn.Close()
+	ln.Close()
+	deadline := time.Now().Add(10 * time.Second)
+	for msg, _ := reported.Load().(string); !strings.Contains(msg, "reconnecting"); msg, _ = reported.Load().(string) {
+		if time.Now().After(deadline) {
+			t.Fatal("The writer did not notice the connection was closed")
+		}
+		w.LogWrite(&LogRecord{Level: INFO, Created: now, Message: "probe"})
+		time.Sleep(10 * time.Millisecond)
+	}
+	for i := 0; i < 50; i++ {
+		w.LogWrite(&LogRecord{Level: INFO, Created: now, Message: fmt.Sprintf("r%d", i)})
+	}
+	if fi, err := os.Stat(spoolFile); err != nil || fi.Size() == 0 {
+		t.Fatalf("Nothing spooled: %v %v", fi, err)
+	}
+
+	// The collector comes back and gets every record, in order
+	if ln, err = net.Listen("tcp", addr); err != nil {
+		t.Skipf("listen again: %s", err)
+	}
+	defer ln.Close()
+	received := make(chan []string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		var msgs []string
+		r := bufio.NewReader(conn)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				received <- msgs
+				return
+			}
+			if !strings.Contains(line, "msg=probe") {
+				msgs = append(msgs, line[strings.Index(line, "msg=")+4:len(line)-1])
+			}
+		}
+	}()
+	w.Flush()
+	if fi, err := os.Stat(spoolFile); err != nil || fi.Size() != 0 {
+		t.Errorf("Spool not emptied after Flush: %v %v", fi, err)
+	}
+	w.Close()
+
+	msgs := <-received
+	if len(msgs) != 50 {
+		t.Fatalf("Received %d records, want 50: %q", len(msgs), msgs)
+	}
+	for i, msg := range msgs {
+		if want := fmt.Sprintf("r%d", i); msg != want {
+			t.Errorf("Record %d: got %q, want %q", i, msg, want)
+		}
+	}
+}
+
+func TestSocketSpoolKeptOnClose(t *testing.T) {
+	spoolFile := filepath.Join(t.TempDir(), "socket.spool")
+	sp, err := openSpool(spoolFile, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	queue := make(chan *LogRecord)
+	var o overflow
+	for i := 0; i < 3; i++ {
+		sp.send(queue, &LogRecord{Level: INFO, Message: fmt.Sprintf("spooled%d", i)}, &o)
+	}
+	if recs := sp.next(); len(recs) != 3 || recs[0].Message != "spooled0" || recs[0].Level != INFO {
+		t.Fatalf("Replayed %+v", recs)
+	}
+	sp.send(queue, &LogRecord{Level: INFO, Message: "later"}, &o)
+	sp.prepend([]*LogRecord{{Level: INFO, Message: "unsent"}})
+	sp.close()
+
+	// The next writer replays what is left
+	if sp, err = openSpool(spoolFile, 30); err != nil {
+		t.Fatal(err)
+	}
+	defer sp.close()
+	var msgs []string
+	for _, rec := range sp.next() {
+		msgs = append(msgs, rec.Message)
+	}
+	if got, want := strings.Join(msgs, " "), "unsent later"; got != want {
+		t.Errorf("Replayed %q, want %q", got, want)
+	}
+	if sp.spooled() {
+		t.Error("Spool not empty after replay")
+	}
+
+	sp.send(queue, &LogRecord{Level: INFO, Message: "too long for the spool"}, &o)
+	if o.count() != 1 || sp.spooled() {
+		t.Errorf("Record beyond the maximum size: %d dropped", o.count())
+	}
+}
+
+func TestSocketFraming(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("listen: %s", err)
+	}
+	defer ln.Close()
+	read := func(w *SocketLogWriter, rec *LogRecord) []byte {
+		conns := make(chan net.Conn, 1)
+		go func() {
+			conn, _ := ln.Accept()
+			conns <- conn
+		}()
+		w.LogWrite(rec)
+		w.Close()
+		conn := <-conns
+		defer conn.Close()
+		b, err := ioutil.ReadAll(conn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	rec := &LogRecord{Level: INFO, Created: now, Category: "api", Message: "hi", Fields: Fields{"n": 1, "ok": true}}
+
+	b := read(NewSocketLogWriter("tcp", ln.Addr().String()).SetMsgpack(true).SetFraming(FrameLengthPrefix), rec)
+	if len(b) < 4 || int(b[0])<<24|int(b[1])<<16|int(b[2])<<8|int(b[3]) != len(b)-4 {
+		t.Fatalf("Bad length prefix in %q", b)
+	}
+	payload := b[4:]
+	if payload[0] != 0x85 {
+		t.Errorf("Msgpack: got map header %#x, want 5 entries", payload[0])
+	}
+	for _, want := range []string{"\xa5level\xa4INFO", "\xa8category\xa3api", "\xa7message\xa2hi", "\xa6fields\x82\xa1n\x01\xa2ok\xc3"} {
+		if !bytes.Contains(payload, []byte(want)) {
+			t.Errorf("Msgpack: no %q in %q", want, payload)
+		}
+	}
+
+	b = read(NewSocketLogWriter("tcp", ln.Addr().String()).SetFraming(FrameNewline), rec)
+	var got LogRecord
+	if !bytes.HasSuffix(b, []byte("}\n")) || json.Unmarshal(b, &got) != nil || got.Message != "hi" {
+		t.Errorf("Newline framing: got %q", b)
+	}
+
+	if f, err := ParseFraming("length_prefix"); err != nil || f != FrameLengthPrefix || f.String() != "length_prefix" {
+		t.Errorf("ParseFraming: got %v, %v", f, err)
+	}
+	issues, err := ValidateConfiguration(`{"sockets": [{"enable": true, "category": "s", "level": "INFO", "addr": "127.0.0.1:5000", "format": "msgpack", "framing": "newline"}]}`, "json")
+	if err != nil || len(issues) != 1 {
+		t.Errorf("Msgpack with newline framing: got %v, %v", issues, err)
+	}
+
+	conns := make(chan net.Conn, 1)
+	go func() {
+		conn, _ := ln.Accept()
+		conns <- conn
+	}()
+	log := make(Logger)
+	log.LoadJsonConfiguration(`{"sockets": [{"enable": true, "category": "api", "level": "INFO", "addr": "` + ln.Addr().String() + `",
+		"format": "pattern", "pattern": "%L %M"}]}`)
+	log.Info("patterned")
+	log.Close()
+	conn := <-conns
+	defer conn.Close()
+	if b, _ := ioutil.ReadAll(conn); string(b) != "INFO patterned\n" {
+		t.Errorf("Pattern format: got %q", b)
+	}
+}
+
+func TestSocketBatches(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("listen: %s", err)
+	}
+	defer ln.Close()
+	frames := func(conn net.Conn, n int) [][]byte {
+		var got [][]byte
+		for i := 0; i < n; i++ {
+			var size [4]byte
+			if _, err := io.ReadFull(conn, size[:]); err != nil {
+				t.Fatalf("Frame %d: %s", i, err)
+			}
+			frame := make([]byte, int(size[0])<<24|int(size[1])<<16|int(size[2])<<8|int(size[3]))
+			if _, err := io.ReadFull(conn, frame); err != nil {
+				t.Fatalf("Frame %d: %s", i, err)
+			}
+			got = append(got, frame)
+		}
+		return got
+	}
+
+	// Batches of 3 records, gzipped
+	conns := make(chan net.Conn, 1)
+	go func() {
+		conn, _ := ln.Accept()
+		conns <- conn
+	}()
+	w := NewSocketLogWriter("tcp", ln.Addr().String()).SetLogfmt(true).SetBatch(3, 0).SetCompression("gzip")
+	for i := 0; i < 4; i++ {
+		w.LogWrite(&LogRecord{Level: INFO, Created: now, Message: fmt.Sprintf("m%d", i)})
+	}
+	w.Close()
+	conn := <-conns
+	var batches []string
+	for _, frame := range frames(conn, 2) {
+		zr, err := gzip.NewReader(bytes.NewReader(frame))
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := ioutil.ReadAll(zr)
+		lines := strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+		last := lines[len(lines)-1]
+		batches = append(batches, fmt.Sprintf("%d:%s", len(lines), last[strings.LastIndex(last, "=")+1:]))
+	}
+	conn.Close()
+	if got, want := strings.Join(batches, " "), "3:m2 1:m3"; got != want {
+		t.Errorf("Gzip batches: got %q, want %q", got, want)
+	}
+
+	// Batches sent after the interval, without closing, zstd compressed
+	go func() {
+		conn, _ := ln.Accept()
+		conns <- conn
+	}()
+	w = NewSocketLogWriter("tcp", ln.Addr().String()).SetLogfmt(true).SetBatch(100, 20*time.Millisecond).SetCompression("zstd")
+	defer w.Close()
+	w.LogWrite(&LogRecord{Level: INFO, Created: now, Message: "a"})
+	w.LogWrite(&LogRecord{Level: INFO, Created: now, Message: "b"})
+	conn = <-conns
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	dec, _ := zstd.NewReader(nil)
+	defer dec.Close()
+	b, err := dec.DecodeAll(frames(conn, 1)[0], nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(string(b), "\n") != 2 || !strings.Contains(string(b), "msg=b") {
+		t.Errorf("Zstd batch: got %q", b)
+	}
+}
+
+func TestSocketWriteTimeout(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("listen: %s", err)
+	}
+	defer ln.Close()
+	// The collector accepts connections but never reads from them
+	conns := make(chan net.Conn, 10)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conns <- conn
+		}
+	}()
+	defer func() {
+		for len(conns) > 0 {
+			(<-conns).Close()
+		}
+	}()
+
+	var reported atomic.Value
+	SetErrorHandler(func(err error) { reported.Store(err.Error()) })
+	defer SetErrorHandler(nil)
+
+	w := DialSocketLogWriter(&net.Dialer{Timeout: time.Second, KeepAlive: -1}, "tcp", ln.Addr().String(), nil)
+	if w == nil {
+		t.Fatal("DialSocketLogWriter failed")
+	}
+	w.SetWriteTimeout(50*time.Millisecond).SetReconnectDelay(10*time.Millisecond, 10*time.Millisecond).SetOverflowPolicy(OverflowDrop)
+	first := <-conns
+	defer first.Close()
+
+	big := strings.Repeat("x", 1<<20)
+	deadline := time.Now().Add(10 * time.Second)
+	for msg, _ := reported.Load().(string); !strings.Contains(msg, "timeout"); msg, _ = reported.Load().(string) {
+		if time.Now().After(deadline) {
+			t.Fatal("The write to the hung collector did not time out")
+		}
+		w.LogWrite(&LogRecord{Level: INFO, Created: now, Message: big})
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case conn := <-conns:
+		conn.Close()
+	case <-time.After(5 * time.Second):
+		t.Error("The writer did not reconnect after the timeout")
+	}
+	w.Close()
+}
+
+func TestSocketDatagramSize(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("listen: %s", err)
+	}
+	defer pc.Close()
+	pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	receive := func() string {
+		buf := make([]byte, 65536)
+		n, _, err := pc.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n > 200 {
+			t.Errorf("Datagram of %d bytes", n)
+		}
+		return string(buf[:n])
+	}
+	defer SetErrorHandler(nil)
+	SetErrorHandler(func(error) {})
+
+	w := NewSocketLogWriter("udp", pc.LocalAddr().String()).SetLogfmt(true).SetMaxDatagramSize(200, DatagramTruncate)
+	w.LogWrite(&LogRecord{Level: INFO, Created: now, Message: strings.Repeat("a", 1000)})
+	if got := receive(); !strings.Contains(got, "a…(truncated ") {
+		t.Errorf("Truncated: got %q", got)
+	}
+	w.LogWrite(&LogRecord{Level: INFO, Created: now, Message: "big fields", Fields: Fields{"blob": strings.Repeat("b", 1000)}})
+	w.Flush()
+	if w.Dropped() != 1 {
+		t.Errorf("Dropped %d records that cannot fit, want 1", w.Dropped())
+	}
+	w.Close()
+
+	w = NewSocketLogWriter("udp", pc.LocalAddr().String()).SetFormatter(PatternFormatter("%M")).SetMaxDatagramSize(200, DatagramSplit)
+	defer w.Close()
+	msg := strings.Repeat("0123456789", 50)
+	w.LogWrite(&LogRecord{Level: INFO, Created: now, Message: msg})
+	parts := []string{receive()}
+	var n int
+	fmt.Sscanf(parts[0][strings.LastIndex(parts[0], "/")+1:], "%d)", &n)
+	if n < 2 {
+		t.Fatalf("Split: first part %q", parts[0])
+	}
+	for len(parts) < n {
+		parts = append(parts, receive())
+	}
+	var joined string
+	for i, part := range parts {
+		suffix := fmt.Sprintf("…(part %d/%d)\n", i+1, len(parts))
+		if !strings.HasSuffix(part, suffix) {
+			t.Fatalf("Part %d: got %q, want the suffix %q", i, part, suffix)
+		}
+		joined += strings.TrimSuffix(part, suffix)
+	}
+	if joined != msg {
+		t.Errorf("Split: got %q, want %q", joined, msg)
+	}
+}
+
+func TestSocketStats(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("listen: %s", err)
+	}
+	defer ln.Close()
+	conns := make(chan net.Conn, 10)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conns <- conn
+			go io.Copy(ioutil.Discard, conn)
+		}
+	}()
+
+	SetErrorHandler(func(error) {})
+	defer SetErrorHandler(nil)
+
+	w := NewSocketLogWriter("tcp", ln.Addr().String())
+	if w == nil {
+		t.Fatal("NewSocketLogWriter failed")
+	}
+	w.SetLogfmt(true).SetReconnectDelay(10*time.Millisecond, 50*time.Millisecond)
+	for i := 0; i < 3; i++ {
+		w.LogWrite(&LogRecord{Level: INFO, Created: now, Message: "sent"})
+	}
+	w.Flush()
+	if stats := w.Stats(); !stats.Connected || stats.RecordsSent != 3 || stats.BytesSent == 0 || stats.Reconnects != 0 {
+		t.Errorf("Stats after sending = %+v", stats)
+	}
+
+	// The collector drops the connection: writes fail after a while and the
+	// writer reconnects
+	(<-conns).Close()
+	deadline := time.Now().Add(10 * time.Second)
+	for w.Stats().Reconnects == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("The writer did not reconnect")
+		}
+		w.LogWrite(&LogRecord{Level: INFO, Created: now, Message: "again"})
+		w.Flush()
+		time.Sleep(10 * time.Millisecond)
+	}
+	if stats := w.Stats(); !stats.Connected || stats.Reconnects != 1 || len(stats.LastError) == 0 || stats.LastErrorTime.IsZero() {
+		t.Errorf("Stats after reconnecting = %+v", stats)
+	}
+
+	w.PublishExpvar("log4go_test_socket")
+	if v := expvar.Get("log4go_test_socket"); v == nil || !strings.Contains(v.String(), `"reconnects":1`) {
+		t.Errorf("expvar = %v", v)
+	}
+
+	w.Close()
+	if w.Stats().Connected {
+		t.Error("Connected after Close")
+	}
+}
+
+func TestAppendFormatLogRecord(t *testing.T) {
+	rec := &LogRecord{Level: ERROR, Created: now, Source: "source", Message: "méssage", Category: "api", Line: 15,
+		Fields: Fields{"user": "ann", "n": 3, "err": errors.New("boom")}}
+	buf := []byte("prefix ")
+	for _, format := range []string{FORMAT_DEFAULT, "%-5L|%8C|%-9M|%l %X{n} %X", "%5M"} {
+		got := AppendFormatLogRecord(buf, format, rec)
+		if want := "prefix " + FormatLogRecord(format, rec); string(got) != want {
+			t.Errorf("AppendFormatLogRecord(%q) = %q, want %q", format, got, want)
+		}
+	}
+	if got := string(AppendFormatLogRecord(nil, "%-5L|%8C|%-9M|%l %X", rec)); got != "EROR |     api|méssage  |15 err=boom n=3 user=ann\n" {
+		t.Errorf("Padded = %q", got)
+	}
+	if got := AppendFormatLogRecord(buf, FORMAT_DEFAULT, nil); string(got) != "prefix <nil>" {
+		t.Errorf("nil record = %q", got)
+	}
+
+	// Formatting into a buffer with room to spare does not allocate
+	b := make([]byte, 0, 256)
+	p := CompilePattern("[%L] (%S) %M %X{user}")
+	if n := testing.AllocsPerRun(100, func() { b = p.AppendFormat(b[:0], rec) }); n != 0 {
+		t.Errorf("AppendFormat allocates %v times", n)
+	}
+}
+
+func TestCustomDateCompiledOnce(t *testing.T) {
+	p := CompilePattern("[%D{2006-01-02T15:04:05.000}] %M")
+	if len(p.tokens) != 4 || p.tokens[1].verb != '{' || p.tokens[1].text != "2006-01-02T15:04:05.000" {
+		t.Fatalf("Tokens = %+v", p.tokens)
+	}
+
+	// The layout is not looked for again in the pattern of each record
+	rec := &LogRecord{Level: INFO, Created: now, Message: "message"}
+	b := make([]byte, 0, 128)
+	if n := testing.AllocsPerRun(100, func() { b = p.AppendFormat(b[:0], rec) }); n != 0 {
+		t.Errorf("AppendFormat allocates %v times", n)
+	}
+	if got, want := string(b), "["+now.Format("2006-01-02T15:04:05.000")+"] message\n"; got != want {
+		t.Errorf("AppendFormat = %q, want %q", got, want)
+	}
+}
+
+func TestFormatCacheConcurrent(t *testing.T) {
+	// Writers and FormatLogRecord callers formatting different seconds at
+	// the same time each get the time of their own record
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			var cache *formatCacheType
+			for i := 0; i < 200; i++ {
+				rec := &LogRecord{Level: INFO, Created: now.Add(time.Duration(g*1000+i%3) * time.Second), Message: "m"}
+				want := rec.Created.Format("2006/01/02 15:04:05 MST") + " m\n"
+				if got := FormatLogRecord("%D %T %M", rec); got != want {
+					t.Errorf("FormatLogRecord = %q, want %q", got, want)
+					return
+				}
+				if got := string(appendFormat(nil, "%D %T %M", rec, &cache)); got != want {
+					t.Errorf("appendFormat = %q, want %q", got, want)
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+}
+
+func TestFileLogWriterShards(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "sharded.log")
+	w := NewFileLogWriter(fname, false, false).SetFormat("%M").SetBufferLength(16).SetShards(4)
+	if w == nil {
+		t.Fatal("NewFileLogWriter failed")
+	}
+
+	// The records are appended in the order they were logged, and Flush
+	// waits for all of them
+	for i := 0; i < 1000; i++ {
+		w.LogWrite(&LogRecord{Level: INFO, Created: now, Message: strconv.Itoa(i)})
+	}
+	w.Flush()
+	contents, err := ioutil.ReadFile(fname)
+	if err != nil {
+		t.Fatalf("read: %s", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(contents), "\n"), "\n")
+	if len(lines) != 1000 {
+		t.Fatalf("Flushed %d lines, want 1000", len(lines))
+	}
+	for i, line := range lines {
+		if line != strconv.Itoa(i) {
+			t.Fatalf("Line %d is %q", i, line)
+		}
+	}
+
+	// A record whose formatting panics is dropped, the others are written
+	var reported atomic.Value
+	SetErrorHandler(func(err error) { reported.Store(err) })
+	defer SetErrorHandler(nil)
+	w.Close()
+	fname = filepath.Join(t.TempDir(), "panics.log")
+	w = NewFileLogWriter(fname, false, false).SetShards(3).SetFormatter(FormatterFunc(func(rec *LogRecord) []byte {
+		if rec.Message == "bad" {
+			panic("bad record")
+		}
+		return []byte(rec.Message + "\n")
+	}))
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				w.LogWrite(&LogRecord{Level: INFO, Created: now, Message: "concurrent"})
+			}
+		}()
+	}
+	wg.Wait()
+	w.LogWrite(&LogRecord{Level: INFO, Created: now, Message: "bad"})
+	w.LogWrite(&LogRecord{Level: INFO, Created: now, Message: "last"})
+	w.Close()
+
+	contents, _ = ioutil.ReadFile(fname)
+	if n := strings.Count(string(contents), "concurrent\n"); n != 400 {
+		t.Errorf("Wrote %d concurrent records, want 400", n)
+	}
+	if !strings.HasSuffix(string(contents), "concurrent\nlast\n") {
+		t.Errorf("Ends with %q", contents[len(contents)-40:])
+	}
+	if _, ok := reported.Load().(*WriterPanic); !ok {
+		t.Errorf("Reported %v", reported.Load())
+	}
+}
+
+func TestQueueStats(t *testing.T) {
+	var o overflow
+	queue := make(chan *LogRecord, 5)
+	for i := 0; i < 3; i++ {
+		o.send(queue, &LogRecord{Message: "queued"})
+	}
+	<-queue
+	<-queue
+	o.send(queue, &LogRecord{Message: "queued"})
+	if got, want := o.stats(queue), (QueueStats{Depth: 2, Capacity: 5, HighWater: 3}); got != want {
+		t.Errorf("stats = %+v, want %+v", got, want)
+	}
+
+	w := NewFileLogWriter(filepath.Join(t.TempDir(), "queue.log"), false, false).SetBufferLength(7)
+	w.LogWrite(&LogRecord{Level: INFO, Created: now, Message: "m"})
+	w.Flush()
+	if stats := w.QueueStats(); stats.Capacity != 7 || stats.HighWater < 1 || stats.Depth != 0 {
+		t.Errorf("QueueStats = %+v", stats)
+	}
+	w.Close()
+
+	w = NewFileLogWriter(filepath.Join(t.TempDir(), "shards.log"), false, false).SetBufferLength(7).SetShards(3)
+	w.LogWrite(&LogRecord{Level: INFO, Created: now, Message: "m"})
+	w.Flush()
+	if stats := w.QueueStats(); stats.Capacity != 21 || stats.HighWater < 1 || stats.Depth != 0 {
+		t.Errorf("QueueStats with shards = %+v", stats)
+	}
+	w.Close()
+}
+
+type discardLogWriter struct{}
+
+func (discardLogWriter) LogWrite(rec *LogRecord) {}
+func (discardLogWriter) Close()                  {}
+
+func TestLogStringAllocs(t *testing.T) {
+	log := make(Logger)
+	log.AddFilter("api", DEBUG, discardLogWriter{}, "api")
+	api := log.LOGGER("api")
+	// Patterns showing %G, compiled by other tests, have each record find
+	// its goroutine, which allocates
+	defer atomic.StoreInt32(&recordGoroutines, atomic.SwapInt32(&recordGoroutines, 0))
+
+	if n := testing.AllocsPerRun(1000, func() { api.FinestString("not logged") }); n != 0 {
+		t.Errorf("FinestString: %v allocations when not logged, want 0", n)
+	}
+	// Only the record: the source of a call site is looked up once
+	if n := testing.AllocsPerRun(1000, func() { api.InfoString("constant message") }); n != 1 {
+		t.Errorf("InfoString: %v allocations, want 1", n)
+	}
+	// And the message boxed in an interface{}
+	if n := testing.AllocsPerRun(1000, func() { api.Warn("constant message") }); n > 2 {
+		t.Errorf("Warn: %v allocations without arguments, want at most 2", n)
+	}
+
+	rec := &recordingLogWriter{}
+	log.AddFilter("api", DEBUG, rec, "api")
+	api = log.LOGGER("api")
+	api.LogString(INFO, "100%")
+	api.ErrorString("50% done")
+	api.Warn("100%")
+	api.Critical(errors.New("5% lost"))
+	if len(rec.records) != 4 {
+		t.Fatalf("got %d records, want 4", len(rec.records))
+	}
+	for i, want := range []string{"100%", "50% done", "100%", "5% lost"} {
+		if got := rec.records[i].Message; got != want {
+			t.Errorf("record %d: got %q, want %q", i, got, want)
+		}
+	}
+	if rec.records[1].Level != ERROR {
+		t.Errorf("ErrorString: got level %v", rec.records[1].Level)
+	}
+	if src := rec.records[0].Source; !strings.HasPrefix(src, "github.com/jeanphorn/log4go.TestLogStringAllocs:") {
+		t.Errorf("LogString: got source %q", src)
+	}
+}
+
+// TestWarnWithoutArgs checks that Warn, Error and Critical log a message
+// without arguments as is through the Filter, the Logger and the global
+// functions alike, and return it as is.
+func TestWarnWithoutArgs(t *testing.T) {
+	defer func(saved Logger) { Global = saved }(Global)
+	rec := &recordingLogWriter{}
+	Global = make(Logger)
+	Global.AddFilter("api", DEBUG, rec, "api")
+
+	api := LOGGER("api")
+	api.Warn("100%")
+	api.Error("50%% done")
+	api.Critical(stringer("5% lost"))
+	var errs []error
+	errs = append(errs, Global.Warn("100%"), Global.Error("50%% done"), Global.Critical(stringer("5% lost")))
+	errs = append(errs, Warn("100%"), Error("50%% done"), Critical(stringer("5% lost")))
+
+	want := []string{"100%", "50%% done", "5% lost"}
+	if len(rec.records) != 3*len(want) {
+		t.Fatalf("got %d records, want %d", len(rec.records), 3*len(want))
+	}
+	for i, r := range rec.records {
+		if r.Message != want[i%3] {
+			t.Errorf("record %d: got %q, want %q", i, r.Message, want[i%3])
+		}
+	}
+	for i, err := range errs {
+		if err.Error() != want[i%3] {
+			t.Errorf("error %d: got %q, want %q", i, err, want[i%3])
+		}
+	}
+}
+
+type stringer string
+
+func (s stringer) String() string { return string(s) }
+
+// TestAllocations guards the allocations per record of the hot paths, which
+// the benchmarks measure, against regressions.
+func TestAllocations(t *testing.T) {
+	defer atomic.StoreInt32(&recordGoroutines, atomic.SwapInt32(&recordGoroutines, 0))
+	log := make(Logger)
+	log.AddFilter("api", DEBUG, discardLogWriter{}, "api")
+	api := log.LOGGER("api")
+	rec := benchRecord()
+	buf := make([]byte, 0, 256)
+	pattern := CompilePattern(FORMAT_DEFAULT)
+	fields := CompilePattern("%D{2006-01-02T15:04:05.000Z07:00} %L %C %M %X")
+	cef := NewCEFFormatter("vendor", "product", "1.0")
+	msgpack := NewMsgpackFormatter()
+
+	for _, test := range []struct {
+		name string
+		max  float64
+		f    func()
+	}{
+		{"Pattern.AppendFormat", 0, func() { buf = pattern.AppendFormat(buf[:0], rec) }},
+		{"Pattern.AppendFormat with fields", 2, func() { buf = fields.AppendFormat(buf[:0], rec) }},
+		{"CEFFormatter", 2, func() { cef.Format(rec) }},
+		{"MsgpackFormatter", 4, func() { msgpack.Format(rec) }},
+		{"InfoString", 1, func() { api.InfoString("This is a log message") }},
+		{"Info", 2, func() { api.Info("%s is a log message", "This") }},
+		{"not logged", 0, func() { api.Finest("%s is a log message", "This") }},
+	} {
+		if n := testing.AllocsPerRun(1000, test.f); n > test.max {
+			t.Errorf("%s: %v allocations, want at most %v", test.name, n, test.max)
+		}
+	}
+}
+
+func TestUnmarshalYAML(t *testing.T) {
+	var lc LogConfig
+	err := unmarshalYAML(`files:
+- filename: a.log
+  maxbackup: 2
+- {filename: "b # not a comment.log", rotate: true}
+level_names:
+  WARNING: "WARNING"
+`, &lc)
+	if err != nil {
+		t.Fatalf("unmarshalYAML: %s", err)
+	}
+	if len(lc.Files) != 2 || lc.Files[0].Filename != "a.log" || lc.Files[0].Maxbackup != 2 ||
+		lc.Files[1].Filename != "b # not a comment.log" || !lc.Files[1].Rotate {
+		t.Errorf("unmarshalYAML: got %+v %+v", lc.Files[0], lc.Files[len(lc.Files)-1])
+	}
+	if lc.LevelNames["WARNING"] != "WARNING" {
+		t.Errorf("unmarshalYAML: got level names %v", lc.LevelNames)
+	}
+
+	for _, bad := range []string{"files:\n\t- filename: a.log", "console: [1", "files:\n  - maxbackup: many"} {
+		if err := unmarshalYAML(bad, &LogConfig{}); err == nil {
+			t.Errorf("unmarshalYAML(%q): expected an error", bad)
+		}
+	}
+}
+
+func BenchmarkFormatLogRecord(b *testing.B) {
+	const updateEvery = 1
+	rec := &LogRecord{
+		Level:   CRITICAL,
+		Created: now,
+		Source:  "source",
+		Message: "message",
+	}
+	for i := 0; i < b.N; i++ {
+		rec.Created = rec.Created.Add(1 * time.Second / updateEvery)
+		if i%2 == 0 {
+			FormatLogRecord(FORMAT_DEFAULT, rec)
+		} else {
+			FormatLogRecord(FORMAT_SHORT, rec)
+		}
+	}
+}
+
+func BenchmarkPatternFormat(b *testing.B) {
+	p := CompilePattern("[%D{2006-01-02T15:04:05}] [%L] (%S) %M")
+	rec := &LogRecord{
+		Level:   CRITICAL,
+		Created: now,
+		Source:  "source",
+		Message: "message",
+	}
+	for i := 0; i < b.N; i++ {
+		p.Format(rec)
+	}
+}
+
+func BenchmarkConsoleLog(b *testing.B) {
+	/* This doesn't seem to work on OS X
+	sink, err := os.Open(os.DevNull)
+	if err != nil {
+		panic(err)
+	}
+	if err := syscall.Dup2(int(sink.Fd()), syscall.Stdout); err != nil {
+		panic(err)
+	}
+	*/
+
+	stdout = ioutil.Discard
+	sl := NewDefaultLogger(INFO)
+	for i := 0; i < b.N; i++ {
+		sl.Log(WARNING, "here", "This is a log message")
+	}
+}
+
+func BenchmarkConsoleNotLogged(b *testing.B) {
+	sl := NewDefaultLogger(INFO)
+	for i := 0; i < b.N; i++ {
+		sl.Log(DEBUG, "here", "This is a log message")
+	}
+}
+
+func BenchmarkConsoleUtilLog(b *testing.B) {
+	sl := NewDefaultLogger(INFO)
+	for i := 0; i < b.N; i++ {
+		sl.Info("%s is a log message", "This")
+	}
+}
+
+func BenchmarkConsoleUtilNotLog(b *testing.B) {
+	sl := NewDefaultLogger(INFO)
+	for i := 0; i < b.N; i++ {
+		sl.Debug("%s is a log message", "This")
+	}
+}
+
+func BenchmarkFileLog(b *testing.B) {
+	sl := make(Logger)
+	b.StopTimer()
+	sl.AddFilter("file", INFO, NewFileLogWriter("benchlog.log", false, false))
+	b.StartTimer()
+	for i := 0; i < b.N; i++ {
+		sl.Log(WARNING, "here", "This is a log message")
+	}
+	b.StopTimer()
+	os.Remove("benchlog.log")
+}
+
+func BenchmarkFileNotLogged(b *testing.B) {
+	sl := make(Logger)
+	b.StopTimer()
+	sl.AddFilter("file", INFO, NewFileLogWriter("benchlog.log", false, false))
+	b.StartTimer()
+	for i := 0; i < b.N; i++ {
+		sl.Log(DEBUG, "here", "This is a log message")
+	}
+	b.StopTimer()
+	os.Remove("benchlog.log")
+}
+
+func BenchmarkFileUtilLog(b *testing.B) {
+	sl := make(Logger)
+	b.StopTimer()
+	sl.AddFilter("file", INFO, NewFileLogWriter("benchlog.log", false, false))
+	b.StartTimer()
+	for i := 0; i < b.N; i++ {
+		sl.Info("%s is a log message", "This")
+	}
+	b.StopTimer()
+	os.Remove("benchlog.log")
+}
+
+func BenchmarkFileUtilNotLog(b *testing.B) {
+	sl := make(Logger)
+	b.StopTimer()
+	sl.AddFilter("file", INFO, NewFileLogWriter("benchlog.log", false, false))
+	b.StartTimer()
+	for i := 0; i < b.N; i++ {
+		sl.Debug("%s is a log message", "This")
+	}
+	b.StopTimer()
+	os.Remove("benchlog.log")
+}
+
+// benchRecord is a record with the usual parts: a source, a category and a
+// few fields.
+func benchRecord() *LogRecord {
+	return &LogRecord{
+		Level:    WARNING,
+		Created:  now,
+		Source:   "github.com/jeanphorn/log4go.benchRecord:42",
+		Message:  "This is a log message",
+		Category: "api",
+		Fields:   Fields{"user": "alice", "status": 200, "elapsed": 1.5},
+		Seq:      12345,
+	}
+}
+
+func BenchmarkPatterns(b *testing.B) {
+	for _, bench := range []struct{ name, format string }{
+		{"default", FORMAT_DEFAULT},
+		{"short", FORMAT_SHORT},
+		{"abbrev", FORMAT_ABBREV},
+		{"fields", "%D{2006-01-02T15:04:05.000Z07:00} %L %C %M %X"},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			p := CompilePattern(bench.format)
+			rec := benchRecord()
+			buf := make([]byte, 0, 256)
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				buf = p.AppendFormat(buf[:0], rec)
+			}
+		})
+	}
+}
+
+func BenchmarkFormatters(b *testing.B) {
+	for _, bench := range []struct {
+		name string
+		f    Formatter
+	}{
+		{"pattern", CompilePattern(FORMAT_DEFAULT)},
+		{"json", NewJSONFormatter()},
+		{"logfmt", NewLogfmtFormatter()},
+		{"msgpack", NewMsgpackFormatter()},
+		{"cef", NewCEFFormatter("vendor", "product", "1.0")},
+		{"pretty", NewPrettyFormatter(false)},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			rec := benchRecord()
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				bench.f.Format(rec)
+			}
+		})
+	}
+}
+
+// BenchmarkFileWrite measures the writers themselves: the time includes
+// waiting for the records to be written.
+func BenchmarkFileWrite(b *testing.B) {
+	for _, bench := range []struct {
+		name  string
+		setup func(w *FileLogWriter) *FileLogWriter
+	}{
+		{"plain", func(w *FileLogWriter) *FileLogWriter { return w }},
+		{"buffered", func(w *FileLogWriter) *FileLogWriter { return w.SetFlushInterval(time.Second) }},
+		{"json", func(w *FileLogWriter) *FileLogWriter { return w.SetJSON(true) }},
+		{"rotate", func(w *FileLogWriter) *FileLogWriter {
+			return w.SetRotate(true).SetRotateSize(1 << 20).SetRotateMaxBackup(2)
+		}},
+		{"shards", func(w *FileLogWriter) *FileLogWriter { return w.SetShards(4) }},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			w := bench.setup(NewFileLogWriter(filepath.Join(b.TempDir(), "bench.log"), false, false))
+			defer w.Close()
+			rec := benchRecord()
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				w.LogWrite(rec)
+			}
+			w.Flush()
+		})
+	}
+}
+
+func BenchmarkFilterLog(b *testing.B) {
+	log := make(Logger)
+	defer log.Close()
+	log.AddFilter("api", DEBUG, discardLogWriter{}, "api")
+	api := log.LOGGER("api")
+	b.Run("InfoString", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			api.InfoString("This is a log message")
+		}
+	})
+	b.Run("Info", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			api.Info("%s is a log message", "This")
+		}
+	})
+	b.Run("WithFields", func(b *testing.B) {
+		req := api.WithFields(Fields{"user": "alice", "status": 200})
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			req.InfoString("This is a log message")
+		}
+	})
+	b.Run("NotLogged", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			api.Finest("%s is a log message", "This")
+		}
+	})
+}
+
+// BenchmarkParallelCategories logs from concurrent goroutines to several
+// categories, each with a file of its own.
+func BenchmarkParallelCategories(b *testing.B) {
+	const categories = 8
+	dir := b.TempDir()
+	log := make(Logger)
+	var filters []*Filter
+	for i := 0; i < categories; i++ {
+		name := "cat" + strconv.Itoa(i)
+		log.AddFilter(name, INFO, NewFileLogWriter(filepath.Join(dir, name+".log"), false, false).SetFormat(FORMAT_DEFAULT), name)
+		filters = append(filters, log.LOGGER(name))
+	}
+	defer log.Close()
+
+	var next uint32
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		api := filters[atomic.AddUint32(&next, 1)%categories]
+		for i := 0; pb.Next(); i++ {
+			api.Info("request %d served", i)
+		}
+	})
+	for _, filt := range filters {
+		if w, ok := filt.LogWriter.(*FileLogWriter); ok {
+			w.Flush()
+		}
+	}
+}
+
+// Benchmark results (darwin amd64 6g)
+//elog.BenchmarkConsoleLog           100000       22819 ns/op
+//elog.BenchmarkConsoleNotLogged    2000000         879 ns/op
+//elog.BenchmarkConsoleUtilLog        50000       34380 ns/op
+//elog.BenchmarkConsoleUtilNotLog   1000000        1339 ns/op
 //elog.BenchmarkFileLog              100000       26497 ns/op
 //elog.BenchmarkFileNotLogged       2000000         821 ns/op
 //elog.BenchmarkFileUtilLog           50000       33945 ns/op
 //elog.BenchmarkFileUtilNotLog      1000000        1258 ns/op
+
+func TestFileLogWriterUTC(t *testing.T) {
+	w := NewFileLogWriter(testLogFile, false, false).SetFormat("%T %M").SetUTC(true)
+	if w == nil {
+		t.Fatalf("Invalid return: w should not be nil")
+	}
+	defer os.Remove(testLogFile)
+
+	created := now.In(time.FixedZone("CET", 3600))
+	if got, want := FormatLogRecord("%T", &LogRecord{Created: created}), "00:31:30 CET\n"; got != want {
+		t.Errorf("FormatLogRecord: got %q, want %q", got, want)
+	}
+	w.LogWrite(&LogRecord{Level: INFO, Created: created, Message: "message"})
+	w.Close()
+	time.Sleep(50 * time.Millisecond)
+
+	want := "23:31:30 UTC message\n"
+	if contents, err := ioutil.ReadFile(testLogFile); err != nil || string(contents) != want {
+		t.Errorf("UTC log: got %q (%v), want %q", contents, err, want)
+	}
+}
+
+func TestTokens(t *testing.T) {
+	tokens := Tokens()
+	if len(tokens) == 0 {
+		t.Fatalf("Tokens returned no format codes")
+	}
+	rec := newLogRecord(INFO, "source", "message")
+	rec.File, rec.Line = "/src/main.go", 15
+	rec.Fields = Fields{"user": "bob", TraceIDKey: "4bf92f35", SpanIDKey: "00f067aa"}
+	rec.Stack = "main.main\n\t/src/main.go:15\n"
+	for _, tok := range tokens {
+		if tok.Description == "" {
+			t.Errorf("Token %s has no description", tok.Token)
+		}
+		if strings.Contains(tok.Token, "{") {
+			// Placeholder arguments like {layout} aren't valid in a pattern
+			continue
+		}
+		if got := FormatLogRecord(tok.Token, rec); got == "\n" {
+			t.Errorf("Token %s produced no output", tok.Token)
+		}
+	}
+
+	tokens[0].Token = "changed"
+	if Tokens()[0].Token == "changed" {
+		t.Errorf("Tokens returned a shared slice")
+	}
+}
+
+func TestSplitFileLogWriter(t *testing.T) {
+	w := NewSplitFileLogWriter(testLogFile, false, false).SetFormat("[%L] %M")
+	defer os.Remove(w.LevelFilename(ERROR))
+	defer os.Remove(w.LevelFilename(INFO))
+
+	if fname := w.LevelFilename(ERROR); fname != "_logtest.error.log" {
+		t.Errorf("Incorrect level filename: %s should be %s", fname, "_logtest.error.log")
+	}
+
+	w.LogWrite(newLogRecord(ERROR, "source", "error message"))
+	w.LogWrite(newLogRecord(INFO, "source", "info message"))
+	w.Close()
+	time.Sleep(50 * time.Millisecond)
+
+	for lvl, want := range map[Level]string{ERROR: "[EROR] error message\n", INFO: "[INFO] info message\n"} {
+		fname := w.LevelFilename(lvl)
+		if contents, err := ioutil.ReadFile(fname); err != nil {
+			t.Errorf("read(%q): %s", fname, err)
+		} else if string(contents) != want {
+			t.Errorf("%s: got %q, want %q", fname, string(contents), want)
+		}
+	}
+	if _, err := os.Stat(w.LevelFilename(WARNING)); err == nil {
+		os.Remove(w.LevelFilename(WARNING))
+		t.Errorf("SplitFileLogWriter opened a file for an unused level")
+	}
+}
+
+func TestUniqueFilename(t *testing.T) {
+	const fname = "_logtest.backup"
+	defer os.Remove(fname)
+	defer os.Remove(fname + ".1")
+
+	if got := uniqueFilename(fname, ""); got != fname {
+		t.Errorf("uniqueFilename(%q) = %q, want %q", fname, got, fname)
+	}
+	ioutil.WriteFile(fname, nil, 0660)
+	if got := uniqueFilename(fname, ""); got != fname+".1" {
+		t.Errorf("uniqueFilename(%q) = %q, want %q", fname, got, fname+".1")
+	}
+	ioutil.WriteFile(fname+".1", nil, 0660)
+	if got := uniqueFilename(fname, ""); got != fname+".2" {
+		t.Errorf("uniqueFilename(%q) = %q, want %q", fname, got, fname+".2")
+	}
+}
+
+func TestEncryptedFileLogWriter(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+
+	w := NewFileLogWriter(testLogFile, false, false).SetFormat("[%L] %M")
+	if w == nil {
+		t.Fatalf("Invalid return: w should not be nil")
+	}
+	defer os.Remove(testLogFile)
+	if err := w.SetEncryptionKey(key); err != nil {
+		t.Fatalf("SetEncryptionKey: %s", err)
+	}
+	w.LogWrite(newLogRecord(CRITICAL, "source", "secret message"))
+	w.LogWrite(newLogRecord(INFO, "source", "another message"))
+	w.Close()
+	time.Sleep(50 * time.Millisecond)
+
+	contents, err := ioutil.ReadFile(testLogFile)
+	if err != nil {
+		t.Fatalf("read(%q): %s", testLogFile, err)
+	}
+	if bytes.Contains(contents, []byte("secret")) {
+		t.Errorf("encrypted file contains plain text: %q", contents)
+	}
+
+	var out bytes.Buffer
+	if err := DecryptLogFile(bytes.NewReader(contents), &out, key); err != nil {
+		t.Fatalf("DecryptLogFile: %s", err)
+	}
+	if want := "[CRIT] secret message\n[INFO] another message\n"; out.String() != want {
+		t.Errorf("decrypted: got %q, want %q", out.String(), want)
+	}
+
+	contents[len(contents)-1] ^= 0xff
+	if err := DecryptLogFile(bytes.NewReader(contents), ioutil.Discard, key); err == nil {
+		t.Errorf("DecryptLogFile accepted a tampered file")
+	}
+}
+
+func TestEncryptionExistingPlainText(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+	defer os.Remove(testLogFile)
+	defer os.Remove(testLogFile + ".1")
+	ioutil.WriteFile(testLogFile, []byte("plain text from an earlier run\n"), 0660)
+
+	w := NewFileLogWriter(testLogFile, false, false)
+	if err := w.SetEncryptionKey(key); err == nil {
+		t.Errorf("SetEncryptionKey appended to a plain text file")
+	}
+	w.Close()
+
+	w = NewFileLogWriter(testLogFile, true, false).SetFormat("%M")
+	if err := w.SetEncryptionKey(key); err != nil {
+		t.Fatalf("SetEncryptionKey: %s", err)
+	}
+	w.LogWrite(newLogRecord(INFO, "source", "encrypted"))
+	w.Close()
+	time.Sleep(50 * time.Millisecond)
+
+	if old, _ := ioutil.ReadFile(testLogFile + ".1"); string(old) != "plain text from an earlier run\n" {
+		t.Errorf("plain text file was not rotated away: %q", old)
+	}
+	contents, _ := ioutil.ReadFile(testLogFile)
+	var out bytes.Buffer
+	if err := DecryptLogFile(bytes.NewReader(contents), &out, key); err != nil || out.String() != "encrypted\n" {
+		t.Errorf("DecryptLogFile = %q, %v", out.String(), err)
+	}
+
+	// An encrypted file is appended to
+	w = NewFileLogWriter(testLogFile, false, false).SetFormat("%M")
+	if err := w.SetEncryptionKey(key); err != nil {
+		t.Fatalf("SetEncryptionKey on an encrypted file: %s", err)
+	}
+	w.Close()
+}
+
+func TestSplitFileEncryption(t *testing.T) {
+	const keyHex = "000102030405060708090a0b0c0d0e0f"
+	os.Setenv("LOG4GO_TEST_KEY", keyHex)
+	defer os.Unsetenv("LOG4GO_TEST_KEY")
+	infoFile := "_logtest.info.log"
+	defer os.Remove(infoFile)
+
+	log := make(Logger)
+	log.LoadJsonConfiguration(`{"files": [{
+		"enable": true, "category": "enc", "level": "INFO", "pattern": "%M",
+		"filename": "` + testLogFile + `", "split_by_level": true, "encrypt_key_env": "LOG4GO_TEST_KEY"
+	}]}`)
+	log["enc"].Info("top secret")
+	log.Close()
+	time.Sleep(50 * time.Millisecond)
+
+	contents, err := ioutil.ReadFile(infoFile)
+	if err != nil {
+		t.Fatalf("read(%q): %s", infoFile, err)
+	}
+	if bytes.Contains(contents, []byte("secret")) {
+		t.Fatalf("split file contains plain text: %q", contents)
+	}
+	key, _ := hex.DecodeString(keyHex)
+	var out bytes.Buffer
+	if err := DecryptLogFile(bytes.NewReader(contents), &out, key); err != nil || out.String() != "top secret\n" {
+		t.Errorf("DecryptLogFile = %q, %v", out.String(), err)
+	}
+}
+
+func TestReadFile(t *testing.T) {
+	const fname = "_logtest.json"
+	ioutil.WriteFile(fname, []byte("  {\"console\": {}}\n"), 0660)
+	defer os.Remove(fname)
+
+	if got, err := ReadFile(fname); err != nil || got != "{\"console\": {}}" {
+		t.Errorf("ReadFile(%q) = %q, %v", fname, got, err)
+	}
+	if _, err := ReadFile("_nonexistent.json"); err == nil {
+		t.Errorf("ReadFile of a missing file should fail")
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/log.json" {
+			http.NotFound(w, r)
+			return
+		}
+		io.WriteString(w, "{\"files\": []}\n")
+	}))
+	defer srv.Close()
+
+	if got, err := ReadFile(srv.URL + "/log.json"); err != nil || got != "{\"files\": []}" {
+		t.Errorf("ReadFile(url) = %q, %v", got, err)
+	}
+	if _, err := ReadFile(srv.URL + "/missing.json"); err == nil {
+		t.Errorf("ReadFile of a missing url should fail")
+	}
+}
+
+func TestAuditLog(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("GenerateKey: %s", err)
+	}
+
+	w := NewFileLogWriter(testLogFile, false, false).SetFormat("[%L] %M").SetAudit(priv, 2)
+	if w == nil {
+		t.Fatalf("Invalid return: w should not be nil")
+	}
+	defer os.Remove(testLogFile)
+	w.LogWrite(newLogRecord(INFO, "source", "first"))
+	w.LogWrite(newLogRecord(INFO, "source", "second\nspans lines"))
+	w.LogWrite(newLogRecord(ERROR, "source", "third"))
+	w.Close()
+	time.Sleep(50 * time.Millisecond)
+
+	contents, err := ioutil.ReadFile(testLogFile)
+	if err != nil {
+		t.Fatalf("read(%q): %s", testLogFile, err)
+	}
+	if n, err := VerifyAuditLog(bytes.NewReader(contents), pub); err != nil || n != 3 {
+		t.Fatalf("VerifyAuditLog = %d, %v; want 3, nil\n%s", n, err, contents)
+	}
+
+	tampered := bytes.Replace(contents, []byte("third"), []byte("THIRD"), 1)
+	if _, err := VerifyAuditLog(bytes.NewReader(tampered), pub); err == nil {
+		t.Errorf("VerifyAuditLog accepted a modified record")
+	}
+	truncated := contents[:bytes.LastIndex(contents, []byte("#checkpoint"))]
+	if _, err := VerifyAuditLog(bytes.NewReader(truncated), pub); err == nil {
+		t.Errorf("VerifyAuditLog accepted a truncated file")
+	}
+}
+
+func TestJsonConfigMissingCategory(t *testing.T) {
+	for mode, want := range map[string]string{"default": DefaultCategory, "filename": "_logtest"} {
+		log := make(Logger)
+		log.LoadJsonConfiguration(`{
+			"missing_category": "` + mode + `",
+			"files": [{"enable": true, "level": "INFO", "filename": "` + testLogFile + `"}]
+		}`)
+		filt, ok := log[want]
+		if !ok {
+			t.Errorf("missing_category %q: expected filter %q, found %v", mode, want, log)
+		} else if filt.Category != want {
+			t.Errorf("missing_category %q: category is %q, want %q", mode, filt.Category, want)
+		}
+		log.Close()
+		os.Remove(testLogFile)
+	}
+}
+
+func TestJsonConfigSocketDialFailure(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("listen: %s", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close() // nothing listens there any more
+
+	log := make(Logger)
+	log.LoadJsonConfiguration(`{"sockets": [{"enable": true, "category": "s", "level": "INFO", "protocol": "tcp", "addr": "` + addr + `"}]}`)
+	if filt, ok := log["s"]; ok {
+		t.Errorf("Registered a filter for an unreachable socket: %#v", filt)
+	}
+	log.Close()
+}
+
+func TestGlobalFields(t *testing.T) {
+	defer SetGlobalFields(nil)
+	app := map[string]interface{}{"app": "billing", "env": "prod"}
+	SetGlobalFields(app)
+	app["env"] = "changed"
+
+	rw := &recordingLogWriter{}
+	l := make(Logger)
+	l.AddFilter("api", DEBUG, rw, "api")
+
+	MDCPut("env", "staging")
+	l.Info("plain")
+	MDCClear()
+	l["api"].WithFields(Fields{"app": "override"}).Info("category")
+
+	if len(rw.records) != 2 {
+		t.Fatalf("Expected 2 records, got %d", len(rw.records))
+	}
+	if got, want := FormatLogRecord("%X", rw.records[0]), "app=billing env=staging\n"; got != want {
+		t.Errorf("Logger: got %q, want %q", got, want)
+	}
+	if got, want := FormatLogRecord("%X", rw.records[1]), "app=override env=prod\n"; got != want {
+		t.Errorf("Filter: got %q, want %q", got, want)
+	}
+
+	SetGlobalFields(nil)
+	if fields := GlobalFields(); len(fields) != 0 {
+		t.Errorf("SetGlobalFields(nil) left %v", fields)
+	}
+}
+
+func TestRecordSeq(t *testing.T) {
+	rw := &recordingLogWriter{}
+	l := make(Logger)
+	l.AddFilter("api", DEBUG, rw, "api")
+
+	l.Info("one")
+	l["api"].Info("two")
+	l.Ingest([]*LogRecord{{Level: INFO, Message: "three"}, {Level: INFO, Message: "kept", Seq: 7}})
+
+	if len(rw.records) != 4 {
+		t.Fatalf("Expected 4 records, got %d", len(rw.records))
+	}
+	first := rw.records[0].Seq
+	for i, rec := range rw.records[:3] {
+		if rec.Seq != first+uint64(i) {
+			t.Errorf("Record %d: got seq %d, want %d", i, rec.Seq, first+uint64(i))
+		}
+	}
+	if rw.records[3].Seq != 7 {
+		t.Errorf("Ingest renumbered a record: got seq %d", rw.records[3].Seq)
+	}
+	if got, want := FormatLogRecord("%n %M", rw.records[3]), "7 kept\n"; got != want {
+		t.Errorf("%%n: got %q, want %q", got, want)
+	}
+	if got := string(NewJSONFormatter().Format(rw.records[3])); !strings.Contains(got, `"seq":7`) {
+		t.Errorf("JSONFormatter: no seq in %q", got)
+	}
+}
+
+func TestLineWriter(t *testing.T) {
+	rw := &recordingLogWriter{}
+	l := make(Logger)
+	l.AddFilter("http", INFO, rw, "http")
+
+	w := l.Writer(ERROR, "http")
+	fmt.Fprint(w, "first line\r\nsecond ")
+	fmt.Fprint(w, "line\n\npartial")
+	if len(rw.records) != 2 {
+		t.Fatalf("Expected 2 records before Flush, got %d", len(rw.records))
+	}
+	w.Flush()
+
+	want := []string{"first line", "second line", "partial"}
+	if len(rw.records) != len(want) {
+		t.Fatalf("Expected %d records, got %d", len(want), len(rw.records))
+	}
+	for i, rec := range rw.records {
+		if rec.Message != want[i] || rec.Level != ERROR || rec.Category != "http" {
+			t.Errorf("Record %d: got %+v, want an ERROR record %q in http", i, rec, want[i])
+		}
+	}
+}
+
+func TestStdLogger(t *testing.T) {
+	rw := &recordingLogWriter{}
+	l := make(Logger)
+	l.AddFilter("http", INFO, rw, "http")
+
+	std := l.NewStdLogger("http", ERROR)
+	_, _, line, _ := runtime.Caller(0)
+	std.Printf("handler failed\n\tstack trace")
+	std.Print("ends with a newline\n")
+	if len(rw.records) != 2 {
+		t.Fatalf("Expected 2 records, got %d", len(rw.records))
+	}
+	rec := rw.records[0]
+	if rec.Message != "handler failed\n\tstack trace" || rec.Level != ERROR || rec.Category != "http" {
+		t.Errorf("Got %+v, want an ERROR record in http", rec)
+	}
+	if filepath.Base(rec.File) != "log4go_test.go" || rec.Line != line+1 || rec.Source != "log4go_test.go:"+strconv.Itoa(line+1) {
+		t.Errorf("Got file %q, line %d and source %q", rec.File, rec.Line, rec.Source)
+	}
+	if rec := rw.records[1]; rec.Message != "ends with a newline" {
+		t.Errorf("Got %q", rec.Message)
+	}
+
+	for msg, want := range map[string]string{
+		"no source":             "no source",
+		"main.go:12: message":   "message",
+		"main.go:x: message":    "main.go:x: message",
+		"/a/b.go:7:no space":    "/a/b.go:7:no space",
+		"/a/b.go:7: a.go:8: ok": "a.go:8: ok",
+	} {
+		if _, _, got := splitStdSource([]byte(msg)); string(got) != want {
+			t.Errorf("splitStdSource(%q): got %q, want %q", msg, got, want)
+		}
+	}
+
+	defer func(saved Logger) { Global = saved }(Global)
+	rw = &recordingLogWriter{}
+	Global = make(Logger)
+	Global.AddFilter("all", DEBUG, rw)
+	var out bytes.Buffer
+	stdlog.SetOutput(&out)
+	defer stdlog.SetOutput(os.Stderr)
+	stdlog.SetFlags(stdlog.LstdFlags)
+	stdlog.SetPrefix("app: ")
+
+	restore := ReplaceStdLog()
+	stdlog.Printf("from a library")
+	restore()
+	stdlog.Print("after restore")
+
+	if len(rw.records) != 1 || rw.records[0].Message != "from a library" || rw.records[0].Level != INFO || rw.records[0].Line == 0 {
+		t.Fatalf("ReplaceStdLog: got %+v", rw.records)
+	}
+	if !strings.HasPrefix(out.String(), "app: ") || !strings.HasSuffix(out.String(), "after restore\n") || stdlog.Flags() != stdlog.LstdFlags {
+		t.Errorf("restore: the standard logger wrote %q with flags %d", out.String(), stdlog.Flags())
+	}
+	stdlog.SetFlags(stdlog.LstdFlags)
+	stdlog.SetPrefix("")
+}
+
+// lockedLogWriter is a recordingLogWriter for records logged concurrently.
+type lockedLogWriter struct {
+	mu sync.Mutex
+	recordingLogWriter
+}
+
+func (w *lockedLogWriter) LogWrite(rec *LogRecord) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.recordingLogWriter.LogWrite(rec)
+}
+
+func TestCaptureOutput(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skipf("no shell: %s", err)
+	}
+	rw := &lockedLogWriter{}
+	l := make(Logger)
+	l.AddFilter("job", DEBUG, rw, "job")
+
+	cmd := exec.Command(sh, "-c", `echo failed >&2; sleep 0.1; printf 'one\ntwo\r\nprogress 1\rprogress 2\rdone'`)
+	flush := l.CaptureOutput(cmd, "job", INFO, WARNING)
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("Run: %s", err)
+	}
+	flush()
+
+	want := []struct {
+		msg    string
+		lvl    Level
+		stream string
+	}{
+		{"failed", WARNING, "stderr"},
+		{"one", INFO, "stdout"},
+		{"two", INFO, "stdout"},
+		{"progress 1", INFO, "stdout"},
+		{"progress 2", INFO, "stdout"},
+		{"done", INFO, "stdout"},
+	}
+	if len(rw.records) != len(want) {
+		t.Fatalf("Expected %d records, got %d", len(want), len(rw.records))
+	}
+	for i, rec := range rw.records {
+		if rec.Message != want[i].msg || rec.Level != want[i].lvl || rec.Category != "job" || rec.Fields["stream"] != want[i].stream || rec.Fields["cmd"] != "sh" {
+			t.Errorf("Record %d: got %q at %v with %v, want %q", i, rec.Message, rec.Level, rec.Fields, want[i].msg)
+		}
+	}
+
+	// A line that never ends is logged once long enough
+	w := l.captureWriter("job", INFO, "yes", "stdout")
+	rw.records = nil
+	w.Write(bytes.Repeat([]byte{'y'}, maxCapturedLine-1))
+	if len(rw.records) != 0 {
+		t.Fatalf("Got %d records below the limit", len(rw.records))
+	}
+	w.Write([]byte("yy"))
+	w.Write([]byte("y\n"))
+	if len(rw.records) != 2 || len(rw.records[0].Message) != maxCapturedLine+1 || rw.records[1].Message != "y" {
+		t.Errorf("Got %d records", len(rw.records))
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	before := ReadMetrics()
+	fname := filepath.Join(t.TempDir(), "metrics.log")
+	w := NewFileLogWriter(fname, true, false).SetFormat("%M")
+	l := make(Logger)
+	l.AddFilter("metrics", INFO, w, "metrics")
+	l.LOGGER("metrics").Info("one")
+	l.LOGGER("metrics").Info("two")
+	l.LOGGER("metrics").Warn("three")
+	l.LOGGER("metrics").Debug("below the level")
+	time.Sleep(50 * time.Millisecond)
+	if err := w.RotateNow(); err != nil {
+		t.Fatalf("RotateNow: %s", err)
+	}
+	l.Close()
+	(&overflow{policy: OverflowDrop}).send(make(chan *LogRecord), &LogRecord{})
+
+	after := ReadMetrics()
+	if got := after.Records["metrics"]["INFO"] - before.Records["metrics"]["INFO"]; got != 2 {
+		t.Errorf("Expected 2 INFO records, got %d", got)
+	}
+	if got := after.Records["metrics"]["WARNING"] - before.Records["metrics"]["WARNING"]; got != 1 {
+		t.Errorf("Expected 1 WARNING record, got %d", got)
+	}
+	if got := after.Records["metrics"]["DEBUG"]; got != 0 {
+		t.Errorf("Expected no DEBUG records, got %d", got)
+	}
+	if got := after.BytesWritten - before.BytesWritten; got < uint64(len("one\ntwo\nthree\n")) {
+		t.Errorf("Expected at least 14 bytes written, got %d", got)
+	}
+	if after.Rotations == before.Rotations {
+		t.Errorf("Rotation not counted")
+	}
+	if after.Dropped == before.Dropped {
+		t.Errorf("Dropped record not counted")
+	}
+
+	PublishMetrics("log4go_test_metrics")
+	var published Metrics
+	if err := json.Unmarshal([]byte(expvar.Get("log4go_test_metrics").String()), &published); err != nil {
+		t.Fatalf("expvar: %s", err)
+	}
+	if published.Records["metrics"]["WARNING"] < 1 || published.Rotations < after.Rotations {
+		t.Errorf("expvar: got %+v", published)
+	}
+}
+
+func TestJsonConfigUnknownLevelName(t *testing.T) {
+	defer SetLevelName(WARNING, "")
+
+	// An unknown key must be skipped with a warning, not end the program
+	log := make(Logger)
+	log.LoadJsonConfiguration(`{"level_names": {"WARN": "W", "WARNING": "WARNING"}}`)
+	log.Close()
+	if got := WARNING.String(); got != "WARNING" {
+		t.Errorf("Known level name not set: %q", got)
+	}
+}
+
+func TestFileLogWriterCompression(t *testing.T) {
+	for method, ext := range map[string]string{"gzip": ".gz", "zstd": ".zst"} {
+		w := NewFileLogWriter(testLogFile, true, false).SetFormat("[%L] %M").SetCompression(method)
+		if w == nil {
+			t.Fatalf("Invalid return: w should not be nil")
+		}
+		w.LogWrite(newLogRecord(INFO, "source", "rotated away"))
+		time.Sleep(50 * time.Millisecond)
+		if err := w.RotateNow(); err != nil {
+			t.Fatalf("%s: RotateNow: %s", method, err)
+		}
+		w.LogWrite(newLogRecord(INFO, "source", "current"))
+		time.Sleep(50 * time.Millisecond)
+		w.Close()
+		time.Sleep(50 * time.Millisecond)
+
+		backup := testLogFile + ".1" + ext
+		if _, err := os.Stat(testLogFile + ".1"); err == nil {
+			t.Errorf("%s: uncompressed backup left behind", method)
+		}
+		fd, err := os.Open(backup)
+		if err != nil {
+			t.Errorf("%s: %s", method, err)
+		} else {
+			var r io.Reader
+			if method == "gzip" {
+				r, err = gzip.NewReader(fd)
+			} else {
+				r, err = zstd.NewReader(fd)
+			}
+			if err != nil {
+				t.Errorf("%s: %s", method, err)
+			} else if contents, _ := ioutil.ReadAll(r); string(contents) != "[INFO] rotated away\n" {
+				t.Errorf("%s: backup contains %q", method, contents)
+			}
+			fd.Close()
+		}
+		os.Remove(backup)
+		os.Remove(testLogFile)
+	}
+}
+
+type recordingLogWriter struct {
+	records []*LogRecord
+}
+
+func (w *recordingLogWriter) LogWrite(rec *LogRecord) { w.records = append(w.records, rec) }
+func (w *recordingLogWriter) Close()                  {}
+
+func TestLoggerIngest(t *testing.T) {
+	stdout, api := &recordingLogWriter{}, &recordingLogWriter{}
+	l := make(Logger)
+	l.AddFilter("stdout", WARNING, stdout)
+	l.AddFilter("api", DEBUG, api, "api")
+
+	l.Ingest([]*LogRecord{
+		{Level: INFO, Message: "plain info"},
+		{Level: ERROR, Message: "plain error"},
+		{Level: DEBUG, Category: "api", Message: "api debug"},
+		{Level: ERROR, Category: "api", Message: "api error"},
+		nil,
+	})
+
+	if len(stdout.records) != 2 || stdout.records[0].Message != "plain error" || stdout.records[1].Message != "api error" {
+		t.Errorf("stdout received %d records", len(stdout.records))
+	}
+	if len(api.records) != 4 {
+		t.Errorf("api received %d records, want 4", len(api.records))
+	}
+	for _, rec := range api.records {
+		if rec.Created.IsZero() {
+			t.Errorf("Ingest did not stamp record %q", rec.Message)
+		}
+	}
+}
+
+func TestFileLogWriterRotateNow(t *testing.T) {
+	w := NewFileLogWriter(testLogFile, true, false)
+	if w == nil {
+		t.Fatalf("Invalid return: w should not be nil")
+	}
+	defer os.Remove(testLogFile)
+	defer os.Remove(testLogFile + ".1")
+
+	if err := w.RotateNow(); err != nil {
+		t.Errorf("RotateNow: %s", err)
+	}
+	if _, err := os.Stat(testLogFile + ".1"); err != nil {
+		t.Errorf("RotateNow returned before the backup was created: %s", err)
+	}
+	w.Close()
+}
+
+// dirRotation names every backup after an existing directory, so renaming
+// fails.
+type dirRotation struct{ dir string }
+
+func (dirRotation) ShouldRotate(rec *LogRecord, stats RotationStats) bool { return false }
+func (r dirRotation) NextName(prev string) string                         { return r.dir }
+
+func TestFileLogWriterRotateNowError(t *testing.T) {
+	const dir = "_logtest.dir"
+	os.Mkdir(dir, 0770)
+	defer os.RemoveAll(dir)
+	w := NewFileLogWriter(testLogFile, true, false).SetFormat("%M").SetRotationPolicy(dirRotation{dir})
+	if w == nil {
+		t.Fatalf("Invalid return: w should not be nil")
+	}
+	defer os.Remove(testLogFile)
+
+	w.LogWrite(newLogRecord(INFO, "source", "before"))
+	for i := 0; i < 2; i++ {
+		err := w.RotateNow()
+		if err == nil {
+			t.Fatalf("RotateNow onto a directory succeeded")
+		}
+		if strings.HasSuffix(err.Error(), "\n") {
+			t.Errorf("RotateNow error ends in a newline: %q", err)
+		}
+	}
+	w.LogWrite(newLogRecord(INFO, "source", "after"))
+	w.Close()
+
+	if contents, _ := ioutil.ReadFile(testLogFile); string(contents) != "before\nafter\n" {
+		t.Errorf("Log after failed rotations: got %q", contents)
+	}
+	if err := w.RotateNow(); err == nil {
+		t.Errorf("RotateNow after Close succeeded")
+	}
+}
+
+func TestFileLogWriterTimestampBackups(t *testing.T) {
+	for _, method := range []string{"none", "gzip"} {
+		w := NewFileLogWriter(testLogFile, true, false).SetRotateTimestamp(true).SetRotateMaxBackup(2).SetCompression(method)
+		if w == nil {
+			t.Fatalf("Invalid return: w should not be nil")
+		}
+
+		for i := 0; i < 4; i++ {
+			w.LogWrite(newLogRecord(INFO, "source", "message"))
+			if err := w.RotateNow(); err != nil {
+				t.Fatalf("%s: RotateNow: %s", method, err)
+			}
+		}
+		w.Close()
+		os.Remove(testLogFile)
+
+		backups, _ := filepath.Glob(testLogFile + ".*")
+		for _, fname := range backups {
+			os.Remove(fname)
+			if method == "gzip" && !strings.HasSuffix(fname, ".gz") {
+				t.Errorf("%s: uncompressed backup %s left behind", method, fname)
+			}
+		}
+		if len(backups) != 2 {
+			t.Errorf("%s: expected 2 backups to be kept, found %v", method, backups)
+		}
+	}
+}
+
+// markerRotation rotates before every record whose message is "ROTATE".
+type markerRotation struct{}
+
+func (markerRotation) ShouldRotate(rec *LogRecord, stats RotationStats) bool {
+	return rec.Message == "ROTATE"
+}
+
+func (markerRotation) NextName(prev string) string {
+	return prev + ".marker"
+}
+
+func TestFileLogWriterRotationPolicy(t *testing.T) {
+	w := NewFileLogWriter(testLogFile, false, false).SetFormat("%M").SetRotationPolicy(markerRotation{})
+	if w == nil {
+		t.Fatalf("Invalid return: w should not be nil")
+	}
+	defer os.Remove(testLogFile)
+	defer os.Remove(testLogFile + ".marker")
+
+	for _, msg := range []string{"one", "two", "ROTATE", "three"} {
+		w.LogWrite(&LogRecord{Level: INFO, Created: now, Message: msg})
+	}
+	w.Close()
+	time.Sleep(50 * time.Millisecond)
+
+	if contents, err := ioutil.ReadFile(testLogFile + ".marker"); err != nil || string(contents) != "one\ntwo\n" {
+		t.Errorf("Backup: got %q (%v), want %q", contents, err, "one\ntwo\n")
+	}
+	if contents, err := ioutil.ReadFile(testLogFile); err != nil || string(contents) != "ROTATE\nthree\n" {
+		t.Errorf("Log: got %q (%v), want %q", contents, err, "ROTATE\nthree\n")
+	}
+}
+
+func TestFileLogWriterBuiltinPolicies(t *testing.T) {
+	var _ RotationPolicy = LineRotation{}
+	var _ RotationPolicy = SizeRotation{}
+	var _ RotationPolicy = DailyRotation{}
+
+	w := NewFileLogWriter(testLogFile, false, false).SetFormat("%M").
+		SetRotationPolicy(LineRotation{MaxLines: 2, Name: NumberedName(3)})
+	if w == nil {
+		t.Fatalf("Invalid return: w should not be nil")
+	}
+	defer os.Remove(testLogFile)
+	defer os.Remove(testLogFile + ".1")
+	defer os.Remove(testLogFile + ".2")
+	defer os.Remove(testLogFile + ".3")
+
+	for _, msg := range []string{"a", "b", "c", "d", "e"} {
+		w.LogWrite(&LogRecord{Level: INFO, Created: now, Message: msg})
+	}
+	w.Close()
+	time.Sleep(50 * time.Millisecond)
+
+	for fname, want := range map[string]string{
+		testLogFile + ".2": "a\nb\n",
+		testLogFile + ".1": "c\nd\n",
+		testLogFile:        "e\n",
+	} {
+		if contents, err := ioutil.ReadFile(fname); err != nil || string(contents) != want {
+			t.Errorf("%s: got %q (%v), want %q", fname, contents, err, want)
+		}
+	}
+}
+
+func TestFileLogWriterResetRotationPolicy(t *testing.T) {
+	w := NewFileLogWriter(testLogFile, false, false).SetFormat("%M").
+		SetRotationPolicy(markerRotation{}).SetRotationPolicy(nil)
+	if w == nil {
+		t.Fatalf("Invalid return: w should not be nil")
+	}
+	defer os.Remove(testLogFile)
+	defer os.Remove(testLogFile + ".1")
+
+	w.LogWrite(&LogRecord{Level: INFO, Created: now, Message: "one"})
+	if err := w.RotateNow(); err != nil {
+		t.Errorf("RotateNow: %s", err)
+	}
+	w.LogWrite(&LogRecord{Level: INFO, Created: now, Message: "two"})
+	w.Close()
+	time.Sleep(50 * time.Millisecond)
+
+	if _, err := os.Stat(testLogFile + ".1"); err == nil {
+		t.Errorf("Rotating without rotate set should not keep a backup")
+	}
+	if contents, err := ioutil.ReadFile(testLogFile); err != nil || string(contents) != "one\ntwo\n" {
+		t.Errorf("Log: got %q (%v), want %q", contents, err, "one\ntwo\n")
+	}
+}
+
+type panicLogWriter struct{}
+
+func (panicLogWriter) LogWrite(rec *LogRecord) { panic("shadow sink is down") }
+func (panicLogWriter) Close()                  {}
+
+func TestShadowLogWriter(t *testing.T) {
+	primary := &recordingLogWriter{}
+	l := make(Logger)
+	l.AddFilter("api", DEBUG, primary, "api")
+	if _, err := l.AddShadow("missing", panicLogWriter{}); err == nil {
+		t.Errorf("AddShadow on a missing filter should fail")
+	}
+	sw, err := l.AddShadow("api", panicLogWriter{})
+	if err != nil {
+		t.Fatalf("AddShadow: %s", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		l.Log(INFO, "source", "message")
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	if len(primary.records) != 3 {
+		t.Errorf("primary received %d records, want 3", len(primary.records))
+	}
+	if stats := sw.Stats(); stats.Failed+stats.Dropped != 3 || stats.Delivered != 0 {
+		t.Errorf("unexpected shadow stats %+v", stats)
+	}
+	l.Close()
+}
+
+func TestJSONFormatter(t *testing.T) {
+	rec := &LogRecord{
+		Level:    ERROR,
+		Created:  now,
+		Source:   "source",
+		Message:  "a \"quoted\"\nmessage",
+		Category: "api",
+	}
+	want := `{"timestamp":"2009-02-13T23:31:30.123456789Z","level":"EROR","category":"api","source":"source","message":"a \"quoted\"\nmessage"}` + "\n"
+	if got := string(NewJSONFormatter().Format(rec)); got != want {
+		t.Errorf("JSONFormatter:\n   got %q\n  want %q", got, want)
+	}
+
+	w := NewFileLogWriter(testLogFile, false, false).SetJSON(true)
+	if w == nil {
+		t.Fatalf("Invalid return: w should not be nil")
+	}
+	defer os.Remove(testLogFile)
+	w.LogWrite(rec)
+	w.Close()
+	time.Sleep(50 * time.Millisecond)
+	if contents, err := ioutil.ReadFile(testLogFile); err != nil {
+		t.Errorf("read(%q): %s", testLogFile, err)
+	} else if string(contents) != want {
+		t.Errorf("json filelog: got %q", contents)
+	}
+}
+
+func TestCEFFormatter(t *testing.T) {
+	rec := &LogRecord{
+		Level:    ERROR,
+		Created:  now,
+		Source:   "source",
+		Message:  "a=b|c\nsecond line",
+		Category: "api",
+	}
+	want := `CEF:0|Acme|bill\|ing|1.0|api|a=b\|c|8|rt=1234567890123 cat=api dvchost=` + hostname() +
+		` cs1Label=source cs1=source msg=a\=b|c\nsecond line` + "\n"
+	if got := string(NewCEFFormatter("Acme", "bill|ing", "1.0").Format(rec)); got != want {
+		t.Errorf("CEFFormatter:\n   got %q\n  want %q", got, want)
+	}
+
+	want = "LEEF:1.0|Acme|billing|1.0|api|devTimeFormat=MMM dd yyyy HH:mm:ss.SSS z\tdevTime=Feb 13 2009 23:31:30.123 UTC" +
+		"\tsev=8\tcat=api\tsource=source\tmsg=a=b|c\\nsecond line\n"
+	if got := string(NewLEEFFormatter("Acme", "billing", "1.0").Format(rec)); got != want {
+		t.Errorf("LEEFFormatter:\n   got %q\n  want %q", got, want)
+	}
+}
+
+func TestFileLogWriterFlushInterval(t *testing.T) {
+	w := NewFileLogWriter(testLogFile, false, false).SetFormat("[%L] %M").SetFlushInterval(20 * time.Millisecond)
+	if w == nil {
+		t.Fatalf("Invalid return: w should not be nil")
+	}
+	defer os.Remove(testLogFile)
+	defer w.Close()
+
+	w.LogWrite(newLogRecord(INFO, "source", "buffered"))
+	time.Sleep(100 * time.Millisecond)
+	if contents, err := ioutil.ReadFile(testLogFile); err != nil {
+		t.Errorf("read(%q): %s", testLogFile, err)
+	} else if string(contents) != "[INFO] buffered\n" {
+		t.Errorf("record not flushed within the interval: %q", contents)
+	}
+}
+
+func TestPrettyFormatter(t *testing.T) {
+	f := &PrettyFormatter{Start: now.Add(-1500 * time.Millisecond)}
+	rec := &LogRecord{
+		Level:    ERROR,
+		Created:  now,
+		Source:   "main.query:42",
+		Message:  "query failed:\nconnection reset",
+		Category: "db",
+		Fields:   Fields{"user": "bob", "error": errors.New("EOF")},
+		Stack:    "main.query\n\t/src/main.go:42\n",
+	}
+	want := "    +1.500s  EROR  [db] query failed:\n" +
+		"                   connection reset\n" +
+		"                   error=EOF\n" +
+		"                   user=bob\n" +
+		"                   at main.query:42\n" +
+		"                   main.query\n" +
+		"                   \t/src/main.go:42\n"
+	if got := string(f.Format(rec)); got != want {
+		t.Errorf("PrettyFormatter:\n   got %q\n  want %q", got, want)
+	}
+
+	// The column follows the badge, colored or not
+	f.Color = true
+	got := string(f.Format(rec))
+	if i := strings.Index(got, "\n"); !strings.HasPrefix(got[i+1:], "                   connection") {
+		t.Errorf("PrettyFormatter with color misaligned:\n%s", got)
+	}
+}
+
+func TestLogfmtFormatter(t *testing.T) {
+	rec := &LogRecord{
+		Level:    INFO,
+		Created:  now,
+		Source:   "main.main:15",
+		Message:  "login ok user=\"bob\"",
+		Category: "api",
+	}
+	want := `time=2009-02-13T23:31:30.123456789Z level=INFO category=api source=main.main:15 msg="login ok user=\"bob\""` + "\n"
+	if got := string(NewLogfmtFormatter().Format(rec)); got != want {
+		t.Errorf("LogfmtFormatter:\n   got %q\n  want %q", got, want)
+	}
+
+	rec.Message, rec.Category, rec.Source = "simple", "", ""
+	want = "time=2009-02-13T23:31:30.123456789Z level=INFO msg=simple\n"
+	if got := string(NewLogfmtFormatter().Format(rec)); got != want {
+		t.Errorf("LogfmtFormatter:\n   got %q\n  want %q", got, want)
+	}
+}
+
+func TestSetFormatter(t *testing.T) {
+	upper := FormatterFunc(func(rec *LogRecord) []byte {
+		return []byte(strings.ToUpper(rec.Message) + "\n")
+	})
+
+	w := NewFileLogWriter(testLogFile, false, false).SetFormatter(upper)
+	if w == nil {
+		t.Fatalf("Invalid return: w should not be nil")
+	}
+	defer os.Remove(testLogFile)
+	w.LogWrite(newLogRecord(INFO, "source", "custom"))
+	w.Close()
+	time.Sleep(50 * time.Millisecond)
+	if contents, err := ioutil.ReadFile(testLogFile); err != nil {
+		t.Errorf("read(%q): %s", testLogFile, err)
+	} else if string(contents) != "CUSTOM\n" {
+		t.Errorf("custom formatter: got %q", contents)
+	}
+
+	rec := newLogRecord(ERROR, "source", "message")
+	if got, want := string(PatternFormatter(FORMAT_ABBREV).Format(rec)), FormatLogRecord(FORMAT_ABBREV, rec); got != want {
+		t.Errorf("PatternFormatter: got %q, want %q", got, want)
+	}
+}
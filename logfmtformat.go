@@ -0,0 +1,76 @@
+package log4go
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+// LogfmtFormatter formats each record as a line of logfmt key=value pairs:
+//
+//	time=2009-02-13T23:31:30.123456789Z level=EROR category=api source=main.main:15 msg="login failed"
+//
+// Values containing spaces, quotes, '=' or control characters are quoted.
+// Empty category and source are omitted.  Structured fields follow msg,
+// sorted by key.
+type LogfmtFormatter struct {
+	// TimeLayout is the layout of the time field (default time.RFC3339Nano)
+	TimeLayout string
+}
+
+// NewLogfmtFormatter creates a LogfmtFormatter with the default settings.
+func NewLogfmtFormatter() *LogfmtFormatter {
+	return &LogfmtFormatter{TimeLayout: time.RFC3339Nano}
+}
+
+// Format returns rec as a single logfmt line, including the trailing newline.
+func (f *LogfmtFormatter) Format(rec *LogRecord) []byte {
+	layout := f.TimeLayout
+	if len(layout) == 0 {
+		layout = time.RFC3339Nano
+	}
+	out := bytes.NewBuffer(make([]byte, 0, 128))
+	writeLogfmtPair(out, "time", rec.Created.Format(layout))
+	out.WriteByte(' ')
+	writeLogfmtPair(out, "level", rec.Level.String())
+	if len(rec.Category) > 0 {
+		out.WriteByte(' ')
+		writeLogfmtPair(out, "category", rec.Category)
+	}
+	if len(rec.Source) > 0 {
+		out.WriteByte(' ')
+		writeLogfmtPair(out, "source", rec.Source)
+	}
+	out.WriteByte(' ')
+	writeLogfmtPair(out, "msg", rec.Message)
+	for _, k := range rec.Fields.keys() {
+		out.WriteByte(' ')
+		writeLogfmtPair(out, k, fmt.Sprint(rec.Fields[k]))
+	}
+	out.WriteByte('\n')
+	return out.Bytes()
+}
+
+func writeLogfmtPair(out *bytes.Buffer, key, value string) {
+	out.WriteString(key)
+	out.WriteByte('=')
+	if logfmtNeedsQuote(value) {
+		out.WriteString(strconv.Quote(value))
+	} else {
+		out.WriteString(value)
+	}
+}
+
+func logfmtNeedsQuote(value string) bool {
+	if len(value) == 0 {
+		return true
+	}
+	for _, r := range value {
+		if r <= ' ' || r == '=' || r == '"' || r == '\\' || r == 0x7f || r == utf8.RuneError {
+			return true
+		}
+	}
+	return false
+}
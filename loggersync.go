@@ -0,0 +1,160 @@
+package log4go
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// loggerMu guards the filters of every Logger, so that messages can be logged
+// from any goroutine while another one loads a configuration, adds filters or
+// closes the logger.  The Logger methods hold it; code indexing a Logger map
+// directly while it may be changed must use them instead.  Writers are not
+// written to under it: a filter taken out of a Logger is retired, see
+// acquire, before its writer is closed.
+var loggerMu sync.RWMutex
+
+// loggerGen counts the changes made to the filters of the Loggers under
+// loggerMu, so that the handles of LOGGER know when to find their filter
+// again; accessed atomically.
+var loggerGen uint64
+
+// get returns the filter called name.
+func (log Logger) get(name string) (*Filter, bool) {
+	loggerMu.RLock()
+	defer loggerMu.RUnlock()
+	filt, ok := log[name]
+	return filt, ok
+}
+
+// set registers filt as the filter called name.
+func (log Logger) set(name string, filt *Filter) {
+	loggerMu.Lock()
+	log[name] = filt
+	atomic.AddUint64(&loggerGen, 1)
+	loggerMu.Unlock()
+}
+
+// enabled returns the filters that write records at lvl, so that they can
+// be written to without holding loggerMu.
+func (log Logger) enabled(lvl Level) []*Filter {
+	loggerMu.RLock()
+	defer loggerMu.RUnlock()
+	var filters []*Filter
+	for _, filt := range log {
+		if lvl.atLeast(filt.level()) {
+			filters = append(filters, filt)
+		}
+	}
+	return filters
+}
+
+// snapshot returns the filters by name, sorted by name.
+func (log Logger) snapshot() ([]string, []*Filter) {
+	loggerMu.RLock()
+	defer loggerMu.RUnlock()
+	names := make([]string, 0, len(log))
+	for name := range log {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	filters := make([]*Filter, len(names))
+	for i, name := range names {
+		filters[i] = log[name]
+	}
+	return names, filters
+}
+
+// handle returns an immutable filter logging for category through f, which
+// sees the changes SetLevel makes to f.
+func (f *Filter) handle(category string) *Filter {
+	return &Filter{Level: f.level(), LogWriter: f.LogWriter, Category: category, fields: f.fields, base: f.registered()}
+}
+
+// registered returns the filter of the Logger that f was derived from.
+func (f *Filter) registered() *Filter {
+	if f.byName {
+		return f.current().registered()
+	}
+	if f.base != nil {
+		return f.base
+	}
+	return f
+}
+
+// handleView is the filter a LOGGER handle found for its category, as
+// handle makes them, while loggerGen was gen.
+type handleView struct {
+	gen  uint64
+	filt *Filter
+}
+
+// current returns the filter f logs through: for a LOGGER handle, the one
+// its category has in its Logger now, found again once the filters change;
+// f itself otherwise.
+func (f *Filter) current() *Filter {
+	if !f.byName {
+		return f
+	}
+	gen := atomic.LoadUint64(&loggerGen)
+	if v, _ := f.view.Load().(*handleView); v != nil && v.gen == gen {
+		return v.filt
+	}
+	log := f.logger
+	if log == nil {
+		log = Global
+	}
+	filt := log.handle(f.Category, f.logger)
+	f.view.Store(&handleView{gen: gen, filt: filt})
+	return filt
+}
+
+// acquire marks a write to the filter f of a Logger as in progress, until
+// release, so that retire waits for it before the writer is closed.  It
+// returns false, and f must not be written to, once f is retired.
+func (f *Filter) acquire() bool {
+	atomic.AddInt32(&f.users, 1)
+	if atomic.LoadUint32(&f.retired) != 0 {
+		atomic.AddInt32(&f.users, -1)
+		return false
+	}
+	return true
+}
+
+// release ends a write started with acquire.
+func (f *Filter) release() {
+	atomic.AddInt32(&f.users, -1)
+}
+
+// retire stops f, taken out of its Logger, from being written to, and waits
+// for the writes in progress, after which its writer may be closed.
+func (f *Filter) retire() {
+	atomic.StoreUint32(&f.retired, 1)
+	for atomic.LoadInt32(&f.users) > 0 {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// retireAll retires filters, all of them before any writer is closed, as
+// writers may be shared between filters.
+func retireAll(filters []*Filter) {
+	for _, filt := range filters {
+		filt.retire()
+	}
+}
+
+// send writes rec to the filter f of a Logger, unless f is retired.
+func (f *Filter) send(rec *LogRecord) {
+	if f.acquire() {
+		f.LogWrite(rec)
+		f.release()
+	}
+}
+
+// writeTo writes rec to filters, skipping those retired meanwhile.
+func writeTo(filters []*Filter, rec *LogRecord) {
+	for _, filt := range filters {
+		filt.send(rec)
+	}
+}
@@ -0,0 +1,140 @@
+//go:build log4go_logr
+
+package log4go
+
+import (
+	"fmt"
+	"runtime"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// This file is only built with the log4go_logr tag, so that programs not
+// using it do not build logr.  The go.mod of log4go requires the version of
+// github.com/go-logr/logr it is tested with; programs using it build with
+// -tags log4go_logr.
+
+// LogrSink is a logr.LogSink that logs through a log4go Filter, so code
+// logging through logr (controller-runtime, client-go, ...) reaches the
+// configured categories and writers:
+//
+//	ctrl.SetLogger(logr.New(log.NewLogrSink(log.LOGGER("k8s"))))
+//
+// Info records at V(0) are logged at INFO, V(1) at TRACE, V(2) at DEBUG and
+// anything more verbose at FINE.  Error records are logged at ERROR with the
+// error attached as the field ErrorKey.  Key-value pairs become the record's
+// Fields, and names given to WithName extend the category like Filter.Child.
+type LogrSink struct {
+	filter *Filter
+	depth  int
+}
+
+// NewLogrSink creates a LogrSink that logs through f.
+func NewLogrSink(f *Filter) *LogrSink {
+	return &LogrSink{filter: f}
+}
+
+// logrLevel maps a logr verbosity to a log4go Level.
+func logrLevel(v int) Level {
+	switch {
+	case v <= 0:
+		return INFO
+	case v == 1:
+		return TRACE
+	case v == 2:
+		return DEBUG
+	}
+	return FINE
+}
+
+// Init records how many logr frames sit between the caller and the sink.
+func (s *LogrSink) Init(info logr.RuntimeInfo) {
+	s.depth = info.CallDepth
+}
+
+// Enabled reports whether the filter logs records at verbosity level.
+func (s *LogrSink) Enabled(level int) bool {
+	return logrLevel(level).atLeast(s.filter.level())
+}
+
+// Info logs a non-error message at verbosity level.
+func (s *LogrSink) Info(level int, msg string, keysAndValues ...interface{}) {
+	s.log(logrLevel(level), msg, nil, keysAndValues)
+}
+
+// Error logs an error message at the error level.
+func (s *LogrSink) Error(err error, msg string, keysAndValues ...interface{}) {
+	s.log(ERROR, msg, err, keysAndValues)
+}
+
+func (s *LogrSink) log(lvl Level, msg string, err error, keysAndValues []interface{}) {
+	if !lvl.atLeast(s.filter.level()) {
+		return
+	}
+
+	fields := make(Fields, len(s.filter.fields)+len(keysAndValues)/2+1)
+	for k, v := range s.filter.fields {
+		fields[k] = v
+	}
+	addKeysAndValues(fields, keysAndValues)
+	if err != nil {
+		fields[ErrorKey] = err
+	}
+
+	rec := &LogRecord{
+		Level:     lvl,
+		Created:   time.Now(),
+		Message:   msg,
+		Category:  s.filter.Category,
+		Fields:    withMDC(fields),
+		Goroutine: currentGoroutine(),
+		Seq:       nextSeq(),
+	}
+	// Skip log, Info or Error, and the logr frames above them
+	if pc, file, lineno, ok := runtime.Caller(2 + s.depth); ok {
+		rec.Source = fmt.Sprintf("%s:%d", runtime.FuncForPC(pc).Name(), lineno)
+		rec.File, rec.Line = file, lineno
+	}
+	rec.Stack = errorStack(lvl, rec.Fields, 2+s.depth)
+	if len(rec.Fields) == 0 {
+		rec.Fields = nil
+	}
+	s.filter.dispatch(rec)
+}
+
+// WithValues returns a sink that adds keysAndValues to every record.
+func (s *LogrSink) WithValues(keysAndValues ...interface{}) logr.LogSink {
+	fields := make(Fields, len(keysAndValues)/2)
+	addKeysAndValues(fields, keysAndValues)
+	return &LogrSink{filter: s.filter.WithFields(fields), depth: s.depth}
+}
+
+// WithName returns a sink whose category is extended by name, see
+// Filter.Child.
+func (s *LogrSink) WithName(name string) logr.LogSink {
+	return &LogrSink{filter: s.filter.Child(name), depth: s.depth}
+}
+
+// WithCallDepth returns a sink that skips depth more frames to find the
+// source of a record, for helpers wrapping the logr.Logger.
+func (s *LogrSink) WithCallDepth(depth int) logr.LogSink {
+	return &LogrSink{filter: s.filter, depth: s.depth + depth}
+}
+
+// addKeysAndValues stores alternating keys and values in fields.  Keys that
+// are not strings are formatted with %v, and a key without a value gets
+// "(MISSING)".
+func addKeysAndValues(fields Fields, keysAndValues []interface{}) {
+	for i := 0; i < len(keysAndValues); i += 2 {
+		key, ok := keysAndValues[i].(string)
+		if !ok {
+			key = fmt.Sprint(keysAndValues[i])
+		}
+		if i+1 < len(keysAndValues) {
+			fields[key] = keysAndValues[i+1]
+		} else {
+			fields[key] = "(MISSING)"
+		}
+	}
+}
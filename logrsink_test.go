@@ -0,0 +1,31 @@
+//go:build log4go_logr
+
+package log4go
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/go-logr/logr"
+)
+
+func TestLogrSink(t *testing.T) {
+	rw := &recordingLogWriter{}
+	l := make(Logger)
+	l.AddFilter("k8s", TRACE, rw, "k8s")
+
+	logger := logr.New(NewLogrSink(l["k8s"]))
+	logger.V(2).Info("dropped")
+	logger.WithName("ctrl").WithValues("ns", "default").V(1).Info("reconcile", "pod", "web-1")
+	logger.Error(errors.New("timeout"), "sync failed", "attempt", 3)
+
+	if len(rw.records) != 2 {
+		t.Fatalf("Expected 2 records, got %d", len(rw.records))
+	}
+	if got, want := FormatLogRecord("[%L] [%C] %M %X", rw.records[0]), "[TRAC] [k8s.ctrl] reconcile ns=default pod=web-1\n"; got != want {
+		t.Errorf("Info: got %q, want %q", got, want)
+	}
+	if got, want := FormatLogRecord("[%L] (%s) %M %X", rw.records[1]), "[EROR] (log4go.TestLogrSink:20) sync failed attempt=3 error=timeout\n"; got != want {
+		t.Errorf("Error: got %q, want %q", got, want)
+	}
+}
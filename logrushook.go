@@ -0,0 +1,98 @@
+//go:build log4go_logrus
+
+package log4go
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// This file is only built with the log4go_logrus tag, so that programs not
+// using it do not build logrus.  The go.mod of log4go requires the version of
+// github.com/sirupsen/logrus it is tested with; programs using it build with
+// -tags log4go_logrus.
+
+// LogrusHook is a logrus.Hook that forwards every entry to a log4go Filter,
+// so services moving from logrus to log4go can write through one set of
+// writers while both are in use:
+//
+//	logrus.AddHook(log.NewLogrusHook(log.LOGGER("legacy")))
+//
+// Entry data becomes the record's Fields.  logrus levels map to their log4go
+// namesakes, except that Trace, which is finer than Debug in logrus, is FINE.
+type LogrusHook struct {
+	filter *Filter
+}
+
+// NewLogrusHook creates a LogrusHook that logs through f.
+func NewLogrusHook(f *Filter) *LogrusHook {
+	return &LogrusHook{filter: f}
+}
+
+// logrusLevel maps a logrus level to a log4go Level.
+func logrusLevel(l logrus.Level) Level {
+	switch l {
+	case logrus.PanicLevel:
+		return PANIC
+	case logrus.FatalLevel:
+		return FATAL
+	case logrus.ErrorLevel:
+		return ERROR
+	case logrus.WarnLevel:
+		return WARNING
+	case logrus.InfoLevel:
+		return INFO
+	case logrus.DebugLevel:
+		return DEBUG
+	}
+	return FINE
+}
+
+// Levels returns every level; entries below the filter's level are dropped by
+// Fire.
+func (h *LogrusHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire logs e through the filter.
+func (h *LogrusHook) Fire(e *logrus.Entry) error {
+	lvl := logrusLevel(e.Level)
+	if !lvl.atLeast(h.filter.level()) {
+		return nil
+	}
+
+	fields := make(Fields, len(h.filter.fields)+len(e.Data))
+	for k, v := range h.filter.fields {
+		fields[k] = v
+	}
+	for k, v := range e.Data {
+		if k == logrus.ErrorKey {
+			k = ErrorKey
+		}
+		fields[k] = v
+	}
+
+	rec := &LogRecord{
+		Level:     lvl,
+		Created:   e.Time,
+		Message:   e.Message,
+		Category:  h.filter.Category,
+		Fields:    withMDC(fields),
+		Goroutine: currentGoroutine(),
+		Seq:       nextSeq(),
+	}
+	if rec.Created.IsZero() {
+		rec.Created = time.Now()
+	}
+	if e.HasCaller() {
+		rec.Source = fmt.Sprintf("%s:%d", e.Caller.Function, e.Caller.Line)
+		rec.File, rec.Line = e.Caller.File, e.Caller.Line
+	}
+	if len(rec.Fields) == 0 {
+		rec.Fields = nil
+	}
+	h.filter.dispatch(rec)
+	return nil
+}
@@ -0,0 +1,31 @@
+//go:build log4go_logrus
+
+package log4go
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestLogrusHook(t *testing.T) {
+	rw := &recordingLogWriter{}
+	l := make(Logger)
+	l.AddFilter("legacy", DEBUG, rw, "legacy")
+
+	h := NewLogrusHook(l["legacy"])
+	h.Fire(&logrus.Entry{Level: logrus.TraceLevel, Message: "dropped"})
+	h.Fire(&logrus.Entry{
+		Level:   logrus.ErrorLevel,
+		Message: "payment failed",
+		Data:    logrus.Fields{"order": 7, logrus.ErrorKey: errors.New("declined")},
+	})
+
+	if len(rw.records) != 1 {
+		t.Fatalf("Expected 1 record, got %d", len(rw.records))
+	}
+	if got, want := FormatLogRecord("[%L] [%C] %M %X", rw.records[0]), "[EROR] [legacy] payment failed error=declined order=7\n"; got != want {
+		t.Errorf("FormatLogRecord: got %q, want %q", got, want)
+	}
+}
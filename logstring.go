@@ -0,0 +1,52 @@
+package log4go
+
+// The String methods log a message as it is, without formatting it.  Unlike
+// Info("...") and the like, which take the message as an interface{}, they
+// do not box it, so that logging a constant message allocates only the
+// record when the writers format it without allocating, and nothing when the
+// message is not logged.  Hot paths logging fixed messages can use them.
+
+// LogString logs msg at the given log level, using the caller as its source.
+func (f *Filter) LogString(lvl Level, msg string) {
+	f.intLogf(lvl, msg)
+}
+
+// FinestString logs msg at the finest log level.
+func (f *Filter) FinestString(msg string) {
+	f.intLogf(FINEST, msg)
+}
+
+// FineString logs msg at the fine log level.
+func (f *Filter) FineString(msg string) {
+	f.intLogf(FINE, msg)
+}
+
+// DebugString logs msg at the debug log level.
+func (f *Filter) DebugString(msg string) {
+	f.intLogf(DEBUG, msg)
+}
+
+// TraceString logs msg at the trace log level.
+func (f *Filter) TraceString(msg string) {
+	f.intLogf(TRACE, msg)
+}
+
+// InfoString logs msg at the info log level.
+func (f *Filter) InfoString(msg string) {
+	f.intLogf(INFO, msg)
+}
+
+// WarnString logs msg at the warning log level.
+func (f *Filter) WarnString(msg string) {
+	f.intLogf(WARNING, msg)
+}
+
+// ErrorString logs msg at the error log level.
+func (f *Filter) ErrorString(msg string) {
+	f.intLogf(ERROR, msg)
+}
+
+// CriticalString logs msg at the critical log level.
+func (f *Filter) CriticalString(msg string) {
+	f.intLogf(CRITICAL, msg)
+}
@@ -0,0 +1,107 @@
+package log4go
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// The Mapped Diagnostic Context holds key-value pairs (request id, user id,
+// ...) per goroutine.  They are attached to the Fields of every record logged
+// from that goroutine, where %X{key} and the structured formatters find them.
+// Fields given to WithFields take precedence over MDC values of the same key.
+//
+// Go has no goroutine local storage, so the context is keyed by goroutine id
+// and must be removed with MDCClear before the goroutine exits:
+//
+//	log.MDCPut("req", reqID)
+//	defer log.MDCClear()
+var (
+	mdc        sync.Map // goroutine id -> Fields, replaced on every change
+	mdcEntries int32    // goroutines with a context, to skip lookups when zero
+)
+
+// MDCPut sets key to value in the calling goroutine's context.
+func MDCPut(key string, value interface{}) {
+	id := goroutineID()
+	old, _ := mdc.Load(id)
+	fields := Fields{}
+	if old != nil {
+		for k, v := range old.(Fields) {
+			fields[k] = v
+		}
+	} else {
+		atomic.AddInt32(&mdcEntries, 1)
+	}
+	fields[key] = value
+	mdc.Store(id, fields)
+}
+
+// MDCGet returns the value of key in the calling goroutine's context.
+func MDCGet(key string) (interface{}, bool) {
+	fields := mdcFields()
+	v, ok := fields[key]
+	return v, ok
+}
+
+// MDCRemove removes key from the calling goroutine's context.
+func MDCRemove(key string) {
+	id := goroutineID()
+	old, ok := mdc.Load(id)
+	if !ok {
+		return
+	}
+	if _, ok := old.(Fields)[key]; !ok {
+		return
+	}
+	if len(old.(Fields)) == 1 {
+		MDCClear()
+		return
+	}
+	fields := Fields{}
+	for k, v := range old.(Fields) {
+		if k != key {
+			fields[k] = v
+		}
+	}
+	mdc.Store(id, fields)
+}
+
+// MDCClear removes the calling goroutine's context.
+func MDCClear() {
+	if _, ok := mdc.LoadAndDelete(goroutineID()); ok {
+		atomic.AddInt32(&mdcEntries, -1)
+	}
+}
+
+// mdcFields returns the calling goroutine's context, or nil.  The result must
+// not be modified.
+func mdcFields() Fields {
+	if atomic.LoadInt32(&mdcEntries) == 0 {
+		return nil
+	}
+	fields, _ := mdc.Load(goroutineID())
+	if fields == nil {
+		return nil
+	}
+	return fields.(Fields)
+}
+
+// withMDC returns fields merged over the calling goroutine's context and the
+// global fields (see SetGlobalFields).
+func withMDC(fields Fields) Fields {
+	ctx := contextFields()
+	if len(ctx) == 0 {
+		return fields
+	}
+	if len(fields) == 0 {
+		return ctx
+	}
+	merged := make(Fields, len(ctx)+len(fields))
+	for k, v := range ctx {
+		merged[k] = v
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+	return merged
+}
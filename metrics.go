@@ -0,0 +1,110 @@
+package log4go
+
+import (
+	"expvar"
+	"sync"
+	"sync/atomic"
+)
+
+// Metrics are the counters of the logging subsystem since the program
+// started, for all the loggers, e.g. to alert when the rate of errors spikes
+// or when records start being dropped.  See ReadMetrics, PublishMetrics and,
+// for Prometheus, the log4go_prometheus build tag.
+type Metrics struct {
+	Records      map[string]map[string]uint64 `json:"records"`       // Records logged, by category ("DEFAULT" for Log and the global functions) and level name
+	Dropped      uint64                       `json:"dropped"`       // Records dropped by the overflow policies, and by shadow writers falling behind
+	RateLimited  uint64                       `json:"rate_limited"`  // Messages dropped by the rate limits of categories
+	WriteErrors  uint64                       `json:"write_errors"`  // Failed writes and rotations of the files and sockets
+	Rotations    uint64                       `json:"rotations"`     // Log files rotated
+	BytesWritten uint64                       `json:"bytes_written"` // Bytes written to the files and sockets
+}
+
+// recordKey is the key of the record counters.
+type recordKey struct {
+	category string
+	level    Level
+}
+
+// metrics are the counters read by ReadMetrics.  records holds a
+// map[recordKey]*uint64, copied when a category or level is first logged so
+// that counting a record neither locks nor allocates.
+var metrics struct {
+	records   atomic.Value
+	recordsMu sync.Mutex
+
+	dropped, rateLimited, writeErrors, rotations, bytes uint64
+}
+
+// countRecord counts rec as logged.
+func countRecord(rec *LogRecord) {
+	key := recordKey{rec.Category, rec.Level}
+	if len(key.category) == 0 {
+		key.category = "DEFAULT"
+	}
+	records, _ := metrics.records.Load().(map[recordKey]*uint64)
+	n, ok := records[key]
+	if !ok {
+		n = addRecordCounter(key)
+	}
+	atomic.AddUint64(n, 1)
+}
+
+// addRecordCounter returns the counter of key, adding it if needed.
+func addRecordCounter(key recordKey) *uint64 {
+	metrics.recordsMu.Lock()
+	defer metrics.recordsMu.Unlock()
+	current, _ := metrics.records.Load().(map[recordKey]*uint64)
+	if n, ok := current[key]; ok {
+		return n
+	}
+	records := make(map[recordKey]*uint64, len(current)+1)
+	for k, n := range current {
+		records[k] = n
+	}
+	n := new(uint64)
+	records[key] = n
+	metrics.records.Store(records)
+	return n
+}
+
+func countDropped(n uint64)      { atomic.AddUint64(&metrics.dropped, n) }
+func countRateLimited()          { atomic.AddUint64(&metrics.rateLimited, 1) }
+func countWriteError()           { atomic.AddUint64(&metrics.writeErrors, 1) }
+func countRotation()             { atomic.AddUint64(&metrics.rotations, 1) }
+func countBytesWritten(n uint64) { atomic.AddUint64(&metrics.bytes, n) }
+
+// ReadMetrics returns the current values of the counters.
+func ReadMetrics() Metrics {
+	m := Metrics{
+		Records:      map[string]map[string]uint64{},
+		Dropped:      atomic.LoadUint64(&metrics.dropped),
+		RateLimited:  atomic.LoadUint64(&metrics.rateLimited),
+		WriteErrors:  atomic.LoadUint64(&metrics.writeErrors),
+		Rotations:    atomic.LoadUint64(&metrics.rotations),
+		BytesWritten: atomic.LoadUint64(&metrics.bytes),
+	}
+	records, _ := metrics.records.Load().(map[recordKey]*uint64)
+	for key, n := range records {
+		levels := m.Records[key.category]
+		if levels == nil {
+			levels = map[string]uint64{}
+			m.Records[key.category] = levels
+		}
+		levels[configLevelName(key.level)] += atomic.LoadUint64(n)
+	}
+	return m
+}
+
+// publishMetrics guards against publishing the metrics twice.
+var publishMetrics sync.Once
+
+// PublishMetrics publishes ReadMetrics as the expvar name, served with the
+// other expvars at /debug/vars.  Only the first call publishes anything.
+// Like expvar.Publish, it panics if other code published name already.
+func PublishMetrics(name string) {
+	publishMetrics.Do(func() {
+		expvar.Publish(name, expvar.Func(func() interface{} {
+			return ReadMetrics()
+		}))
+	})
+}
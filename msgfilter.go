@@ -0,0 +1,102 @@
+package log4go
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+)
+
+// FilterRecords returns a writer that writes to writer only the records for
+// which keep returns true, before they are formatted, e.g. to silence a
+// known noisy message without changing the code logging it:
+//
+//	log.AddFilter("stdout", log.INFO, log.FilterRecords(func(rec *log.LogRecord) bool {
+//		return rec.Category != "health"
+//	}, log.NewConsoleLogWriter()))
+//
+// keep is called from the logging goroutines, so it must be safe for
+// concurrent use.
+func FilterRecords(keep func(*LogRecord) bool, writer LogWriter) LogWriter {
+	return &recordFilter{LogWriter: writer, keep: keep}
+}
+
+// FilterMessages returns a writer that writes to writer only the records
+// whose message matches none of the deny regular expressions and, unless
+// allow is empty, one of the allow ones.  In configuration files, they are
+// the "allow" and "deny" lists in JSON and YAML and repeated "allow" and
+// "deny" properties in XML.
+func FilterMessages(allow, deny []string, writer LogWriter) (LogWriter, error) {
+	w := &recordFilter{LogWriter: writer}
+	var err error
+	if w.allow, err = compileAll(allow); err != nil {
+		return nil, err
+	}
+	if w.deny, err = compileAll(deny); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func compileAll(exprs []string) ([]*regexp.Regexp, error) {
+	res := make([]*regexp.Regexp, 0, len(exprs))
+	for _, expr := range exprs {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid message filter %q: %s", expr, err)
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
+
+type recordFilter struct {
+	LogWriter
+	allow, deny []*regexp.Regexp
+	keep        func(*LogRecord) bool
+}
+
+func (w *recordFilter) LogWrite(rec *LogRecord) {
+	if w.keep != nil && !w.keep(rec) {
+		return
+	}
+	for _, re := range w.deny {
+		if re.MatchString(rec.Message) {
+			return
+		}
+	}
+	if len(w.allow) > 0 && !matchesAny(w.allow, rec.Message) {
+		return
+	}
+	w.LogWriter.LogWrite(rec)
+}
+
+func matchesAny(res []*regexp.Regexp, msg string) bool {
+	for _, re := range res {
+		if re.MatchString(msg) {
+			return true
+		}
+	}
+	return false
+}
+
+// Flush flushes the writer if it is a Flusher.
+func (w *recordFilter) Flush() {
+	if f, ok := w.LogWriter.(Flusher); ok {
+		f.Flush()
+	}
+}
+
+// withMessageFilter wraps w in FilterMessages for the "allow" and "deny"
+// config values, if set, warning about and leaving w unfiltered for invalid
+// expressions.
+func withMessageFilter(loader, filename string, w LogWriter, allow, deny []string) LogWriter {
+	if len(allow) == 0 && len(deny) == 0 {
+		return w
+	}
+	fw, err := FilterMessages(allow, deny, w)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: Warning: %s in %s\n", loader, err, filename)
+		return w
+	}
+	return fw
+}
@@ -0,0 +1,213 @@
+package log4go
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// MsgpackFormatter formats each record as a MessagePack map with the keys of
+// JSONFormatter: "timestamp", "level", "category", "source", "message",
+// "fields", "stack" and "seq".  Empty category, source, fields, stack and
+// seq are omitted.  Field values that are not nil, booleans, numbers,
+// strings, byte slices, times, errors, []interface{} or
+// map[string]interface{} are sent as fmt.Sprint strings.
+//
+// The output has no trailing newline; a stream of records needs the
+// FrameLengthPrefix framing, or a receiver decoding one map after another.
+type MsgpackFormatter struct {
+	// TimeLayout is the layout of the timestamp (default time.RFC3339Nano)
+	TimeLayout string
+}
+
+// NewMsgpackFormatter creates a MsgpackFormatter with the default settings.
+func NewMsgpackFormatter() *MsgpackFormatter {
+	return &MsgpackFormatter{TimeLayout: time.RFC3339Nano}
+}
+
+// Format returns rec as a MessagePack map.
+func (f *MsgpackFormatter) Format(rec *LogRecord) []byte {
+	layout := f.TimeLayout
+	if len(layout) == 0 {
+		layout = time.RFC3339Nano
+	}
+
+	n := 3
+	for _, present := range []bool{len(rec.Category) > 0, len(rec.Source) > 0, len(rec.Fields) > 0, len(rec.Stack) > 0, rec.Seq > 0} {
+		if present {
+			n++
+		}
+	}
+	b := make([]byte, 0, 128)
+	b = appendMsgpackMapHeader(b, n)
+	b = appendMsgpackString(appendMsgpackString(b, "timestamp"), rec.Created.Format(layout))
+	b = appendMsgpackString(appendMsgpackString(b, "level"), rec.Level.String())
+	if len(rec.Category) > 0 {
+		b = appendMsgpackString(appendMsgpackString(b, "category"), rec.Category)
+	}
+	if len(rec.Source) > 0 {
+		b = appendMsgpackString(appendMsgpackString(b, "source"), rec.Source)
+	}
+	b = appendMsgpackString(appendMsgpackString(b, "message"), rec.Message)
+	if len(rec.Fields) > 0 {
+		b = appendMsgpackString(b, "fields")
+		b = appendMsgpackMapHeader(b, len(rec.Fields))
+		for _, k := range rec.Fields.keys() {
+			b = appendMsgpackValue(appendMsgpackString(b, k), rec.Fields[k], layout)
+		}
+	}
+	if len(rec.Stack) > 0 {
+		b = appendMsgpackString(appendMsgpackString(b, "stack"), rec.Stack)
+	}
+	if rec.Seq > 0 {
+		b = appendMsgpackUint(appendMsgpackString(b, "seq"), rec.Seq)
+	}
+	return b
+}
+
+func appendMsgpackValue(b []byte, v interface{}, layout string) []byte {
+	switch v := v.(type) {
+	case nil:
+		return append(b, 0xc0)
+	case bool:
+		if v {
+			return append(b, 0xc3)
+		}
+		return append(b, 0xc2)
+	case int:
+		return appendMsgpackInt(b, int64(v))
+	case int8:
+		return appendMsgpackInt(b, int64(v))
+	case int16:
+		return appendMsgpackInt(b, int64(v))
+	case int32:
+		return appendMsgpackInt(b, int64(v))
+	case int64:
+		return appendMsgpackInt(b, v)
+	case uint:
+		return appendMsgpackUint(b, uint64(v))
+	case uint8:
+		return appendMsgpackUint(b, uint64(v))
+	case uint16:
+		return appendMsgpackUint(b, uint64(v))
+	case uint32:
+		return appendMsgpackUint(b, uint64(v))
+	case uint64:
+		return appendMsgpackUint(b, v)
+	case float32:
+		b = append(b, 0xca)
+		return appendBigEndian32(b, math.Float32bits(v))
+	case float64:
+		b = append(b, 0xcb)
+		return appendBigEndian64(b, math.Float64bits(v))
+	case string:
+		return appendMsgpackString(b, v)
+	case []byte:
+		return appendMsgpackBinary(b, v)
+	case time.Time:
+		return appendMsgpackString(b, v.Format(layout))
+	case error:
+		return appendMsgpackString(b, v.Error())
+	case []interface{}:
+		b = appendMsgpackArrayHeader(b, len(v))
+		for _, e := range v {
+			b = appendMsgpackValue(b, e, layout)
+		}
+		return b
+	case map[string]interface{}:
+		b = appendMsgpackMapHeader(b, len(v))
+		for _, k := range Fields(v).keys() {
+			b = appendMsgpackValue(appendMsgpackString(b, k), v[k], layout)
+		}
+		return b
+	}
+	return appendMsgpackString(b, fmt.Sprint(v))
+}
+
+func appendMsgpackInt(b []byte, v int64) []byte {
+	switch {
+	case v >= 0:
+		return appendMsgpackUint(b, uint64(v))
+	case v >= -32:
+		return append(b, byte(v))
+	case v >= math.MinInt8:
+		return append(b, 0xd0, byte(v))
+	case v >= math.MinInt16:
+		return appendBigEndian16(append(b, 0xd1), uint16(v))
+	case v >= math.MinInt32:
+		return appendBigEndian32(append(b, 0xd2), uint32(v))
+	}
+	return appendBigEndian64(append(b, 0xd3), uint64(v))
+}
+
+func appendMsgpackUint(b []byte, v uint64) []byte {
+	switch {
+	case v < 0x80:
+		return append(b, byte(v))
+	case v <= math.MaxUint8:
+		return append(b, 0xcc, byte(v))
+	case v <= math.MaxUint16:
+		return appendBigEndian16(append(b, 0xcd), uint16(v))
+	case v <= math.MaxUint32:
+		return appendBigEndian32(append(b, 0xce), uint32(v))
+	}
+	return appendBigEndian64(append(b, 0xcf), v)
+}
+
+func appendMsgpackString(b []byte, s string) []byte {
+	switch n := len(s); {
+	case n < 32:
+		b = append(b, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		b = append(b, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		b = appendBigEndian16(append(b, 0xda), uint16(n))
+	default:
+		b = appendBigEndian32(append(b, 0xdb), uint32(n))
+	}
+	return append(b, s...)
+}
+
+func appendMsgpackBinary(b []byte, v []byte) []byte {
+	switch n := len(v); {
+	case n <= math.MaxUint8:
+		b = append(b, 0xc4, byte(n))
+	case n <= math.MaxUint16:
+		b = appendBigEndian16(append(b, 0xc5), uint16(n))
+	default:
+		b = appendBigEndian32(append(b, 0xc6), uint32(n))
+	}
+	return append(b, v...)
+}
+
+func appendMsgpackArrayHeader(b []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(b, 0x90|byte(n))
+	case n <= math.MaxUint16:
+		return appendBigEndian16(append(b, 0xdc), uint16(n))
+	}
+	return appendBigEndian32(append(b, 0xdd), uint32(n))
+}
+
+func appendMsgpackMapHeader(b []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(b, 0x80|byte(n))
+	case n <= math.MaxUint16:
+		return appendBigEndian16(append(b, 0xde), uint16(n))
+	}
+	return appendBigEndian32(append(b, 0xdf), uint32(n))
+}
+
+func appendBigEndian16(b []byte, v uint16) []byte {
+	return append(b, byte(v>>8), byte(v))
+}
+
+func appendBigEndian32(b []byte, v uint32) []byte {
+	return append(b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func appendBigEndian64(b []byte, v uint64) []byte {
+	return appendBigEndian32(appendBigEndian32(b, uint32(v>>32)), uint32(v))
+}
@@ -0,0 +1,27 @@
+//go:build log4go_otel
+
+package log4go
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// This file is only built with the log4go_otel tag, so that programs not
+// using it do not build OpenTelemetry.  The go.mod of log4go requires the
+// version of go.opentelemetry.io/otel/trace it is tested with; programs using
+// it build with -tags log4go_otel.
+
+func init() {
+	SetSpanExtractor(otelSpan)
+}
+
+// otelSpan returns the ids of the OpenTelemetry span active in ctx.
+func otelSpan(ctx context.Context) (string, string) {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return "", ""
+	}
+	return sc.TraceID().String(), sc.SpanID().String()
+}
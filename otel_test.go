@@ -0,0 +1,36 @@
+//go:build log4go_otel
+
+package log4go
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestOtelSpan(t *testing.T) {
+	rw := &recordingLogWriter{}
+	l := make(Logger)
+	l.AddFilter("api", INFO, rw, "api")
+
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: trace.TraceID{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36},
+		SpanID:  trace.SpanID{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7},
+	})
+	ctx := NewContext(trace.ContextWithSpanContext(context.Background(), sc), l["api"])
+	if f, ok := FromContext(ctx); ok {
+		f.Info("handled")
+	}
+	l["api"].WithContext(context.Background()).Info("no span")
+
+	if len(rw.records) != 2 {
+		t.Fatalf("Expected 2 records, got %d", len(rw.records))
+	}
+	if got, want := FormatLogRecord("%I %i %M", rw.records[0]), "4bf92f3577b34da6a3ce929d0e0e4736 00f067aa0ba902b7 handled\n"; got != want {
+		t.Errorf("With span: got %q, want %q", got, want)
+	}
+	if got, want := FormatLogRecord("%I %i %M", rw.records[1]), "  no span\n"; got != want {
+		t.Errorf("Without span: got %q, want %q", got, want)
+	}
+}
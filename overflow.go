@@ -0,0 +1,137 @@
+package log4go
+
+import (
+	"fmt"
+	"os"
+	"sync/atomic"
+)
+
+// An OverflowPolicy decides what LogWrite does when the record queue of a
+// writer is full, e.g. because the disk or the network is slow.
+type OverflowPolicy int
+
+const (
+	OverflowBlock      OverflowPolicy = iota // Wait for room in the queue, the default
+	OverflowDrop                             // Drop the new record
+	OverflowDropOldest                       // Drop the oldest queued record to make room
+)
+
+var overflowPolicyNames = [...]string{"block", "drop", "drop_oldest"}
+
+func (p OverflowPolicy) String() string {
+	if p < 0 || int(p) >= len(overflowPolicyNames) {
+		return "unknown"
+	}
+	return overflowPolicyNames[p]
+}
+
+// ParseOverflowPolicy returns the OverflowPolicy called name ("block", "drop"
+// or "drop_oldest").
+func ParseOverflowPolicy(name string) (OverflowPolicy, error) {
+	for i, n := range overflowPolicyNames {
+		if n == name {
+			return OverflowPolicy(i), nil
+		}
+	}
+	return OverflowBlock, fmt.Errorf("unknown overflow policy %q", name)
+}
+
+// parseOverflow parses the "overflow" config value, warning about and
+// blocking on unknown policies.
+func parseOverflow(loader, filename, value string) OverflowPolicy {
+	if len(value) == 0 {
+		return OverflowBlock
+	}
+	p, err := ParseOverflowPolicy(value)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: Warning: %s in %s, using %q\n", loader, err, filename, OverflowBlock)
+	}
+	return p
+}
+
+// overflow queues records for a writer goroutine according to a policy and
+// counts the records dropped.
+type overflow struct {
+	policy    OverflowPolicy
+	dropped   uint64
+	highWater int32 // The most records seen queued
+}
+
+// send queues rec on queue.
+func (o *overflow) send(queue chan *LogRecord, rec *LogRecord) {
+	policy := o.policy
+	if policy == OverflowDropOldest && cap(queue) == 0 {
+		// Nothing is queued that could be dropped instead
+		policy = OverflowDrop
+	}
+
+	switch policy {
+	case OverflowDrop:
+		select {
+		case queue <- rec:
+			o.mark(len(queue))
+		default:
+			o.drop(1)
+		}
+	case OverflowDropOldest:
+		for {
+			select {
+			case queue <- rec:
+				o.mark(len(queue))
+				return
+			default:
+			}
+			select {
+			case old := <-queue:
+				if old != nil && old.flushed != nil {
+					// Everything queued before the Flush marker is written
+					close(old.flushed)
+				} else {
+					o.drop(1)
+				}
+			default:
+			}
+		}
+	default:
+		queue <- rec
+		o.mark(len(queue))
+	}
+}
+
+// mark raises the high-water mark to n queued records.
+func (o *overflow) mark(n int) {
+	for {
+		high := atomic.LoadInt32(&o.highWater)
+		if int32(n) <= high || atomic.CompareAndSwapInt32(&o.highWater, high, int32(n)) {
+			return
+		}
+	}
+}
+
+// QueueStats reports how full the queue of a writer is, to tune its length,
+// see SetBufferLength.
+type QueueStats struct {
+	Depth     int `json:"depth"`      // Records queued now
+	Capacity  int `json:"capacity"`   // Records that can be queued before the overflow policy applies
+	HighWater int `json:"high_water"` // The most records queued at once so far
+}
+
+// stats returns the stats of queue.
+func (o *overflow) stats(queue chan *LogRecord) QueueStats {
+	return QueueStats{
+		Depth:     len(queue),
+		Capacity:  cap(queue),
+		HighWater: int(atomic.LoadInt32(&o.highWater)),
+	}
+}
+
+// drop counts n records dropped.
+func (o *overflow) drop(n uint64) {
+	atomic.AddUint64(&o.dropped, n)
+	countDropped(n)
+}
+
+// count returns the number of records dropped so far.
+func (o *overflow) count() uint64 {
+	return atomic.LoadUint64(&o.dropped)
+}
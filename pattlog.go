@@ -6,8 +6,14 @@ import (
 	"bytes"
 	"fmt"
 	"io"
-	"regexp"
+	"os"
+	"runtime"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
 )
 
 const (
@@ -16,24 +22,92 @@ const (
 	FORMAT_ABBREV  = "[%L] %M"
 )
 
+// formatCacheType holds the time codes formatted for one second, so that
+// they are formatted once a second rather than for every record.  Each writer
+// goroutine keeps its own, see Pattern.appendTo.
 type formatCacheType struct {
 	LastUpdateSeconds    int64
+	location             *time.Location
 	shortTime, shortDate string
 	longTime, longDate   string
 }
 
-var formatCache = &formatCacheType{}
+// TokenInfo describes a single format code understood by FormatLogRecord.
+type TokenInfo struct {
+	Token       string // The format code as written in a pattern, e.g. "%D"
+	Description string // A short human readable description
+	Example     string // Sample output for the code
+}
+
+// formatTokens lists the known format codes in the order they are documented.
+var formatTokens = []TokenInfo{
+	{"%T", "Time", "15:04:05 MST"},
+	{"%t", "Time", "15:04"},
+	{"%D", "Date", "2006/01/02"},
+	{"%D{layout}", "Date and time using a custom Go time layout", "%D{2006-01-02T15:04:05}"},
+	{"%d", "Date", "01/02/06"},
+	{"%o", "Microseconds", "123456"},
+	{"%o{digits}", "Fraction of a second with 1 to 9 digits", "%o{3}"},
+	{"%L", "Level", "FNST, FINE, DEBG, TRAC, WARN, EROR, CRIT"},
+	{"%S", "Source", "main.main:15"},
+	{"%s", "Short source", "main.main:15"},
+	{"%F", "Short file name", "main.go"},
+	{"%l", "Line number", "15"},
+	{"%M", "Message", "message"},
+	{"%C", "Category", "DEFAULT"},
+	{"%P", "Process id", "4242"},
+	{"%h", "Hostname", "web-1"},
+	{"%g", "Goroutine id", "17"},
+	{"%n", "Sequence number of the record", "1042"},
+	{"%E{VAR}", "Value of the environment variable VAR", "%E{REGION}"},
+	{"%X{key}", "Value of the structured field key", "%X{user}"},
+	{"%X", "All structured fields", "req=42 user=bob"},
+	{"%K", "Stack trace of an error record, on the following lines", "main.main\n\t/src/main.go:15"},
+	{"%I", "Trace id of the span in the logging context", "4bf92f3577b34da6a3ce929d0e0e4736"},
+	{"%i", "Span id of the span in the logging context", "00f067aa0ba902b7"},
+}
+
+// Tokens returns the format codes supported by this version of the library so
+// that configuration tools can offer completion and validation of patterns.
+// The returned slice is a copy and may be modified by the caller.
+func Tokens() []TokenInfo {
+	tokens := make([]TokenInfo, len(formatTokens))
+	copy(tokens, formatTokens)
+	return tokens
+}
 
 // Known format codes:
 // %T - Time (15:04:05 MST)
 // %t - Time (15:04)
 // %D - Date (2006/01/02)
 // %d - Date (01/02/06)
+// %o - Microseconds (123456)
+// %o{digits} - Fraction of a second with 1 to 9 digits (%o{3} for ms)
 // %L - Level (FNST, FINE, DEBG, TRAC, WARN, EROR, CRIT)
 // %S - Source
+// %s - Short source
+// %F - Short file name (main.go)
+// %l - Line number
 // %M - Message
-// Ignores unknown formats
+// %C - Category
+// %P - Process id
+// %h - Hostname (looked up once)
+// %g - Goroutine id of the logging goroutine
+// %n - Sequence number of the record (see LogRecord.Seq)
+// %E{VAR} - Environment variable VAR, read once when the pattern is compiled
+// %X{key} - Structured field key (see Filter.WithFields)
+// %X - All structured fields as key=value pairs
+// %K - Stack trace of the logging call on the following lines (see SetErrorStacks)
+// %I - Trace id of the span in the logging context (see Filter.WithContext)
+// %i - Span id of the span in the logging context
+// %D{layout} - Date and time formatted with a custom Go time layout
+// A width between % and the code pads it with spaces, on the left (%10C) or
+// with a minus sign on the right (%-5L), so that columns line up.
+// Ignores unknown formats; see Tokens for the complete list
 // Recommended: "[%D %T] [%L] (%S) %M"
+//
+// The format is compiled with CompilePattern the first time it is seen and
+// the compiled form is reused for later records.
 func FormatLogRecord(format string, rec *LogRecord) string {
 	if rec == nil {
 		return "<nil>"
@@ -41,68 +115,524 @@ func FormatLogRecord(format string, rec *LogRecord) string {
 	if len(format) == 0 {
 		return ""
 	}
+	buf := formatBuffers.Get().(*[]byte)
+	b := cachedPattern(format).appendTo((*buf)[:0], rec, nil)
+	s := string(b)
+	putFormatBuffer(buf, b)
+	return s
+}
 
-	out := bytes.NewBuffer(make([]byte, 0, 64))
-	secs := rec.Created.UnixNano() / 1e9
+// AppendFormatLogRecord appends rec formatted as FormatLogRecord does to buf
+// and returns the extended buffer, so that writers reusing buf format
+// records without allocating the string.
+func AppendFormatLogRecord(buf []byte, format string, rec *LogRecord) []byte {
+	if rec == nil {
+		return append(buf, "<nil>"...)
+	}
+	return appendFormat(buf, format, rec, nil)
+}
+
+// appendFormat is AppendFormatLogRecord, for a writer goroutine keeping the
+// formatted time codes in *cache.
+func appendFormat(buf []byte, format string, rec *LogRecord, cache **formatCacheType) []byte {
+	if len(format) == 0 {
+		return buf
+	}
+	return cachedPattern(format).appendTo(buf, rec, cache)
+}
+
+// maxPooledBuffer is the capacity above which a format buffer, grown by an
+// unusually long record, is left to the garbage collector.
+const maxPooledBuffer = 64 * 1024
+
+// formatBuffers pools the *[]byte buffers records are formatted into.
+var formatBuffers = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, 0, 256)
+		return &b
+	},
+}
+
+// putFormatBuffer returns buf to the pool, keeping b, what it grew into.
+func putFormatBuffer(buf *[]byte, b []byte) {
+	if cap(b) > maxPooledBuffer {
+		return
+	}
+	*buf = b[:0]
+	formatBuffers.Put(buf)
+}
+
+// A Pattern is a format string parsed once into a list of tokens, so that
+// formatting a record is a single pass over the tokens with no splitting or
+// regexp matching.  A Pattern is safe for concurrent use and is a Formatter.
+type Pattern struct {
+	format string
+	tokens []patternToken
+
+	// The *formatCacheType of the last second formatted by Format or
+	// FormatLogRecord, which have no writer to keep it
+	cache atomic.Value
+}
+
+// A patternToken is either literal text (verb 0), a format code, a custom
+// date layout (verb '{' with the layout in text), a field (verb 'x' with the
+// key in text), or a fraction of a second (verb 'o' with the number of digits
+// in digits).  Codes are padded to width
+// characters, on the left or, if width is negative, on the right.
+type patternToken struct {
+	verb   byte
+	text   string
+	digits int
+	width  int
+}
+
+// parseWidth parses the optional width modifier, e.g. -5 in %-5L, starting at
+// format[i].  It returns the width, negative for left alignment, and the index
+// of the code that follows it.
+func parseWidth(format string, i int) (int, int) {
+	left := i < len(format) && format[i] == '-'
+	if left {
+		i++
+	}
+	width := 0
+	for ; i < len(format) && format[i] >= '0' && format[i] <= '9'; i++ {
+		width = width*10 + int(format[i]-'0')
+	}
+	if left {
+		width = -width
+	}
+	return width, i
+}
+
+// padField pads s with spaces to the width of a width modifier.
+func padField(s string, width int) string {
+	n := utf8.RuneCountInString(s)
+	switch {
+	case width > n:
+		return strings.Repeat(" ", width-n) + s
+	case -width > n:
+		return s + strings.Repeat(" ", -width-n)
+	}
+	return s
+}
+
+// patternVerbs are the single letter format codes, %D{layout} and %o{digits}
+// aside.
+const patternVerbs = "TtDdLSsFlMCPhgoXKIin"
+
+// ValidatePattern reports the problems CompilePattern silently ignores:
+// unknown codes, which are dropped from the output, a % at the end of the
+// pattern, and %D{, %E{, %X{ or %o{ without a closing brace.
+func ValidatePattern(format string) error {
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			continue
+		}
+		if i+1 < len(format) && format[i+1] != '%' {
+			_, next := parseWidth(format, i+1)
+			i = next - 1
+		}
+		if i+1 >= len(format) {
+			return fmt.Errorf("pattern %q: dangling %% at the end", format)
+		}
+		verb := format[i+1]
+		switch {
+		case verb == '%':
+			return fmt.Errorf("pattern %q: %%%% at offset %d is not an escape and produces no output", format, i)
+		case (verb == 'D' || verb == 'E' || verb == 'X') && i+2 < len(format) && format[i+2] == '{':
+			end := strings.IndexByte(format[i+2:], '}')
+			if end < 0 {
+				return fmt.Errorf("pattern %q: %%%c{ at offset %d has no closing }", format, verb, i)
+			}
+			i += 2 + end
+			continue
+		case verb == 'o' && i+2 < len(format) && format[i+2] == '{':
+			if i+4 >= len(format) || format[i+3] < '1' || format[i+3] > '9' || format[i+4] != '}' {
+				return fmt.Errorf("pattern %q: %%o{ at offset %d must be followed by a digit 1-9 and }", format, i)
+			}
+			i += 4
+			continue
+		case strings.IndexByte(patternVerbs, verb) < 0:
+			return fmt.Errorf("pattern %q: unknown code %%%c at offset %d", format, verb, i)
+		}
+		i++
+	}
+	return nil
+}
+
+// CompilePattern parses format, which uses the codes of FormatLogRecord.
+func CompilePattern(format string) *Pattern {
+	p := &Pattern{format: format}
+	literal := make([]byte, 0, len(format))
+	flush := func() {
+		if len(literal) > 0 {
+			p.tokens = append(p.tokens, patternToken{text: string(literal)})
+			literal = literal[:0]
+		}
+	}
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			literal = append(literal, format[i])
+			continue
+		}
+		// A trailing or doubled % produces nothing, the next % starts a code
+		if i+1 >= len(format) || format[i+1] == '%' {
+			continue
+		}
+		width, next := parseWidth(format, i+1)
+		if next >= len(format) {
+			break
+		}
+		i = next
+		verb := format[i]
+		if verb == 'E' && i+1 < len(format) && format[i+1] == '{' {
+			if end := strings.IndexByte(format[i+1:], '}'); end >= 0 {
+				literal = append(literal, padField(os.Getenv(format[i+2:i+1+end]), width)...)
+				i += 1 + end
+				continue
+			}
+		}
+		if verb == 'D' && i+1 < len(format) && format[i+1] == '{' {
+			if end := strings.IndexByte(format[i+1:], '}'); end >= 0 {
+				flush()
+				p.tokens = append(p.tokens, patternToken{verb: '{', text: format[i+2 : i+1+end], width: width})
+				i += 1 + end
+				continue
+			}
+		}
+		if verb == 'X' && i+1 < len(format) && format[i+1] == '{' {
+			if end := strings.IndexByte(format[i+1:], '}'); end >= 0 {
+				flush()
+				p.tokens = append(p.tokens, patternToken{verb: 'x', text: format[i+2 : i+1+end], width: width})
+				i += 1 + end
+				continue
+			}
+		}
+		if verb == 'o' {
+			digits := 6
+			if i+2 < len(format) && format[i+1] == '{' && format[i+2] >= '1' && format[i+2] <= '9' &&
+				i+3 < len(format) && format[i+3] == '}' {
+				digits = int(format[i+2] - '0')
+				i += 3
+			}
+			flush()
+			p.tokens = append(p.tokens, patternToken{verb: 'o', digits: digits, width: width})
+			continue
+		}
+		if verb == 'g' {
+			atomic.StoreInt32(&recordGoroutines, 1)
+		}
+		if strings.IndexByte(patternVerbs, verb) >= 0 {
+			flush()
+			p.tokens = append(p.tokens, patternToken{verb: verb, width: width})
+		}
+		// Unknown codes are dropped
+	}
+	flush()
+	return p
+}
+
+// String returns the format the pattern was compiled from.
+func (p *Pattern) String() string {
+	return p.format
+}
 
-	cache := *formatCache
-	if cache.LastUpdateSeconds != secs {
+// Format returns rec formatted by the pattern, including the trailing newline.
+func (p *Pattern) Format(rec *LogRecord) []byte {
+	if rec == nil {
+		return []byte("<nil>")
+	}
+	return p.appendTo(make([]byte, 0, 64), rec, nil)
+}
+
+// AppendFormat appends rec formatted by the pattern to buf and returns the
+// extended buffer.
+func (p *Pattern) AppendFormat(buf []byte, rec *LogRecord) []byte {
+	if rec == nil {
+		return append(buf, "<nil>"...)
+	}
+	return p.appendTo(buf, rec, nil)
+}
+
+// appendTo appends rec formatted by the pattern to b.  cache holds the time
+// codes of the last second formatted by the calling writer goroutine; if nil,
+// those of the pattern are used.
+func (p *Pattern) appendTo(b []byte, rec *LogRecord, cache **formatCacheType) []byte {
+	if cache == nil {
+		last, _ := p.cache.Load().(*formatCacheType)
+		prev := last
+		cache = &last
+		defer func() {
+			if last != prev {
+				p.cache.Store(last)
+			}
+		}()
+	}
+	for _, tok := range p.tokens {
+		if tok.width == 0 {
+			b = appendToken(b, tok, rec, cache)
+			continue
+		}
+		start := len(b)
+		b = padBytes(appendToken(b, tok, rec, cache), start, tok.width)
+	}
+	return append(b, '\n')
+}
+
+// padBytes pads b[start:] with spaces to the width of a width modifier.
+func padBytes(b []byte, start, width int) []byte {
+	n := utf8.RuneCount(b[start:])
+	switch {
+	case width > n:
+		end := len(b)
+		for i := n; i < width; i++ {
+			b = append(b, ' ')
+		}
+		copy(b[start+width-n:], b[start:end])
+		for i := start; i < start+width-n; i++ {
+			b[i] = ' '
+		}
+	case -width > n:
+		for i := n; i < -width; i++ {
+			b = append(b, ' ')
+		}
+	}
+	return b
+}
+
+// appendToken appends a single token of a pattern.  cache holds the formatted
+// time fields, see timeCache.
+func appendToken(b []byte, tok patternToken, rec *LogRecord, cache **formatCacheType) []byte {
+	switch tok.verb {
+	case 0:
+		b = append(b, tok.text...)
+	case '{':
+		b = rec.Created.AppendFormat(b, tok.text)
+	case 'T', 't', 'D', 'd':
+		fields := timeCache(rec, cache)
+		switch tok.verb {
+		case 'T':
+			b = append(b, fields.longTime...)
+		case 't':
+			b = append(b, fields.shortTime...)
+		case 'D':
+			b = append(b, fields.longDate...)
+		case 'd':
+			b = append(b, fields.shortDate...)
+		}
+	case 'o':
+		b = appendFraction(b, rec.Created.Nanosecond(), tok.digits)
+	case 'L':
+		b = append(b, rec.Level.String()...)
+	case 'S':
+		b = append(b, rec.Source...)
+	case 's':
+		b = append(b, rec.Source[strings.LastIndexByte(rec.Source, '/')+1:]...)
+	case 'F':
+		b = append(b, rec.File[strings.LastIndexAny(rec.File, `/\`)+1:]...)
+	case 'l':
+		b = strconv.AppendInt(b, int64(rec.Line), 10)
+	case 'M':
+		b = append(b, rec.Message...)
+	case 'C':
+		// The record is shared with the other writers, so it is not changed
+		if len(rec.Category) == 0 {
+			b = append(b, "DEFAULT"...)
+		} else {
+			b = append(b, rec.Category...)
+		}
+	case 'P':
+		b = append(b, processID...)
+	case 'h':
+		b = append(b, hostname()...)
+	case 'g':
+		b = strconv.AppendUint(b, rec.Goroutine, 10)
+	case 'n':
+		b = strconv.AppendUint(b, rec.Seq, 10)
+	case 'x':
+		if v, ok := rec.Fields[tok.text]; ok {
+			b = appendValue(b, v)
+		}
+	case 'X':
+		for i, k := range rec.Fields.keys() {
+			if i > 0 {
+				b = append(b, ' ')
+			}
+			b = append(append(b, k...), '=')
+			b = appendValue(b, rec.Fields[k])
+		}
+	case 'I':
+		if v, ok := rec.Fields[TraceIDKey]; ok {
+			b = appendValue(b, v)
+		}
+	case 'i':
+		if v, ok := rec.Fields[SpanIDKey]; ok {
+			b = appendValue(b, v)
+		}
+	case 'K':
+		if len(rec.Stack) > 0 {
+			b = append(b, '\n')
+			b = append(b, strings.TrimSuffix(rec.Stack, "\n")...)
+		}
+	}
+	return b
+}
+
+// appendValue appends a field value as fmt.Sprint formats it, without
+// going through fmt for the common types.
+func appendValue(b []byte, v interface{}) []byte {
+	switch v := v.(type) {
+	case string:
+		return append(b, v...)
+	case int:
+		return strconv.AppendInt(b, int64(v), 10)
+	case int64:
+		return strconv.AppendInt(b, v, 10)
+	case uint64:
+		return strconv.AppendUint(b, v, 10)
+	case bool:
+		return strconv.AppendBool(b, v)
+	}
+	return append(b, fmt.Sprint(v)...)
+}
+
+// appendFraction appends the leading digits of the zero padded nanoseconds
+// ns.
+func appendFraction(b []byte, ns, digits int) []byte {
+	var buf [9]byte
+	for i := len(buf) - 1; i >= 0; i-- {
+		buf[i] = byte('0' + ns%10)
+		ns /= 10
+	}
+	return append(b, buf[:digits]...)
+}
+
+// timeCache returns the formatted time fields for rec, reusing *last while
+// records keep arriving within the same second, and replacing it otherwise.
+func timeCache(rec *LogRecord, last **formatCacheType) *formatCacheType {
+	secs := rec.Created.UnixNano() / 1e9
+	cache := *last
+	if cache == nil || cache.LastUpdateSeconds != secs || cache.location != rec.Created.Location() {
 		month, day, year := rec.Created.Month(), rec.Created.Day(), rec.Created.Year()
 		hour, minute, second := rec.Created.Hour(), rec.Created.Minute(), rec.Created.Second()
 		zone, _ := rec.Created.Zone()
-		updated := &formatCacheType{
+		cache = &formatCacheType{
 			LastUpdateSeconds: secs,
+			location:          rec.Created.Location(),
 			shortTime:         fmt.Sprintf("%02d:%02d", hour, minute),
 			shortDate:         fmt.Sprintf("%02d/%02d/%02d", day, month, year%100),
 			longTime:          fmt.Sprintf("%02d:%02d:%02d %s", hour, minute, second, zone),
 			longDate:          fmt.Sprintf("%04d/%02d/%02d", year, month, day),
 		}
-		cache = *updated
-		formatCache = updated
-
-	}
-	//custom format datetime pattern %D{2006-01-02T15:04:05}
-	formatByte := changeDttmFormat(format, rec)
-	// Split the string into pieces by % signs
-	pieces := bytes.Split(formatByte, []byte{'%'})
-
-	// Iterate over the pieces, replacing known formats
-	for i, piece := range pieces {
-		if i > 0 && len(piece) > 0 {
-			switch piece[0] {
-			case 'T':
-				out.WriteString(cache.longTime)
-			case 't':
-				out.WriteString(cache.shortTime)
-			case 'D':
-				out.WriteString(cache.longDate)
-			case 'd':
-				out.WriteString(cache.shortDate)
-			case 'L':
-				out.WriteString(levelStrings[rec.Level])
-			case 'S':
-				out.WriteString(rec.Source)
-			case 's':
-				slice := strings.Split(rec.Source, "/")
-				out.WriteString(slice[len(slice)-1])
-			case 'M':
-				out.WriteString(rec.Message)
-			case 'C':
-				if len(rec.Category) == 0 {
-					rec.Category = "DEFAULT"
-				}
-				out.WriteString(rec.Category)
-			}
-			if len(piece) > 1 {
-				out.Write(piece[1:])
-			}
-		} else if len(piece) > 0 {
-			out.Write(piece)
+		*last = cache
+	}
+	return cache
+}
+
+var processID = strconv.Itoa(os.Getpid())
+
+var (
+	hostnameOnce  sync.Once
+	hostnameValue string
+)
+
+// hostname returns the host name, looked up on first use.
+func hostname() string {
+	hostnameOnce.Do(func() {
+		name, err := os.Hostname()
+		if err != nil {
+			name = "unknown"
 		}
+		hostnameValue = name
+	})
+	return hostnameValue
+}
+
+// recordGoroutines is set once a pattern using %g is compiled, which the
+// writers' SetFormat do right away.  Finding the goroutine id is comparatively
+// slow, so records only carry it from then on.
+var recordGoroutines int32
+
+// currentGoroutine returns the id of the calling goroutine, or 0 if no
+// pattern needs it.
+func currentGoroutine() uint64 {
+	if atomic.LoadInt32(&recordGoroutines) == 0 {
+		return 0
+	}
+	return goroutineID()
+}
+
+// goroutineID returns the id of the calling goroutine.
+func goroutineID() uint64 {
+	var buf [64]byte
+	stack := buf[:runtime.Stack(buf[:], false)]
+	// The trace starts with "goroutine 17 [running]:"
+	stack = bytes.TrimPrefix(stack, []byte("goroutine "))
+	if i := bytes.IndexByte(stack, ' '); i > 0 {
+		stack = stack[:i]
+	}
+	id, _ := strconv.ParseUint(string(stack), 10, 64)
+	return id
+}
+
+// maxCachedPatterns bounds the patterns remembered by FormatLogRecord, so that
+// callers building formats on the fly can't grow the cache without limit.
+const maxCachedPatterns = 256
+
+var (
+	patternCache     sync.Map // format string -> *Pattern
+	patternCacheSize int32
+)
+
+func cachedPattern(format string) *Pattern {
+	if p, ok := patternCache.Load(format); ok {
+		return p.(*Pattern)
 	}
-	out.WriteByte('\n')
+	p := CompilePattern(format)
+	if atomic.AddInt32(&patternCacheSize, 1) <= maxCachedPatterns {
+		patternCache.Store(format, p)
+	}
+	return p
+}
+
+// utcRecord returns a copy of rec with its time in UTC, for writers set to
+// format records in UTC.
+func utcRecord(rec *LogRecord) *LogRecord {
+	utc := *rec
+	utc.Created = rec.Created.UTC()
+	return &utc
+}
 
-	return out.String()
+// trimNewline removes the trailing newline of a formatted record, for writers
+// in raw mode.
+func trimNewline(b []byte) []byte {
+	return bytes.TrimSuffix(b, []byte{'\n'})
+}
+
+// A Formatter turns a LogRecord into the bytes a writer outputs, including any
+// trailing newline.  Writers call Format from their own goroutine, so a
+// Formatter shared between writers must be safe for concurrent use.
+type Formatter interface {
+	Format(rec *LogRecord) []byte
+}
+
+// FormatterFunc adapts an ordinary function to the Formatter interface.
+type FormatterFunc func(rec *LogRecord) []byte
+
+// Format calls f(rec).
+func (f FormatterFunc) Format(rec *LogRecord) []byte {
+	return f(rec)
+}
+
+// PatternFormatter is a Formatter using the % pattern codes of FormatLogRecord.
+type PatternFormatter string
+
+// Format returns FormatLogRecord(string(p), rec).
+func (p PatternFormatter) Format(rec *LogRecord) []byte {
+	if len(p) == 0 {
+		return nil
+	}
+	return cachedPattern(string(p)).Format(rec)
 }
 
 // This is the standard writer that prints to standard output.
@@ -116,38 +646,40 @@ func NewFormatLogWriter(out io.Writer, format string) FormatLogWriter {
 }
 
 func (w FormatLogWriter) run(out io.Writer, format string) {
-	defer recoverPanic()
+	var cache *formatCacheType
 	for rec := range w {
-		fmt.Fprint(out, FormatLogRecord(format, rec))
+		if rec.flushed != nil {
+			close(rec.flushed)
+			continue
+		}
+		w.writeRecord(out, format, rec, &cache)
 	}
 }
 
+// writeRecord writes rec to out.  A panic drops rec, see recoverWriter.
+func (w FormatLogWriter) writeRecord(out io.Writer, format string, rec *LogRecord, cache **formatCacheType) {
+	defer recoverWriter("FormatLogWriter", format)
+	buf := formatBuffers.Get().(*[]byte)
+	b := appendFormat((*buf)[:0], format, rec, cache)
+	out.Write(b)
+	putFormatBuffer(buf, b)
+}
+
 // This is the FormatLogWriter's output method.  This will block if the output
 // buffer is full.
 func (w FormatLogWriter) LogWrite(rec *LogRecord) {
 	w <- rec
 }
 
-// Close stops the logger from sending messages to standard output.  Attempts to
-// send log messages to this logger after a Close have undefined behavior.
-func (w FormatLogWriter) Close() {
-	close(w)
+// Flush blocks until the records queued before the call are written.
+func (w FormatLogWriter) Flush() {
+	flushQueue(w, nil)
 }
 
-func changeDttmFormat(format string, rec *LogRecord) []byte {
-	formatByte := []byte(format)
-	r := regexp.MustCompile("\\%D\\{(.*?)\\}")
-	i := 0
-	formatByte = r.ReplaceAllFunc(formatByte, func(s []byte) []byte {
-		if i < 2 {
-			i++
-			str := string(s)
-			str = strings.Replace(str, "%D", "", -1)
-			str = strings.Replace(str, "{", "", -1)
-			str = strings.Replace(str, "}", "", -1)
-			return []byte(rec.Created.Format(str))
-		}
-		return s
-	})
-	return formatByte
+// Close stops the logger from sending messages to standard output, once the
+// queued ones are written.  Attempts to send log messages to this logger after
+// a Close have undefined behavior.
+func (w FormatLogWriter) Close() {
+	w.Flush()
+	close(w)
 }
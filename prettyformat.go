@@ -0,0 +1,96 @@
+package log4go
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ANSI colors for the level badges of PrettyFormatter
+var prettyLevelColors = [...]string{
+	"\x1b[90m",   // FINEST
+	"\x1b[90m",   // FINE
+	"\x1b[36m",   // DEBUG
+	"\x1b[34m",   // TRACE
+	"\x1b[32m",   // INFO
+	"\x1b[33m",   // WARNING
+	"\x1b[31m",   // ERROR
+	"\x1b[1;31m", // CRITICAL
+	"\x1b[1;35m", // PANIC
+	"\x1b[1;35m", // FATAL
+}
+
+const prettyColorReset = "\x1b[0m"
+
+// PrettyFormatter renders records for humans during local development:
+//
+//	+1.204s  INFO  [api] login ok
+//	+1.310s  EROR  [db] query failed:
+//	               connection reset by peer
+//	               user=bob
+//	               at main.query:42
+//
+// Timestamps are relative to Start, level badges are aligned, and everything
+// after the first line of the message is indented to the message column:
+// the other lines of the message, one structured field per line, the source
+// and the stack trace of error records.  It is not meant for files parsed by
+// machines.
+type PrettyFormatter struct {
+	// Start is the reference time for relative timestamps
+	Start time.Time
+
+	// Color enables ANSI colored level badges
+	Color bool
+}
+
+// NewPrettyFormatter creates a PrettyFormatter with timestamps relative to now.
+func NewPrettyFormatter(color bool) *PrettyFormatter {
+	return &PrettyFormatter{Start: time.Now(), Color: color}
+}
+
+// Format returns rec as one or more indented lines.
+func (f *PrettyFormatter) Format(rec *LogRecord) []byte {
+	out := bytes.NewBuffer(make([]byte, 0, 128))
+
+	elapsed := rec.Created.Sub(f.Start).Seconds()
+	fmt.Fprintf(out, "%+10.3fs  ", elapsed)
+
+	name := fmt.Sprintf("%-4s", rec.Level.String())
+	badge := name
+	if lvl := rec.Level.builtin(); f.Color && lvl >= 0 && int(lvl) < len(prettyLevelColors) {
+		badge = prettyLevelColors[lvl] + name + prettyColorReset
+	}
+	out.WriteString(badge)
+	out.WriteString("  ")
+
+	// Everything after the first line lines up with the message column
+	indent := strings.Repeat(" ", out.Len()-len(badge)+utf8.RuneCountInString(name))
+	if len(rec.Category) > 0 {
+		out.WriteString("[" + rec.Category + "] ")
+	}
+
+	lines := strings.Split(strings.TrimRight(rec.Message, "\n"), "\n")
+	out.WriteString(lines[0])
+	out.WriteByte('\n')
+	for _, line := range lines[1:] {
+		out.WriteString(indent)
+		out.WriteString(line)
+		out.WriteByte('\n')
+	}
+	for _, k := range rec.Fields.keys() {
+		fmt.Fprintf(out, "%s%s=%v\n", indent, k, rec.Fields[k])
+	}
+	if len(rec.Source) > 0 {
+		out.WriteString(indent + "at " + rec.Source + "\n")
+	}
+	if len(rec.Stack) > 0 {
+		for _, line := range strings.Split(strings.TrimRight(rec.Stack, "\n"), "\n") {
+			out.WriteString(indent)
+			out.WriteString(line)
+			out.WriteByte('\n')
+		}
+	}
+	return out.Bytes()
+}
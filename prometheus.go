@@ -0,0 +1,61 @@
+//go:build log4go_prometheus
+
+package log4go
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// This file is only built with the log4go_prometheus tag, so that programs
+// not using it do not build the Prometheus client.  The go.mod of log4go
+// requires the version of github.com/prometheus/client_golang it is tested
+// with; programs using it build with -tags log4go_prometheus.
+
+var (
+	recordsDesc = prometheus.NewDesc("log4go_records_total",
+		"Records logged, by category and level.", []string{"category", "level"}, nil)
+	droppedDesc = prometheus.NewDesc("log4go_dropped_records_total",
+		"Records dropped by the overflow policies and by shadow writers falling behind.", nil, nil)
+	rateLimitedDesc = prometheus.NewDesc("log4go_rate_limited_records_total",
+		"Messages dropped by the rate limits of categories.", nil, nil)
+	writeErrorsDesc = prometheus.NewDesc("log4go_write_errors_total",
+		"Failed writes and rotations of the log files and sockets.", nil, nil)
+	rotationsDesc = prometheus.NewDesc("log4go_rotations_total",
+		"Log files rotated.", nil, nil)
+	bytesWrittenDesc = prometheus.NewDesc("log4go_written_bytes_total",
+		"Bytes written to the log files and sockets.", nil, nil)
+)
+
+// metricsCollector collects ReadMetrics, see NewMetricsCollector.
+type metricsCollector struct{}
+
+// NewMetricsCollector returns a prometheus.Collector of the Metrics, as
+// log4go_records_total{category, level}, log4go_dropped_records_total,
+// log4go_rate_limited_records_total, log4go_write_errors_total,
+// log4go_rotations_total and log4go_written_bytes_total:
+//
+//	prometheus.MustRegister(log4go.NewMetricsCollector())
+func NewMetricsCollector() prometheus.Collector {
+	return metricsCollector{}
+}
+
+func (metricsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- recordsDesc
+	ch <- droppedDesc
+	ch <- rateLimitedDesc
+	ch <- writeErrorsDesc
+	ch <- rotationsDesc
+	ch <- bytesWrittenDesc
+}
+
+func (metricsCollector) Collect(ch chan<- prometheus.Metric) {
+	m := ReadMetrics()
+	for category, levels := range m.Records {
+		for level, n := range levels {
+			ch <- prometheus.MustNewConstMetric(recordsDesc, prometheus.CounterValue, float64(n), category, level)
+		}
+	}
+	ch <- prometheus.MustNewConstMetric(droppedDesc, prometheus.CounterValue, float64(m.Dropped))
+	ch <- prometheus.MustNewConstMetric(rateLimitedDesc, prometheus.CounterValue, float64(m.RateLimited))
+	ch <- prometheus.MustNewConstMetric(writeErrorsDesc, prometheus.CounterValue, float64(m.WriteErrors))
+	ch <- prometheus.MustNewConstMetric(rotationsDesc, prometheus.CounterValue, float64(m.Rotations))
+	ch <- prometheus.MustNewConstMetric(bytesWrittenDesc, prometheus.CounterValue, float64(m.BytesWritten))
+}
@@ -0,0 +1,46 @@
+//go:build log4go_prometheus
+
+package log4go
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestMetricsCollector(t *testing.T) {
+	l := make(Logger)
+	l.AddFilter("prom", INFO, discardLogWriter{}, "prom")
+	l.LOGGER("prom").Error("failed")
+
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(NewMetricsCollector())
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %s", err)
+	}
+	found := map[string]bool{}
+	for _, mf := range families {
+		found[mf.GetName()] = true
+		if mf.GetName() != "log4go_records_total" {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			labels := map[string]string{}
+			for _, lp := range m.GetLabel() {
+				labels[lp.GetName()] = lp.GetValue()
+			}
+			if labels["category"] == "prom" && labels["level"] == "ERROR" {
+				found["prom ERROR"] = true
+				if got := m.GetCounter().GetValue(); got != 1 {
+					t.Errorf("Expected 1 ERROR record, got %v", got)
+				}
+			}
+		}
+	}
+	for _, name := range []string{"prom ERROR", "log4go_records_total", "log4go_dropped_records_total", "log4go_rate_limited_records_total", "log4go_write_errors_total", "log4go_rotations_total", "log4go_written_bytes_total"} {
+		if !found[name] {
+			t.Errorf("%s not collected", name)
+		}
+	}
+}
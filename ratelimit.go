@@ -0,0 +1,88 @@
+package log4go
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SetRateLimit limits the messages logged for category to perSecond a
+// second on average, with bursts of up to burst messages, so that one chatty
+// subsystem cannot fill the queues shared with the others or the disk.  The
+// messages over the limit are dropped before they are formatted, and counted
+// in the /stats of AdminHandler.  A perSecond of zero or less removes the
+// limit.  Like SetLevel, it applies at once to LOGGER(category) and the
+// filters derived from it; messages logged through the Logger itself are not
+// limited.  In configuration files, it is "rate_limit" and "rate_burst".
+func (log Logger) SetRateLimit(category string, perSecond float64, burst int) error {
+	filt, ok := log.get(category)
+	if !ok {
+		return fmt.Errorf("no filter for category %q", category)
+	}
+	if perSecond <= 0 {
+		filt.limiter.Store((*rateLimiter)(nil))
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	filt.limiter.Store(&rateLimiter{
+		rate:   perSecond,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	})
+	return nil
+}
+
+// rateLimiter is a token bucket holding up to burst tokens, refilled at rate
+// tokens a second.
+type rateLimiter struct {
+	mu          sync.Mutex
+	rate, burst float64
+	tokens      float64
+	last        time.Time
+	dropped     uint64
+}
+
+// allow takes a token if there is one, and counts the message dropped
+// otherwise.
+func (l *rateLimiter) allow(now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if elapsed := now.Sub(l.last).Seconds(); elapsed > 0 {
+		l.tokens += elapsed * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+	}
+	l.last = now
+	if l.tokens < 1 {
+		atomic.AddUint64(&l.dropped, 1)
+		countRateLimited()
+		return false
+	}
+	l.tokens--
+	return true
+}
+
+// rateLimiter returns the limiter of the category of f, or nil.
+func (f *Filter) rateLimiter() *rateLimiter {
+	l, _ := f.registered().limiter.Load().(*rateLimiter)
+	return l
+}
+
+// allow reports whether the rate limit of f lets one more message through.
+func (f *Filter) allow() bool {
+	l := f.rateLimiter()
+	return l == nil || l.allow(time.Now())
+}
+
+// rateLimited returns the number of messages dropped by the rate limit of f.
+func (f *Filter) rateLimited() uint64 {
+	if l := f.rateLimiter(); l != nil {
+		return atomic.LoadUint64(&l.dropped)
+	}
+	return 0
+}
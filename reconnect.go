@@ -0,0 +1,180 @@
+package log4go
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultReconnectDelay and DefaultMaxReconnectDelay are the first and the
+// longest waits of a SocketLogWriter between attempts to reconnect, see
+// SetReconnectDelay.
+var (
+	DefaultReconnectDelay    = 100 * time.Millisecond
+	DefaultMaxReconnectDelay = 30 * time.Second
+)
+
+// socketConn is the connection of a SocketLogWriter's goroutine.  When a
+// write fails, it closes the connection and dials again, waiting twice as
+// long after each failed attempt up to the maximum delay, and then sends what
+// it could not.  Meanwhile the records wait in the writer's queue, and
+// LogWrite blocks or drops them according to the overflow policy once it is
+// full.
+type socketConn struct {
+	w        *SocketLogWriter
+	hostport string
+	dial     func() (net.Conn, error)
+
+	conn    net.Conn
+	pending []byte        // Encoded records not sent yet
+	records int           // Records in pending
+	delay   time.Duration // Wait before the next attempt to reconnect
+	gaveUp  bool          // Closed while disconnected
+
+	// With a spool, the records in pending, and those that could not be sent
+	// when the writer was closed, to be spooled for the next writer
+	spooling         bool
+	inflight, unsent []*LogRecord
+
+	// The records sent together, see SetBatch and SetCompression
+	batching     bool
+	batchRecords int
+	batch        []byte
+	batched      []*LogRecord
+	compress     func(dst, src []byte) []byte
+	compressed   []byte
+	prefix       bool // Send the length of compressed batches
+	maxBatch     int  // Seal larger batches (0 if unlimited)
+}
+
+// add appends js, the encoding of rec, to the pending records, or to the
+// batch.
+func (c *socketConn) add(rec *LogRecord, js []byte) {
+	if c.batching {
+		c.addBatch(rec, js)
+		return
+	}
+	c.pending = append(c.pending, js...)
+	c.records++
+	if c.spooling {
+		c.inflight = append(c.inflight, rec)
+	}
+}
+
+// flush sends the pending records and the batch.
+func (c *socketConn) flush() bool {
+	c.seal()
+	return c.send()
+}
+
+// send writes the pending records, reconnecting until it succeeds.  When the
+// writer is closed while the connection is down, they are dropped, or kept
+// for the spool, and send returns false.
+func (c *socketConn) send() bool {
+	for len(c.pending) > 0 {
+		if c.conn == nil && !c.reconnect() {
+			if !c.spooling {
+				c.w.overflow.drop(uint64(c.records))
+			}
+			c.pending, c.records = c.pending[:0], 0
+			c.unsent = append(c.unsent, c.inflight...)
+			c.inflight = c.inflight[:0]
+			return false
+		}
+		if c.w.writeTimeout > 0 {
+			c.conn.SetWriteDeadline(time.Now().Add(c.w.writeTimeout))
+		}
+		n, err := c.conn.Write(c.pending)
+		atomic.AddUint64(&c.w.stats.bytes, uint64(n))
+		countBytesWritten(uint64(n))
+		if err == nil {
+			atomic.AddUint64(&c.w.stats.sends, uint64(c.records))
+			c.pending, c.records = c.pending[:0], 0
+			c.inflight = c.inflight[:0]
+			return true
+		}
+		// Send the rest, not what went through, after reconnecting
+		c.pending = c.pending[:copy(c.pending, c.pending[n:])]
+		c.w.stats.fail(err)
+		c.w.stats.setConnected(false)
+		countWriteError()
+		reportError(fmt.Errorf("SocketLogWriter(%q): %s, reconnecting", c.hostport, err))
+		c.conn.Close()
+		c.conn = nil
+	}
+	return true
+}
+
+// reconnect dials until it succeeds, or until the writer is closed, when it
+// returns false.
+func (c *socketConn) reconnect() bool {
+	if c.gaveUp {
+		return false
+	}
+	min, max := c.w.reconnectDelay, c.w.maxReconnectDelay
+	if min <= 0 {
+		min = DefaultReconnectDelay
+	}
+	if max <= 0 {
+		max = DefaultMaxReconnectDelay
+	}
+	if max < min {
+		max = min
+	}
+	if c.delay < min {
+		c.delay = min
+	}
+	for {
+		timer := time.NewTimer(c.delay)
+		select {
+		case <-timer.C:
+		case <-c.w.closing:
+			timer.Stop()
+			c.gaveUp = true
+			if c.spooling {
+				reportError(fmt.Errorf("SocketLogWriter(%q): closed while disconnected, records left in the spool", c.hostport))
+			} else {
+				reportError(fmt.Errorf("SocketLogWriter(%q): closed while disconnected, records dropped", c.hostport))
+			}
+			return false
+		}
+
+		conn, err := c.dial()
+		if err == nil {
+			c.conn = conn
+			c.delay = 0
+			atomic.AddUint64(&c.w.stats.reconnects, 1)
+			c.w.stats.setConnected(true)
+			return true
+		}
+		c.w.stats.fail(err)
+		if c.delay *= 2; c.delay > max {
+			c.delay = max
+		}
+	}
+}
+
+// close closes the connection, if it is up.
+func (c *socketConn) close() {
+	if c.conn != nil {
+		c.conn.Close()
+		c.conn = nil
+		c.w.stats.setConnected(false)
+	}
+}
+
+// parseSocketDuration returns the duration of the socket property name, e.g.
+// reconnect_delay, or zero for the default.
+func parseSocketDuration(filename, name, value string) time.Duration {
+	if len(value) == 0 {
+		return 0
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "LoadConfiguration: Warning: Invalid %s %q in %s, using the default\n", name, value, filename)
+		return 0
+	}
+	return d
+}
@@ -0,0 +1,178 @@
+package log4go
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sync"
+	"sync/atomic"
+)
+
+// A Redactor masks sensitive data, e.g. e-mail addresses, tokens or card
+// numbers, in the messages and string fields of the records logged, before
+// any writer sees them.  It is called from the logging goroutines, so it
+// must be safe for concurrent use.
+type Redactor interface {
+	Redact(s string) string
+}
+
+// RedactorFunc adapts a function to the Redactor interface.
+type RedactorFunc func(s string) string
+
+func (f RedactorFunc) Redact(s string) string {
+	return f(s)
+}
+
+// RedactPattern returns a Redactor replacing the matches of the regular
+// expression pattern with replacement, in which $1 and ${name} stand for the
+// submatches as in regexp.ReplaceAllString.
+func RedactPattern(pattern, replacement string) (Redactor, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redact pattern %q: %s", pattern, err)
+	}
+	return RedactorFunc(func(s string) string {
+		return re.ReplaceAllString(s, replacement)
+	}), nil
+}
+
+// The built-in redactors, also available as "email", "card" and "token" in
+// configuration files.
+var (
+	// RedactEmails replaces e-mail addresses with "[EMAIL]"
+	RedactEmails = mustRedactPattern(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`, "[EMAIL]")
+
+	// RedactCardNumbers replaces runs of 13 to 19 digits, possibly grouped
+	// by spaces or dashes, with "[CARD]"
+	RedactCardNumbers = mustRedactPattern(`\b\d(?:[ -]?\d){12,18}\b`, "[CARD]")
+
+	// RedactTokens replaces the values of bearer tokens and of key=value or
+	// key: value pairs whose key is token, api_key, apikey, password, passwd
+	// or secret with "***"
+	RedactTokens = mustRedactPattern(`(?i)(bearer\s+|\b(?:token|api[_-]?key|password|passwd|secret)\s*[=:]\s*)[^\s,;"'&]+`, "${1}***")
+)
+
+var builtinRedactors = map[string]Redactor{
+	"email": RedactEmails,
+	"card":  RedactCardNumbers,
+	"token": RedactTokens,
+}
+
+func mustRedactPattern(pattern, replacement string) Redactor {
+	r, err := RedactPattern(pattern, replacement)
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+// redactors holds the []Redactor set by SetRedactors and AddRedactor.  It is
+// replaced, never modified, so that loggers can read it without locking.
+var (
+	redactors     atomic.Value
+	redactorsLock sync.Mutex
+)
+
+// SetRedactors replaces the redactors applied to every record logged, in
+// order, after the hooks registered with RegisterHook.  No argument removes
+// them all.
+//
+//	log.SetRedactors(log.RedactEmails, log.RedactTokens)
+func SetRedactors(rs ...Redactor) {
+	redactorsLock.Lock()
+	defer redactorsLock.Unlock()
+	redactors.Store(append([]Redactor(nil), rs...))
+}
+
+// AddRedactor adds r to the redactors applied to every record logged.
+func AddRedactor(r Redactor) {
+	redactorsLock.Lock()
+	defer redactorsLock.Unlock()
+	current, _ := redactors.Load().([]Redactor)
+	redactors.Store(append(current[:len(current):len(current)], r))
+}
+
+// redact returns rec with its message and string fields redacted, a copy if
+// anything was changed, as rec and its fields may be shared.
+func redact(rec *LogRecord) *LogRecord {
+	rs, _ := redactors.Load().([]Redactor)
+	if len(rs) == 0 {
+		return rec
+	}
+	apply := func(s string) string {
+		for _, r := range rs {
+			s = r.Redact(s)
+		}
+		return s
+	}
+
+	msg := apply(rec.Message)
+	var fields Fields
+	for k, v := range rec.Fields {
+		s, ok := v.(string)
+		if !ok {
+			continue
+		}
+		if redacted := apply(s); redacted != s {
+			if fields == nil {
+				fields = make(Fields, len(rec.Fields))
+				for k, v := range rec.Fields {
+					fields[k] = v
+				}
+			}
+			fields[k] = redacted
+		}
+	}
+	if msg == rec.Message && fields == nil {
+		return rec
+	}
+
+	copied := *rec
+	copied.Message = msg
+	if fields != nil {
+		copied.Fields = fields
+	}
+	return &copied
+}
+
+// RedactConfig is an entry of the "redact" list of a configuration: the name
+// of a built-in redactor ("email", "card" or "token"), or a regular
+// expression and its replacement.
+type RedactConfig struct {
+	Name        string `json:"name"`
+	Pattern     string `json:"pattern"`
+	Replacement string `json:"replacement"` // "***" if empty
+}
+
+// configRedactors returns the redactors of the "redact" config entries,
+// warning about and skipping invalid ones.
+func configRedactors(loader, filename string, entries []RedactConfig) []Redactor {
+	var rs []Redactor
+	for _, rc := range entries {
+		r, err := rc.redactor()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: Warning: %s in %s\n", loader, err, filename)
+			continue
+		}
+		rs = append(rs, r)
+	}
+	return rs
+}
+
+func (rc RedactConfig) redactor() (Redactor, error) {
+	if len(rc.Name) > 0 {
+		r, ok := builtinRedactors[rc.Name]
+		if !ok {
+			return nil, fmt.Errorf("unknown redactor %q", rc.Name)
+		}
+		return r, nil
+	}
+	if len(rc.Pattern) == 0 {
+		return nil, fmt.Errorf("redact entry without a name or pattern")
+	}
+	replacement := rc.Replacement
+	if len(replacement) == 0 {
+		replacement = "***"
+	}
+	return RedactPattern(rc.Pattern, replacement)
+}
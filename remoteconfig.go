@@ -0,0 +1,198 @@
+package log4go
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A RemoteSource is a configuration kept in a key-value store, see
+// ConsulSource and EtcdSource.
+type RemoteSource interface {
+	// Fetch returns the configuration and its version once the version is
+	// no longer version, waiting for a change as long as the store lets it.
+	// Version 0 returns the current configuration at once.
+	Fetch(ctx context.Context, version uint64) (data []byte, next uint64, err error)
+}
+
+// RemoteRetryInterval is how long WatchRemoteConfiguration waits after a
+// failed fetch.
+var RemoteRetryInterval = 10 * time.Second
+
+// WatchRemoteConfiguration loads the configuration from src, in format "json",
+// "yaml" or "xml" as for LoadConfigurationFromBytes, and then reloads it every
+// time it changes until ctx is done.  Turning a debug level on in the store
+// thus reaches every process of a fleet:
+//
+//	src := &log.ConsulSource{Addr: "http://127.0.0.1:8500", Key: "config/billing/log4go"}
+//	if err := log.Global.WatchRemoteConfiguration(ctx, src, "json"); err != nil {
+//		...
+//	}
+//
+// Only the first load is reported as an error; later failures are printed to
+// standard error and retried after RemoteRetryInterval, keeping the running
+// configuration.  Other goroutines may keep logging while a change is
+// loaded: the records go to the old filters or to the new ones, or are
+// dropped in between.
+func (log Logger) WatchRemoteConfiguration(ctx context.Context, src RemoteSource, format string) error {
+	data, version, err := src.Fetch(ctx, 0)
+	if err != nil {
+		return err
+	}
+	if err := log.LoadConfigurationFromBytes(data, format); err != nil {
+		return err
+	}
+
+	go func() {
+		for ctx.Err() == nil {
+			data, next, err := src.Fetch(ctx, version)
+			if err == nil && next != version {
+				version = next
+				err = log.LoadConfigurationFromBytes(data, format)
+			}
+			if err != nil && ctx.Err() == nil {
+				fmt.Fprintf(os.Stderr, "WatchRemoteConfiguration: Warning: %s\n", err)
+				select {
+				case <-ctx.Done():
+				case <-time.After(RemoteRetryInterval):
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// ConsulSource reads the configuration from a Consul KV key, and waits for
+// changes with blocking queries.
+type ConsulSource struct {
+	Addr   string        // Agent address, e.g. "http://127.0.0.1:8500"
+	Key    string        // KV key, e.g. "config/billing/log4go"
+	Token  string        // ACL token, if any
+	Wait   time.Duration // Longest blocking query, 5 minutes if zero
+	Client *http.Client  // http.DefaultClient if nil
+}
+
+// Fetch implements RemoteSource.
+func (s *ConsulSource) Fetch(ctx context.Context, version uint64) ([]byte, uint64, error) {
+	wait := s.Wait
+	if wait <= 0 {
+		wait = 5 * time.Minute
+	}
+	for {
+		query := url.Values{"raw": {""}}
+		if version > 0 {
+			query.Set("index", strconv.FormatUint(version, 10))
+			query.Set("wait", fmt.Sprintf("%ds", int(wait/time.Second)))
+		}
+		req, err := http.NewRequest("GET", strings.TrimSuffix(s.Addr, "/")+"/v1/kv/"+strings.TrimPrefix(s.Key, "/")+"?"+query.Encode(), nil)
+		if err != nil {
+			return nil, 0, err
+		}
+		if len(s.Token) > 0 {
+			req.Header.Set("X-Consul-Token", s.Token)
+		}
+		body, header, err := remoteDo(ctx, s.Client, req)
+		if err != nil {
+			return nil, 0, fmt.Errorf("consul key %q: %s", s.Key, err)
+		}
+
+		index, err := strconv.ParseUint(header.Get("X-Consul-Index"), 10, 64)
+		if err != nil {
+			return nil, 0, fmt.Errorf("consul key %q: invalid X-Consul-Index %q", s.Key, header.Get("X-Consul-Index"))
+		}
+		// Any other index is a change; it may even go backwards, e.g. after
+		// a snapshot restore
+		if index != version {
+			return body, index, nil
+		}
+	}
+}
+
+// EtcdSource reads the configuration from an etcd v3 key through the JSON
+// gRPC gateway, and polls it for changes.
+type EtcdSource struct {
+	Endpoint     string        // Gateway address, e.g. "http://127.0.0.1:2379"
+	Key          string        // Key, e.g. "/config/billing/log4go"
+	PollInterval time.Duration // Time between checks for changes, 5 seconds if zero
+	Client       *http.Client  // http.DefaultClient if nil
+}
+
+// Fetch implements RemoteSource.  The version is the key's mod_revision.
+func (s *EtcdSource) Fetch(ctx context.Context, version uint64) ([]byte, uint64, error) {
+	interval := s.PollInterval
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	for {
+		data, rev, err := s.get(ctx)
+		if err != nil || rev != version {
+			return data, rev, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, 0, ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+func (s *EtcdSource) get(ctx context.Context) ([]byte, uint64, error) {
+	query, _ := json.Marshal(map[string]string{"key": base64.StdEncoding.EncodeToString([]byte(s.Key))})
+	req, err := http.NewRequest("POST", strings.TrimSuffix(s.Endpoint, "/")+"/v3/kv/range", bytes.NewReader(query))
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	body, _, err := remoteDo(ctx, s.Client, req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("etcd key %q: %s", s.Key, err)
+	}
+
+	// int64 fields are strings in the gateway's JSON
+	var resp struct {
+		Kvs []struct {
+			Value       []byte `json:"value"`
+			ModRevision string `json:"mod_revision"`
+		} `json:"kvs"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, 0, fmt.Errorf("etcd key %q: %s", s.Key, err)
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, 0, fmt.Errorf("etcd key %q not found", s.Key)
+	}
+	rev, err := strconv.ParseUint(resp.Kvs[0].ModRevision, 10, 64)
+	if err != nil {
+		return nil, 0, fmt.Errorf("etcd key %q: invalid mod_revision %q", s.Key, resp.Kvs[0].ModRevision)
+	}
+	return resp.Kvs[0].Value, rev, nil
+}
+
+// remoteDo sends req and returns the body of a 200 response.
+func remoteDo(ctx context.Context, client *http.Client, req *http.Request) ([]byte, http.Header, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return body, resp.Header, nil
+}
@@ -0,0 +1,175 @@
+package log4go
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// RotationStats describes the log file a FileLogWriter is currently writing.
+type RotationStats struct {
+	Filename string    // Name of the log file
+	Lines    int       // Lines written since the file was opened
+	Size     int       // Bytes written since the file was opened
+	Opened   time.Time // When the file was opened
+}
+
+// A RotationPolicy decides when a FileLogWriter rotates its file and what the
+// old file is renamed to.  Policies are only called from the writer's
+// goroutine, so they need no locking of their own.
+type RotationPolicy interface {
+	// ShouldRotate is called before rec is written and reports whether the
+	// file should be rotated first.
+	ShouldRotate(rec *LogRecord, stats RotationStats) bool
+
+	// NextName returns the name the log file prev is renamed to when it is
+	// rotated, or "" to keep appending to prev.  An existing file of that
+	// name is replaced.
+	NextName(prev string) string
+}
+
+// SetRotationPolicy replaces the built-in line, size and daily rotation with
+// policy (chainable).  Rotated files are kept, compressed and encrypted just
+// like the built-in backups, whether or not rotate was set.  Passing nil
+// restores the built-in policy and the rotate setting.  Must be called before
+// the first log message is written.
+func (w *FileLogWriter) SetRotationPolicy(policy RotationPolicy) *FileLogWriter {
+	if policy == nil {
+		policy = stdRotation{w}
+	}
+	w.policy = policy
+	return w
+}
+
+// keepsBackups reports whether rotated files are renamed rather than
+// appended to: always with a custom policy, otherwise if rotate is set.
+func (w *FileLogWriter) keepsBackups() bool {
+	_, std := w.policy.(stdRotation)
+	return w.rotate || !std
+}
+
+// TimestampName is a NextName helper for custom policies: it names backups
+// like SetRotateTimestamp does, e.g. app.log.20240615-130501.123.
+func TimestampName(prev string) string {
+	return uniqueFilename(prev+"."+time.Now().Format(backupTimestampLayout), "")
+}
+
+// DailyName is a NextName helper for custom policies: it names backups after
+// the day they were last written to, like daily rotation does, e.g.
+// app.log.2024-06-15.  A name already taken gets a .1, .2, ... suffix.
+func DailyName(prev string) string {
+	day := time.Now()
+	if info, err := os.Stat(prev); err == nil {
+		day = info.ModTime()
+	}
+	return uniqueFilename(prev+"."+day.Format("2006-01-02"), "")
+}
+
+// NumberedName returns a NextName helper for custom policies which numbers
+// backups like the built-in policy: prev.1 is the newest, and older backups,
+// compressed or not, are shifted up by one, keeping at most maxbackup.
+func NumberedName(maxbackup int) func(prev string) string {
+	return func(prev string) string {
+		for num := maxbackup - 1; num >= 1; num-- {
+			for _, ext := range []string{"", ".gz", ".zst"} {
+				fname := prev + fmt.Sprintf(".%d", num) + ext
+				if _, err := os.Lstat(fname); err == nil {
+					os.Rename(fname, prev+fmt.Sprintf(".%d", num+1)+ext)
+				}
+			}
+		}
+		return prev + ".1"
+	}
+}
+
+// LineRotation rotates after MaxLines lines.
+type LineRotation struct {
+	MaxLines int
+
+	// Name names the backups (TimestampName if nil)
+	Name func(prev string) string
+}
+
+func (p LineRotation) ShouldRotate(rec *LogRecord, stats RotationStats) bool {
+	return p.MaxLines > 0 && stats.Lines >= p.MaxLines
+}
+
+func (p LineRotation) NextName(prev string) string {
+	return backupName(p.Name, TimestampName, prev)
+}
+
+// SizeRotation rotates after MaxSize bytes.
+type SizeRotation struct {
+	MaxSize int
+
+	// Name names the backups (TimestampName if nil)
+	Name func(prev string) string
+}
+
+func (p SizeRotation) ShouldRotate(rec *LogRecord, stats RotationStats) bool {
+	return p.MaxSize > 0 && stats.Size >= p.MaxSize
+}
+
+func (p SizeRotation) NextName(prev string) string {
+	return backupName(p.Name, TimestampName, prev)
+}
+
+// DailyRotation rotates on the first record written on a new day.
+type DailyRotation struct {
+	// Name names the backups (DailyName if nil)
+	Name func(prev string) string
+}
+
+func (p DailyRotation) ShouldRotate(rec *LogRecord, stats RotationStats) bool {
+	return time.Now().Day() != stats.Opened.Day()
+}
+
+func (p DailyRotation) NextName(prev string) string {
+	return backupName(p.Name, DailyName, prev)
+}
+
+func backupName(name, fallback func(string) string, prev string) string {
+	if name == nil {
+		name = fallback
+	}
+	return name(prev)
+}
+
+// stdRotation is the built-in policy configured by the SetRotate* methods.
+type stdRotation struct {
+	w *FileLogWriter
+}
+
+func (p stdRotation) ShouldRotate(rec *LogRecord, stats RotationStats) bool {
+	w := p.w
+	return LineRotation{MaxLines: w.maxlines}.ShouldRotate(rec, stats) ||
+		SizeRotation{MaxSize: w.maxsize}.ShouldRotate(rec, stats) ||
+		(w.daily && DailyRotation{}.ShouldRotate(rec, stats))
+}
+
+// NextName names backups by time of rotation, by the day they were written in
+// daily mode, or otherwise shifts the numbered backups (.1, .2, ...) up by one
+// to make room for prev.1.
+func (p stdRotation) NextName(prev string) string {
+	w := p.w
+	ext := w.backupExt()
+	if w.timestamp {
+		return uniqueFilename(prev+"."+time.Now().Format(backupTimestampLayout), ext)
+	}
+	if w.daily {
+		info, err := os.Stat(prev)
+		if err != nil || time.Now().Day() == info.ModTime().Day() {
+			return ""
+		}
+		// The clock may have moved backwards (VM restore, NTP
+		// correction), so never rename onto an existing backup
+		return uniqueFilename(prev+"."+info.ModTime().Format("2006-01-02"), ext)
+	}
+	for num := w.maxbackup - 1; num >= 1; num-- {
+		fname := prev + fmt.Sprintf(".%d", num)
+		if _, err := os.Lstat(fname + ext); err == nil {
+			os.Rename(fname+ext, prev+fmt.Sprintf(".%d", num+1)+ext)
+		}
+	}
+	return prev + ".1"
+}
@@ -0,0 +1,139 @@
+//go:build log4go_grpc
+
+package rpclog
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/jeanphorn/log4go"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryServerInterceptor returns an interceptor logging the unary calls
+// served, with the address of the client as the peer.
+func (l *Logger) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		l.logCall(ctx, info.FullMethod, peerAddr(ctx), err, start)
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor returns an interceptor logging the streams served,
+// once their handler returns.
+func (l *Logger) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		err := handler(srv, ss)
+		ctx := ss.Context()
+		l.logCall(ctx, info.FullMethod, peerAddr(ctx), err, start)
+		return err
+	}
+}
+
+// UnaryClientInterceptor returns an interceptor logging the unary calls
+// made, with the target of the connection as the peer.
+func (l *Logger) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		start := time.Now()
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		l.logCall(ctx, method, target(cc), err, start)
+		return err
+	}
+}
+
+// StreamClientInterceptor returns an interceptor logging the streams opened,
+// once they end: when receiving returns an error, io.EOF for a stream ended
+// by the server, or the reply of a stream without server streaming is
+// received.  A stream the caller abandons before it ends is not logged.
+func (l *Logger) StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		start := time.Now()
+		cs, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			l.logCall(ctx, method, target(cc), err, start)
+			return nil, err
+		}
+		return &clientStream{
+			ClientStream:  cs,
+			serverStreams: desc.ServerStreams,
+			done: func(err error) {
+				l.logCall(ctx, method, target(cc), err, start)
+			},
+		}, nil
+	}
+}
+
+// clientStream calls done once the stream ends.
+type clientStream struct {
+	grpc.ClientStream
+	serverStreams bool
+	once          sync.Once
+	done          func(err error)
+}
+
+func (s *clientStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err != nil || !s.serverStreams {
+		ended := err
+		if ended == io.EOF {
+			ended = nil
+		}
+		s.once.Do(func() { s.done(ended) })
+	}
+	return err
+}
+
+// logCall logs a call of method with peer, ended with err, started at
+// start.
+func (l *Logger) logCall(ctx context.Context, method, peer string, err error, start time.Time) {
+	latency := time.Since(start)
+	code := status.Code(err)
+	lvl := l.methodLevel(method)
+	if err != nil {
+		lvl = codeLevel(code)
+	}
+	fields := log4go.Fields{
+		"method":  method,
+		"peer":    peer,
+		"code":    code.String(),
+		"latency": latency,
+	}
+	if err != nil {
+		fields[log4go.ErrorKey] = err
+	}
+	l.filter.WithContext(ctx).WithFields(fields).Log(lvl, "rpclog", method+" "+code.String())
+}
+
+// codeLevel returns the level of the calls failing with code.
+func codeLevel(code codes.Code) log4go.Level {
+	switch code {
+	case codes.Canceled, codes.InvalidArgument, codes.NotFound, codes.AlreadyExists,
+		codes.PermissionDenied, codes.FailedPrecondition, codes.OutOfRange, codes.Unauthenticated:
+		return log4go.WARNING
+	}
+	return log4go.ERROR
+}
+
+// peerAddr returns the address of the client of the call served in ctx.
+func peerAddr(ctx context.Context) string {
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		return p.Addr.String()
+	}
+	return ""
+}
+
+// target returns the target cc was dialed with.
+func target(cc *grpc.ClientConn) string {
+	if cc == nil {
+		return ""
+	}
+	return cc.Target()
+}
@@ -0,0 +1,113 @@
+//go:build log4go_grpc
+
+package rpclog
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/jeanphorn/log4go"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+type recordingLogWriter struct {
+	mu      sync.Mutex
+	records []*log4go.LogRecord
+}
+
+func (w *recordingLogWriter) LogWrite(rec *log4go.LogRecord) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.records = append(w.records, rec)
+}
+
+func (w *recordingLogWriter) Close() {}
+
+func newTestLogger() (*Logger, *recordingLogWriter) {
+	w := &recordingLogWriter{}
+	log := make(log4go.Logger)
+	log.AddFilter("rpc", log4go.FINEST, w, "rpc")
+	return New(log.LOGGER("rpc")).SetMethodLevel("/grpc.health.v1.Health/*", log4go.DEBUG), w
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	l, w := newTestLogger()
+	intercept := l.UnaryServerInterceptor()
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 5000}})
+
+	for _, test := range []struct {
+		method string
+		err    error
+		lvl    log4go.Level
+		code   string
+	}{
+		{"/api.Orders/Get", nil, log4go.INFO, "OK"},
+		{"/grpc.health.v1.Health/Check", nil, log4go.DEBUG, "OK"},
+		{"/grpc.health.v1.Health/Check", status.Error(codes.Unavailable, "draining"), log4go.ERROR, "Unavailable"},
+		{"/api.Orders/Get", status.Error(codes.NotFound, "no such order"), log4go.WARNING, "NotFound"},
+	} {
+		w.records = nil
+		intercept(ctx, nil, &grpc.UnaryServerInfo{FullMethod: test.method}, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return nil, test.err
+		})
+		if len(w.records) != 1 {
+			t.Fatalf("%s: got %d records", test.method, len(w.records))
+		}
+		rec := w.records[0]
+		if rec.Level != test.lvl || rec.Message != test.method+" "+test.code {
+			t.Errorf("%s: got %q at %v", test.method, rec.Message, rec.Level)
+		}
+		if rec.Fields["peer"] != "192.0.2.1:5000" || rec.Fields["code"] != test.code || (test.err != nil) != (rec.Fields[log4go.ErrorKey] != nil) {
+			t.Errorf("%s: got fields %v", test.method, rec.Fields)
+		}
+	}
+}
+
+type fakeClientStream struct {
+	grpc.ClientStream
+	msgs int
+}
+
+func (s *fakeClientStream) RecvMsg(m interface{}) error {
+	if s.msgs == 0 {
+		return io.EOF
+	}
+	s.msgs--
+	return nil
+}
+
+func TestStreamClientInterceptor(t *testing.T) {
+	l, w := newTestLogger()
+	intercept := l.StreamClientInterceptor()
+	cs, err := intercept(context.Background(), &grpc.StreamDesc{ServerStreams: true}, nil, "/api.Orders/Watch",
+		func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+			return &fakeClientStream{msgs: 2}, nil
+		})
+	if err != nil {
+		t.Fatalf("got %s", err)
+	}
+	for i := 0; ; i++ {
+		err := cs.RecvMsg(nil)
+		if err == io.EOF {
+			break
+		}
+		if err != nil || i == 2 {
+			t.Fatalf("RecvMsg %d: got %v, want io.EOF after 2 messages", i, err)
+		}
+		if len(w.records) != 0 {
+			t.Fatalf("logged before the end of the stream")
+		}
+	}
+	if err := cs.RecvMsg(nil); err != io.EOF {
+		t.Errorf("RecvMsg after the end: got %v, want io.EOF", err)
+	}
+	if len(w.records) != 1 || w.records[0].Message != "/api.Orders/Watch OK" {
+		t.Errorf("got %d records", len(w.records))
+	}
+}
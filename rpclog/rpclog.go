@@ -0,0 +1,66 @@
+// Package rpclog logs the RPCs of gRPC servers and clients through log4go:
+// its interceptors log the method, the peer, the status code and the latency
+// of each call once it ends.
+//
+//	l := rpclog.New(log4go.LOGGER("rpc")).SetMethodLevel("/grpc.health.v1.Health/*", log4go.DEBUG)
+//	s := grpc.NewServer(
+//		grpc.ChainUnaryInterceptor(l.UnaryServerInterceptor()),
+//		grpc.ChainStreamInterceptor(l.StreamServerInterceptor()))
+//
+// The gRPC code is only built with the log4go_grpc tag, so that programs not
+// using it do not build gRPC.  The go.mod of log4go requires the version of
+// google.golang.org/grpc it is tested with; programs using it build with
+// -tags log4go_grpc.
+package rpclog
+
+import (
+	"path"
+	"strings"
+
+	"github.com/jeanphorn/log4go"
+)
+
+// Logger logs the calls made or served through its interceptors.  A call
+// that succeeds is logged at INFO, or at the level set for its method by
+// SetMethodLevel.  A call that fails is logged at WARNING if the caller is
+// at fault (e.g. InvalidArgument, NotFound, PermissionDenied), and at ERROR
+// otherwise (e.g. Internal, Unavailable, DeadlineExceeded), so that failures
+// of methods logged at DEBUG are not missed.
+type Logger struct {
+	filter *log4go.Filter
+	levels map[string]log4go.Level // By full method name or pattern
+}
+
+// New returns a Logger logging the calls to filter, e.g.
+// log4go.LOGGER("rpc").
+func New(filter *log4go.Filter) *Logger {
+	return &Logger{filter: filter, levels: map[string]log4go.Level{}}
+}
+
+// SetMethodLevel sets the level at which the successful calls of method are
+// logged (chainable), e.g. DEBUG for health checks, so that a filter at INFO
+// drops them.  method is a full method name, "/package.Service/Method", or
+// a wildcard pattern (see path.Match) such as "/package.Service/*"; the
+// longest pattern matching a method applies.  Must be called before the
+// interceptors are used.
+func (l *Logger) SetMethodLevel(method string, lvl log4go.Level) *Logger {
+	l.levels[method] = lvl
+	return l
+}
+
+// methodLevel returns the level of the successful calls of method.
+func (l *Logger) methodLevel(method string) log4go.Level {
+	if lvl, ok := l.levels[method]; ok {
+		return lvl
+	}
+	lvl, match := log4go.INFO, ""
+	for pattern, plvl := range l.levels {
+		if !strings.ContainsAny(pattern, "*?[") || len(pattern) < len(match) || (len(pattern) == len(match) && pattern > match) {
+			continue
+		}
+		if ok, _ := path.Match(pattern, method); ok {
+			lvl, match = plvl, pattern
+		}
+	}
+	return lvl
+}
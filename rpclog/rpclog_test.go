@@ -0,0 +1,26 @@
+package rpclog
+
+import (
+	"testing"
+
+	"github.com/jeanphorn/log4go"
+)
+
+func TestMethodLevel(t *testing.T) {
+	l := New(log4go.LOGGER("rpc")).
+		SetMethodLevel("/grpc.health.v1.Health/*", log4go.DEBUG).
+		SetMethodLevel("/api.Orders/*", log4go.FINE).
+		SetMethodLevel("/api.Orders/Get*", log4go.TRACE).
+		SetMethodLevel("/api.Orders/Create", log4go.WARNING)
+	for method, want := range map[string]log4go.Level{
+		"/grpc.health.v1.Health/Check": log4go.DEBUG,
+		"/api.Orders/List":             log4go.FINE,
+		"/api.Orders/GetOrder":         log4go.TRACE,
+		"/api.Orders/Create":           log4go.WARNING,
+		"/api.Users/Create":            log4go.INFO,
+	} {
+		if got := l.methodLevel(method); got != want {
+			t.Errorf("%s: got %v, want %v", method, got, want)
+		}
+	}
+}
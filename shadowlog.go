@@ -0,0 +1,116 @@
+package log4go
+
+import (
+	"fmt"
+	"os"
+	"sync/atomic"
+)
+
+// ShadowStats reports how a shadow writer has been doing.
+type ShadowStats struct {
+	Delivered uint64 // Records handed to the shadow writer
+	Dropped   uint64 // Records dropped because the shadow writer fell behind
+	Failed    uint64 // Records whose delivery panicked in the shadow writer
+}
+
+// ShadowLogWriter sends every record to a primary LogWriter and, as a
+// migration aid, to a shadow LogWriter (e.g. a new Kafka or Loki sink).  The
+// shadow runs on its own goroutine behind a bounded queue: if it is slow,
+// blocks or panics, records are dropped and counted, and the primary path is
+// never affected.
+type ShadowLogWriter struct {
+	primary LogWriter
+	shadow  LogWriter
+	queue   chan *LogRecord
+
+	delivered, dropped, failed uint64
+}
+
+// NewShadowLogWriter creates a LogWriter writing to primary with shadow
+// attached in shadow mode.
+func NewShadowLogWriter(primary, shadow LogWriter) *ShadowLogWriter {
+	w := &ShadowLogWriter{
+		primary: primary,
+		shadow:  shadow,
+		queue:   make(chan *LogRecord, LogBufferLength),
+	}
+	go w.run()
+	return w
+}
+
+func (w *ShadowLogWriter) run() {
+	for rec := range w.queue {
+		w.deliver(rec)
+	}
+	defer func() {
+		if e := recover(); e != nil {
+			fmt.Fprintf(os.Stderr, "ShadowLogWriter: shadow Close panicked: %v\n", e)
+		}
+	}()
+	w.shadow.Close()
+}
+
+func (w *ShadowLogWriter) deliver(rec *LogRecord) {
+	defer func() {
+		if e := recover(); e != nil {
+			atomic.AddUint64(&w.failed, 1)
+		}
+	}()
+	w.shadow.LogWrite(rec)
+	atomic.AddUint64(&w.delivered, 1)
+}
+
+// This is the ShadowLogWriter's output method.  It blocks only as long as the
+// primary writer does.
+func (w *ShadowLogWriter) LogWrite(rec *LogRecord) {
+	w.primary.LogWrite(rec)
+	select {
+	case w.queue <- rec:
+	default:
+		atomic.AddUint64(&w.dropped, 1)
+		countDropped(1)
+	}
+}
+
+// Close closes the primary writer, then lets the shadow writer drain and close
+// in the background.
+func (w *ShadowLogWriter) Close() {
+	w.primary.Close()
+	close(w.queue)
+}
+
+// Flush flushes the primary writer, if it is a Flusher.  The shadow writer is
+// not waited for.
+func (w *ShadowLogWriter) Flush() {
+	if f, ok := w.primary.(Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Primary returns the primary LogWriter.
+func (w *ShadowLogWriter) Primary() LogWriter {
+	return w.primary
+}
+
+// Stats returns the shadow delivery counters.
+func (w *ShadowLogWriter) Stats() ShadowStats {
+	return ShadowStats{
+		Delivered: atomic.LoadUint64(&w.delivered),
+		Dropped:   atomic.LoadUint64(&w.dropped),
+		Failed:    atomic.LoadUint64(&w.failed),
+	}
+}
+
+// AddShadow attaches shadow to the filter called name in shadow mode and
+// returns the wrapping ShadowLogWriter so that its Stats can be monitored.
+func (log Logger) AddShadow(name string, shadow LogWriter) (*ShadowLogWriter, error) {
+	filt, ok := log.get(name)
+	if !ok {
+		return nil, fmt.Errorf("AddShadow: no filter named %q", name)
+	}
+	sw := NewShadowLogWriter(filt.LogWriter, shadow)
+	shadowed := &Filter{Level: filt.level(), LogWriter: sw, Category: filt.Category, fields: filt.fields, nosource: atomic.LoadUint32(&filt.nosource)}
+	shadowed.limiter.Store(filt.rateLimiter())
+	log.set(name, shadowed)
+	return sw, nil
+}
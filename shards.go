@@ -0,0 +1,148 @@
+package log4go
+
+import "sync"
+
+// shardedQueue spreads the records of a FileLogWriter over several queues,
+// each with a goroutine formatting them, so that formatting, the costly part
+// of writing most records, runs in parallel.  The records are spread round
+// robin, and the writer goroutine takes them back from the shards in the same
+// order, so that they are appended to the file in the order of the LogWrite
+// calls.
+type shardedQueue struct {
+	mu   sync.Mutex
+	in   []chan *LogRecord
+	next int // The shard of the next record
+
+	out  []chan shardRecord
+	read int // The shard the writer goroutine reads next
+}
+
+// shardRecord is a record as formatted by a shard.
+type shardRecord struct {
+	rec *LogRecord
+	s   string
+	ok  bool // Formatting panicked if false, and the record is dropped
+}
+
+// newShardedQueue starts n shards of length records each, formatting records
+// with format and a time cache of their own.
+func newShardedQueue(n, length int, format func(rec *LogRecord, cache **formatCacheType) (string, bool)) *shardedQueue {
+	q := &shardedQueue{}
+	for i := 0; i < n; i++ {
+		in, out := make(chan *LogRecord, length), make(chan shardRecord, length)
+		q.in, q.out = append(q.in, in), append(q.out, out)
+		go func() {
+			defer close(out)
+			var cache *formatCacheType
+			for rec := range in {
+				if rec.flushed != nil {
+					out <- shardRecord{rec: rec}
+					continue
+				}
+				s, ok := format(rec, &cache)
+				out <- shardRecord{rec: rec, s: s, ok: ok}
+			}
+		}()
+	}
+	return q
+}
+
+// send queues rec on the next shard, blocking when it is full, or dropping
+// rec if o says so.  The oldest records are never dropped instead, which
+// would change their order; OverflowDropOldest drops the new record.  A nil
+// o blocks.
+func (q *shardedQueue) send(rec *LogRecord, o *overflow) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	in := q.in[q.next]
+	if o == nil || o.policy == OverflowBlock {
+		in <- rec
+	} else {
+		select {
+		case in <- rec:
+		default:
+			o.drop(1)
+			return
+		}
+	}
+	if o != nil {
+		o.mark(q.queued())
+	}
+	q.next = (q.next + 1) % len(q.in)
+}
+
+// outC returns the shard the next record comes from, nil for no shards.
+func (q *shardedQueue) outC() chan shardRecord {
+	if q == nil {
+		return nil
+	}
+	return q.out[q.read]
+}
+
+// received moves on to the next shard, once a record came from outC.
+func (q *shardedQueue) received() {
+	q.read = (q.read + 1) % len(q.out)
+}
+
+// queued returns the number of records in the shards.
+func (q *shardedQueue) queued() (n int) {
+	for i := range q.in {
+		n += len(q.in[i]) + len(q.out[i])
+	}
+	return n
+}
+
+// flush blocks until the records queued before the call are taken by the
+// writer goroutine, or until done is closed.
+func (q *shardedQueue) flush(done chan struct{}) {
+	marker := &LogRecord{flushed: make(chan struct{})}
+	q.send(marker, nil)
+	select {
+	case <-marker.flushed:
+	case <-done:
+	}
+}
+
+// close stops the shards once they have formatted the queued records.
+func (q *shardedQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, in := range q.in {
+		close(in)
+	}
+}
+
+// shardsSet is queued by SetShards to tell the writer goroutine to read the
+// shards.
+var shardsSet = &LogRecord{}
+
+// SetShards spreads the records over n queues, each formatted by a goroutine
+// of its own, for programs logging more to the file than a single goroutine
+// can format (chainable).  The records are still appended by a single
+// goroutine, in the order they were logged.  Each queue holds as many records
+// as SetBufferLength.  The Formatter, if any, must be safe for concurrent use,
+// and the overflow policy OverflowDropOldest drops the new records instead.
+// One or less keeps the single queue.  Must be called before the first log
+// message is written, after SetBufferLength.
+func (w *FileLogWriter) SetShards(n int) *FileLogWriter {
+	if n <= 1 || w.shards != nil {
+		return w
+	}
+	w.shards = newShardedQueue(n, cap(w.rec), w.formatShard)
+	w.rec <- shardsSet
+	return w
+}
+
+// formatShard formats rec for a shard.  A panic, e.g. in the formatter,
+// drops rec, see recoverWriter.
+func (w *FileLogWriter) formatShard(rec *LogRecord, cache **formatCacheType) (s string, ok bool) {
+	defer recoverWriter("FileLogWriter", w.filename)
+	return w.formatRecord(rec, cache), true
+}
+
+// writeShardRecord writes a record formatted by a shard.  A panic, e.g. in the
+// rotation policy, drops it, see recoverWriter.
+func (w *FileLogWriter) writeShardRecord(r shardRecord) {
+	defer recoverWriter("FileLogWriter", w.filename)
+	w.writeFormatted(r.rec, r.s)
+}
@@ -0,0 +1,138 @@
+//go:build go1.21
+
+package log4go
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime"
+)
+
+// SlogHandler is a slog.Handler that logs through a log4go Filter, so code
+// written against log/slog reaches the configured categories and writers:
+//
+//	logger := slog.New(log.NewSlogHandler(log.LOGGER("api")))
+//	logger.Info("login ok", "user", "bob")
+//
+// Attributes become the record's Fields, with group names joined to the keys
+// by dots.  slog levels map to DEBUG, INFO, WARNING, ERROR and, from
+// slog.LevelError+4 up, CRITICAL; anything below slog.LevelDebug is FINE.
+type SlogHandler struct {
+	filter *Filter
+	attrs  Fields
+	prefix string
+}
+
+// NewSlogHandler creates a SlogHandler that logs through f.
+func NewSlogHandler(f *Filter) *SlogHandler {
+	return &SlogHandler{filter: f}
+}
+
+// slogLevel maps a slog level to a log4go Level.
+func slogLevel(l slog.Level) Level {
+	switch {
+	case l < slog.LevelDebug:
+		return FINE
+	case l < slog.LevelInfo:
+		return DEBUG
+	case l < slog.LevelWarn:
+		return INFO
+	case l < slog.LevelError:
+		return WARNING
+	case l < slog.LevelError+4:
+		return ERROR
+	}
+	return CRITICAL
+}
+
+// Enabled reports whether the filter logs records at level.
+func (h *SlogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return slogLevel(level).atLeast(h.filter.level())
+}
+
+// Handle logs r through the filter.
+func (h *SlogHandler) Handle(_ context.Context, r slog.Record) error {
+	lvl := slogLevel(r.Level)
+	if !lvl.atLeast(h.filter.level()) {
+		return nil
+	}
+
+	fields := make(Fields, len(h.attrs)+r.NumAttrs())
+	for k, v := range h.attrs {
+		fields[k] = v
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		addAttr(fields, h.prefix, a)
+		return true
+	})
+	for k, v := range h.filter.fields {
+		if _, ok := fields[k]; !ok {
+			fields[k] = v
+		}
+	}
+
+	rec := &LogRecord{
+		Level:     lvl,
+		Created:   r.Time,
+		Message:   r.Message,
+		Category:  h.filter.Category,
+		Fields:    withMDC(fields),
+		Goroutine: currentGoroutine(),
+		Seq:       nextSeq(),
+	}
+	if r.PC != 0 {
+		frame, _ := runtime.CallersFrames([]uintptr{r.PC}).Next()
+		rec.Source = fmt.Sprintf("%s:%d", frame.Function, frame.Line)
+		rec.File, rec.Line = frame.File, frame.Line
+	}
+	if len(rec.Fields) == 0 {
+		rec.Fields = nil
+	}
+	h.filter.dispatch(rec)
+	return nil
+}
+
+// WithAttrs returns a handler that adds attrs to every record.
+func (h *SlogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	h2 := *h
+	h2.attrs = make(Fields, len(h.attrs)+len(attrs))
+	for k, v := range h.attrs {
+		h2.attrs[k] = v
+	}
+	for _, a := range attrs {
+		addAttr(h2.attrs, h.prefix, a)
+	}
+	return &h2
+}
+
+// WithGroup returns a handler that qualifies later attributes with name.
+func (h *SlogHandler) WithGroup(name string) slog.Handler {
+	if len(name) == 0 {
+		return h
+	}
+	h2 := *h
+	h2.prefix = h.prefix + name + "."
+	return &h2
+}
+
+// addAttr stores a in fields under prefix, flattening groups.
+func addAttr(fields Fields, prefix string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Value.Kind() == slog.KindGroup {
+		if len(a.Key) > 0 {
+			prefix += a.Key + "."
+		}
+		for _, ga := range a.Value.Group() {
+			addAttr(fields, prefix, ga)
+		}
+		return
+	}
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+	fields[prefix+a.Key] = a.Value.Any()
+}
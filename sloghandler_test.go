@@ -0,0 +1,29 @@
+//go:build go1.21
+
+package log4go
+
+import (
+	"log/slog"
+	"testing"
+)
+
+func TestSlogHandler(t *testing.T) {
+	rw := &recordingLogWriter{}
+	l := make(Logger)
+	l.AddFilter("api", INFO, rw, "api")
+
+	logger := slog.New(NewSlogHandler(l["api"].WithFields(Fields{"svc": "billing"})))
+	logger.Debug("dropped")
+	logger.With("user", "bob").WithGroup("req").Warn("slow", "id", 42, slog.Group("db", "ms", 250))
+
+	if len(rw.records) != 1 {
+		t.Fatalf("Expected 1 record, got %d", len(rw.records))
+	}
+	rec := rw.records[0]
+	if rec.Level != WARNING || rec.Category != "api" {
+		t.Errorf("Record level/category: got %v/%s", rec.Level, rec.Category)
+	}
+	if got, want := FormatLogRecord("[%L] (%s) %M %X", rec), "[WARN] (log4go.TestSlogHandler:17) slow req.db.ms=250 req.id=42 svc=billing user=bob\n"; got != want {
+		t.Errorf("FormatLogRecord: got %q, want %q", got, want)
+	}
+}
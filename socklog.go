@@ -3,55 +3,536 @@
 package log4go
 
 import (
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"net"
 	"os"
+	"time"
 )
 
-// This log writer sends output to a socket
-type SocketLogWriter chan *LogRecord
+// This log writer sends output to a socket.  It used to be a chan *LogRecord;
+// it is now a struct, used through a *SocketLogWriter.
+type SocketLogWriter struct {
+	rec     chan *LogRecord
+	done    chan struct{} // closed when the writer goroutine has finished
+	closing chan struct{} // closed by Close, to stop reconnecting
 
-// This is the SocketLogWriter's output method
-func (w SocketLogWriter) LogWrite(rec *LogRecord) {
-	w <- rec
+	// Formats records when set; otherwise the LogRecord is sent as JSON
+	formatter Formatter
+
+	// Format times in UTC instead of local time
+	utc bool
+
+	// Truncate longer messages (0 if unlimited)
+	maxMessage int
+
+	// Send formatted records without the trailing newline
+	raw bool
+
+	// How records are delimited on the wire
+	framing Framing
+
+	// Buffer tcp writes and flush them at least this often (0 if unbuffered)
+	flushInterval time.Duration
+
+	// What LogWrite does when rec is full
+	overflow overflow
+
+	// Give up a connection whose writes take longer (0 if unlimited)
+	writeTimeout time.Duration
+
+	// The largest udp datagram (DefaultMaxDatagramSize if zero), and what
+	// is done with larger records
+	maxDatagram    int
+	datagramPolicy DatagramPolicy
+
+	// First and longest waits between attempts to reconnect (the defaults if
+	// zero)
+	reconnectDelay, maxReconnectDelay time.Duration
+
+	// Where records go when the queue is full (nil if not spooling)
+	spool *spool
+
+	// Send records in batches of up to batchRecords records, or logged
+	// within batchInterval, compressed with compression (no compression if
+	// empty)
+	batchRecords  int
+	batchInterval time.Duration
+	compression   string
+
+	// Connection state and counters, see Stats
+	stats socketStats
+}
+
+// This is the SocketLogWriter's output method.  When the queue is full, it
+// spools the record, see SetSpool, or blocks or drops it according to the
+// overflow policy.
+func (w *SocketLogWriter) LogWrite(rec *LogRecord) {
+	if w.spool != nil {
+		w.spool.send(w.rec, rec, &w.overflow)
+		return
+	}
+	w.overflow.send(w.rec, rec)
+}
+
+// Flush blocks until the records queued before the call are sent, including
+// any held in the SetFlushInterval buffer, reconnecting if need be.
+func (w *SocketLogWriter) Flush() {
+	flushQueue(w.rec, w.done)
+}
+
+// Close sends the queued records and closes the connection, waiting for both
+// to be done.  If the connection is down, the records are dropped.
+func (w *SocketLogWriter) Close() {
+	close(w.closing)
+	close(w.rec)
+	<-w.done
+}
+
+// SetFormatter sets a custom Formatter used to encode records (chainable).  A
+// nil Formatter restores the default encoding, the LogRecord marshalled as
+// JSON.  Must be called before the first log message is written.
+func (w *SocketLogWriter) SetFormatter(f Formatter) *SocketLogWriter {
+	w.formatter = f
+	return w
+}
+
+// SetLogfmt switches between the LogfmtFormatter encoding and the default
+// encoding (chainable).  Must be called before the first log message is
+// written.
+func (w *SocketLogWriter) SetLogfmt(enable bool) *SocketLogWriter {
+	w.formatter = nil
+	if enable {
+		w.formatter = NewLogfmtFormatter()
+	}
+	return w
+}
+
+// SetJSON switches between the JSONFormatter encoding (one object per line)
+// and the default encoding, which is the LogRecord marshalled as JSON.  Must
+// be called before the first log message is written.
+func (w *SocketLogWriter) SetJSON(enable bool) *SocketLogWriter {
+	w.formatter = nil
+	if enable {
+		w.formatter = NewJSONFormatter()
+	}
+	return w
 }
 
-func (w SocketLogWriter) Close() {
-	close(w)
+// SetUTC switches between sending times in UTC and in local time
+// (chainable).  Must be called before the first log message is written.
+func (w *SocketLogWriter) SetUTC(utc bool) *SocketLogWriter {
+	w.utc = utc
+	return w
 }
 
-func NewSocketLogWriter(proto, hostport string) SocketLogWriter {
-	sock, err := net.Dial(proto, hostport)
+// SetRaw sends each record exactly as the formatter produced it, without the
+// trailing newline, e.g. one JSON document per udp datagram (chainable).  The
+// default JSON encoding never has a newline.  Must be called before the first
+// log message is written.
+func (w *SocketLogWriter) SetRaw(raw bool) *SocketLogWriter {
+	w.raw = raw
+	return w
+}
+
+// SetMsgpack switches between the MsgpackFormatter encoding and the default
+// encoding (chainable).  Over tcp, use it with the FrameLengthPrefix framing
+// unless the receiver decodes a stream of MessagePack maps.  Must be called
+// before the first log message is written.
+func (w *SocketLogWriter) SetMsgpack(enable bool) *SocketLogWriter {
+	w.formatter = nil
+	if enable {
+		w.formatter = NewMsgpackFormatter()
+	}
+	return w
+}
+
+// SetFraming sets how records are delimited on the wire (chainable):
+// FrameDefault, FrameNewline or FrameLengthPrefix.  Must be called before
+// the first log message is written.
+func (w *SocketLogWriter) SetFraming(f Framing) *SocketLogWriter {
+	w.framing = f
+	return w
+}
+
+// SetMaxMessageLength truncates messages longer than max bytes, marking them
+// with a "…(truncated N bytes)" suffix (chainable).  Zero keeps messages
+// whole.  Must be called before the first log message is written.
+func (w *SocketLogWriter) SetMaxMessageLength(max int) *SocketLogWriter {
+	w.maxMessage = max
+	return w
+}
+
+// SetFlushInterval buffers writes to a tcp socket and flushes them at least
+// every interval (chainable).  Zero, the default, sends every record as soon
+// as it is logged.  udp sockets are never buffered, since that would merge
+// records into one datagram.  Must be called before the first log message is
+// written.
+func (w *SocketLogWriter) SetFlushInterval(interval time.Duration) *SocketLogWriter {
+	w.flushInterval = interval
+	return w
+}
+
+// SetBufferLength sets how many records can be queued for the socket before
+// LogWrite blocks (chainable), LogBufferLength by default.  Must be called
+// before the first log message is written.
+func (w *SocketLogWriter) SetBufferLength(n int) *SocketLogWriter {
+	setQueueLength(&w.rec, n)
+	return w
+}
+
+// SetOverflowPolicy sets what LogWrite does when the queue is full
+// (chainable): block, the default, or drop the new or the oldest record.
+// Must be called before the first log message is written.
+func (w *SocketLogWriter) SetOverflowPolicy(p OverflowPolicy) *SocketLogWriter {
+	w.overflow.policy = p
+	return w
+}
+
+// SetWriteTimeout sets how long a write to the socket may take before the
+// connection is given up and dialed again (chainable), so that a hung
+// collector does not block the writer forever.  Zero, the default, waits as
+// long as the write takes.  Must be called before the first log message is
+// written.
+func (w *SocketLogWriter) SetWriteTimeout(timeout time.Duration) *SocketLogWriter {
+	w.writeTimeout = timeout
+	return w
+}
+
+// SetReconnectDelay sets how long the writer waits before dialing again when
+// the connection drops (chainable).  It waits twice as long after each failed
+// attempt, up to max.  Zero keeps DefaultReconnectDelay or
+// DefaultMaxReconnectDelay.  Must be called before the first log message is
+// written.
+func (w *SocketLogWriter) SetReconnectDelay(delay, max time.Duration) *SocketLogWriter {
+	w.reconnectDelay, w.maxReconnectDelay = delay, max
+	return w
+}
+
+// SetSpool spools the records to the file at path when the queue is full,
+// e.g. while the connection is down, instead of blocking or dropping them
+// (chainable).  They are replayed in order once the records queued before
+// them are sent.  Records spooled beyond maxSize bytes are dropped (no limit
+// if zero), and counted by Dropped.  Records still spooled when the writer is
+// closed, with the connection down, are kept in the file and replayed by the
+// next writer spooling to it.  An error opening the file is reported and
+// leaves the writer without a spool.  Must be called before the first log
+// message is written.
+func (w *SocketLogWriter) SetSpool(path string, maxSize int64) *SocketLogWriter {
+	sp, err := openSpool(path, maxSize)
+	if err != nil {
+		reportError(fmt.Errorf("SetSpool(%q): %s", path, err))
+		return w
+	}
+	w.spool = sp
+	w.rec <- spoolSet
+	return w
+}
+
+// spoolSet is queued by SetSpool to tell the writer goroutine to read the
+// spool.
+var spoolSet = &LogRecord{}
+
+// Dropped returns the number of records dropped by the overflow policy, too
+// large for a datagram, or not sent when w was closed while disconnected.
+func (w *SocketLogWriter) Dropped() uint64 {
+	return w.overflow.count()
+}
+
+// QueueStats returns the depth, capacity and high-water mark of the queue.
+// Records spooled to disk, see SetSpool, are not counted.
+func (w *SocketLogWriter) QueueStats() QueueStats {
+	return w.overflow.stats(w.rec)
+}
+
+// DefaultDialTimeout is how long NewSocketLogWriter and
+// NewTLSSocketLogWriter wait for the connection, and the writers for each
+// attempt to reconnect.
+var DefaultDialTimeout = 30 * time.Second
+
+// NewSocketLogWriter connects to hostport over proto ("tcp" or "udp") and
+// returns a writer sending records there, or nil if the connection fails.
+// When the connection drops later, the writer reconnects, see
+// SetReconnectDelay.
+func NewSocketLogWriter(proto, hostport string) *SocketLogWriter {
+	return DialSocketLogWriter(&net.Dialer{Timeout: DefaultDialTimeout}, proto, hostport, nil)
+}
+
+// NewTLSSocketLogWriter connects to hostport over tcp with TLS and returns a
+// writer sending records there, or nil if the connection or the handshake
+// fails.  config sets the CA certificates trusted for the collector, and the
+// client certificate for mutual TLS; a nil config verifies the collector with
+// the system roots.
+func NewTLSSocketLogWriter(hostport string, config *tls.Config) *SocketLogWriter {
+	if config == nil {
+		config = &tls.Config{}
+	}
+	return DialSocketLogWriter(&net.Dialer{Timeout: DefaultDialTimeout}, "tcp", hostport, config)
+}
+
+// DialSocketLogWriter is NewSocketLogWriter, or NewTLSSocketLogWriter if
+// config is not nil, connecting with dialer, also when it reconnects.  The
+// dialer sets the connect timeout and the tcp keep-alive period, e.g.
+//
+//	w := log.DialSocketLogWriter(&net.Dialer{Timeout: 5 * time.Second, KeepAlive: time.Minute}, "tcp", "collector:5000", nil)
+func DialSocketLogWriter(dialer *net.Dialer, proto, hostport string, config *tls.Config) *SocketLogWriter {
+	dial := func() (net.Conn, error) { return dialer.Dial(proto, hostport) }
+	if config != nil {
+		dial = func() (net.Conn, error) { return tls.DialWithDialer(dialer, proto, hostport, config) }
+	}
+	sock, err := dial()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "NewSocketLogWriter(%q): %s\n", hostport, err)
 		return nil
 	}
+	return newSocketLogWriter(sock, dial, proto, hostport)
+}
 
-	w := SocketLogWriter(make(chan *LogRecord, LogBufferLength))
+// newSocketLogWriter returns a writer sending records to sock, connected to
+// hostport over proto, and dialing again after write errors.
+func newSocketLogWriter(sock net.Conn, dial func() (net.Conn, error), proto, hostport string) *SocketLogWriter {
+	w := &SocketLogWriter{
+		rec:     make(chan *LogRecord, LogBufferLength),
+		done:    make(chan struct{}),
+		closing: make(chan struct{}),
+	}
+	w.stats.setConnected(true)
 
+	queue := w.rec // the goroutine's copy, see SetBufferLength
 	go func() {
+		var (
+			flush    flushTicker
+			batches  flushTicker
+			started  bool
+			buffered bool
+			sp       *spool
+			waiting  []chan struct{} // Flush markers waiting for the spool to be replayed
+			c        = &socketConn{w: w, hostport: hostport, dial: dial, conn: sock}
+		)
+		defer close(w.done)
 		defer func() {
-			if sock != nil && proto == "tcp" {
-				sock.Close()
+			flush.stop()
+			batches.stop()
+			c.flush()
+			c.close()
+			if sp != nil {
+				if len(c.unsent) > 0 {
+					sp.prepend(c.unsent)
+				}
+				sp.close()
 			}
 		}()
 
-		for rec := range w {
-			// Marshall into JSON
-			js, err := json.Marshal(rec)
-			if err != nil {
-				fmt.Fprint(os.Stderr, "SocketLogWriter(%q): %s", hostport, err)
+		// emit sends rec, encoded as js, or adds it to the buffer
+		emit := func(rec *LogRecord, js []byte) {
+			c.add(rec, js)
+			if (!buffered || len(c.pending) >= DefaultFlushBufferSize) && !c.send() {
 				return
 			}
+			written(w, rec)
+		}
+
+		// write encodes rec and emits it
+		write := func(rec *LogRecord) {
+			if !started {
+				started = true
+				if w.flushInterval > 0 && proto == "tcp" {
+					buffered = true
+					flush.start(w.flushInterval)
+				}
+				batches.start(c.startBatches(proto))
+			}
 
-			_, err = sock.Write(js)
+			rec, js, err := w.encode(rec, hostport)
 			if err != nil {
-				fmt.Fprint(os.Stderr, "SocketLogWriter(%q): %s", hostport, err)
+				fmt.Fprintf(os.Stderr, "SocketLogWriter(%q): %s\n", hostport, err)
+				return
+			}
+			if js == nil {
+				// The encoding panicked, which was reported already
+				return
+			}
+
+			if proto != "udp" {
+				emit(rec, js)
 				return
 			}
+			recs, encs := w.fitDatagrams(rec, js, w.datagramSize(), hostport)
+			for i := range recs {
+				emit(recs[i], encs[i])
+			}
+		}
+
+		for {
+			if sp != nil && len(queue) == 0 && !c.gaveUp {
+				// The records queued before the spooled ones are sent
+				if recs := sp.next(); len(recs) > 0 {
+					for _, r := range recs {
+						write(r)
+					}
+					continue
+				}
+				if len(waiting) > 0 {
+					c.flush()
+					for _, flushed := range waiting {
+						close(flushed)
+					}
+					waiting = nil
+				}
+			}
+
+			select {
+			case <-flush.C():
+				c.flush()
+			case <-batches.C():
+				c.seal()
+				if !buffered {
+					c.send()
+				}
+			case <-sp.wakeC():
+			case r, ok := <-queue:
+				if !ok {
+					// Replay the spool first, unless the connection is down
+					for sp != nil && !c.gaveUp {
+						recs := sp.next()
+						if len(recs) == 0 {
+							break
+						}
+						for _, r := range recs {
+							write(r)
+						}
+					}
+					return
+				}
+				if r == nil {
+					// SetBufferLength replaced the channel
+					queue = w.rec
+					continue
+				}
+				if r == spoolSet {
+					sp = w.spool
+					c.spooling = true
+					continue
+				}
+				if r.flushed != nil {
+					// Flush: the records queued before r are sent, and
+					// those spooled since
+					c.flush()
+					if sp != nil && sp.spooled() {
+						waiting = append(waiting, r.flushed)
+					} else {
+						close(r.flushed)
+					}
+					continue
+				}
+				write(r)
+			}
 		}
 	}()
 
 	return w
 }
+
+// encode returns rec as sent to hostport, and its encoding.  A panic, e.g. in
+// the formatter, returns no encoding, see recoverWriter.
+func (w *SocketLogWriter) encode(rec *LogRecord, hostport string) (sent *LogRecord, js []byte, err error) {
+	defer recoverWriter("SocketLogWriter", hostport)
+	if w.utc {
+		rec = utcRecord(rec)
+	}
+	rec = truncateRecord(rec, w.maxMessage)
+
+	if w.formatter != nil {
+		js = w.formatter.Format(rec)
+		if w.raw {
+			js = trimNewline(js)
+		}
+		return rec, w.framing.frame(js), nil
+	}
+	// Marshall into JSON
+	if js, err = json.Marshal(rec); err != nil {
+		return rec, nil, err
+	}
+	return rec, w.framing.frame(js), nil
+}
+
+// Framing is how a SocketLogWriter delimits the records it sends, see
+// SetFraming.
+type Framing int
+
+const (
+	// FrameDefault sends each record as it is encoded: the formatters end
+	// records with a newline, unless SetRaw is set, and the default JSON
+	// encoding has none.  Over udp, each record is a datagram anyway.
+	FrameDefault Framing = iota
+
+	// FrameNewline ends every record with exactly one newline, for receivers
+	// of newline-delimited text or JSON, e.g. syslog over tcp or Logstash's
+	// json_lines codec.
+	FrameNewline
+
+	// FrameLengthPrefix sends the length of each record, without its
+	// trailing newline, as 4 bytes in big-endian order ahead of it, for
+	// binary encodings like MessagePack and receivers of length-prefixed
+	// frames.
+	FrameLengthPrefix
+)
+
+var framingNames = []string{"default", "newline", "length_prefix"}
+
+func (f Framing) String() string {
+	if f >= 0 && int(f) < len(framingNames) {
+		return framingNames[f]
+	}
+	return fmt.Sprintf("Framing(%d)", int(f))
+}
+
+// ParseFraming returns the framing named name: "default" (or empty),
+// "newline" or "length_prefix".
+func ParseFraming(name string) (Framing, error) {
+	if len(name) == 0 {
+		return FrameDefault, nil
+	}
+	for f, n := range framingNames {
+		if name == n {
+			return Framing(f), nil
+		}
+	}
+	return FrameDefault, fmt.Errorf("unknown framing %q", name)
+}
+
+// frame returns the encoding js of a record as sent with framing f.
+func (f Framing) frame(js []byte) []byte {
+	switch f {
+	case FrameNewline:
+		return append(trimNewline(js), '\n')
+	case FrameLengthPrefix:
+		js = trimNewline(js)
+		return append(appendBigEndian32(make([]byte, 0, 4+len(js)), uint32(len(js))), js...)
+	}
+	return js
+}
+
+// socketDialer returns the dialer of a socket in a configuration, with the
+// dial_timeout and keepalive properties.
+func socketDialer(filename, dialTimeout, keepAlive string) *net.Dialer {
+	dialer := &net.Dialer{
+		Timeout:   parseSocketDuration(filename, "dial_timeout", dialTimeout),
+		KeepAlive: parseSocketDuration(filename, "keepalive", keepAlive),
+	}
+	if dialer.Timeout == 0 {
+		dialer.Timeout = DefaultDialTimeout
+	}
+	return dialer
+}
+
+// parseFraming returns the framing named in a configuration, warning about
+// an unknown one.
+func parseFraming(filename, name string) Framing {
+	f, err := ParseFraming(name)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "LoadConfiguration: Warning: %s in %s, using the default\n", err, filename)
+	}
+	return f
+}
@@ -0,0 +1,95 @@
+package log4go
+
+import (
+	"expvar"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SocketStats reports the health of a SocketLogWriter, e.g. for a dashboard
+// to alert when log shipping degrades.
+type SocketStats struct {
+	Connected     bool      `json:"connected"`                 // The connection is up
+	Reconnects    uint64    `json:"reconnects"`                // Connections made again after one dropped
+	BytesSent     uint64    `json:"bytes_sent"`                // Bytes written to the connection, after framing and compression
+	RecordsSent   uint64    `json:"records_sent"`              // Records written to the connection
+	Dropped       uint64    `json:"dropped"`                   // Records dropped by the overflow policy, too large for a datagram, or unsent at Close
+	Queued        int       `json:"queued"`                    // Records waiting for the writer goroutine
+	Spooled       int64     `json:"spooled"`                   // Bytes waiting in the spool, see SetSpool
+	LastError     string    `json:"last_error,omitempty"`      // The last write or dial error
+	LastErrorTime time.Time `json:"last_error_time,omitempty"` // When LastError happened
+}
+
+// socketStats are the counters of a SocketLogWriter, updated by its
+// goroutine.
+type socketStats struct {
+	connected                uint32
+	reconnects, bytes, sends uint64
+
+	mu          sync.Mutex
+	lastErr     string
+	lastErrTime time.Time
+}
+
+func (s *socketStats) setConnected(up bool) {
+	var v uint32
+	if up {
+		v = 1
+	}
+	atomic.StoreUint32(&s.connected, v)
+}
+
+// fail records err as the last error.
+func (s *socketStats) fail(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastErr, s.lastErrTime = err.Error(), time.Now()
+}
+
+// Stats returns the connection state and the counters of w.
+func (w *SocketLogWriter) Stats() SocketStats {
+	s := &w.stats
+	stats := SocketStats{
+		Connected:   atomic.LoadUint32(&s.connected) == 1,
+		Reconnects:  atomic.LoadUint64(&s.reconnects),
+		BytesSent:   atomic.LoadUint64(&s.bytes),
+		RecordsSent: atomic.LoadUint64(&s.sends),
+		Dropped:     w.Dropped(),
+		Queued:      len(w.rec),
+	}
+	if sp := w.spool; sp != nil {
+		sp.mu.Lock()
+		stats.Spooled = sp.size - sp.offset
+		sp.mu.Unlock()
+	}
+	s.mu.Lock()
+	stats.LastError, stats.LastErrorTime = s.lastErr, s.lastErrTime
+	s.mu.Unlock()
+	return stats
+}
+
+// expvarSockets are the writers published by PublishExpvar, by name.
+var expvarSockets = struct {
+	sync.Mutex
+	writers map[string]*SocketLogWriter
+}{writers: map[string]*SocketLogWriter{}}
+
+// PublishExpvar publishes the Stats of w as the expvar name, served with the
+// other expvars at /debug/vars (chainable).  Publishing another writer under
+// the same name, e.g. after the configuration is reloaded, replaces w.  Like
+// expvar.Publish, it panics if other code published name already.
+func (w *SocketLogWriter) PublishExpvar(name string) *SocketLogWriter {
+	expvarSockets.Lock()
+	defer expvarSockets.Unlock()
+	if _, ok := expvarSockets.writers[name]; !ok {
+		expvar.Publish(name, expvar.Func(func() interface{} {
+			expvarSockets.Lock()
+			sw := expvarSockets.writers[name]
+			expvarSockets.Unlock()
+			return sw.Stats()
+		}))
+	}
+	expvarSockets.writers[name] = w
+	return w
+}
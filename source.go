@@ -0,0 +1,102 @@
+package log4go
+
+import (
+	"fmt"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// SetCaptureSource turns finding the caller of the messages logged for
+// category on or off.  It is on by default; walking the stack to the caller
+// is a large part of the cost of logging a message, so it can be turned off
+// for hot categories whose writers do not show %S or the source fields.
+// The records then have an empty Source and File and Line 0.  Like
+// SetLevel, it applies at once to LOGGER(category) and the filters derived
+// from it.  Messages logged through the Logger itself are given their source
+// unless every filter writing them has it turned off.
+func (log Logger) SetCaptureSource(category string, capture bool) error {
+	filt, ok := log.get(category)
+	if !ok {
+		return fmt.Errorf("no filter for category %q", category)
+	}
+	var nosource uint32
+	if !capture {
+		nosource = 1
+	}
+	atomic.StoreUint32(&filt.nosource, nosource)
+	return nil
+}
+
+// captureSource reports whether messages logged through f are given their
+// source.
+func (f *Filter) captureSource() bool {
+	return atomic.LoadUint32(&f.registered().nosource) == 0
+}
+
+// anyCaptureSource reports whether any of filters wants the source.
+func anyCaptureSource(filters []*Filter) bool {
+	for _, filt := range filters {
+		if filt.captureSource() {
+			return true
+		}
+	}
+	return false
+}
+
+// callerSite is the source, file and line of a call site.
+type callerSite struct {
+	src, file string
+	line      int
+}
+
+// callerSites maps the program counters of the call sites seen by caller to
+// their callerSite, so that the function name and the line of a call site
+// are looked up, and its source formatted, only the first time it logs.  The
+// map is copied when a site is added, under callerSitesMu, and read without
+// locking: a program has a bounded number of call sites, and the map soon
+// stops growing.
+var (
+	callerSites   atomic.Value // map[uintptr]callerSite
+	callerSitesMu sync.Mutex
+)
+
+// caller returns the source, file and line of the caller skip frames above
+// the caller of caller, as runtime.Caller does, or nothing if capture is
+// false.
+func caller(skip int, capture bool) (src, file string, line int) {
+	if !capture {
+		return "", "", 0
+	}
+	var pc [1]uintptr
+	if runtime.Callers(skip+2, pc[:]) == 0 {
+		return "", "", 0
+	}
+	sites, _ := callerSites.Load().(map[uintptr]callerSite)
+	site, ok := sites[pc[0]]
+	if !ok {
+		site = addCallerSite(pc[0])
+	}
+	return site.src, site.file, site.line
+}
+
+// addCallerSite looks up the call site at pc and adds it to callerSites.
+func addCallerSite(pc uintptr) callerSite {
+	frame, _ := runtime.CallersFrames([]uintptr{pc}).Next()
+	site := callerSite{file: frame.File, line: frame.Line}
+	if frame.PC != 0 {
+		site.src = frame.Function + ":" + strconv.Itoa(frame.Line)
+	}
+
+	callerSitesMu.Lock()
+	defer callerSitesMu.Unlock()
+	sites, _ := callerSites.Load().(map[uintptr]callerSite)
+	added := make(map[uintptr]callerSite, len(sites)+1)
+	for k, v := range sites {
+		added[k] = v
+	}
+	added[pc] = site
+	callerSites.Store(added)
+	return site
+}
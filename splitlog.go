@@ -0,0 +1,330 @@
+package log4go
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Per-level file name suffixes used by SplitFileLogWriter
+var splitLevelNames = [...]string{"finest", "fine", "debug", "trace", "info", "warn", "error", "critical", "panic", "fatal"}
+
+// SplitFileLogWriter routes each record to a separate file depending on its
+// level (e.g. app.error.log, app.warn.log, app.info.log), while sharing the
+// same format and rotation settings between all of the files.  The per-level
+// FileLogWriters are opened the first time a record of that level is written.
+type SplitFileLogWriter struct {
+	mu      sync.Mutex
+	writers map[Level]*FileLogWriter
+
+	// The base file name that the level names are inserted into
+	filename string
+
+	// Settings shared by every per-level FileLogWriter
+	opts            fileOptions
+	header, trailer string
+	daily           bool
+	rotate          bool
+	policy          RotationPolicy
+}
+
+// NewSplitFileLogWriter creates a new LogWriter which writes each level to its
+// own file derived from fname.  For fname "logs/app.log", ERROR records go to
+// "logs/app.error.log", WARNING records to "logs/app.warn.log" and so on.
+func NewSplitFileLogWriter(fname string, rotate bool, daily bool) *SplitFileLogWriter {
+	return &SplitFileLogWriter{
+		writers:  make(map[Level]*FileLogWriter),
+		filename: fname,
+		opts:     defaultFileOptions(),
+		daily:    daily,
+		rotate:   rotate,
+	}
+}
+
+// LevelFilename returns the name of the file that records at lvl are written to.
+func (w *SplitFileLogWriter) LevelFilename(lvl Level) string {
+	name := splitLevelName(lvl)
+	ext := filepath.Ext(w.filename)
+	return strings.TrimSuffix(w.filename, ext) + "." + name + ext
+}
+
+// This is the SplitFileLogWriter's output method
+func (w *SplitFileLogWriter) LogWrite(rec *LogRecord) {
+	if fw := w.writer(rec.Level); fw != nil {
+		fw.LogWrite(rec)
+	}
+}
+
+// Close closes every per-level file that has been opened.
+func (w *SplitFileLogWriter) Close() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for lvl, fw := range w.writers {
+		if fw != nil {
+			fw.Close()
+		}
+		delete(w.writers, lvl)
+	}
+}
+
+// Flush blocks until the records queued before the call are written to all
+// of the opened per-level logs.
+func (w *SplitFileLogWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, fw := range w.writers {
+		if fw != nil {
+			fw.Flush()
+		}
+	}
+}
+
+// Request that all of the opened per-level logs rotate
+func (w *SplitFileLogWriter) Rotate() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, fw := range w.writers {
+		if fw != nil {
+			fw.Rotate()
+		}
+	}
+}
+
+// RotateNow rotates all of the opened per-level logs, waiting for each rotation
+// to complete, and returns the first error encountered.
+func (w *SplitFileLogWriter) RotateNow() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var first error
+	for _, fw := range w.writers {
+		if fw == nil {
+			continue
+		}
+		if err := fw.RotateNow(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// writer returns the FileLogWriter for lvl, opening it if necessary.  A nil
+// writer is remembered so that a file which cannot be opened is not retried
+// for every record.
+func (w *SplitFileLogWriter) writer(lvl Level) *FileLogWriter {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	fw, ok := w.writers[lvl]
+	if !ok {
+		fw = NewFileLogWriter(w.LevelFilename(lvl), w.rotate, w.daily)
+		if fw != nil {
+			if err := w.opts.apply(fw); err != nil {
+				// Never fall back to writing the level in plain text
+				fmt.Fprintf(os.Stderr, "SplitFileLogWriter(%q): %s\n", w.filename, err)
+				fw.Close()
+				fw = nil
+			}
+		}
+		if fw != nil {
+			if w.policy != nil {
+				fw.SetRotationPolicy(w.policy)
+			}
+			if len(w.header) > 0 || len(w.trailer) > 0 {
+				fw.SetHeadFoot(w.header, w.trailer)
+			}
+		}
+		w.writers[lvl] = fw
+	}
+	return fw
+}
+
+// Set the logging format (chainable).  Must be called before the first log
+// message is written.
+func (w *SplitFileLogWriter) SetFormat(format string) *SplitFileLogWriter {
+	w.opts.format = format
+	cachedPattern(format) // compile now, so %g has goroutines from the start
+	return w
+}
+
+// SetJSON switches every per-level file between JSON output and the pattern
+// format (chainable).  Must be called before the first log message is written.
+func (w *SplitFileLogWriter) SetJSON(enable bool) *SplitFileLogWriter {
+	w.opts.formatter = nil
+	if enable {
+		w.opts.formatter = NewJSONFormatter()
+	}
+	return w
+}
+
+// SetLogfmt switches every per-level file between logfmt output and the
+// pattern format (chainable).  Must be called before the first log message is
+// written.
+func (w *SplitFileLogWriter) SetLogfmt(enable bool) *SplitFileLogWriter {
+	w.opts.formatter = nil
+	if enable {
+		w.opts.formatter = NewLogfmtFormatter()
+	}
+	return w
+}
+
+// SetFormatter sets a custom Formatter shared by every per-level file
+// (chainable).  It must be safe for concurrent use.  Must be called before the
+// first log message is written.
+func (w *SplitFileLogWriter) SetFormatter(f Formatter) *SplitFileLogWriter {
+	w.opts.formatter = f
+	return w
+}
+
+// Set the logfile header and footer (chainable).  Must be called before the
+// first log message is written.
+func (w *SplitFileLogWriter) SetHeadFoot(head, foot string) *SplitFileLogWriter {
+	w.header, w.trailer = head, foot
+	return w
+}
+
+// Set rotate at linecount (chainable). Must be called before the first log
+// message is written.
+func (w *SplitFileLogWriter) SetRotateLines(maxlines int) *SplitFileLogWriter {
+	w.opts.maxlines = maxlines
+	return w
+}
+
+// Set rotate at size (chainable). Must be called before the first log message
+// is written.
+func (w *SplitFileLogWriter) SetRotateSize(maxsize int) *SplitFileLogWriter {
+	w.opts.maxsize = maxsize
+	return w
+}
+
+// Set rotate daily (chainable). Must be called before the first log message is
+// written.
+func (w *SplitFileLogWriter) SetRotateDaily(daily bool) *SplitFileLogWriter {
+	w.daily = daily
+	return w
+}
+
+// Set max backup files. Must be called before the first log message
+// is written.
+func (w *SplitFileLogWriter) SetRotateMaxBackup(maxbackup int) *SplitFileLogWriter {
+	w.opts.maxbackup = maxbackup
+	return w
+}
+
+// SetRotate changes whether or not the old logs are kept. (chainable) Must be
+// called before the first log message is written.
+func (w *SplitFileLogWriter) SetRotate(rotate bool) *SplitFileLogWriter {
+	w.rotate = rotate
+	return w
+}
+
+// SetSanitize changes whether or not newline characters are escaped in
+// messages (chainable). Must be called before the first log message is written.
+func (w *SplitFileLogWriter) SetSanitize(sanitize bool) *SplitFileLogWriter {
+	w.opts.escape = EscapeNone
+	if sanitize {
+		w.opts.escape = EscapeNewline
+	}
+	return w
+}
+
+// SetRaw writes every per-level file without trailing newlines (chainable).
+func (w *SplitFileLogWriter) SetRaw(raw bool) *SplitFileLogWriter {
+	w.opts.raw = raw
+	return w
+}
+
+// SetMaxMessageLength truncates messages longer than max bytes in every
+// per-level file (chainable).
+func (w *SplitFileLogWriter) SetMaxMessageLength(max int) *SplitFileLogWriter {
+	w.opts.maxMessage = max
+	return w
+}
+
+// SetEscape sets how messages are escaped in every per-level file
+// (chainable).  Must be called before the first log message is written.
+func (w *SplitFileLogWriter) SetEscape(mode EscapeMode) *SplitFileLogWriter {
+	w.opts.escape = mode
+	return w
+}
+
+// SetCompression sets the compression applied to rotated backups of every
+// per-level file (chainable): "gzip", "zstd" or "none".
+func (w *SplitFileLogWriter) SetCompression(method string) *SplitFileLogWriter {
+	w.opts.compression = method
+	return w
+}
+
+// SetRotateTimestamp names backups of every per-level file after the time of
+// rotation instead of numbering them (chainable).
+func (w *SplitFileLogWriter) SetRotateTimestamp(timestamp bool) *SplitFileLogWriter {
+	w.opts.timestamp = timestamp
+	return w
+}
+
+// SetFlushInterval buffers writes to every per-level file and flushes them at
+// least every interval (chainable).
+func (w *SplitFileLogWriter) SetFlushInterval(interval time.Duration) *SplitFileLogWriter {
+	w.opts.flushInterval = interval
+	return w
+}
+
+// SetBufferLength sets how many records can be queued for every per-level
+// file (chainable), LogBufferLength by default.
+func (w *SplitFileLogWriter) SetBufferLength(n int) *SplitFileLogWriter {
+	w.opts.bufferLength = n
+	return w
+}
+
+// SetOverflowPolicy sets what happens to records logged while the queue of a
+// per-level file is full (chainable), see FileLogWriter.SetOverflowPolicy.
+func (w *SplitFileLogWriter) SetOverflowPolicy(p OverflowPolicy) *SplitFileLogWriter {
+	w.opts.overflow = p
+	return w
+}
+
+// Dropped returns the number of records dropped by the overflow policy of
+// the per-level files.
+func (w *SplitFileLogWriter) Dropped() uint64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var dropped uint64
+	for _, fw := range w.writers {
+		if fw != nil {
+			dropped += fw.Dropped()
+		}
+	}
+	return dropped
+}
+
+// SetRotationPolicy sets a custom rotation policy for every per-level file
+// (chainable).  The policy is shared between the files, so it must be safe
+// for concurrent use.
+func (w *SplitFileLogWriter) SetRotationPolicy(policy RotationPolicy) *SplitFileLogWriter {
+	w.policy = policy
+	return w
+}
+
+// SetUTC switches every per-level file between formatting times in UTC and
+// in local time (chainable).
+func (w *SplitFileLogWriter) SetUTC(utc bool) *SplitFileLogWriter {
+	w.opts.utc = utc
+	return w
+}
+
+// SetEncryptionKeySource encrypts every per-level file with the key fetched
+// from src, see FileLogWriter.SetEncryptionKey.  The key is checked right
+// away; a level whose file can't be encrypted is not written at all.  Must
+// be called before the first log message is written.
+func (w *SplitFileLogWriter) SetEncryptionKeySource(src KeySource) error {
+	key, err := src()
+	if err == nil {
+		_, err = newAEAD(key)
+	}
+	if err != nil {
+		return fmt.Errorf("SplitFileLogWriter(%q): %s", w.filename, err)
+	}
+	w.opts.keySource = src
+	return nil
+}
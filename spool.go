@@ -0,0 +1,202 @@
+package log4go
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// spoolChunk is how much of the spool file the writer goroutine replays at a
+// time, between the records it receives.
+const spoolChunk = 64 * 1024
+
+// spool is the file a SetSpool'd SocketLogWriter appends records to when its
+// queue is full, e.g. while the connection is down, one LogRecord as JSON per
+// line.  Once a record is in the spool, the next ones go there too, until the
+// writer goroutine has sent the records queued before them and replayed the
+// file, so that records are sent in order.  The file is emptied, not
+// removed, once replayed; records still in it when the writer is closed are
+// replayed by the next writer spooling to it.
+type spool struct {
+	path    string
+	maxSize int64 // Spooled records beyond this size are dropped (0 if unlimited)
+
+	mu     sync.Mutex
+	file   *os.File
+	size   int64 // Bytes in the file
+	offset int64 // Bytes replayed
+
+	wake chan struct{} // Tells the writer goroutine that records were spooled
+}
+
+// openSpool opens the spool file at path, which may hold records left by a
+// previous writer.
+func openSpool(path string, maxSize int64) (*spool, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0640)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	s := &spool{
+		path:    path,
+		maxSize: maxSize,
+		file:    file,
+		size:    fi.Size(),
+		wake:    make(chan struct{}, 1),
+	}
+	if s.size > 0 {
+		s.signal()
+	}
+	return s, nil
+}
+
+// wakeC returns the channel signalled when records are spooled, nil for no
+// spool.
+func (s *spool) wakeC() chan struct{} {
+	if s == nil {
+		return nil
+	}
+	return s.wake
+}
+
+func (s *spool) signal() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// send queues rec, or spools it if the queue is full or records are spooled
+// already.
+func (s *spool) send(queue chan *LogRecord, rec *LogRecord, o *overflow) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.offset == s.size {
+		select {
+		case queue <- rec:
+			o.mark(len(queue))
+			return
+		default:
+		}
+	}
+	if !s.append(rec) {
+		o.drop(1)
+		return
+	}
+	s.signal()
+}
+
+// append writes rec at the end of the spool, and reports whether it did.
+// s.mu is held.
+func (s *spool) append(rec *LogRecord) bool {
+	js, err := json.Marshal(rec)
+	if err != nil {
+		reportError(fmt.Errorf("spool %s: %s, record dropped", s.path, err))
+		return false
+	}
+	js = append(js, '\n')
+	if s.maxSize > 0 && s.size+int64(len(js)) > s.maxSize {
+		return false
+	}
+	if _, err := s.file.WriteAt(js, s.size); err != nil {
+		reportError(fmt.Errorf("spool %s: %s, record dropped", s.path, err))
+		return false
+	}
+	s.size += int64(len(js))
+	return true
+}
+
+// spooled reports whether records are waiting in the spool.
+func (s *spool) spooled() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.offset < s.size
+}
+
+// next returns the next spooled records, removing them from the spool, or
+// none if it is empty.
+func (s *spool) next() []*LogRecord {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var chunk []byte
+	for n := spoolChunk; s.offset < s.size; n *= 2 {
+		if rest := s.size - s.offset; int64(n) > rest {
+			n = int(rest)
+		}
+		chunk = make([]byte, n)
+		if _, err := s.file.ReadAt(chunk, s.offset); err != nil {
+			reportError(fmt.Errorf("spool %s: %s, spooled records dropped", s.path, err))
+			s.reset()
+			return nil
+		}
+		if end := bytes.LastIndexByte(chunk, '\n'); end >= 0 {
+			chunk = chunk[:end+1]
+			break
+		}
+		if s.offset+int64(n) == s.size {
+			break // The last line is cut short
+		}
+	}
+
+	s.offset += int64(len(chunk))
+	if s.offset == s.size {
+		s.reset()
+	}
+
+	var recs []*LogRecord
+	for _, line := range bytes.Split(bytes.TrimSuffix(chunk, []byte("\n")), []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		rec := &LogRecord{}
+		if err := json.Unmarshal(line, rec); err != nil {
+			reportError(fmt.Errorf("spool %s: %s, spooled record dropped", s.path, err))
+			continue
+		}
+		recs = append(recs, rec)
+	}
+	return recs
+}
+
+// prepend puts recs back at the head of the spool, ahead of the records
+// spooled after them.
+func (s *spool) prepend(recs []*LogRecord) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rest := make([]byte, s.size-s.offset)
+	if _, err := s.file.ReadAt(rest, s.offset); err != nil {
+		reportError(fmt.Errorf("spool %s: %s, spooled records dropped", s.path, err))
+		rest = nil
+	}
+	s.reset()
+	for _, rec := range recs {
+		s.append(rec)
+	}
+	if _, err := s.file.WriteAt(rest, s.size); err != nil {
+		reportError(fmt.Errorf("spool %s: %s, spooled records dropped", s.path, err))
+		return
+	}
+	s.size += int64(len(rest))
+}
+
+// reset empties the spool file.  s.mu is held.
+func (s *spool) reset() {
+	s.offset, s.size = 0, 0
+	if err := s.file.Truncate(0); err != nil {
+		reportError(fmt.Errorf("spool %s: %s", s.path, err))
+	}
+}
+
+func (s *spool) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.file.Close()
+}
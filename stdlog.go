@@ -0,0 +1,89 @@
+package log4go
+
+import (
+	"bytes"
+	stdlog "log"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// NewStdLogger returns a *log.Logger logging each message at lvl, for
+// libraries that log through the standard library (http.Server.ErrorLog,
+// httputil.ReverseProxy.ErrorLog, ...).  With a category the records are
+// routed like those of LOGGER(category), otherwise they go to every filter,
+// like Log.
+//
+//	srv := &http.Server{ErrorLog: log.Global.NewStdLogger("http", log.ERROR)}
+//
+// Unlike a *log.Logger writing to a LineWriter, a message of several lines,
+// e.g. with a stack trace, is logged as a single record, and the file and
+// line of the call to the *log.Logger, which it is created to prefix the
+// messages with (log.Llongfile), become the File, Line and Source of the
+// record.  Other flags or a prefix set on it are left in the messages.
+func (log Logger) NewStdLogger(category string, lvl Level) *stdlog.Logger {
+	return stdlog.New(&stdWriter{log: log, lvl: lvl, category: category}, "", stdlog.Llongfile)
+}
+
+// replaceStdLog redirects the standard logger into log, see ReplaceStdLog.
+func (log Logger) replaceStdLog(lvl Level) (restore func()) {
+	out, flags, prefix := stdlog.Writer(), stdlog.Flags(), stdlog.Prefix()
+	stdlog.SetOutput(&stdWriter{log: log, lvl: lvl})
+	stdlog.SetFlags(stdlog.Llongfile)
+	stdlog.SetPrefix("")
+	return func() {
+		stdlog.SetOutput(out)
+		stdlog.SetFlags(flags)
+		stdlog.SetPrefix(prefix)
+	}
+}
+
+// stdWriter is the output of the *log.Logger of NewStdLogger.  The logger
+// writes each message with a single Write, which is logged as one record.
+type stdWriter struct {
+	log      Logger
+	lvl      Level
+	category string
+}
+
+func (w *stdWriter) Write(p []byte) (int, error) {
+	msg := bytes.TrimSuffix(p, []byte{'\n'})
+	file, line, msg := splitStdSource(msg)
+	rec := &LogRecord{
+		Level:     w.lvl,
+		Created:   time.Now(),
+		File:      file,
+		Line:      line,
+		Message:   string(msg),
+		Category:  w.category,
+		Goroutine: currentGoroutine(),
+		Fields:    withMDC(nil),
+	}
+	if len(file) > 0 {
+		rec.Source = filepath.Base(file) + ":" + strconv.Itoa(line)
+	}
+	w.log.Ingest([]*LogRecord{rec})
+	return len(p), nil
+}
+
+// splitStdSource splits the "/path/file.go:23: " prefix of log.Llongfile, or
+// of log.Lshortfile, off msg.  msg is returned as is without the prefix.
+func splitStdSource(msg []byte) (file string, line int, rest []byte) {
+	i := bytes.Index(msg, []byte(".go:"))
+	if i < 0 {
+		return "", 0, msg
+	}
+	j := i + len(".go:")
+	k := j
+	for k < len(msg) && '0' <= msg[k] && msg[k] <= '9' {
+		k++
+	}
+	if k == j || !bytes.HasPrefix(msg[k:], []byte(": ")) {
+		return "", 0, msg
+	}
+	line, err := strconv.Atoi(string(msg[j:k]))
+	if err != nil {
+		return "", 0, msg
+	}
+	return string(msg[:j-1]), line, msg[k+2:]
+}
@@ -0,0 +1,63 @@
+package log4go
+
+import (
+	"fmt"
+	"os"
+	"runtime/debug"
+	"sync/atomic"
+)
+
+// errorHandler holds the func(error) set by SetErrorHandler.
+var errorHandler atomic.Value
+
+// SetErrorHandler sets the function told about the failures that logging
+// cannot report through itself, e.g. a writer goroutine panicking while
+// writing a record (a *WriterPanic).  They are printed to standard error by
+// default; nil restores that.  h is called from the writer goroutines, so it
+// must not log through the writer that failed.
+func SetErrorHandler(h func(err error)) {
+	errorHandler.Store(h)
+}
+
+// ReportError passes err to the function set by SetErrorHandler, for the
+// writers of other packages, e.g. grpcsink, to report their failures like
+// those of this package.
+func ReportError(err error) {
+	reportError(err)
+}
+
+// reportError passes err to the error handler.
+func reportError(err error) {
+	if h, _ := errorHandler.Load().(func(error)); h != nil {
+		h(err)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "log4go: %s\n", err)
+}
+
+// A WriterPanic reports that a writer goroutine panicked, e.g. in a custom
+// Formatter or RotationPolicy.  The record being written is dropped, and the
+// goroutine goes on with the next one.
+type WriterPanic struct {
+	Writer string      // The writer, e.g. `FileLogWriter("app.log")`
+	Value  interface{} // The value passed to panic
+	Stack  []byte      // The stack of the goroutine when it panicked
+}
+
+func (p *WriterPanic) Error() string {
+	return fmt.Sprintf("%s: panic writing a record, dropped: %v", p.Writer, p.Value)
+}
+
+// recoverWriter is deferred by the writer goroutines around each record they
+// write.  It recovers from a panic and reports it, so that the goroutine
+// keeps writing the next records instead of exiting, after which logging
+// would block on the full queue or the records would vanish.
+func recoverWriter(kind, name string) {
+	if e := recover(); e != nil {
+		reportError(&WriterPanic{
+			Writer: fmt.Sprintf("%s(%q)", kind, name),
+			Value:  e,
+			Stack:  debug.Stack(),
+		})
+	}
+}
@@ -3,18 +3,26 @@
 package log4go
 
 import (
-	"fmt"
 	"io"
 	"os"
-	"time"
 )
 
 var stdout io.Writer = os.Stdout
 
 // This is the standard writer that prints to standard output.
 type ConsoleLogWriter struct {
-	format string
-	w      chan *LogRecord
+	format     string
+	formatter  Formatter
+	utc        bool
+	escape     EscapeMode
+	maxMessage int
+	raw        bool
+	w          chan *LogRecord
+	done       chan struct{} // closed when the writer goroutine has finished
+	overflow   overflow
+
+	// The time codes of the last second formatted, for the writer goroutine
+	timeCache *formatCacheType
 }
 
 // This creates a new ConsoleLogWriter
@@ -22,28 +30,154 @@ func NewConsoleLogWriter() *ConsoleLogWriter {
 	consoleWriter := &ConsoleLogWriter{
 		format: "[%T %D] [%C] [%L] (%S) %M",
 		w:      make(chan *LogRecord, LogBufferLength),
+		done:   make(chan struct{}),
 	}
-	go consoleWriter.run(stdout)
+	go consoleWriter.run(consoleWriter.w, stdout)
 	return consoleWriter
 }
 func (c *ConsoleLogWriter) SetFormat(format string) {
 	c.format = format
+	cachedPattern(format) // compile now, so %g has goroutines from the start
+}
+
+// SetFormatter sets a custom Formatter used instead of the pattern format.  A
+// nil Formatter restores the pattern format.
+func (c *ConsoleLogWriter) SetFormatter(f Formatter) {
+	c.formatter = f
+}
+
+// SetLogfmt switches between logfmt output (see LogfmtFormatter) and the
+// pattern format.
+func (c *ConsoleLogWriter) SetLogfmt(enable bool) {
+	c.formatter = nil
+	if enable {
+		c.formatter = NewLogfmtFormatter()
+	}
 }
-func (c *ConsoleLogWriter) run(out io.Writer) {
-	for rec := range c.w {
-		fmt.Fprint(out, FormatLogRecord(c.format, rec))
+
+// SetJSON switches between JSON output (one object per line, see
+// JSONFormatter) and the pattern format.
+func (c *ConsoleLogWriter) SetJSON(enable bool) {
+	c.formatter = nil
+	if enable {
+		c.formatter = NewJSONFormatter()
+	}
+}
+
+// SetPretty switches between the human friendly PrettyFormatter output (for
+// local development) and the pattern format.
+func (c *ConsoleLogWriter) SetPretty(enable bool) {
+	c.formatter = nil
+	if enable {
+		c.formatter = NewPrettyFormatter(stdout == os.Stdout)
+	}
+}
+
+// SetUTC switches between formatting times in UTC and in local time.
+func (c *ConsoleLogWriter) SetUTC(utc bool) {
+	c.utc = utc
+}
+
+// SetRaw writes each formatted record without the trailing newline.
+func (c *ConsoleLogWriter) SetRaw(raw bool) {
+	c.raw = raw
+}
+
+// SetMaxMessageLength truncates messages longer than max bytes, marking them
+// with a "…(truncated N bytes)" suffix.  Zero keeps messages whole.
+func (c *ConsoleLogWriter) SetMaxMessageLength(max int) {
+	c.maxMessage = max
+}
+
+// SetEscape sets how messages are escaped.
+func (c *ConsoleLogWriter) SetEscape(mode EscapeMode) {
+	c.escape = mode
+}
+
+// SetBufferLength sets how many records can be queued for the console before
+// LogWrite blocks, LogBufferLength by default.  Must be called before the
+// first log message is written.
+func (c *ConsoleLogWriter) SetBufferLength(n int) {
+	setQueueLength(&c.w, n)
+}
+
+// SetOverflowPolicy sets what LogWrite does when the queue is full: block, the
+// default, or drop the new or the oldest record.  Must be called before the
+// first log message is written.
+func (c *ConsoleLogWriter) SetOverflowPolicy(p OverflowPolicy) {
+	c.overflow.policy = p
+}
+
+// Dropped returns the number of records dropped by the overflow policy.
+func (c *ConsoleLogWriter) Dropped() uint64 {
+	return c.overflow.count()
+}
+
+// QueueStats returns the depth, capacity and high-water mark of the queue.
+func (c *ConsoleLogWriter) QueueStats() QueueStats {
+	return c.overflow.stats(c.w)
+}
+
+// run writes the records from queue, c.w when it was started, to out.
+func (c *ConsoleLogWriter) run(queue chan *LogRecord, out io.Writer) {
+	defer close(c.done)
+	for {
+		rec, ok := <-queue
+		if !ok {
+			return
+		}
+		if rec == nil {
+			// SetBufferLength replaced the channel
+			queue = c.w
+			continue
+		}
+		if rec.flushed != nil {
+			close(rec.flushed)
+			continue
+		}
+		c.writeRecord(rec, out)
+	}
+}
+
+// writeRecord writes rec to out.  A panic, e.g. in the formatter, drops rec,
+// see recoverWriter.
+func (c *ConsoleLogWriter) writeRecord(rec *LogRecord, out io.Writer) {
+	defer recoverWriter("ConsoleLogWriter", "stdout")
+	if c.utc {
+		rec = utcRecord(rec)
+	}
+	rec = escapeRecord(truncateRecord(rec, c.maxMessage), c.escape)
+	var b []byte
+	if c.formatter != nil {
+		b = c.formatter.Format(rec)
+	} else {
+		buf := formatBuffers.Get().(*[]byte)
+		b = appendFormat((*buf)[:0], c.format, rec, &c.timeCache)
+		defer putFormatBuffer(buf, b)
+	}
+	if c.raw {
+		b = trimNewline(b)
+	}
+	if _, err := out.Write(b); err == nil {
+		written(c, rec)
 	}
 }
 
 // This is the ConsoleLogWriter's output method.  This will block if the output
-// buffer is full.
+// buffer is full, unless an overflow policy drops records.
 func (c *ConsoleLogWriter) LogWrite(rec *LogRecord) {
-	c.w <- rec
+	c.overflow.send(c.w, rec)
+}
+
+// Flush blocks until the records queued before the call are written.
+func (c *ConsoleLogWriter) Flush() {
+	flushQueue(c.w, c.done)
 }
 
-// Close stops the logger from sending messages to standard output.  Attempts to
-// send log messages to this logger after a Close have undefined behavior.
+// Close stops the logger from sending messages to standard output, once the
+// queued ones are written.  Attempts to send log messages to this logger after
+// a Close have undefined behavior.
 func (c *ConsoleLogWriter) Close() {
 	close(c.w)
-	time.Sleep(50 * time.Millisecond) // Try to give console I/O time to complete
+	<-c.done
 }
@@ -0,0 +1,82 @@
+package log4go
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+)
+
+// socketTLS holds the TLS settings of a socket writer in a configuration.
+type socketTLS struct {
+	enable     bool
+	cert, key  string // Client certificate and key files for mutual TLS
+	ca         string // CA certificates file trusted for the collector, the system roots if empty
+	serverName string // Name verified in the collector's certificate, the host of the address if empty
+	insecure   bool   // Skip verifying the collector's certificate
+}
+
+// set reports whether any TLS setting is given.
+func (st socketTLS) set() bool {
+	return st.enable || len(st.cert) > 0 || len(st.key) > 0 || len(st.ca) > 0 ||
+		len(st.serverName) > 0 || st.insecure
+}
+
+// check returns an error for settings that cannot be used to connect over
+// proto.  The certificates are checked by config.
+func (st socketTLS) check(proto string) error {
+	if !st.enable && st.set() {
+		return errors.New("tls settings without tls enabled")
+	}
+	if st.enable && proto == "udp" {
+		return errors.New("tls requires the tcp protocol")
+	}
+	return nil
+}
+
+// config loads the certificates and returns the tls.Config to connect with.
+func (st socketTLS) config() (*tls.Config, error) {
+	config := &tls.Config{
+		ServerName:         st.serverName,
+		InsecureSkipVerify: st.insecure,
+	}
+	if len(st.cert) > 0 || len(st.key) > 0 {
+		if len(st.cert) == 0 || len(st.key) == 0 {
+			return nil, errors.New("tls_cert and tls_key must be set together")
+		}
+		cert, err := tls.LoadX509KeyPair(st.cert, st.key)
+		if err != nil {
+			return nil, fmt.Errorf("tls_cert: %s", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	if len(st.ca) > 0 {
+		pem, err := ioutil.ReadFile(st.ca)
+		if err != nil {
+			return nil, fmt.Errorf("tls_ca: %s", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("tls_ca: no certificate found in %s", st.ca)
+		}
+	}
+	return config, nil
+}
+
+// dial returns a writer connected to hostport over proto with dialer, with
+// TLS if it is enabled, or nil.
+func (st socketTLS) dial(dialer *net.Dialer, proto, hostport string) (*SocketLogWriter, error) {
+	if err := st.check(proto); err != nil {
+		return nil, err
+	}
+	if !st.enable {
+		return DialSocketLogWriter(dialer, proto, hostport, nil), nil
+	}
+	config, err := st.config()
+	if err != nil {
+		return nil, err
+	}
+	return DialSocketLogWriter(dialer, proto, hostport, config), nil
+}
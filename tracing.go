@@ -0,0 +1,47 @@
+package log4go
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// TraceIDKey and SpanIDKey are the fields under which WithContext attaches the
+// ids of the active span, shown by %I and %i.
+const (
+	TraceIDKey = "trace_id"
+	SpanIDKey  = "span_id"
+)
+
+// A SpanExtractor returns the trace and span ids of the span active in ctx,
+// or empty strings if there is none.
+type SpanExtractor func(ctx context.Context) (traceID, spanID string)
+
+// spanExtractor holds the SpanExtractor set by SetSpanExtractor.
+var spanExtractor atomic.Value
+
+// SetSpanExtractor sets how WithContext finds the span active in a context.
+// Building with the log4go_otel tag sets an extractor for OpenTelemetry
+// spans; other tracers can set their own.  nil disables the lookup.
+func SetSpanExtractor(extract SpanExtractor) {
+	spanExtractor.Store(extract)
+}
+
+// WithContext returns a copy of the filter that attaches the trace and span
+// ids of the span active in ctx, as the fields TraceIDKey and SpanIDKey, to
+// every record it logs, so that logs can be correlated with traces.  Without
+// an active span it returns f.
+func (f *Filter) WithContext(ctx context.Context) *Filter {
+	extract, _ := spanExtractor.Load().(SpanExtractor)
+	if extract == nil || ctx == nil {
+		return f
+	}
+	traceID, spanID := extract(ctx)
+	if len(traceID) == 0 {
+		return f
+	}
+	fields := Fields{TraceIDKey: traceID}
+	if len(spanID) > 0 {
+		fields[SpanIDKey] = spanID
+	}
+	return f.WithFields(fields)
+}
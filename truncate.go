@@ -0,0 +1,31 @@
+package log4go
+
+import (
+	"strconv"
+	"unicode/utf8"
+)
+
+// truncateMessage shortens msg to at most max bytes, cut at a character
+// boundary, followed by a marker saying how much was dropped.  A max of zero
+// or less disables truncation.
+func truncateMessage(msg string, max int) string {
+	if max <= 0 || len(msg) <= max {
+		return msg
+	}
+	cut := max
+	for cut > 0 && !utf8.RuneStart(msg[cut]) {
+		cut--
+	}
+	return msg[:cut] + "…(truncated " + strconv.Itoa(len(msg)-cut) + " bytes)"
+}
+
+// truncateRecord returns rec with its message truncated to max bytes, copying
+// it if needed so that records shared with other writers are left alone.
+func truncateRecord(rec *LogRecord, max int) *LogRecord {
+	if max <= 0 || len(rec.Message) <= max {
+		return rec
+	}
+	truncated := *rec
+	truncated.Message = truncateMessage(rec.Message, max)
+	return &truncated
+}
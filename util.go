@@ -1,9 +1,22 @@
 package log4go
 
-import "fmt"
+// firstString returns the first of the optional arguments s, or "".
+func firstString(s []string) string {
+	if len(s) == 0 {
+		return ""
+	}
+	return s[0]
+}
 
-func recoverPanic() {
-	if e := recover(); e != nil {
-		fmt.Printf("Panicing %s\n", e)
+// setQueueLength replaces the record channel *queue of a writer with one
+// buffering n records, for the SetBufferLength methods.  A nil record sent on
+// the old channel tells the writer goroutine to switch to the new one; records
+// queued before it are still written.
+func setQueueLength(queue *chan *LogRecord, n int) {
+	if n < 0 {
+		n = 0
 	}
+	old := *queue
+	*queue = make(chan *LogRecord, n)
+	old <- nil
 }
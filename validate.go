@@ -0,0 +1,455 @@
+package log4go
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// An Issue is a problem found by ValidateConfiguration.
+type Issue struct {
+	Entry   string // The config entry, e.g. "files[2]" or "filter[0] (stdout)"
+	Message string
+}
+
+func (i Issue) String() string {
+	if len(i.Entry) == 0 {
+		return i.Message
+	}
+	return i.Entry + ": " + i.Message
+}
+
+// ValidateConfiguration checks the configuration in path, as LoadConfiguration
+// would load it, without setting up any writer, so that CI can verify it
+// before a deploy.  It checks levels, patterns and other values, that the
+// log files can be written, socket addresses and category patterns.
+// The error is for a configuration that cannot be read or parsed at all.
+// types are as for LoadConfiguration.
+//
+//	issues, err := log.ValidateConfiguration("conf/log4go.json")
+//	for _, issue := range issues {
+//		fmt.Println(issue)
+//	}
+func ValidateConfiguration(path string, types ...string) ([]Issue, error) {
+	format := "json"
+	if strings.EqualFold(filepath.Ext(path), ".xml") || isXMLContent(path) {
+		format = "xml"
+	} else if isYAMLFile(strings.ToLower(path)) {
+		format = "yaml"
+	}
+	if len(types) > 0 {
+		format = types[0]
+	}
+	profile := ""
+	if len(types) > 1 {
+		profile = types[1]
+	}
+
+	content := path
+	if !isXMLContent(path) && !strings.Contains(path, "\n") && !json.Valid([]byte(path)) {
+		var err error
+		if content, err = ReadFile(path); err != nil {
+			return nil, err
+		}
+	}
+	content = expandConfigEnv(content)
+
+	var v configValidator
+	switch format {
+	case "xml":
+		xc := new(xmlLoggerConfig)
+		if err := xml.Unmarshal([]byte(content), xc); err != nil {
+			return nil, fmt.Errorf("could not parse XML configuration: %s", err)
+		}
+		v.checkXML(xc)
+	case "yaml", "yml":
+		var lc LogConfig
+		if err := decodeYAMLConfig(content, profile, &lc); err != nil {
+			return nil, fmt.Errorf("could not parse yaml configuration: %s", err)
+		}
+		v.checkConfig(&lc)
+	default:
+		var lc LogConfig
+		if err := decodeJSONConfig([]byte(content), profile, &lc); err != nil {
+			return nil, fmt.Errorf("could not parse json configuration: %s", err)
+		}
+		v.checkConfig(&lc)
+	}
+	return v.issues, nil
+}
+
+type configValidator struct {
+	issues []Issue
+}
+
+func (v *configValidator) add(entry, format string, args ...interface{}) {
+	v.issues = append(v.issues, Issue{Entry: entry, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *configValidator) checkConfig(lc *LogConfig) {
+	for level := range lc.LevelNames {
+		if _, ok := configLevel(level); !ok {
+			v.add("level_names", "unknown level %q", level)
+		}
+	}
+
+	for i, rc := range lc.Redact {
+		v.checkRedact(fmt.Sprintf("redact[%d]", i), rc)
+	}
+
+	if cf := lc.Console; cf != nil {
+		v.checkLevel("console", cf.Level)
+		v.checkMaxLevel("console", cf.Level, cf.MaxLevel)
+		v.checkMessageFilters("console", cf.Allow, cf.Deny)
+		v.checkPattern("console", cf.Pattern)
+		v.checkOneOf("console", "format", cf.Format, "", "json", "logfmt", "pretty")
+		v.checkEscape("console", cf.Escape)
+		v.checkOverflow("console", cf.Overflow)
+	}
+
+	for i, fc := range lc.Files {
+		entry := fmt.Sprintf("files[%d]", i)
+		v.checkLevel(entry, fc.Level)
+		v.checkMaxLevel(entry, fc.Level, fc.MaxLevel)
+		v.checkMessageFilters(entry, fc.Allow, fc.Deny)
+		v.checkRateLimit(entry, fc.RateLimit, fc.RateBurst)
+		v.checkPattern(entry, fc.Pattern)
+		v.checkOneOf(entry, "format", fc.Format, "", "json", "logfmt")
+		v.checkEscape(entry, fc.Escape)
+		v.checkOneOf(entry, "compression", fc.Compression, "", "none", "gzip", "zstd")
+		v.checkDuration(entry, "flush_interval", fc.FlushInterval)
+		v.checkOverflow(entry, fc.Overflow)
+		v.checkKey(entry, fileKeySource(fc.EncryptKeyEnv, fc.EncryptKeyFile))
+
+		file := fc.Filename
+		if len(file) == 0 {
+			file = "app.log"
+		}
+		v.checkWritable(entry, expandFilename(file))
+		if categories, ok := lc.fileCategories(fc); !ok {
+			v.add(entry, "no category")
+		} else if fc.Enable {
+			for _, category := range categories {
+				v.checkCategory(entry, category)
+			}
+		}
+	}
+
+	for i, sc := range lc.Sockets {
+		entry := fmt.Sprintf("sockets[%d]", i)
+		v.checkLevel(entry, sc.Level)
+		v.checkMaxLevel(entry, sc.Level, sc.MaxLevel)
+		v.checkMessageFilters(entry, sc.Allow, sc.Deny)
+		v.checkRateLimit(entry, sc.RateLimit, sc.RateBurst)
+		v.checkPattern(entry, sc.Pattern)
+		v.checkOneOf(entry, "format", sc.Format, "", "json", "logfmt", "msgpack", "pattern")
+		v.checkFraming(entry, sc.Format, sc.Framing)
+		v.checkOneOf(entry, "protocol", sc.Protocol, "", "tcp", "udp")
+		v.checkDuration(entry, "flush_interval", sc.FlushInterval)
+		if sc.MaxDatagramSize < 0 {
+			v.add(entry, "negative max_datagram_size %d", sc.MaxDatagramSize)
+		}
+		v.checkOneOf(entry, "datagram_policy", sc.DatagramPolicy, "", "truncate", "split")
+		v.checkDuration(entry, "dial_timeout", sc.DialTimeout)
+		v.checkDuration(entry, "write_timeout", sc.WriteTimeout)
+		v.checkDuration(entry, "keepalive", sc.KeepAlive)
+		v.checkDuration(entry, "reconnect_delay", sc.ReconnectDelay)
+		v.checkDuration(entry, "max_reconnect_delay", sc.MaxReconnectDelay)
+		v.checkDuration(entry, "batch_interval", sc.BatchInterval)
+		if sc.BatchRecords < 0 {
+			v.add(entry, "negative batch_records %d", sc.BatchRecords)
+		}
+		v.checkOneOf(entry, "compression", sc.Compression, "", "none", "gzip", "zstd")
+		if len(sc.Spool) > 0 {
+			v.checkWritable(entry, expandFilename(sc.Spool))
+		}
+		v.checkOverflow(entry, sc.Overflow)
+		v.checkAddr(entry, sc.Addr)
+		v.checkTLS(entry, sc.tls(), sc.Protocol)
+		if category, ok := lc.resolveCategory(sc.Category, ""); !ok {
+			v.add(entry, "no category")
+		} else if sc.Enable {
+			v.checkCategory(entry, category)
+		}
+	}
+}
+
+func (v *configValidator) checkXML(xc *xmlLoggerConfig) {
+	for _, prop := range xc.LevelName {
+		if _, ok := configLevel(prop.Name); !ok {
+			v.add("levelname", "unknown level %q", prop.Name)
+		}
+	}
+
+	for i, xr := range xc.Redact {
+		v.checkRedact(fmt.Sprintf("redact[%d]", i), xr.config())
+	}
+
+	for i, xf := range xc.Filter {
+		entry := fmt.Sprintf("filter[%d]", i)
+		if len(xf.Tag) > 0 {
+			entry += " (" + xf.Tag + ")"
+		}
+		if len(xf.Enabled) == 0 {
+			v.add(entry, "missing enabled attribute")
+		}
+		if len(xf.Tag) == 0 {
+			v.add(entry, "missing <tag>")
+		}
+		if len(xf.Level) == 0 {
+			v.add(entry, "missing <level>")
+		} else {
+			v.checkLevel(entry, xf.Level)
+		}
+		v.checkMaxLevel(entry, xf.Level, xf.MaxLevel)
+
+		props := map[string]string{}
+		var allow, deny []string
+		for _, prop := range xf.Property {
+			props[prop.Name] = strings.Trim(prop.Value, " \r\n")
+			switch prop.Name {
+			case "allow":
+				allow = append(allow, props[prop.Name])
+			case "deny":
+				deny = append(deny, props[prop.Name])
+			}
+		}
+		v.checkMessageFilters(entry, allow, deny)
+		if value, ok := props["rate_limit"]; ok {
+			if rate, err := strconv.ParseFloat(value, 64); err != nil {
+				v.add(entry, "invalid rate_limit %q", value)
+			} else {
+				v.checkRateLimit(entry, rate, 0)
+			}
+		}
+		if value, ok := props["rate_burst"]; ok {
+			if burst, err := strconv.Atoi(value); err != nil {
+				v.add(entry, "invalid rate_burst %q", value)
+			} else {
+				v.checkRateLimit(entry, 0, burst)
+			}
+		}
+		if format, ok := props["format"]; ok && format != "json" && format != "logfmt" && (xf.Type != "console" || format != "pretty") && xf.Type != "socket" {
+			v.checkPattern(entry, format)
+		}
+		v.checkEscape(entry, props["escape"])
+		v.checkDuration(entry, "flush_interval", props["flush_interval"])
+		v.checkOverflow(entry, props["overflow"])
+
+		name := xf.Tag
+		switch xf.Type {
+		case "console":
+		case "file", "xml":
+			if len(props["filename"]) == 0 {
+				v.add(entry, "missing filename property")
+			} else {
+				v.checkWritable(entry, expandFilename(props["filename"]))
+			}
+			v.checkOneOf(entry, "compression", props["compression"], "", "none", "gzip", "zstd")
+			v.checkKey(entry, fileKeySource(props["encrypt_key_env"], props["encrypt_key_file"]))
+			if len(xf.Category) > 0 {
+				name = xf.Category
+			}
+		case "socket":
+			v.checkAddr(entry, props["endpoint"])
+			v.checkOneOf(entry, "protocol", props["protocol"], "", "tcp", "udp")
+			v.checkOneOf(entry, "format", props["format"], "", "json", "logfmt", "msgpack", "pattern")
+			v.checkPattern(entry, props["pattern"])
+			v.checkFraming(entry, props["format"], props["framing"])
+			v.checkTLS(entry, xmlSocketTLS(xf.Property), props["protocol"])
+			v.checkOneOf(entry, "datagram_policy", props["datagram_policy"], "", "truncate", "split")
+			v.checkDuration(entry, "dial_timeout", props["dial_timeout"])
+			v.checkDuration(entry, "write_timeout", props["write_timeout"])
+			v.checkDuration(entry, "keepalive", props["keepalive"])
+			v.checkDuration(entry, "reconnect_delay", props["reconnect_delay"])
+			v.checkDuration(entry, "max_reconnect_delay", props["max_reconnect_delay"])
+			v.checkDuration(entry, "batch_interval", props["batch_interval"])
+			v.checkOneOf(entry, "compression", props["compression"], "", "none", "gzip", "zstd")
+			if len(props["spool"]) > 0 {
+				v.checkWritable(entry, expandFilename(props["spool"]))
+			}
+		case "":
+			v.add(entry, "missing <type>")
+		default:
+			v.add(entry, "unknown filter type %q", xf.Type)
+		}
+		if xf.Enabled != "false" && len(name) > 0 {
+			v.checkCategory(entry, name)
+		}
+	}
+}
+
+func (v *configValidator) checkLevel(entry, level string) {
+	if _, ok := configLevel(level); !ok {
+		v.add(entry, "unknown level %q", level)
+	}
+}
+
+func (v *configValidator) checkMaxLevel(entry, level, max string) {
+	if len(max) == 0 {
+		return
+	}
+	maxLvl, ok := configLevel(max)
+	if !ok {
+		v.add(entry, "unknown max level %q", max)
+		return
+	}
+	if lvl, ok := configLevel(level); ok && lvl.above(maxLvl) {
+		v.add(entry, "max level %s is below level %s, nothing is written", max, level)
+	}
+}
+
+func (v *configValidator) checkMessageFilters(entry string, allow, deny []string) {
+	for _, expr := range append(append([]string(nil), allow...), deny...) {
+		if _, err := compileAll([]string{expr}); err != nil {
+			v.add(entry, "%s", err)
+		}
+	}
+}
+
+func (v *configValidator) checkRateLimit(entry string, rate float64, burst int) {
+	if rate < 0 {
+		v.add(entry, "negative rate_limit %g", rate)
+	}
+	if burst < 0 {
+		v.add(entry, "negative rate_burst %d", burst)
+	}
+}
+
+func (v *configValidator) checkRedact(entry string, rc RedactConfig) {
+	if _, err := rc.redactor(); err != nil {
+		v.add(entry, "%s", err)
+	}
+}
+
+func (v *configValidator) checkPattern(entry, pattern string) {
+	if len(pattern) == 0 {
+		return
+	}
+	if err := ValidatePattern(strings.Trim(pattern, " \r\n")); err != nil {
+		v.add(entry, "%s", err)
+	}
+}
+
+func (v *configValidator) checkFraming(entry, format, framing string) {
+	f, err := ParseFraming(framing)
+	if err != nil {
+		v.add(entry, "%s", err)
+	} else if format == "msgpack" && f == FrameNewline {
+		v.add(entry, "msgpack records may contain newlines, use length_prefix framing")
+	}
+}
+
+func (v *configValidator) checkOneOf(entry, field, value string, allowed ...string) {
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+	v.add(entry, "unknown %s %q", field, value)
+}
+
+func (v *configValidator) checkEscape(entry, value string) {
+	if len(value) == 0 {
+		return
+	}
+	if _, err := ParseEscapeMode(value); err != nil {
+		v.add(entry, "%s", err)
+	}
+}
+
+func (v *configValidator) checkOverflow(entry, value string) {
+	if len(value) == 0 {
+		return
+	}
+	if _, err := ParseOverflowPolicy(value); err != nil {
+		v.add(entry, "%s", err)
+	}
+}
+
+func (v *configValidator) checkDuration(entry, field, value string) {
+	if len(value) == 0 {
+		return
+	}
+	if _, err := time.ParseDuration(value); err != nil {
+		v.add(entry, "invalid %s %q", field, value)
+	}
+}
+
+func (v *configValidator) checkKey(entry string, source KeySource) {
+	if source == nil {
+		return
+	}
+	if _, err := source(); err != nil {
+		v.add(entry, "%s", err)
+	}
+}
+
+// checkWritable checks that file can be appended to, or created in its
+// directory, without changing it.
+func (v *configValidator) checkWritable(entry, file string) {
+	if fi, err := os.Stat(file); err == nil {
+		if fi.IsDir() {
+			v.add(entry, "%s is a directory", file)
+			return
+		}
+		fd, err := os.OpenFile(file, os.O_WRONLY|os.O_APPEND, 0)
+		if err != nil {
+			v.add(entry, "%s is not writable: %s", file, err)
+			return
+		}
+		fd.Close()
+		return
+	}
+
+	dir := filepath.Dir(file)
+	if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+		v.add(entry, "directory %s of %s does not exist", dir, file)
+		return
+	}
+	fd, err := ioutil.TempFile(dir, ".log4go-validate")
+	if err != nil {
+		v.add(entry, "directory %s of %s is not writable: %s", dir, file, err)
+		return
+	}
+	fd.Close()
+	os.Remove(fd.Name())
+}
+
+func (v *configValidator) checkAddr(entry, addr string) {
+	if len(addr) == 0 {
+		v.add(entry, "missing address")
+		return
+	}
+	if _, port, err := net.SplitHostPort(addr); err != nil {
+		v.add(entry, "invalid address %q: %s", addr, err)
+	} else if _, err := net.LookupPort("tcp", port); err != nil {
+		v.add(entry, "invalid port in address %q", addr)
+	}
+}
+
+func (v *configValidator) checkTLS(entry string, st socketTLS, proto string) {
+	if err := st.check(proto); err != nil {
+		v.add(entry, "%s", err)
+	} else if st.enable {
+		if _, err := st.config(); err != nil {
+			v.add(entry, "%s", err)
+		}
+	}
+}
+
+func (v *configValidator) checkCategory(entry, category string) {
+	if isCategoryPattern(category) {
+		if _, err := path.Match(category, ""); err != nil {
+			v.add(entry, "invalid category pattern %q", category)
+		}
+	}
+}
@@ -5,8 +5,14 @@ package log4go
 import (
 	"errors"
 	"fmt"
+	"io"
+	stdlog "log"
+	"net/http"
 	"os"
+	"os/exec"
+	"path/filepath"
 	"strings"
+	"time"
 )
 
 var (
@@ -15,27 +21,107 @@ var (
 
 func init() {
 	Global = NewDefaultLogger(FINE)
+	Global.applyEnvLevels()
 }
 
-// Wrapper for (*Logger).LoadConfiguration
+// Load a configuration of the given type, "xml" or "json".  Without a type,
+// files ending in .xml and inline XML are loaded as XML, anything else as
+// JSON.
+// Wrapper for (*Logger).LoadConfiguration, (*Logger).LoadJsonConfiguration
+// and (*Logger).LoadYamlConfiguration.  The format is taken from types[0]
+// ("xml", "yaml" or "json") or else from the file extension.  types[1]
+// selects the profile of a json or yaml configuration instead of ProfileEnv:
+//
+//	log.LoadConfiguration("log4go.json", "json", "prod")
 func LoadConfiguration(filename string, types ...string) {
-	if len(types) > 0 && types[0] == "xml" {
+	format := "json"
+	if strings.EqualFold(filepath.Ext(filename), ".xml") || isXMLContent(filename) {
+		format = "xml"
+	} else if isYAMLFile(strings.ToLower(filename)) {
+		format = "yaml"
+	}
+	if len(types) > 0 && len(types[0]) > 0 {
+		format = types[0]
+	}
+	profile := ""
+	if len(types) > 1 {
+		profile = types[1]
+	}
+	switch format {
+	case "xml":
 		Global.LoadConfiguration(filename)
-	} else {
-		Global.LoadJsonConfiguration(filename)
+	case "yaml", "yml":
+		Global.LoadYamlConfiguration(filename, profile)
+	default:
+		Global.LoadJsonConfiguration(filename, profile)
 	}
 }
 
+// Wrapper for (*Logger).LoadConfigurationFromReader
+func LoadConfigurationFromReader(r io.Reader, format string) error {
+	return Global.LoadConfigurationFromReader(r, format)
+}
+
+// Wrapper for (*Logger).LoadConfigurationFromBytes
+func LoadConfigurationFromBytes(data []byte, format string) error {
+	return Global.LoadConfigurationFromBytes(data, format)
+}
+
+// Wrapper for (*Logger).SetLevel
+func SetLevel(category string, lvl Level) error {
+	return Global.SetLevel(category, lvl)
+}
+
+// Wrapper for (*Logger).GetLevel
+func GetLevel(category string) (Level, bool) {
+	return Global.GetLevel(category)
+}
+
+// Wrapper for (*Logger).IsEnabledFor
+func IsEnabledFor(lvl Level) bool {
+	return Global.IsEnabledFor(lvl)
+}
+
+// Wrapper for (*Logger).SetCaptureSource
+func SetCaptureSource(category string, capture bool) error {
+	return Global.SetCaptureSource(category, capture)
+}
+
+// Wrapper for (*Logger).SetRateLimit
+func SetRateLimit(category string, perSecond float64, burst int) error {
+	return Global.SetRateLimit(category, perSecond, burst)
+}
+
+// Wrapper for (*Logger).AdminHandler
+func AdminHandler() http.Handler {
+	return Global.AdminHandler()
+}
+
 // Wrapper for (*Logger).AddFilter
 func AddFilter(name string, lvl Level, writer LogWriter) {
 	Global.AddFilter(name, lvl, writer)
 }
 
+// Wrapper for (*Logger).AddWriter
+func AddWriter(category string, lvl Level, writer LogWriter) {
+	Global.AddWriter(category, lvl, writer)
+}
+
+// Wrapper for (*Logger).Flush
+func Flush() {
+	Global.Flush()
+}
+
 // Wrapper for (*Logger).Close (closes and removes all logwriters)
 func Close() {
 	Global.Close()
 }
 
+// Wrapper for (*Logger).CloseTimeout
+func CloseTimeout(timeout time.Duration) error {
+	return Global.CloseTimeout(timeout)
+}
+
 func Crash(args ...interface{}) {
 	if len(args) > 0 {
 		Global.intLogf(CRITICAL, strings.Repeat(" %v", len(args))[1:], args...)
@@ -50,6 +136,36 @@ func Crashf(format string, args ...interface{}) {
 	panic(fmt.Sprintf(format, args...))
 }
 
+// Wrapper for (*Logger).Fatal
+func Fatal(args ...interface{}) {
+	Global.intLogf(FATAL, "%s", fmt.Sprint(args...))
+	Global.Flush()
+	exit(1)
+}
+
+// Wrapper for (*Logger).Fatalf
+func Fatalf(format string, args ...interface{}) {
+	Global.intLogf(FATAL, format, args...)
+	Global.Flush()
+	exit(1)
+}
+
+// Wrapper for (*Logger).Panic
+func Panic(args ...interface{}) {
+	msg := fmt.Sprint(args...)
+	Global.intLogf(PANIC, "%s", msg)
+	Global.Flush()
+	panic(msg)
+}
+
+// Wrapper for (*Logger).Panicf
+func Panicf(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	Global.intLogf(PANIC, "%s", msg)
+	Global.Flush()
+	panic(msg)
+}
+
 // Compatibility with `log`
 func Exit(args ...interface{}) {
 	if len(args) > 0 {
@@ -96,6 +212,40 @@ func Log(lvl Level, source, message string) {
 	Global.Log(lvl, source, message)
 }
 
+// Push pre-built records through the logger
+// Wrapper for (*Logger).Ingest
+func Ingest(records []*LogRecord) {
+	Global.Ingest(records)
+}
+
+// Get an io.Writer logging each line written to it
+// Wrapper for (*Logger).Writer
+func Writer(lvl Level, category string) *LineWriter {
+	return Global.Writer(lvl, category)
+}
+
+// Log the output of a child process
+// Wrapper for (*Logger).CaptureOutput
+func CaptureOutput(cmd *exec.Cmd, category string, outLvl, errLvl Level) (flush func()) {
+	return Global.CaptureOutput(cmd, category, outLvl, errLvl)
+}
+
+// Get a *log.Logger logging each message as a record
+// Wrapper for (*Logger).NewStdLogger
+func NewStdLogger(category string, lvl Level) *stdlog.Logger {
+	return Global.NewStdLogger(category, lvl)
+}
+
+// ReplaceStdLog redirects the output of the standard logger, the functions
+// of package log, into Global: each message is logged at INFO to every
+// filter, with the file and line of its call as its source, as
+// NewStdLogger does.  Messages from third-party libraries logging through
+// the standard logger thus reach the log4go writers.  It returns a function
+// restoring the output, flags and prefix the standard logger had.
+func ReplaceStdLog() (restore func()) {
+	return Global.replaceStdLog(INFO)
+}
+
 // Send a formatted log message easily
 // Wrapper for (*Logger).Logf
 func Logf(lvl Level, format string, args ...interface{}) {
@@ -215,8 +365,11 @@ func Warn(arg0 interface{}, args ...interface{}) error {
 	)
 	switch first := arg0.(type) {
 	case string:
-		// Use the string as a format string
+		// Use the string as a format string, unless there is nothing to format
 		Global.intLogf(lvl, first, args...)
+		if len(args) == 0 {
+			return errors.New(first)
+		}
 		return errors.New(fmt.Sprintf(first, args...))
 	case func() string:
 		// Log the closure (no other arguments used)
@@ -228,7 +381,6 @@ func Warn(arg0 interface{}, args ...interface{}) error {
 		Global.intLogf(lvl, fmt.Sprint(first)+strings.Repeat(" %v", len(args)), args...)
 		return errors.New(fmt.Sprint(first) + fmt.Sprintf(strings.Repeat(" %v", len(args)), args...))
 	}
-	return nil
 }
 
 // Utility for error log messages (returns an error for easy function returns) (see Debug() for parameter explanation)
@@ -240,8 +392,11 @@ func Error(arg0 interface{}, args ...interface{}) error {
 	)
 	switch first := arg0.(type) {
 	case string:
-		// Use the string as a format string
+		// Use the string as a format string, unless there is nothing to format
 		Global.intLogf(lvl, first, args...)
+		if len(args) == 0 {
+			return errors.New(first)
+		}
 		return errors.New(fmt.Sprintf(first, args...))
 	case func() string:
 		// Log the closure (no other arguments used)
@@ -253,7 +408,6 @@ func Error(arg0 interface{}, args ...interface{}) error {
 		Global.intLogf(lvl, fmt.Sprint(first)+strings.Repeat(" %v", len(args)), args...)
 		return errors.New(fmt.Sprint(first) + fmt.Sprintf(strings.Repeat(" %v", len(args)), args...))
 	}
-	return nil
 }
 
 // Utility for critical log messages (returns an error for easy function returns) (see Debug() for parameter explanation)
@@ -265,8 +419,11 @@ func Critical(arg0 interface{}, args ...interface{}) error {
 	)
 	switch first := arg0.(type) {
 	case string:
-		// Use the string as a format string
+		// Use the string as a format string, unless there is nothing to format
 		Global.intLogf(lvl, first, args...)
+		if len(args) == 0 {
+			return errors.New(first)
+		}
 		return errors.New(fmt.Sprintf(first, args...))
 	case func() string:
 		// Log the closure (no other arguments used)
@@ -278,5 +435,4 @@ func Critical(arg0 interface{}, args ...interface{}) error {
 		Global.intLogf(lvl, fmt.Sprint(first)+strings.Repeat(" %v", len(args)), args...)
 		return errors.New(fmt.Sprint(first) + fmt.Sprintf(strings.Repeat(" %v", len(args)), args...))
 	}
-	return nil
 }
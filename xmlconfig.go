@@ -5,7 +5,6 @@ package log4go
 import (
 	"encoding/xml"
 	"fmt"
-	"io/ioutil"
 	"os"
 	"strconv"
 	"strings"
@@ -19,41 +18,93 @@ type xmlProperty struct {
 type xmlFilter struct {
 	Enabled  string        `xml:"enabled,attr"`
 	Tag      string        `xml:"tag"`
+	Category string        `xml:"category"`
 	Level    string        `xml:"level"`
+	MaxLevel string        `xml:"maxlevel"`
 	Type     string        `xml:"type"`
 	Property []xmlProperty `xml:"property"`
 }
 
 type xmlLoggerConfig struct {
-	Filter []xmlFilter `xml:"filter"`
+	Filter      []xmlFilter   `xml:"filter"`
+	LevelName   []xmlProperty `xml:"levelname"`
+	GlobalField []xmlProperty `xml:"globalfield"`
+	Redact      []xmlRedact   `xml:"redact"`
 }
 
-// Load XML configuration; see examples/example.xml for documentation
+// xmlRedact is <redact name="email"/> or
+// <redact replacement="ssn=***">ssn=\d+</redact>, see RedactConfig.
+type xmlRedact struct {
+	Name        string `xml:"name,attr"`
+	Replacement string `xml:"replacement,attr"`
+	Pattern     string `xml:",chardata"`
+}
+
+func (xr xmlRedact) config() RedactConfig {
+	return RedactConfig{Name: xr.Name, Pattern: strings.TrimSpace(xr.Pattern), Replacement: xr.Replacement}
+}
+
+// Load XML configuration; see examples/example.xml for documentation.  Like
+// LoadJsonConfiguration, filename may also be "-", an http(s) URL or the XML
+// itself, and ${VAR} and ${VAR:-default} are replaced by environment
+// variables.
+//
+// Each <filter> is registered under its <tag>.  A filter with a <category>
+// is registered under the category instead, so that LOGGER(category) finds
+// it as with a JSON configuration.
 func (log Logger) LoadConfiguration(filename string) {
 	log.Close()
 
-	// Open the configuration file
-	fd, err := os.Open(filename)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "LoadConfiguration: Error: Could not open %q for reading: %s\n", filename, err)
-		os.Exit(1)
-	}
-
-	contents, err := ioutil.ReadAll(fd)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "LoadConfiguration: Error: Could not read %q: %s\n", filename, err)
-		os.Exit(1)
+	contents := filename
+	if !isXMLContent(filename) {
+		var err error
+		contents, err = ReadFile(filename)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "LoadConfiguration: Error: Could not read %q: %s\n", filename, err)
+			os.Exit(1)
+		}
 	}
 
 	xc := new(xmlLoggerConfig)
-	if err := xml.Unmarshal(contents, xc); err != nil {
+	if err := xml.Unmarshal([]byte(expandConfigEnv(contents)), xc); err != nil {
 		fmt.Fprintf(os.Stderr, "LoadConfiguration: Error: Could not parse XML configuration in %q: %s\n", filename, err)
 		os.Exit(1)
 	}
+	log.applyXMLConfig(filename, xc)
+}
+
+// applyXMLConfig sets up the filters of a parsed XML configuration.
+func (log Logger) applyXMLConfig(filename string, xc *xmlLoggerConfig) {
+	// The environment overrides the configured levels, see LevelEnv
+	defer log.applyEnvLevels()
+
+	// Override level names: <levelname name="WARNING">WARNING</levelname>
+	for _, prop := range xc.LevelName {
+		if lvl, ok := configLevel(prop.Name); ok {
+			SetLevelName(lvl, strings.Trim(prop.Value, " \r\n"))
+		} else {
+			fmt.Fprintf(os.Stderr, "LoadConfiguration: Warning: Unknown level \"%s\" for levelname in %s\n", prop.Name, filename)
+		}
+	}
+
+	// Fields attached to every record: <globalfield name="app">billing</globalfield>
+	if len(xc.GlobalField) > 0 {
+		fields := make(map[string]interface{}, len(xc.GlobalField))
+		for _, prop := range xc.GlobalField {
+			fields[prop.Name] = strings.Trim(prop.Value, " \r\n")
+		}
+		SetGlobalFields(fields)
+	}
+	if len(xc.Redact) > 0 {
+		entries := make([]RedactConfig, len(xc.Redact))
+		for i, xr := range xc.Redact {
+			entries[i] = xr.config()
+		}
+		SetRedactors(configRedactors("LoadConfiguration", filename, entries)...)
+	}
 
 	for _, xmlfilt := range xc.Filter {
 		var filt LogWriter
-		var lvl Level
 		bad, good, enabled := false, true, false
 
 		// Check required children
@@ -76,28 +127,18 @@ func (log Logger) LoadConfiguration(filename string) {
 			bad = true
 		}
 
-		switch xmlfilt.Level {
-		case "FINEST":
-			lvl = FINEST
-		case "FINE":
-			lvl = FINE
-		case "DEBUG":
-			lvl = DEBUG
-		case "TRACE":
-			lvl = TRACE
-		case "INFO":
-			lvl = INFO
-		case "WARNING":
-			lvl = WARNING
-		case "ERROR":
-			lvl = ERROR
-		case "CRITICAL":
-			lvl = CRITICAL
-		default:
+		lvl, known := configLevel(xmlfilt.Level)
+		if !known && len(xmlfilt.Level) > 0 {
 			fmt.Fprintf(os.Stderr, "LoadConfiguration: Error: Required child <%s> for filter has unknown value in %s: %s\n", "level", filename, xmlfilt.Level)
 			bad = true
 		}
 
+		maxLvl, known := configLevel(xmlfilt.MaxLevel)
+		if !known && len(xmlfilt.MaxLevel) > 0 {
+			fmt.Fprintf(os.Stderr, "LoadConfiguration: Error: Child <%s> for filter has unknown value in %s: %s\n", "maxlevel", filename, xmlfilt.MaxLevel)
+			bad = true
+		}
+
 		// Just so all of the required attributes are errored at the same time if missing
 		if bad {
 			os.Exit(1)
@@ -126,20 +167,101 @@ func (log Logger) LoadConfiguration(filename string) {
 		if !enabled {
 			continue
 		}
+		// The writer could not be opened, which was reported already
+		if filt == nil {
+			continue
+		}
+
+		name, category := xmlfilt.Tag, "DEFAULT"
+		if xmlfilt.Type != "console" {
+			category = xmlfilt.Tag
+			if len(xmlfilt.Category) > 0 {
+				name, category = xmlfilt.Category, xmlfilt.Category
+			}
+		}
+		if len(xmlfilt.MaxLevel) > 0 {
+			filt = MaxLevel(maxLvl, filt)
+		}
+		var (
+			allow, deny []string
+			rate        float64
+			burst       int
+			badLimit    bool
+		)
+		for _, prop := range xmlfilt.Property {
+			value := strings.Trim(prop.Value, " \r\n")
+			var err error
+			switch prop.Name {
+			case "allow":
+				allow = append(allow, value)
+			case "deny":
+				deny = append(deny, value)
+			case "rate_limit":
+				rate, err = strconv.ParseFloat(value, 64)
+			case "rate_burst":
+				burst, err = strconv.Atoi(value)
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "LoadConfiguration: Warning: Invalid %s %q in %s, not limiting\n", prop.Name, value, filename)
+				badLimit = true
+			}
+		}
+		filt = withMessageFilter("LoadConfiguration", filename, filt, allow, deny)
+		log.add(name, &Filter{Level: lvl, LogWriter: filt, Category: category})
+		if rate > 0 && !badLimit {
+			log.SetRateLimit(name, rate, burst)
+		}
+	}
+}
+
+// isXMLContent reports whether the configuration "file name" is the XML
+// itself rather than the name of a file.
+func isXMLContent(filename string) bool {
+	return strings.HasPrefix(strings.TrimSpace(filename), "<")
+}
+
+// levelConfigNames are the level names used in configuration files.
+var levelConfigNames = [...]string{"FINEST", "FINE", "DEBUG", "TRACE", "INFO", "WARNING", "ERROR", "CRITICAL", "PANIC", "FATAL"}
 
-		log[xmlfilt.Tag] = &Filter{lvl, filt, "DEFAULT"}
+// configLevel returns the level called name in configuration files.
+func configLevel(name string) (Level, bool) {
+	for lvl := FINEST; lvl <= FATAL; lvl++ {
+		if levelConfigNames[lvl] == name {
+			return lvl, true
+		}
 	}
+	return customConfigLevel(name)
 }
 
 func xmlToConsoleLogWriter(filename string, props []xmlProperty, enabled bool) (*ConsoleLogWriter, bool) {
 
 	format := "[%D %T] [%L] (%S) %M"
+	utc := false
+	escape := ""
+	maxMessage := 0
+	raw := false
+	bufferLength := 0
+	overflow := ""
 
 	// Parse properties
 	for _, prop := range props {
 		switch prop.Name {
 		case "format":
 			format = strings.Trim(prop.Value, " \r\n")
+		case "buffer_length":
+			bufferLength = strToNumSuffix(strings.Trim(prop.Value, " \r\n"), 1000)
+		case "overflow":
+			overflow = strings.Trim(prop.Value, " \r\n")
+		case "utc":
+			utc = strings.Trim(prop.Value, " \r\n") != "false"
+		case "max_message_length":
+			maxMessage = strToNumSuffix(strings.Trim(prop.Value, " \r\n"), 1024)
+		case "raw":
+			raw = strings.Trim(prop.Value, " \r\n") != "false"
+		case "escape":
+			escape = strings.Trim(prop.Value, " \r\n")
+		case "allow", "deny", "rate_limit", "rate_burst":
+			// Applied by applyXMLConfig
 		default:
 			fmt.Fprintf(os.Stderr, "LoadConfiguration: Warning: Unknown property \"%s\" for console filter in %s\n", prop.Name, filename)
 		}
@@ -151,7 +273,24 @@ func xmlToConsoleLogWriter(filename string, props []xmlProperty, enabled bool) (
 	}
 
 	clw := NewConsoleLogWriter()
-	clw.SetFormat(format)
+	switch format {
+	case "json":
+		clw.SetJSON(true)
+	case "logfmt":
+		clw.SetLogfmt(true)
+	case "pretty":
+		clw.SetPretty(true)
+	default:
+		clw.SetFormat(format)
+	}
+	clw.SetUTC(utc)
+	clw.SetEscape(parseEscape("LoadConfiguration", filename, escape, EscapeNone))
+	clw.SetMaxMessageLength(maxMessage)
+	clw.SetRaw(raw)
+	if bufferLength > 0 {
+		clw.SetBufferLength(bufferLength)
+	}
+	clw.SetOverflowPolicy(parseOverflow("LoadConfiguration", filename, overflow))
 
 	return clw, true
 }
@@ -175,14 +314,14 @@ func strToNumSuffix(str string, mult int) int {
 	parsed, _ := strconv.Atoi(str)
 	return parsed * num
 }
-func xmlToFileLogWriter(filename string, props []xmlProperty, enabled bool) (*FileLogWriter, bool) {
+func xmlToFileLogWriter(filename string, props []xmlProperty, enabled bool) (LogWriter, bool) {
 	file := ""
-	format := "[%D %T] [%L] (%S) %M"
-	maxlines := 0
-	maxsize := 0
+	opts := defaultFileOptions()
 	daily := false
 	rotate := false
-	sanitize := false
+	split := false
+	keyEnv, keyFile := "", ""
+	escape := ""
 
 	// Parse properties
 	for _, prop := range props {
@@ -190,21 +329,64 @@ func xmlToFileLogWriter(filename string, props []xmlProperty, enabled bool) (*Fi
 		case "filename":
 			file = strings.Trim(prop.Value, " \r\n")
 		case "format":
-			format = strings.Trim(prop.Value, " \r\n")
+			switch format := strings.Trim(prop.Value, " \r\n"); format {
+			case "json":
+				opts.formatter = NewJSONFormatter()
+			case "logfmt":
+				opts.formatter = NewLogfmtFormatter()
+			default:
+				opts.format = format
+			}
 		case "maxlines":
-			maxlines = strToNumSuffix(strings.Trim(prop.Value, " \r\n"), 1000)
+			opts.maxlines = strToNumSuffix(strings.Trim(prop.Value, " \r\n"), 1000)
 		case "maxsize":
-			maxsize = strToNumSuffix(strings.Trim(prop.Value, " \r\n"), 1024)
+			opts.maxsize = strToNumSuffix(strings.Trim(prop.Value, " \r\n"), 1024)
 		case "daily":
 			daily = strings.Trim(prop.Value, " \r\n") != "false"
 		case "rotate":
 			rotate = strings.Trim(prop.Value, " \r\n") != "false"
 		case "sanitize":
-			sanitize = strings.Trim(prop.Value, " \r\n") != "false"
+			if strings.Trim(prop.Value, " \r\n") != "false" {
+				opts.escape = EscapeNewline
+			}
+		case "split_by_level":
+			split = strings.Trim(prop.Value, " \r\n") != "false"
+		case "encrypt_key_env":
+			keyEnv = strings.Trim(prop.Value, " \r\n")
+		case "encrypt_key_file":
+			keyFile = strings.Trim(prop.Value, " \r\n")
+		case "compression":
+			opts.compression = strings.Trim(prop.Value, " \r\n")
+		case "buffer_length":
+			opts.bufferLength = strToNumSuffix(strings.Trim(prop.Value, " \r\n"), 1000)
+		case "overflow":
+			opts.overflow = parseOverflow("LoadConfiguration", filename, strings.Trim(prop.Value, " \r\n"))
+		case "shards":
+			opts.shards = strToNumSuffix(strings.Trim(prop.Value, " \r\n"), 1000)
+		case "maxbackup":
+			if maxbackup := strToNumSuffix(strings.Trim(prop.Value, " \r\n"), 1000); maxbackup > 0 {
+				opts.maxbackup = maxbackup
+			}
+		case "timestamp":
+			opts.timestamp = strings.Trim(prop.Value, " \r\n") != "false"
+		case "flush_interval":
+			opts.flushInterval = parseFlushInterval(filename, strings.Trim(prop.Value, " \r\n"))
+		case "utc":
+			opts.utc = strings.Trim(prop.Value, " \r\n") != "false"
+		case "max_message_length":
+			opts.maxMessage = strToNumSuffix(strings.Trim(prop.Value, " \r\n"), 1024)
+		case "raw":
+			opts.raw = strings.Trim(prop.Value, " \r\n") != "false"
+		case "escape":
+			escape = strings.Trim(prop.Value, " \r\n")
+		case "allow", "deny", "rate_limit", "rate_burst":
+			// Applied by applyXMLConfig
 		default:
 			fmt.Fprintf(os.Stderr, "LoadConfiguration: Warning: Unknown property \"%s\" for file filter in %s\n", prop.Name, filename)
 		}
 	}
+	opts.escape = parseEscape("LoadConfiguration", filename, escape, opts.escape)
+	opts.keySource = fileKeySource(keyEnv, keyFile)
 
 	// Check properties
 	if len(file) == 0 {
@@ -217,12 +399,12 @@ func xmlToFileLogWriter(filename string, props []xmlProperty, enabled bool) (*Fi
 		return nil, true
 	}
 
-	flw := NewFileLogWriter(file, rotate, daily)
-	flw.SetFormat(format)
-	flw.SetRotateLines(maxlines)
-	flw.SetRotateSize(maxsize)
-	flw.SetSanitize(sanitize)
-	return flw, true
+	fw, err := newFileWriter(file, rotate, daily, split, &opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "LoadConfiguration: Error: Could not set up file filter in %s: %s\n", filename, err)
+		return nil, false
+	}
+	return fw, true
 }
 
 func xmlToXMLLogWriter(filename string, props []xmlProperty, enabled bool) (*FileLogWriter, bool) {
@@ -245,6 +427,8 @@ func xmlToXMLLogWriter(filename string, props []xmlProperty, enabled bool) (*Fil
 			daily = strings.Trim(prop.Value, " \r\n") != "false"
 		case "rotate":
 			rotate = strings.Trim(prop.Value, " \r\n") != "false"
+		case "allow", "deny", "rate_limit", "rate_burst":
+			// Applied by applyXMLConfig
 		default:
 			fmt.Fprintf(os.Stderr, "LoadConfiguration: Warning: Unknown property \"%s\" for xml filter in %s\n", prop.Name, filename)
 		}
@@ -261,15 +445,54 @@ func xmlToXMLLogWriter(filename string, props []xmlProperty, enabled bool) (*Fil
 		return nil, true
 	}
 
-	xlw := NewXMLLogWriter(file, rotate, daily)
+	xlw := NewXMLLogWriter(expandFilename(file), rotate, daily)
 	xlw.SetRotateLines(maxrecords)
 	xlw.SetRotateSize(maxsize)
 	return xlw, true
 }
 
-func xmlToSocketLogWriter(filename string, props []xmlProperty, enabled bool) (SocketLogWriter, bool) {
+// xmlSocketTLS returns the TLS settings in the properties of a socket filter.
+func xmlSocketTLS(props []xmlProperty) socketTLS {
+	var st socketTLS
+	for _, prop := range props {
+		value := strings.Trim(prop.Value, " \r\n")
+		switch prop.Name {
+		case "tls":
+			st.enable = value != "false"
+		case "tls_cert":
+			st.cert = value
+		case "tls_key":
+			st.key = value
+		case "tls_ca":
+			st.ca = value
+		case "tls_server_name":
+			st.serverName = value
+		case "tls_insecure_skip_verify":
+			st.insecure = value != "false"
+		}
+	}
+	return st
+}
+
+func xmlToSocketLogWriter(filename string, props []xmlProperty, enabled bool) (LogWriter, bool) {
 	endpoint := ""
-	protocol := "udp"
+	protocol := ""
+	format := ""
+	pattern := FORMAT_DEFAULT
+	framing := ""
+	flushInterval := ""
+	reconnectDelay, maxReconnectDelay := "", ""
+	dialTimeout, writeTimeout, keepAlive := "", "", ""
+	maxDatagram, datagramPolicy := 0, ""
+	spool, spoolMaxSize := "", 0
+	batchRecords, batchInterval, compression := 0, "", ""
+	expvarName := ""
+	utc := false
+	maxMessage := 0
+	raw := false
+	bufferLength := 0
+	overflow := ""
+	secure := xmlSocketTLS(props)
 
 	// Parse properties
 	for _, prop := range props {
@@ -278,6 +501,54 @@ func xmlToSocketLogWriter(filename string, props []xmlProperty, enabled bool) (S
 			endpoint = strings.Trim(prop.Value, " \r\n")
 		case "protocol":
 			protocol = strings.Trim(prop.Value, " \r\n")
+		case "format":
+			format = strings.Trim(prop.Value, " \r\n")
+		case "pattern":
+			pattern = strings.Trim(prop.Value, " \r\n")
+		case "framing":
+			framing = strings.Trim(prop.Value, " \r\n")
+		case "flush_interval":
+			flushInterval = strings.Trim(prop.Value, " \r\n")
+		case "max_datagram_size":
+			maxDatagram = strToNumSuffix(strings.Trim(prop.Value, " \r\n"), 1024)
+		case "datagram_policy":
+			datagramPolicy = strings.Trim(prop.Value, " \r\n")
+		case "dial_timeout":
+			dialTimeout = strings.Trim(prop.Value, " \r\n")
+		case "write_timeout":
+			writeTimeout = strings.Trim(prop.Value, " \r\n")
+		case "keepalive":
+			keepAlive = strings.Trim(prop.Value, " \r\n")
+		case "reconnect_delay":
+			reconnectDelay = strings.Trim(prop.Value, " \r\n")
+		case "max_reconnect_delay":
+			maxReconnectDelay = strings.Trim(prop.Value, " \r\n")
+		case "batch_records":
+			batchRecords = strToNumSuffix(strings.Trim(prop.Value, " \r\n"), 1000)
+		case "batch_interval":
+			batchInterval = strings.Trim(prop.Value, " \r\n")
+		case "compression":
+			compression = strings.Trim(prop.Value, " \r\n")
+		case "spool":
+			spool = strings.Trim(prop.Value, " \r\n")
+		case "expvar":
+			expvarName = strings.Trim(prop.Value, " \r\n")
+		case "spool_max_size":
+			spoolMaxSize = strToNumSuffix(strings.Trim(prop.Value, " \r\n"), 1024)
+		case "buffer_length":
+			bufferLength = strToNumSuffix(strings.Trim(prop.Value, " \r\n"), 1000)
+		case "overflow":
+			overflow = strings.Trim(prop.Value, " \r\n")
+		case "utc":
+			utc = strings.Trim(prop.Value, " \r\n") != "false"
+		case "max_message_length":
+			maxMessage = strToNumSuffix(strings.Trim(prop.Value, " \r\n"), 1024)
+		case "raw":
+			raw = strings.Trim(prop.Value, " \r\n") != "false"
+		case "allow", "deny", "rate_limit", "rate_burst":
+			// Applied by applyXMLConfig
+		case "tls", "tls_cert", "tls_key", "tls_ca", "tls_server_name", "tls_insecure_skip_verify":
+			// Read by xmlSocketTLS
 		default:
 			fmt.Fprintf(os.Stderr, "LoadConfiguration: Warning: Unknown property \"%s\" for file filter in %s\n", prop.Name, filename)
 		}
@@ -288,11 +559,57 @@ func xmlToSocketLogWriter(filename string, props []xmlProperty, enabled bool) (S
 		fmt.Fprintf(os.Stderr, "LoadConfiguration: Error: Required property \"%s\" for file filter missing in %s\n", "endpoint", filename)
 		return nil, false
 	}
+	if len(protocol) == 0 {
+		protocol = "udp"
+		if secure.enable {
+			protocol = "tcp"
+		}
+	}
 
 	// If it's disabled, we're just checking syntax
 	if !enabled {
 		return nil, true
 	}
 
-	return NewSocketLogWriter(protocol, endpoint), true
+	slw, err := secure.dial(socketDialer(filename, dialTimeout, keepAlive), protocol, endpoint)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "LoadConfiguration: Error: %s for socket %q in %s\n", err, endpoint, filename)
+		return nil, false
+	}
+	if slw == nil {
+		// Not a configuration error; leave the filter out
+		return nil, true
+	}
+	slw.SetJSON(format == "json")
+	switch format {
+	case "logfmt":
+		slw.SetLogfmt(true)
+	case "msgpack":
+		slw.SetMsgpack(true)
+	case "pattern":
+		checkPattern(filename, pattern)
+		slw.SetFormatter(PatternFormatter(pattern))
+	}
+	slw.SetFraming(parseFraming(filename, framing))
+	slw.SetFlushInterval(parseFlushInterval(filename, flushInterval))
+	slw.SetWriteTimeout(parseSocketDuration(filename, "write_timeout", writeTimeout))
+	slw.SetReconnectDelay(parseSocketDuration(filename, "reconnect_delay", reconnectDelay),
+		parseSocketDuration(filename, "max_reconnect_delay", maxReconnectDelay))
+	slw.SetUTC(utc)
+	slw.SetMaxMessageLength(maxMessage)
+	slw.SetRaw(raw)
+	if bufferLength > 0 {
+		slw.SetBufferLength(bufferLength)
+	}
+	slw.SetOverflowPolicy(parseOverflow("LoadConfiguration", filename, overflow))
+	slw.SetMaxDatagramSize(maxDatagram, parseDatagramPolicy(filename, datagramPolicy))
+	slw.SetBatch(batchRecords, parseBatchInterval(filename, batchInterval))
+	slw.SetCompression(compression)
+	if len(spool) > 0 {
+		slw.SetSpool(expandFilename(spool), int64(spoolMaxSize))
+	}
+	if len(expvarName) > 0 {
+		slw.PublishExpvar(expvarName)
+	}
+	return slw, true
 }
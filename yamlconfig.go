@@ -0,0 +1,473 @@
+package log4go
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// LoadYamlConfiguration loads a YAML configuration with the same schema as
+// LoadJsonConfiguration, keys named like the JSON ones:
+//
+//	console:
+//	  enable: true
+//	  level: INFO
+//	files:
+//	  - enable: true
+//	    category: api
+//	    filename: logs/api.log   # comments are allowed
+//	    maxsize: 500M
+//
+// filename may also be "-", an http(s) URL or the YAML itself, and
+// environment variables and profiles work as in LoadJsonConfiguration.  Only the
+// block style subset of YAML that configurations need is understood: nested
+// mappings and sequences, plain and quoted scalars, one line [flow, lists]
+// and {flow: maps}, and comments.  Anchors, tags and multi-line scalars are
+// not supported.
+func (log Logger) LoadYamlConfiguration(filename string, profile ...string) {
+	log.Close()
+
+	content := filename
+	if !strings.Contains(filename, "\n") {
+		var err error
+		content, err = ReadFile(filename)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "LoadYamlConfiguration: Error: Could not read %q: %s\n", filename, err)
+			os.Exit(1)
+		}
+	}
+
+	var lc LogConfig
+	if err := decodeYAMLConfig(expandConfigEnv(content), firstString(profile), &lc); err != nil {
+		fmt.Fprintf(os.Stderr, "LoadYamlConfiguration: Error: Could not parse yaml configuration in %q: %s\n", filename, err)
+		os.Exit(1)
+	}
+	log.applyConfig(filename, &lc)
+}
+
+// isYAMLFile reports whether filename has a YAML extension.
+func isYAMLFile(filename string) bool {
+	return strings.HasSuffix(filename, ".yaml") || strings.HasSuffix(filename, ".yml")
+}
+
+// A yamlNode is a parsed YAML scalar (keys and items nil), mapping or
+// sequence.
+type yamlNode struct {
+	scalar string
+	quoted bool
+	keys   []string
+	values map[string]*yamlNode
+	items  []*yamlNode
+	isSeq  bool
+}
+
+func (n *yamlNode) isMap() bool {
+	return n.values != nil
+}
+
+// isNull reports whether n is an empty or null scalar.
+func (n *yamlNode) isNull() bool {
+	if n.isMap() || n.isSeq || n.quoted {
+		return false
+	}
+	return n.scalar == "" || n.scalar == "~" || n.scalar == "null"
+}
+
+type yamlLine struct {
+	num    int
+	indent int
+	text   string
+}
+
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+}
+
+// unmarshalYAML parses content and stores it in the struct pointed to by v,
+// matching mapping keys with the json tags of its fields.
+func unmarshalYAML(content string, v interface{}) error {
+	root, err := parseYAML(content)
+	if err != nil || root == nil {
+		return err
+	}
+	return decodeYAML(root, reflect.ValueOf(v).Elem())
+}
+
+// parseYAML parses content, returning nil if it is empty.
+func parseYAML(content string) (*yamlNode, error) {
+	p := &yamlParser{}
+	for i, line := range strings.Split(content, "\n") {
+		line = strings.TrimRight(stripYAMLComment(line), " \r")
+		text := strings.TrimLeft(line, " ")
+		if len(text) == 0 || (len(p.lines) == 0 && text == "---") {
+			continue
+		}
+		if strings.HasPrefix(text, "\t") {
+			return nil, fmt.Errorf("line %d: tabs are not allowed for indentation", i+1)
+		}
+		p.lines = append(p.lines, yamlLine{num: i + 1, indent: len(line) - len(text), text: text})
+	}
+	if len(p.lines) == 0 {
+		return nil, nil
+	}
+
+	root, err := p.parseBlock(p.lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.lines) {
+		return nil, fmt.Errorf("line %d: unexpected indentation", p.lines[p.pos].num)
+	}
+	return root, nil
+}
+
+// stripYAMLComment removes a # comment outside quotes.
+func stripYAMLComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+func isSeqItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// parseBlock parses the mapping or sequence starting at the current line,
+// which is indented by indent.
+func (p *yamlParser) parseBlock(indent int) (*yamlNode, error) {
+	if isSeqItem(p.lines[p.pos].text) {
+		return p.parseSeq(indent)
+	}
+	return p.parseMap(indent)
+}
+
+func (p *yamlParser) parseMap(indent int) (*yamlNode, error) {
+	node := &yamlNode{values: map[string]*yamlNode{}}
+	for p.pos < len(p.lines) && p.lines[p.pos].indent == indent && !isSeqItem(p.lines[p.pos].text) {
+		line := p.lines[p.pos]
+		key, rest, ok := splitYAMLKey(line.text)
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected \"key: value\"", line.num)
+		}
+		if _, dup := node.values[key]; dup {
+			return nil, fmt.Errorf("line %d: duplicate key %q", line.num, key)
+		}
+		p.pos++
+
+		var (
+			value *yamlNode
+			err   error
+		)
+		switch {
+		case len(rest) > 0:
+			value, err = parseYAMLInline(rest)
+		case p.pos < len(p.lines) && p.lines[p.pos].indent > indent:
+			value, err = p.parseBlock(p.lines[p.pos].indent)
+		case p.pos < len(p.lines) && p.lines[p.pos].indent == indent && isSeqItem(p.lines[p.pos].text):
+			// A sequence may be indented like the key it belongs to
+			value, err = p.parseSeq(indent)
+		default:
+			value = &yamlNode{}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", line.num, err)
+		}
+		node.keys = append(node.keys, key)
+		node.values[key] = value
+	}
+	return node, nil
+}
+
+func (p *yamlParser) parseSeq(indent int) (*yamlNode, error) {
+	node := &yamlNode{isSeq: true}
+	for p.pos < len(p.lines) && p.lines[p.pos].indent == indent && isSeqItem(p.lines[p.pos].text) {
+		line := p.lines[p.pos]
+		rest := strings.TrimLeft(line.text[1:], " ")
+
+		var (
+			item *yamlNode
+			err  error
+		)
+		switch _, _, isKey := splitYAMLKey(rest); {
+		case len(rest) == 0:
+			p.pos++
+			if p.pos < len(p.lines) && p.lines[p.pos].indent > indent {
+				item, err = p.parseBlock(p.lines[p.pos].indent)
+			} else {
+				item = &yamlNode{}
+			}
+		case isKey:
+			// "- key: value" starts a mapping indented like its first key
+			p.lines[p.pos].indent += len(line.text) - len(rest)
+			p.lines[p.pos].text = rest
+			item, err = p.parseMap(p.lines[p.pos].indent)
+		default:
+			p.pos++
+			item, err = parseYAMLInline(rest)
+		}
+		if err != nil {
+			return nil, err
+		}
+		node.items = append(node.items, item)
+	}
+	return node, nil
+}
+
+// splitYAMLKey splits "key: value" into its unquoted key and value.
+func splitYAMLKey(text string) (string, string, bool) {
+	if len(text) == 0 || text[0] == '[' || text[0] == '{' {
+		return "", "", false
+	}
+	i := -1
+	if text[0] == '"' || text[0] == '\'' {
+		end := strings.IndexByte(text[1:], text[0])
+		if end < 0 || !strings.HasPrefix(text[end+2:], ":") {
+			return "", "", false
+		}
+		i = end + 2
+	} else if j := strings.Index(text, ": "); j >= 0 {
+		i = j
+	} else if strings.HasSuffix(text, ":") {
+		i = len(text) - 1
+	}
+	if i <= 0 {
+		return "", "", false
+	}
+	key, err := unquoteYAML(strings.TrimSpace(text[:i]))
+	if err != nil {
+		return "", "", false
+	}
+	return key, strings.TrimSpace(text[i+1:]), true
+}
+
+// parseYAMLInline parses a scalar or a one line flow sequence or mapping.
+func parseYAMLInline(text string) (*yamlNode, error) {
+	switch {
+	case strings.HasPrefix(text, "["):
+		if !strings.HasSuffix(text, "]") {
+			return nil, fmt.Errorf("unterminated flow sequence %q", text)
+		}
+		node := &yamlNode{isSeq: true}
+		for _, part := range splitYAMLFlow(text[1 : len(text)-1]) {
+			item, err := parseYAMLScalar(part)
+			if err != nil {
+				return nil, err
+			}
+			node.items = append(node.items, item)
+		}
+		return node, nil
+	case strings.HasPrefix(text, "{"):
+		if !strings.HasSuffix(text, "}") {
+			return nil, fmt.Errorf("unterminated flow mapping %q", text)
+		}
+		node := &yamlNode{values: map[string]*yamlNode{}}
+		for _, part := range splitYAMLFlow(text[1 : len(text)-1]) {
+			key, rest, ok := splitYAMLKey(part)
+			if !ok {
+				return nil, fmt.Errorf("expected \"key: value\" in %q", text)
+			}
+			value, err := parseYAMLScalar(rest)
+			if err != nil {
+				return nil, err
+			}
+			node.keys = append(node.keys, key)
+			node.values[key] = value
+		}
+		return node, nil
+	}
+	return parseYAMLScalar(text)
+}
+
+// splitYAMLFlow splits the inside of a flow collection at commas outside
+// quotes.
+func splitYAMLFlow(text string) []string {
+	var (
+		parts []string
+		quote byte
+		start int
+	)
+	for i := 0; i < len(text); i++ {
+		switch c := text[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ',':
+			parts = append(parts, strings.TrimSpace(text[start:i]))
+			start = i + 1
+		}
+	}
+	if last := strings.TrimSpace(text[start:]); len(last) > 0 || len(parts) > 0 {
+		parts = append(parts, last)
+	}
+	return parts
+}
+
+func parseYAMLScalar(text string) (*yamlNode, error) {
+	value, err := unquoteYAML(text)
+	if err != nil {
+		return nil, err
+	}
+	return &yamlNode{scalar: value, quoted: value != text || strings.HasPrefix(text, `"`) || strings.HasPrefix(text, "'")}, nil
+}
+
+// unquoteYAML removes the quotes of a single or double quoted scalar.
+func unquoteYAML(text string) (string, error) {
+	switch {
+	case len(text) >= 2 && text[0] == '"' && text[len(text)-1] == '"':
+		return strconv.Unquote(text)
+	case len(text) >= 2 && text[0] == '\'' && text[len(text)-1] == '\'':
+		return strings.Replace(text[1:len(text)-1], "''", "'", -1), nil
+	}
+	return text, nil
+}
+
+// decodeYAML stores node in v, which must be settable.
+func decodeYAML(node *yamlNode, v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if node.isNull() {
+			return nil
+		}
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return decodeYAML(node, v.Elem())
+	case reflect.Interface:
+		v.Set(reflect.ValueOf(yamlValue(node)))
+		return nil
+	case reflect.Struct:
+		if !node.isMap() {
+			return fmt.Errorf("expected a mapping for %s", v.Type())
+		}
+		for _, key := range node.keys {
+			if field := yamlField(v, key); field.IsValid() {
+				if err := decodeYAML(node.values[key], field); err != nil {
+					return fmt.Errorf("%s: %s", key, err)
+				}
+			}
+		}
+		return nil
+	case reflect.Map:
+		if !node.isMap() {
+			return fmt.Errorf("expected a mapping for %s", v.Type())
+		}
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		for _, key := range node.keys {
+			elem := reflect.New(v.Type().Elem()).Elem()
+			if err := decodeYAML(node.values[key], elem); err != nil {
+				return fmt.Errorf("%s: %s", key, err)
+			}
+			v.SetMapIndex(reflect.ValueOf(key), elem)
+		}
+		return nil
+	case reflect.Slice:
+		if node.isNull() {
+			return nil
+		}
+		if !node.isSeq {
+			return fmt.Errorf("expected a sequence for %s", v.Type())
+		}
+		slice := reflect.MakeSlice(v.Type(), len(node.items), len(node.items))
+		for i, item := range node.items {
+			if err := decodeYAML(item, slice.Index(i)); err != nil {
+				return fmt.Errorf("item %d: %s", i+1, err)
+			}
+		}
+		v.Set(slice)
+		return nil
+	}
+
+	if node.isMap() || node.isSeq {
+		return fmt.Errorf("expected a scalar for %s", v.Type())
+	}
+	if node.isNull() {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(node.scalar)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(node.scalar)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", node.scalar)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(node.scalar, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", node.scalar)
+		}
+		v.SetInt(n)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+// yamlField returns the field of the struct v whose json name is key.
+func yamlField(v reflect.Value, key string) reflect.Value {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if len(name) == 0 {
+			name = t.Field(i).Name
+		}
+		if name == key || (len(t.Field(i).Tag.Get("json")) == 0 && strings.EqualFold(name, key)) {
+			return v.Field(i)
+		}
+	}
+	return reflect.Value{}
+}
+
+// yamlValue converts node to plain Go values, like encoding/json does for
+// interface{} targets, but keeping integers as int.
+func yamlValue(node *yamlNode) interface{} {
+	switch {
+	case node.isMap():
+		m := make(map[string]interface{}, len(node.keys))
+		for _, key := range node.keys {
+			m[key] = yamlValue(node.values[key])
+		}
+		return m
+	case node.isSeq:
+		s := make([]interface{}, len(node.items))
+		for i, item := range node.items {
+			s[i] = yamlValue(item)
+		}
+		return s
+	case node.isNull():
+		return nil
+	case node.quoted:
+		return node.scalar
+	}
+	if b, err := strconv.ParseBool(node.scalar); err == nil && node.scalar == strings.ToLower(node.scalar) {
+		return b
+	}
+	if n, err := strconv.Atoi(node.scalar); err == nil {
+		return n
+	}
+	if f, err := strconv.ParseFloat(node.scalar, 64); err == nil {
+		return f
+	}
+	return node.scalar
+}
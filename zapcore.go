@@ -0,0 +1,119 @@
+//go:build log4go_zap
+
+package log4go
+
+import (
+	"fmt"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// This file is only built with the log4go_zap tag, so that programs not using
+// it do not build zap.  The go.mod of log4go requires the version of
+// go.uber.org/zap it is tested with; programs using it build with
+// -tags log4go_zap.
+
+// ZapCore is a zapcore.Core that writes entries through a log4go Filter, so
+// services moving from zap to log4go can write through one set of writers
+// while both are in use:
+//
+//	logger := zap.New(zapcore.NewTee(core, log.NewZapCore(log.LOGGER("legacy"))))
+//
+// Fields become the record's Fields, and the name of a named zap logger
+// extends the category like Filter.Child.  zap levels map to DEBUG, INFO,
+// WARNING, ERROR and CRITICAL (DPanic), PANIC and FATAL, with anything below
+// Debug FINE.  Panic and Fatal entries are only logged: zap panics or exits
+// itself.
+type ZapCore struct {
+	filter *Filter
+}
+
+// NewZapCore creates a ZapCore that logs through f.
+func NewZapCore(f *Filter) *ZapCore {
+	return &ZapCore{filter: f}
+}
+
+// zapLevel maps a zap level to a log4go Level.
+func zapLevel(l zapcore.Level) Level {
+	switch {
+	case l < zapcore.DebugLevel:
+		return FINE
+	case l == zapcore.DebugLevel:
+		return DEBUG
+	case l == zapcore.InfoLevel:
+		return INFO
+	case l == zapcore.WarnLevel:
+		return WARNING
+	case l == zapcore.ErrorLevel:
+		return ERROR
+	case l == zapcore.DPanicLevel:
+		return CRITICAL
+	case l == zapcore.PanicLevel:
+		return PANIC
+	}
+	return FATAL
+}
+
+// Enabled reports whether the filter logs entries at level.
+func (c *ZapCore) Enabled(level zapcore.Level) bool {
+	return zapLevel(level).atLeast(c.filter.level())
+}
+
+// With returns a core that adds fields to every entry.
+func (c *ZapCore) With(fields []zapcore.Field) zapcore.Core {
+	return &ZapCore{filter: c.filter.WithFields(zapFields(fields))}
+}
+
+// Check adds the core to ce if the entry is enabled.
+func (c *ZapCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+// Write logs ent with fields through the filter.
+func (c *ZapCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	f := c.filter
+	if len(ent.LoggerName) > 0 {
+		f = f.Child(ent.LoggerName)
+	}
+
+	rec := &LogRecord{
+		Level:     zapLevel(ent.Level),
+		Created:   ent.Time,
+		Message:   ent.Message,
+		Category:  f.Category,
+		Fields:    withMDC(f.WithFields(zapFields(fields)).fields),
+		Goroutine: currentGoroutine(),
+		Seq:       nextSeq(),
+		Stack:     ent.Stack,
+	}
+	if rec.Created.IsZero() {
+		rec.Created = time.Now()
+	}
+	if ent.Caller.Defined {
+		rec.Source = fmt.Sprintf("%s:%d", ent.Caller.Function, ent.Caller.Line)
+		rec.File, rec.Line = ent.Caller.File, ent.Caller.Line
+	}
+	if len(rec.Fields) == 0 {
+		rec.Fields = nil
+	}
+	f.dispatch(rec)
+	return nil
+}
+
+// Sync does nothing; log4go writers flush on their own.
+func (c *ZapCore) Sync() error {
+	return nil
+}
+
+// zapFields converts zap fields to Fields.
+func zapFields(fields []zapcore.Field) Fields {
+	enc := zapcore.NewMapObjectEncoder()
+	for _, field := range fields {
+		field.AddTo(enc)
+	}
+	return Fields(enc.Fields)
+}
@@ -0,0 +1,29 @@
+//go:build log4go_zap
+
+package log4go
+
+import (
+	"testing"
+
+	"go.uber.org/zap/zapcore"
+)
+
+func TestZapCore(t *testing.T) {
+	rw := &recordingLogWriter{}
+	l := make(Logger)
+	l.AddFilter("legacy", INFO, rw, "legacy")
+
+	core := NewZapCore(l["legacy"]).With([]zapcore.Field{{Key: "svc", Type: zapcore.StringType, String: "billing"}})
+	if ce := core.Check(zapcore.Entry{Level: zapcore.DebugLevel}, nil); ce != nil {
+		t.Errorf("Debug entries should be disabled")
+	}
+	ent := zapcore.Entry{Level: zapcore.WarnLevel, LoggerName: "db", Message: "slow query"}
+	core.Check(ent, nil).Write(zapcore.Field{Key: "ms", Type: zapcore.Int64Type, Integer: 250})
+
+	if len(rw.records) != 1 {
+		t.Fatalf("Expected 1 record, got %d", len(rw.records))
+	}
+	if got, want := FormatLogRecord("[%L] [%C] %M %X", rw.records[0]), "[WARN] [legacy.db] slow query ms=250 svc=billing\n"; got != want {
+		t.Errorf("FormatLogRecord: got %q, want %q", got, want)
+	}
+}